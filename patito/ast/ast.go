@@ -6,13 +6,17 @@
 // Design Philosophy:
 // - All AST nodes implement the Node interface
 // - Statements and Expressions are distinct categories of nodes
+// - Declarations (program, vars, funcs, params) are plain Nodes
 package ast
 
+import "patito/token"
+
 // Node is the base interface that all AST nodes must implement.
 // Every node in the syntax tree can return its token literal, which is useful
 // for debugging, error messages, and representing the original source code.
 type Node interface {
-	TokenLiteral() string // Returns the literal value of the token this node is associated with
+	TokenLiteral() string     // Returns the literal value of the token this node is associated with
+	Position() token.Position // Returns where the node starts in the source
 }
 
 type Statement interface {
@@ -25,87 +29,199 @@ type Expression interface {
 	expressionNode() // Marker method to distinguish expressions from statements
 }
 
+// ---------- Declarations ----------
+
+// Program: program ID ; VARS? FUNCS* main Body end
+type Program struct {
+	Pos   token.Position
+	Name  *Identifier
+	Vars  []*VarDecl
+	Funcs []*FuncDecl
+	Main  *BlockStatement
+}
+
+func (p *Program) TokenLiteral() string     { return "program" }
+func (p *Program) Position() token.Position { return p.Pos }
+
+// VarDecl: ID (, ID)* : TYPE ;
+// A single "vars" section holds one VarDecl per line of names.
+type VarDecl struct {
+	Pos   token.Position
+	Names []*Identifier
+	Type  string // "int" or "float"
+}
+
+func (vd *VarDecl) TokenLiteral() string     { return vd.Type }
+func (vd *VarDecl) Position() token.Position { return vd.Pos }
+
+// FuncDecl: void ID ( Params ) [ VARS? Body ] ;
+type FuncDecl struct {
+	Pos    token.Position
+	Name   *Identifier
+	Params []*Param
+	Vars   []*VarDecl
+	Body   *BlockStatement
+}
+
+func (fd *FuncDecl) TokenLiteral() string     { return "void" }
+func (fd *FuncDecl) Position() token.Position { return fd.Pos }
+
+// Param: ID : TYPE
+type Param struct {
+	Pos  token.Position
+	Name *Identifier
+	Type string
+}
+
+func (pa *Param) TokenLiteral() string     { return pa.Name.Value }
+func (pa *Param) Position() token.Position { return pa.Pos }
+
+// ---------- Statements ----------
+
 // Assignment: ID = Expression ;
 type AssignStatement struct {
+	Pos   token.Position
 	Name  *Identifier
 	Value Expression
 }
 
-func (as *AssignStatement) statementNode()       {}
-func (as *AssignStatement) TokenLiteral() string { return as.Name.Value }
+func (as *AssignStatement) statementNode()           {}
+func (as *AssignStatement) TokenLiteral() string     { return as.Name.Value }
+func (as *AssignStatement) Position() token.Position { return as.Pos }
 
 // Print: print(ExpressionList)
 type PrintStatement struct {
+	Pos         token.Position
 	Expressions []Expression
 }
 
-func (ps *PrintStatement) statementNode()       {}
-func (ps *PrintStatement) TokenLiteral() string { return "print" }
+func (ps *PrintStatement) statementNode()           {}
+func (ps *PrintStatement) TokenLiteral() string     { return "print" }
+func (ps *PrintStatement) Position() token.Position { return ps.Pos }
 
 // If / Else
 type IfStatement struct {
+	Pos         token.Position
 	Condition   Expression
 	Consequence *BlockStatement
 	Alternative *BlockStatement
 }
 
-func (is *IfStatement) statementNode()       {}
-func (is *IfStatement) TokenLiteral() string { return "if" }
+func (is *IfStatement) statementNode()           {}
+func (is *IfStatement) TokenLiteral() string     { return "if" }
+func (is *IfStatement) Position() token.Position { return is.Pos }
 
 // While
 type WhileStatement struct {
+	Pos       token.Position
 	Condition Expression
 	Body      *BlockStatement
 }
 
-func (ws *WhileStatement) statementNode()       {}
-func (ws *WhileStatement) TokenLiteral() string { return "while" }
+func (ws *WhileStatement) statementNode()           {}
+func (ws *WhileStatement) TokenLiteral() string     { return "while" }
+func (ws *WhileStatement) Position() token.Position { return ws.Pos }
+
+// Function call used as a statement: ID ( Args ) ;
+// Patito functions are void, so a call can only appear on its own.
+type CallStatement struct {
+	Pos  token.Position
+	Call *CallExpression
+}
+
+func (cs *CallStatement) statementNode()           {}
+func (cs *CallStatement) TokenLiteral() string     { return cs.Call.Function.Value }
+func (cs *CallStatement) Position() token.Position { return cs.Pos }
 
 // ---------- Expressions ----------
 
 type Identifier struct {
+	Pos   token.Position
 	Value string
 }
 
-func (i *Identifier) expressionNode()      {}
-func (i *Identifier) TokenLiteral() string { return i.Value }
+func (i *Identifier) expressionNode()          {}
+func (i *Identifier) TokenLiteral() string     { return i.Value }
+func (i *Identifier) Position() token.Position { return i.Pos }
 
 type IntegerLiteral struct {
+	Pos   token.Position
 	Value int64 // Idk why but int in go varies between 32 and 64 bit (maybe because it is for system programming.)
 }
 
-func (il *IntegerLiteral) expressionNode()      {}
-func (il *IntegerLiteral) TokenLiteral() string { return "int" }
+func (il *IntegerLiteral) expressionNode()          {}
+func (il *IntegerLiteral) TokenLiteral() string     { return "int" }
+func (il *IntegerLiteral) Position() token.Position { return il.Pos }
 
 type FloatLiteral struct {
+	Pos   token.Position
 	Value float64
 }
 
-func (fl *FloatLiteral) expressionNode()      {}
-func (fl *FloatLiteral) TokenLiteral() string { return "float" }
+func (fl *FloatLiteral) expressionNode()          {}
+func (fl *FloatLiteral) TokenLiteral() string     { return "float" }
+func (fl *FloatLiteral) Position() token.Position { return fl.Pos }
+
+// BooleanLiteral has no source syntax: it is the result of folding a comparison
+// of constants (see package optimize).
+type BooleanLiteral struct {
+	Pos   token.Position
+	Value bool
+}
+
+func (bl *BooleanLiteral) expressionNode()          {}
+func (bl *BooleanLiteral) TokenLiteral() string     { return "bool" }
+func (bl *BooleanLiteral) Position() token.Position { return bl.Pos }
+
+// String constants only show up inside print(...)
+type StringLiteral struct {
+	Pos   token.Position
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()          {}
+func (sl *StringLiteral) TokenLiteral() string     { return "string" }
+func (sl *StringLiteral) Position() token.Position { return sl.Pos }
+
+// Sign applied to a factor: (+|-) FACTOR
+type PrefixExpression struct {
+	Pos      token.Position
+	Operator string
+	Right    Expression
+}
+
+func (pe *PrefixExpression) expressionNode()          {}
+func (pe *PrefixExpression) TokenLiteral() string     { return pe.Operator }
+func (pe *PrefixExpression) Position() token.Position { return pe.Pos }
 
 type InfixExpression struct {
+	Pos      token.Position
 	Left     Expression
 	Operator string
 	Right    Expression
 }
 
-func (ie *InfixExpression) expressionNode()      {}
-func (ie *InfixExpression) TokenLiteral() string { return ie.Operator }
+func (ie *InfixExpression) expressionNode()          {}
+func (ie *InfixExpression) TokenLiteral() string     { return ie.Operator }
+func (ie *InfixExpression) Position() token.Position { return ie.Pos }
 
 type CallExpression struct {
+	Pos       token.Position
 	Function  *Identifier
 	Arguments []Expression
 }
 
-func (ce *CallExpression) expressionNode()      {}
-func (ce *CallExpression) TokenLiteral() string { return ce.Function.Value }
+func (ce *CallExpression) expressionNode()          {}
+func (ce *CallExpression) TokenLiteral() string     { return ce.Function.Value }
+func (ce *CallExpression) Position() token.Position { return ce.Pos }
 
 // ---------- Blocks ----------
 
 type BlockStatement struct {
+	Pos        token.Position
 	Statements []Statement
 }
 
-func (bs *BlockStatement) statementNode()       {}
-func (bs *BlockStatement) TokenLiteral() string { return "{" }
+func (bs *BlockStatement) statementNode()           {}
+func (bs *BlockStatement) TokenLiteral() string     { return "{" }
+func (bs *BlockStatement) Position() token.Position { return bs.Pos }
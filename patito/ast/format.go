@@ -0,0 +1,233 @@
+package ast
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// indent is the unit of indentation used by Format.
+const indent = "    "
+
+// Format prints n back as Patito source in the canonical layout: one
+// declaration or statement per line, blocks indented by four spaces, single
+// spaces around binary operators and only the parentheses the grammar needs.
+// Expressions are printed on one line without a trailing newline.
+func Format(n Node) string {
+	var sb strings.Builder
+	if exp, ok := n.(Expression); ok {
+		writeExpr(&sb, exp, 0)
+		return sb.String()
+	}
+	f := formatter{sb: &sb}
+	f.node(n)
+	return sb.String()
+}
+
+type formatter struct {
+	sb    *strings.Builder
+	depth int
+}
+
+func (f *formatter) line(parts ...string) {
+	f.sb.WriteString(strings.Repeat(indent, f.depth))
+	for _, p := range parts {
+		f.sb.WriteString(p)
+	}
+	f.sb.WriteByte('\n')
+}
+
+func isNil(n Node) bool {
+	return n == nil || reflect.ValueOf(n).IsNil()
+}
+
+func (f *formatter) node(n Node) {
+	if isNil(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *Program:
+		f.line("program ", identName(n.Name), ";")
+		f.vars(n.Vars)
+		for _, fn := range n.Funcs {
+			f.sb.WriteByte('\n')
+			f.node(fn)
+		}
+		f.sb.WriteByte('\n')
+		f.open("main ", n.Main, "")
+		f.line("end")
+	case *VarDecl:
+		f.line(varDecl(n))
+	case *FuncDecl:
+		params := make([]string, len(n.Params))
+		for i, p := range n.Params {
+			params[i] = identName(p.Name) + " : " + p.Type
+		}
+		f.line("void ", identName(n.Name), "(", strings.Join(params, ", "), ") [")
+		f.depth++
+		f.vars(n.Vars)
+		f.open("", n.Body, "")
+		f.depth--
+		f.line("];")
+	case *Param:
+		f.line(identName(n.Name), " : ", n.Type)
+	case *BlockStatement:
+		f.open("", n, "")
+	case *AssignStatement:
+		f.line(identName(n.Name), " = ", exprString(n.Value), ";")
+	case *PrintStatement:
+		items := make([]string, len(n.Expressions))
+		for i, exp := range n.Expressions {
+			items[i] = exprString(exp)
+		}
+		f.line("print(", strings.Join(items, ", "), ");")
+	case *CallStatement:
+		f.line(exprString(n.Call), ";")
+	case *IfStatement:
+		head := "if (" + exprString(n.Condition) + ") "
+		if n.Alternative == nil {
+			f.open(head, n.Consequence, ";")
+			return
+		}
+		f.open(head, n.Consequence, " else {")
+		f.depth++
+		f.block(n.Alternative)
+		f.depth--
+		f.line("};")
+	case *WhileStatement:
+		f.open("while ("+exprString(n.Condition)+") do ", n.Body, ";")
+	}
+}
+
+// vars prints a var section, one declaration per line under the keyword.
+func (f *formatter) vars(decls []*VarDecl) {
+	if len(decls) == 0 {
+		return
+	}
+	f.line("var")
+	f.depth++
+	for _, d := range decls {
+		f.node(d)
+	}
+	f.depth--
+}
+
+// open prints "head{", the statements of block one level deeper, and "}tail".
+// A tail that opens another block (" else {") leaves its closing to the caller.
+func (f *formatter) open(head string, block *BlockStatement, tail string) {
+	f.line(head, "{")
+	f.depth++
+	f.block(block)
+	f.depth--
+	f.line("}", tail)
+}
+
+func (f *formatter) block(block *BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		f.node(stmt)
+	}
+}
+
+func varDecl(d *VarDecl) string {
+	names := make([]string, len(d.Names))
+	for i, id := range d.Names {
+		names[i] = identName(id)
+	}
+	return strings.Join(names, ", ") + " : " + d.Type + ";"
+}
+
+func identName(id *Identifier) string {
+	if id == nil {
+		return ""
+	}
+	return id.Value
+}
+
+// ---------- Expressions ----------
+
+// Binding strength of each level of the grammar; factors bind tightest.
+const (
+	precRelational = iota + 1
+	precSum
+	precProduct
+	precFactor
+)
+
+func precedence(exp Expression) int {
+	if _, ok := exp.(*BooleanLiteral); ok {
+		return precRelational
+	}
+	if in, ok := exp.(*InfixExpression); ok {
+		switch in.Operator {
+		case "+", "-":
+			return precSum
+		case "*", "/":
+			return precProduct
+		}
+		return precRelational
+	}
+	return precFactor
+}
+
+func exprString(exp Expression) string {
+	var sb strings.Builder
+	writeExpr(&sb, exp, 0)
+	return sb.String()
+}
+
+// writeExpr prints exp, wrapped in parentheses when it binds looser than outer.
+func writeExpr(sb *strings.Builder, exp Expression, outer int) {
+	if isNil(exp) {
+		return
+	}
+	if precedence(exp) < outer {
+		sb.WriteByte('(')
+		defer sb.WriteByte(')')
+	}
+	switch x := exp.(type) {
+	case *Identifier:
+		sb.WriteString(x.Value)
+	case *IntegerLiteral:
+		sb.WriteString(strconv.FormatInt(x.Value, 10))
+	case *FloatLiteral:
+		s := strconv.FormatFloat(x.Value, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		sb.WriteString(s)
+	case *BooleanLiteral:
+		// There is no boolean syntax; print a comparison with the same value
+		if x.Value {
+			sb.WriteString("0 == 0")
+		} else {
+			sb.WriteString("0 != 0")
+		}
+	case *StringLiteral:
+		sb.WriteString(`"` + x.Value + `"`)
+	case *PrefixExpression:
+		sb.WriteString(x.Operator)
+		writeExpr(sb, x.Right, precFactor)
+	case *InfixExpression:
+		prec := precedence(x)
+		left := prec
+		if prec == precRelational {
+			left++ // an expression has at most one relational operator
+		}
+		writeExpr(sb, x.Left, left)
+		sb.WriteString(" " + x.Operator + " ")
+		// Operators are left associative, so an equal right operand needs parentheses
+		writeExpr(sb, x.Right, prec+1)
+	case *CallExpression:
+		sb.WriteString(identName(x.Function) + "(")
+		for i, arg := range x.Arguments {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeExpr(sb, arg, 0)
+		}
+		sb.WriteByte(')')
+	}
+}
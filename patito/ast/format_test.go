@@ -0,0 +1,98 @@
+package ast_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/parser"
+)
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return prog
+}
+
+func TestFormat(t *testing.T) {
+	src := `program  p ; var a,b:int; c : float;
+void f(x:int)[var y:int;{y=x;if(y>0){print("pos",y);}else{print(-y);};}];
+main{a=1;b=(a+2)*3;c=a-(b-1)/(2.5*a);while(a<10)do{a=a+1;f(a);};if(a==b){};}end`
+	expected := `program p;
+var
+    a, b : int;
+    c : float;
+
+void f(x : int) [
+    var
+        y : int;
+    {
+        y = x;
+        if (y > 0) {
+            print("pos", y);
+        } else {
+            print(-y);
+        };
+    }
+];
+
+main {
+    a = 1;
+    b = (a + 2) * 3;
+    c = a - (b - 1) / (2.5 * a);
+    while (a < 10) do {
+        a = a + 1;
+        f(a);
+    };
+    if (a == b) {
+    };
+}
+end
+`
+	got := ast.Format(parse(t, src))
+	if got != expected {
+		t.Fatalf("unexpected output:\n%s", got)
+	}
+	if again := ast.Format(parse(t, got)); again != got {
+		t.Fatalf("formatting is not idempotent:\n%s", again)
+	}
+
+	demo, err := os.ReadFile("../testdata/demo.pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := ast.Format(parse(t, string(demo)))
+	if ast.Format(parse(t, first)) != first || !strings.Contains(first, "\n    x = 2 * 3 + 1;\n") {
+		t.Fatalf("demo did not survive formatting:\n%s", first)
+	}
+}
+
+func TestFormatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a - (b - c)", "a - (b - c)"},
+		{"(a - b) - c", "a - b - c"},
+		{"a / (b * c)", "a / (b * c)"},
+		{"-(a + b) * +c", "-(a + b) * +c"},
+		{"(a + 1) < (b * 2)", "a + 1 < b * 2"},
+		{"1.0 + 2.50", "1.0 + 2.5"},
+	}
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		nodes := p.ParseFragment()
+		if len(p.Errors()) > 0 || len(nodes) != 1 {
+			t.Fatalf("%q: %v", tt.input, p.Errors())
+		}
+		if got := ast.Format(nodes[0]); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"patito/token"
+	"reflect"
+)
+
+// JSON layout: every node is an object whose first two keys are "kind" (the Go
+// type name, e.g. "IfStatement") and "pos" ({"line":..,"column":..}), followed by
+// its fields in declaration order with lowerCamelCase keys. Missing optional
+// children (an if without else) are encoded as null.
+
+// EncodeJSON serializes n and all of its children as indented JSON.
+func EncodeJSON(n Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(toJSON(n)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// object keeps the key order stable so dumps are easy to diff.
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type jsonPos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func newObject(kind string, pos token.Position, fields ...field) object {
+	o := object{{"kind", kind}, {"pos", jsonPos{pos.Line, pos.Column}}}
+	return append(o, fields...)
+}
+
+func toJSON(n Node) any {
+	// Optional children arrive as typed nil pointers (e.g. a missing else block)
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return nil
+	}
+	switch n := n.(type) {
+	case *Program:
+		return newObject("Program", n.Pos,
+			field{"name", toJSON(n.Name)},
+			field{"vars", listJSON(n.Vars)},
+			field{"funcs", listJSON(n.Funcs)},
+			field{"main", toJSON(n.Main)})
+	case *VarDecl:
+		return newObject("VarDecl", n.Pos,
+			field{"names", listJSON(n.Names)},
+			field{"type", n.Type})
+	case *FuncDecl:
+		return newObject("FuncDecl", n.Pos,
+			field{"name", toJSON(n.Name)},
+			field{"params", listJSON(n.Params)},
+			field{"vars", listJSON(n.Vars)},
+			field{"body", toJSON(n.Body)})
+	case *Param:
+		return newObject("Param", n.Pos,
+			field{"name", toJSON(n.Name)},
+			field{"type", n.Type})
+	case *AssignStatement:
+		return newObject("AssignStatement", n.Pos,
+			field{"name", toJSON(n.Name)},
+			field{"value", toJSON(n.Value)})
+	case *PrintStatement:
+		return newObject("PrintStatement", n.Pos,
+			field{"expressions", listJSON(n.Expressions)})
+	case *IfStatement:
+		return newObject("IfStatement", n.Pos,
+			field{"condition", toJSON(n.Condition)},
+			field{"consequence", toJSON(n.Consequence)},
+			field{"alternative", toJSON(n.Alternative)})
+	case *WhileStatement:
+		return newObject("WhileStatement", n.Pos,
+			field{"condition", toJSON(n.Condition)},
+			field{"body", toJSON(n.Body)})
+	case *CallStatement:
+		return newObject("CallStatement", n.Pos,
+			field{"call", toJSON(n.Call)})
+	case *BlockStatement:
+		return newObject("BlockStatement", n.Pos,
+			field{"statements", listJSON(n.Statements)})
+	case *Identifier:
+		return newObject("Identifier", n.Pos, field{"value", n.Value})
+	case *IntegerLiteral:
+		return newObject("IntegerLiteral", n.Pos, field{"value", n.Value})
+	case *FloatLiteral:
+		return newObject("FloatLiteral", n.Pos, field{"value", n.Value})
+	case *BooleanLiteral:
+		return newObject("BooleanLiteral", n.Pos, field{"value", n.Value})
+	case *StringLiteral:
+		return newObject("StringLiteral", n.Pos, field{"value", n.Value})
+	case *PrefixExpression:
+		return newObject("PrefixExpression", n.Pos,
+			field{"operator", n.Operator},
+			field{"right", toJSON(n.Right)})
+	case *InfixExpression:
+		return newObject("InfixExpression", n.Pos,
+			field{"left", toJSON(n.Left)},
+			field{"operator", n.Operator},
+			field{"right", toJSON(n.Right)})
+	case *CallExpression:
+		return newObject("CallExpression", n.Pos,
+			field{"function", toJSON(n.Function)},
+			field{"arguments", listJSON(n.Arguments)})
+	}
+	panic(fmt.Sprintf("ast: cannot encode %T", n))
+}
+
+func listJSON[T Node](nodes []T) []any {
+	out := make([]any, len(nodes))
+	for i, n := range nodes {
+		out[i] = toJSON(n)
+	}
+	return out
+}
+
+// DecodeJSON rebuilds an AST from the layout produced by EncodeJSON. The returned
+// error names the JSON path of the first malformed node.
+func DecodeJSON(data []byte) (Node, error) {
+	d := &decoder{}
+	n := d.node(data, "$")
+	if d.err != nil {
+		return nil, d.err
+	}
+	return n, nil
+}
+
+// decoder remembers the first error so the per-kind code can stay linear.
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(path, format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: %s: %s", path, fmt.Sprintf(format, args...))
+	}
+}
+
+func (d *decoder) node(raw json.RawMessage, path string) Node {
+	if d.err != nil || len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		d.fail(path, "expected node object: %v", err)
+		return nil
+	}
+	var kind string
+	if err := json.Unmarshal(obj["kind"], &kind); err != nil || kind == "" {
+		d.fail(path, "missing or invalid \"kind\"")
+		return nil
+	}
+	var p jsonPos
+	if raw, ok := obj["pos"]; ok {
+		if err := json.Unmarshal(raw, &p); err != nil {
+			d.fail(path+".pos", "%v", err)
+			return nil
+		}
+	}
+	pos := token.Position{Line: p.Line, Column: p.Column}
+	at := func(key string) (json.RawMessage, string) { return obj[key], path + "." + key }
+
+	switch kind {
+	case "Program":
+		n := &Program{Pos: pos}
+		n.Name = d.ident(at("name"))
+		n.Vars = decodeList(d, obj["vars"], path+".vars", (*decoder).varDecl)
+		n.Funcs = decodeList(d, obj["funcs"], path+".funcs", (*decoder).funcDecl)
+		n.Main = d.block(at("main"))
+		return n
+	case "VarDecl":
+		n := &VarDecl{Pos: pos}
+		n.Names = decodeList(d, obj["names"], path+".names", (*decoder).ident)
+		n.Type = d.typeName(at("type"))
+		return n
+	case "FuncDecl":
+		n := &FuncDecl{Pos: pos}
+		n.Name = d.ident(at("name"))
+		n.Params = decodeList(d, obj["params"], path+".params", (*decoder).param)
+		n.Vars = decodeList(d, obj["vars"], path+".vars", (*decoder).varDecl)
+		n.Body = d.block(at("body"))
+		return n
+	case "Param":
+		n := &Param{Pos: pos}
+		n.Name = d.ident(at("name"))
+		n.Type = d.typeName(at("type"))
+		return n
+	case "AssignStatement":
+		n := &AssignStatement{Pos: pos}
+		n.Name = d.ident(at("name"))
+		n.Value = d.expr(at("value"))
+		return n
+	case "PrintStatement":
+		n := &PrintStatement{Pos: pos}
+		n.Expressions = decodeList(d, obj["expressions"], path+".expressions", (*decoder).expr)
+		return n
+	case "IfStatement":
+		n := &IfStatement{Pos: pos}
+		n.Condition = d.expr(at("condition"))
+		n.Consequence = d.block(at("consequence"))
+		if raw, p := at("alternative"); len(raw) > 0 && string(raw) != "null" {
+			n.Alternative = d.block(raw, p)
+		}
+		return n
+	case "WhileStatement":
+		n := &WhileStatement{Pos: pos}
+		n.Condition = d.expr(at("condition"))
+		n.Body = d.block(at("body"))
+		return n
+	case "CallStatement":
+		n := &CallStatement{Pos: pos}
+		n.Call = d.call(at("call"))
+		return n
+	case "BlockStatement":
+		n := &BlockStatement{Pos: pos}
+		n.Statements = decodeList(d, obj["statements"], path+".statements", (*decoder).stmt)
+		return n
+	case "Identifier":
+		n := &Identifier{Pos: pos}
+		d.value(obj["value"], path+".value", &n.Value)
+		if d.err == nil && n.Value == "" {
+			d.fail(path+".value", "empty identifier")
+		}
+		return n
+	case "IntegerLiteral":
+		n := &IntegerLiteral{Pos: pos}
+		d.value(obj["value"], path+".value", &n.Value)
+		return n
+	case "FloatLiteral":
+		n := &FloatLiteral{Pos: pos}
+		d.value(obj["value"], path+".value", &n.Value)
+		return n
+	case "BooleanLiteral":
+		n := &BooleanLiteral{Pos: pos}
+		d.value(obj["value"], path+".value", &n.Value)
+		return n
+	case "StringLiteral":
+		n := &StringLiteral{Pos: pos}
+		d.value(obj["value"], path+".value", &n.Value)
+		return n
+	case "PrefixExpression":
+		n := &PrefixExpression{Pos: pos}
+		n.Operator = d.operator(obj["operator"], path+".operator", "+", "-")
+		n.Right = d.expr(at("right"))
+		return n
+	case "InfixExpression":
+		n := &InfixExpression{Pos: pos}
+		n.Left = d.expr(at("left"))
+		n.Operator = d.operator(obj["operator"], path+".operator",
+			"+", "-", "*", "/", "<", ">", "<=", ">=", "==", "!=")
+		n.Right = d.expr(at("right"))
+		return n
+	case "CallExpression":
+		n := &CallExpression{Pos: pos}
+		n.Function = d.ident(at("function"))
+		n.Arguments = decodeList(d, obj["arguments"], path+".arguments", (*decoder).expr)
+		return n
+	}
+	d.fail(path, "unknown node kind %q", kind)
+	return nil
+}
+
+func decodeList[T any](d *decoder, raw json.RawMessage, path string, elem func(*decoder, json.RawMessage, string) T) []T {
+	if d.err != nil || len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		d.fail(path, "expected array: %v", err)
+		return nil
+	}
+	out := make([]T, 0, len(items))
+	for i, item := range items {
+		out = append(out, elem(d, item, fmt.Sprintf("%s[%d]", path, i)))
+	}
+	return out
+}
+
+func (d *decoder) value(raw json.RawMessage, path string, dst any) {
+	if d.err != nil {
+		return
+	}
+	if len(raw) == 0 {
+		d.fail(path, "missing value")
+		return
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		d.fail(path, "%v", err)
+	}
+}
+
+func (d *decoder) operator(raw json.RawMessage, path string, allowed ...string) string {
+	var op string
+	d.value(raw, path, &op)
+	for _, a := range allowed {
+		if op == a {
+			return op
+		}
+	}
+	d.fail(path, "invalid operator %q", op)
+	return op
+}
+
+func (d *decoder) typeName(raw json.RawMessage, path string) string {
+	var t string
+	d.value(raw, path, &t)
+	if d.err == nil && t != "int" && t != "float" {
+		d.fail(path, "invalid type %q", t)
+	}
+	return t
+}
+
+// required decodes a child that must be present and of kind T.
+func required[T Node](d *decoder, raw json.RawMessage, path, want string) T {
+	var zero T
+	n := d.node(raw, path)
+	if d.err != nil {
+		return zero
+	}
+	if n == nil {
+		d.fail(path, "missing %s", want)
+		return zero
+	}
+	t, ok := n.(T)
+	if !ok {
+		d.fail(path, "expected %s, got %T", want, n)
+		return zero
+	}
+	return t
+}
+
+func (d *decoder) ident(raw json.RawMessage, path string) *Identifier {
+	return required[*Identifier](d, raw, path, "Identifier")
+}
+
+func (d *decoder) block(raw json.RawMessage, path string) *BlockStatement {
+	return required[*BlockStatement](d, raw, path, "BlockStatement")
+}
+
+func (d *decoder) call(raw json.RawMessage, path string) *CallExpression {
+	return required[*CallExpression](d, raw, path, "CallExpression")
+}
+
+func (d *decoder) varDecl(raw json.RawMessage, path string) *VarDecl {
+	return required[*VarDecl](d, raw, path, "VarDecl")
+}
+
+func (d *decoder) funcDecl(raw json.RawMessage, path string) *FuncDecl {
+	return required[*FuncDecl](d, raw, path, "FuncDecl")
+}
+
+func (d *decoder) param(raw json.RawMessage, path string) *Param {
+	return required[*Param](d, raw, path, "Param")
+}
+
+func (d *decoder) expr(raw json.RawMessage, path string) Expression {
+	return required[Expression](d, raw, path, "expression")
+}
+
+func (d *decoder) stmt(raw json.RawMessage, path string) Statement {
+	return required[Statement](d, raw, path, "statement")
+}
@@ -0,0 +1,109 @@
+package ast_test
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/parser"
+	"patito/token"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	src, err := os.ReadFile("../testdata/demo.pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.New(string(src)))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	first, err := ast.EncodeJSON(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ast.DecodeJSON(first)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !reflect.DeepEqual(prog, decoded) {
+		t.Fatalf("decoded tree differs from the parsed one.\nexpected=%s\ngot=%s", ast.SExpr(prog), ast.SExpr(decoded))
+	}
+	second, err := ast.EncodeJSON(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatalf("re-encoding is not stable.\nfirst=%s\nsecond=%s", first, second)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[]`, "ast: $: expected node object"},
+		{`{"kind":"Nope"}`, `ast: $: unknown node kind "Nope"`},
+		{`{"kind":"AssignStatement","name":{"kind":"Identifier","value":"x"}}`, "ast: $.value: missing expression"},
+		{`{"kind":"WhileStatement","condition":{"kind":"Identifier","value":"x"},"body":{"kind":"Identifier","value":"y"}}`,
+			"ast: $.body: expected BlockStatement, got *ast.Identifier"},
+		{`{"kind":"InfixExpression","left":{"kind":"IntegerLiteral","value":1},"operator":"%","right":{"kind":"IntegerLiteral","value":2}}`,
+			`ast: $.operator: invalid operator "%"`},
+		{`{"kind":"BlockStatement","statements":[{"kind":"IntegerLiteral","value":1}]}`,
+			"ast: $.statements[0]: expected statement, got *ast.IntegerLiteral"},
+		{`{"kind":"Param","name":{"kind":"Identifier","value":"a"},"type":"bool"}`, `ast: $.type: invalid type "bool"`},
+	}
+
+	for i, tt := range tests {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Fatalf("tests[%d] - expected error starting with %q, got %v", i, tt.expected, err)
+		}
+	}
+}
+
+func TestSExpr(t *testing.T) {
+	p := parser.New(lexer.New("program p;\nmain {\n  if (a > 1) { print(\"hi\", -a); };\n}\nend"))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	expected := `(Program 1:1
+  (Identifier 1:9 p)
+  (vars)
+  (funcs)
+  (BlockStatement 2:6
+    (IfStatement 3:3
+      (InfixExpression 3:7 > (Identifier 3:7 a) (IntegerLiteral 3:11 1))
+      (BlockStatement 3:14
+        (PrintStatement 3:16 (StringLiteral 3:22 "hi") (PrefixExpression 3:28 - (Identifier 3:29 a))))
+      nil)))`
+	if got := ast.SExpr(prog); got != expected {
+		t.Fatalf("SExpr wrong.\nexpected=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestBooleanLiteral(t *testing.T) {
+	lit := &ast.BooleanLiteral{Pos: token.Position{Line: 2, Column: 5}, Value: true}
+	data, err := ast.EncodeJSON(lit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ast.DecodeJSON(data)
+	if err != nil || !reflect.DeepEqual(decoded, lit) {
+		t.Fatalf("round trip of %s gave %v, %v", data, decoded, err)
+	}
+	if got := ast.SExpr(lit); got != "(BooleanLiteral 2:5 true)" {
+		t.Fatalf("unexpected SExpr %s", got)
+	}
+	if got := ast.Format(lit); got != "0 == 0" {
+		t.Fatalf("unexpected Format %s", got)
+	}
+}
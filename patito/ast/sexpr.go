@@ -0,0 +1,116 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SExpr renders n as an S-expression. Each node becomes
+// (Kind line:col field...) using the same kind names as the JSON dump; lists
+// that are not nodes (vars, funcs, params, call args) are wrapped in a labeled list
+// and a missing optional child is written as nil. Declarations and statements
+// put their children on separate indented lines, expressions stay on one line.
+func SExpr(n Node) string {
+	var sb strings.Builder
+	writeSexp(&sb, toSexp(n), 0)
+	return sb.String()
+}
+
+// sexp is either an atom or a list. A multiline list keeps its leading atoms on
+// the first line and puts every child from the first sub-list onwards on its own line.
+type sexp struct {
+	atom      string
+	list      []sexp
+	multiline bool
+}
+
+func atom(s string) sexp { return sexp{atom: s} }
+
+func nodeSexp(kind string, n Node, multiline bool, fields ...sexp) sexp {
+	pos := n.Position()
+	head := []sexp{atom(kind), atom(strconv.Itoa(pos.Line) + ":" + strconv.Itoa(pos.Column))}
+	return sexp{list: append(head, fields...), multiline: multiline}
+}
+
+func children[T Node](nodes []T) []sexp {
+	out := make([]sexp, len(nodes))
+	for i, n := range nodes {
+		out[i] = toSexp(n)
+	}
+	return out
+}
+
+func labeled[T Node](label string, nodes []T, multiline bool) sexp {
+	return sexp{list: append([]sexp{atom(label)}, children(nodes)...), multiline: multiline}
+}
+
+func toSexp(n Node) sexp {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return atom("nil")
+	}
+	switch n := n.(type) {
+	case *Program:
+		return nodeSexp("Program", n, true, toSexp(n.Name),
+			labeled("vars", n.Vars, true), labeled("funcs", n.Funcs, true), toSexp(n.Main))
+	case *VarDecl:
+		return nodeSexp("VarDecl", n, false, append([]sexp{atom(n.Type)}, children(n.Names)...)...)
+	case *FuncDecl:
+		return nodeSexp("FuncDecl", n, true, toSexp(n.Name),
+			labeled("params", n.Params, false), labeled("vars", n.Vars, true), toSexp(n.Body))
+	case *Param:
+		return nodeSexp("Param", n, false, toSexp(n.Name), atom(n.Type))
+	case *AssignStatement:
+		return nodeSexp("AssignStatement", n, false, toSexp(n.Name), toSexp(n.Value))
+	case *PrintStatement:
+		return nodeSexp("PrintStatement", n, false, children(n.Expressions)...)
+	case *IfStatement:
+		return nodeSexp("IfStatement", n, true, toSexp(n.Condition), toSexp(n.Consequence), toSexp(n.Alternative))
+	case *WhileStatement:
+		return nodeSexp("WhileStatement", n, true, toSexp(n.Condition), toSexp(n.Body))
+	case *CallStatement:
+		return nodeSexp("CallStatement", n, false, toSexp(n.Call))
+	case *BlockStatement:
+		return nodeSexp("BlockStatement", n, true, children(n.Statements)...)
+	case *Identifier:
+		return nodeSexp("Identifier", n, false, atom(n.Value))
+	case *IntegerLiteral:
+		return nodeSexp("IntegerLiteral", n, false, atom(strconv.FormatInt(n.Value, 10)))
+	case *FloatLiteral:
+		return nodeSexp("FloatLiteral", n, false, atom(strconv.FormatFloat(n.Value, 'g', -1, 64)))
+	case *BooleanLiteral:
+		return nodeSexp("BooleanLiteral", n, false, atom(strconv.FormatBool(n.Value)))
+	case *StringLiteral:
+		return nodeSexp("StringLiteral", n, false, atom(strconv.Quote(n.Value)))
+	case *PrefixExpression:
+		return nodeSexp("PrefixExpression", n, false, atom(n.Operator), toSexp(n.Right))
+	case *InfixExpression:
+		return nodeSexp("InfixExpression", n, false, atom(n.Operator), toSexp(n.Left), toSexp(n.Right))
+	case *CallExpression:
+		return nodeSexp("CallExpression", n, false, toSexp(n.Function), labeled("args", n.Arguments, false))
+	}
+	panic(fmt.Sprintf("ast: cannot render %T", n))
+}
+
+func writeSexp(sb *strings.Builder, s sexp, indent int) {
+	if s.list == nil {
+		sb.WriteString(s.atom)
+		return
+	}
+	sb.WriteByte('(')
+	broken := false
+	for i, e := range s.list {
+		switch {
+		case i == 0:
+		case s.multiline && (e.list != nil || broken):
+			broken = true
+			sb.WriteByte('\n')
+			sb.WriteString(strings.Repeat("  ", indent+1))
+		default:
+			sb.WriteByte(' ')
+		}
+		writeSexp(sb, e, indent+1)
+	}
+	sb.WriteByte(')')
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"patito/ast"
+	"patito/gen"
+	"patito/optimize"
+	"patito/semantic"
+)
+
+// targets maps the names accepted by -target to the backend that writes them.
+var targets = map[string]func(w io.Writer, prog *ast.Program, dir *semantic.FuncDir, file string) error{
+	"amd64": gen.AMD64,
+	"c":     gen.C,
+	"go":    gen.Go,
+	"llvm":  gen.LLVM,
+	"wat":   gen.WAT,
+}
+
+// runBuild implements "patito build": it translates a program into the source
+// code of another language, whose own toolchain turns it into a native program.
+func runBuild(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	target := fs.String("target", "go", "language to generate: "+strings.Join(targetNames(), ", "))
+	out := fs.String("o", "", "write the output to this file instead of stdout")
+	level := optFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	backend, ok := targets[*target]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "patito build: unknown target %q (want one of %s)\n", *target, strings.Join(targetNames(), ", "))
+		return 2
+	}
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito build: %v\n", err)
+		return 1
+	}
+	prog, dir, ok := check(name, src)
+	if !ok {
+		return 1
+	}
+	if *level > 0 {
+		if errs := optimize.Optimize(prog, dir, src); len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+			}
+			return 1
+		}
+	}
+
+	if *out == "" {
+		err = backend(os.Stdout, prog, dir, name)
+	} else {
+		err = writeFile(*out, func(w io.Writer) error { return backend(w, prog, dir, name) })
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito build: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeFile creates the file called name and has write fill it. A write that
+// only fails when the file is closed is an error as well.
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func targetNames() []string {
+	var names []string
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,61 @@
+package bytecode
+
+import (
+	"testing"
+
+	"patito/internal/vmtest"
+)
+
+func compile(t testing.TB, src string) *Program {
+	t.Helper()
+	prog, dir := vmtest.Check(t, src)
+	p, err := Compile(prog, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDisassemble(t *testing.T) {
+	p := compile(t, `program p;
+var r : int;
+void half(k : int) [
+    var h : float;
+    {
+        h = k / 2.0;
+        if (h > 1) { r = k / 2; };
+    }
+];
+main {
+    half(7);
+    print("r is", r);
+}
+end`)
+	want := `func half(k int): locals=2 stack=2
+   6 0000  loadl      0  ; k
+     0003  itof
+     0004  const      0  ; 2.0
+     0007  divf       0  ; 6:17
+     0010  storel     1  ; h
+   7 0013  loadl      1  ; h
+     0016  const      1  ; 1
+     0019  itof
+     0020  gtf
+     0021  jumpf     36
+   7 0024  loadl      0  ; k
+     0027  const      2  ; 2
+     0030  divi       1  ; 7:30
+     0033  storeg     0  ; r
+     0036  ret
+
+func main(): locals=0 stack=1
+  11 0000  const      3  ; 7
+     0003  call       0  ; half
+  12 0006  loadg      0  ; r
+     0009  print      0  ; "r is", int
+     0012  halt
+`
+	if got := p.String(); got != want {
+		t.Errorf("disassembly wrong.\nexpected:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -0,0 +1,354 @@
+package bytecode
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/token"
+)
+
+// Program is a compiled program: its functions and the tables their operands
+// index.
+type Program struct {
+	Funcs     []*Func           // declared functions in order, then main
+	Globals   []*semantic.Var   // by index
+	Consts    []evaluator.Value // by index
+	Prints    [][]PrintArg      // what each print writes, by index
+	Positions []token.Position  // of the divisor of each division, by index
+}
+
+// Main returns the function that runs the body of the program.
+func (p *Program) Main() *Func { return p.Funcs[len(p.Funcs)-1] }
+
+// Func is the code of a function, or of main.
+type Func struct {
+	Name     string
+	Params   int             // number of params, the first Locals
+	Locals   []*semantic.Var // params and then locals, by index
+	MaxStack int             // the most values the code pushes above the locals
+	Code     []byte
+	Lines    []Line // start of each statement, and of the jumps after a nested block, in order
+}
+
+// Pos returns the position of the statement that the instruction at pc
+// belongs to.
+func (fn *Func) Pos(pc int) token.Position {
+	i := sort.Search(len(fn.Lines), func(i int) bool { return fn.Lines[i].PC > pc })
+	if i == 0 {
+		return token.Position{}
+	}
+	return fn.Lines[i-1].Pos
+}
+
+// Line maps the first instruction of a statement to its position.
+type Line struct {
+	PC  int
+	Pos token.Position
+}
+
+// PrintArg is one part of a print: a string, written as it is, or a value of
+// Type taken from the stack.
+type PrintArg struct {
+	Type semantic.Type
+	Text string // for a String
+}
+
+// maxOperand is the largest operand an instruction can hold.
+const maxOperand = math.MaxUint16
+
+// Compile translates prog, which passed semantic.Check with dir. It fails only
+// when a table or a function outgrows the 16-bit operands.
+func Compile(prog *ast.Program, dir *semantic.FuncDir) (*Program, error) {
+	c := &compiler{
+		p:       &Program{Globals: dir.Globals.All()},
+		dir:     dir,
+		funcs:   map[string]int{},
+		globals: map[string]int{},
+		consts:  map[constKey]int{},
+	}
+	for i, g := range c.p.Globals {
+		c.globals[g.Name] = i
+	}
+	for i, fn := range dir.Funcs() {
+		c.funcs[fn.Name] = i
+	}
+	for _, fn := range dir.Funcs() {
+		c.function(fn, fn.Decl.Body)
+	}
+	c.function(nil, prog.Main)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.p, nil
+}
+
+type compiler struct {
+	p       *Program
+	dir     *semantic.FuncDir
+	funcs   map[string]int
+	globals map[string]int
+	consts  map[constKey]int
+	err     error
+
+	sem    *semantic.Func // function being compiled, nil for main
+	fn     *Func
+	locals map[string]int
+	depth  int // values on the stack at the current instruction
+}
+
+// constKey tells constants apart by their bits, so that 0.0 and -0.0 are
+// different constants.
+type constKey struct {
+	t    semantic.Type
+	bits uint64
+}
+
+func (c *compiler) function(sem *semantic.Func, body *ast.BlockStatement) {
+	c.sem, c.locals, c.depth = sem, map[string]int{}, 0
+	c.fn = &Func{Name: "main"}
+	if sem != nil {
+		c.fn.Name, c.fn.Params = sem.Name, len(sem.Params)
+		for _, v := range sem.Params {
+			c.local(v)
+		}
+		for _, v := range sem.Vars.All() {
+			if v.Scope == semantic.Local {
+				c.local(v)
+			}
+		}
+	}
+	c.block(body)
+	if sem != nil {
+		c.emit(OpReturn, 0)
+	} else {
+		c.emit(OpHalt, 0)
+	}
+	if len(c.fn.Code) > maxOperand {
+		c.fail("function %s is too large", c.fn.Name)
+	}
+	c.p.Funcs = append(c.p.Funcs, c.fn)
+}
+
+func (c *compiler) local(v *semantic.Var) {
+	c.locals[v.Name] = len(c.fn.Locals)
+	c.fn.Locals = append(c.fn.Locals, v)
+}
+
+func (c *compiler) fail(format string, args ...any) {
+	if c.err == nil {
+		c.err = fmt.Errorf("bytecode: "+format, args...)
+	}
+}
+
+// emit appends an instruction and returns its address. a is ignored for ops
+// without an operand.
+func (c *compiler) emit(op Op, a int) int {
+	pc := len(c.fn.Code)
+	c.fn.Code = append(c.fn.Code, byte(op))
+	if op.hasOperand() {
+		if a < 0 || a > maxOperand {
+			c.fail("operand %d of %s does not fit in 16 bits", a, op)
+		}
+		c.fn.Code = append(c.fn.Code, byte(a), byte(a>>8))
+	}
+	c.depth += op.effect() // calls and prints pop more, which their callers count
+	c.fn.MaxStack = max(c.fn.MaxStack, c.depth)
+	return pc
+}
+
+// patch makes the jump at pc continue at target.
+func (c *compiler) patch(pc, target int) {
+	c.fn.Code[pc+1], c.fn.Code[pc+2] = byte(target), byte(target>>8)
+}
+
+func (c *compiler) constant(v evaluator.Value) {
+	var key constKey
+	switch v := v.(type) {
+	case evaluator.Int:
+		key = constKey{semantic.Int, uint64(v)}
+	case evaluator.Float:
+		key = constKey{semantic.Float, math.Float64bits(float64(v))}
+	case evaluator.Bool:
+		key = constKey{t: semantic.Bool}
+		if v {
+			key.bits = 1
+		}
+	}
+	k, ok := c.consts[key]
+	if !ok {
+		k = len(c.p.Consts)
+		c.consts[key] = k
+		c.p.Consts = append(c.p.Consts, v)
+	}
+	c.emit(OpConst, k)
+}
+
+func (c *compiler) lookup(name string) *semantic.Var {
+	if c.sem != nil {
+		if v := c.sem.Vars.Lookup(name); v != nil {
+			return v
+		}
+	}
+	return c.dir.Globals.Lookup(name)
+}
+
+func (c *compiler) typeOf(exp ast.Expression) semantic.Type {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		return c.lookup(x.Value).Type
+	case *ast.IntegerLiteral:
+		return semantic.Int
+	case *ast.FloatLiteral:
+		return semantic.Float
+	case *ast.BooleanLiteral:
+		return semantic.Bool
+	case *ast.StringLiteral:
+		return semantic.String
+	case *ast.PrefixExpression:
+		return c.typeOf(x.Right)
+	case *ast.InfixExpression:
+		return semantic.ResultType(x.Operator, c.typeOf(x.Left), c.typeOf(x.Right))
+	}
+	return semantic.Invalid
+}
+
+func (c *compiler) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		c.statement(stmt)
+	}
+}
+
+// line records that the code emitted next belongs to the statement at pos.
+func (c *compiler) line(pos token.Position) {
+	c.fn.Lines = append(c.fn.Lines, Line{PC: len(c.fn.Code), Pos: pos})
+}
+
+func (c *compiler) statement(stmt ast.Statement) {
+	if _, ok := stmt.(*ast.BlockStatement); !ok {
+		c.line(stmt.Position())
+	}
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		v := c.lookup(s.Name.Value)
+		c.convert(v.Type, s.Value)
+		if i, ok := c.locals[v.Name]; ok {
+			c.emit(OpStoreLocal, i)
+		} else {
+			c.emit(OpStoreGlobal, c.globals[v.Name])
+		}
+	case *ast.PrintStatement:
+		args := make([]PrintArg, len(s.Expressions))
+		values := 0
+		for i, exp := range s.Expressions {
+			if str, ok := exp.(*ast.StringLiteral); ok {
+				args[i] = PrintArg{Type: semantic.String, Text: str.Value}
+				continue
+			}
+			args[i] = PrintArg{Type: c.typeOf(exp)}
+			c.expr(exp)
+			values++
+		}
+		c.p.Prints = append(c.p.Prints, args)
+		c.emit(OpPrint, len(c.p.Prints)-1)
+		c.depth -= values - 1
+	case *ast.CallStatement:
+		callee := c.dir.Lookup(s.Call.Function.Value)
+		for i, arg := range s.Call.Arguments {
+			c.convert(callee.Params[i].Type, arg)
+		}
+		c.emit(OpCall, c.funcs[callee.Name])
+		c.depth -= len(callee.Params) - 1
+	case *ast.IfStatement:
+		c.expr(s.Condition)
+		jumpElse := c.emit(OpJumpIfFalse, 0)
+		c.block(s.Consequence)
+		if s.Alternative == nil {
+			c.patch(jumpElse, len(c.fn.Code))
+			return
+		}
+		c.line(s.Position())
+		jumpEnd := c.emit(OpJump, 0)
+		c.patch(jumpElse, len(c.fn.Code))
+		c.block(s.Alternative)
+		c.patch(jumpEnd, len(c.fn.Code))
+	case *ast.WhileStatement:
+		top := len(c.fn.Code)
+		c.expr(s.Condition)
+		exit := c.emit(OpJumpIfFalse, 0)
+		c.block(s.Body)
+		c.line(s.Position())
+		c.emit(OpJump, top)
+		c.patch(exit, len(c.fn.Code))
+	case *ast.BlockStatement:
+		c.block(s)
+	}
+}
+
+// convert compiles exp as a value of type t, promoting an int to float.
+func (c *compiler) convert(t semantic.Type, exp ast.Expression) {
+	c.expr(exp)
+	if t == semantic.Float && c.typeOf(exp) == semantic.Int {
+		c.emit(OpIntToFloat, 0)
+	}
+}
+
+// intOps and floatOps map the operators to their opcodes.
+var (
+	intOps = map[string]Op{
+		"+": OpAddInt, "-": OpSubInt, "*": OpMulInt, "/": OpDivInt,
+		"<": OpLtInt, ">": OpGtInt, "<=": OpLeInt, ">=": OpGeInt, "==": OpEqInt, "!=": OpNeInt,
+	}
+	floatOps = map[string]Op{
+		"+": OpAddFloat, "-": OpSubFloat, "*": OpMulFloat, "/": OpDivFloat,
+		"<": OpLtFloat, ">": OpGtFloat, "<=": OpLeFloat, ">=": OpGeFloat, "==": OpEqFloat, "!=": OpNeFloat,
+	}
+)
+
+func (c *compiler) expr(exp ast.Expression) {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		if i, ok := c.locals[x.Value]; ok {
+			c.emit(OpLoadLocal, i)
+		} else {
+			c.emit(OpLoadGlobal, c.globals[x.Value])
+		}
+	case *ast.IntegerLiteral:
+		c.constant(evaluator.Int(x.Value))
+	case *ast.FloatLiteral:
+		c.constant(evaluator.Float(x.Value))
+	case *ast.BooleanLiteral:
+		c.constant(evaluator.Bool(x.Value))
+	case *ast.PrefixExpression:
+		c.expr(x.Right)
+		if x.Operator != "-" {
+			return
+		}
+		if c.typeOf(x.Right) == semantic.Float {
+			c.emit(OpNegFloat, 0)
+		} else {
+			c.emit(OpNegInt, 0)
+		}
+	case *ast.InfixExpression:
+		lt, rt := c.typeOf(x.Left), c.typeOf(x.Right)
+		ops := intOps
+		t := semantic.Int
+		if lt == semantic.Float || rt == semantic.Float {
+			ops, t = floatOps, semantic.Float
+		}
+		c.convert(t, x.Left)
+		c.convert(t, x.Right)
+		op := ops[x.Operator]
+		a := 0
+		if op == OpDivInt || op == OpDivFloat {
+			c.p.Positions = append(c.p.Positions, x.Right.Position())
+			a = len(c.p.Positions) - 1
+		}
+		c.emit(op, a)
+	default:
+		panic(fmt.Sprintf("bytecode: unexpected expression %T", exp))
+	}
+}
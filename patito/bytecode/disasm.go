@@ -0,0 +1,88 @@
+package bytecode
+
+import (
+	"fmt"
+	"strings"
+
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/ssa"
+)
+
+// Disassemble lists the code of fn, one instruction per line with its
+// address and what its operand stands for. The line of the source where a
+// statement starts is written before its first instruction.
+func (p *Program) Disassemble(fn *Func) string {
+	var sb strings.Builder
+	params := make([]string, fn.Params)
+	for i, v := range fn.Locals[:fn.Params] {
+		params[i] = v.Name + " " + v.Type.String()
+	}
+	fmt.Fprintf(&sb, "func %s(%s): locals=%d stack=%d\n", fn.Name, strings.Join(params, ", "), len(fn.Locals), fn.MaxStack)
+	lines := fn.Lines
+	for pc := 0; pc < len(fn.Code); {
+		line := ""
+		for len(lines) > 0 && lines[0].PC == pc {
+			line = fmt.Sprint(lines[0].Pos.Line)
+			lines = lines[1:]
+		}
+		op := Op(fn.Code[pc])
+		if !op.hasOperand() {
+			fmt.Fprintf(&sb, "%4s %04d  %s\n", line, pc, op)
+			pc += op.Size()
+			continue
+		}
+		a := int(fn.Code[pc+1]) | int(fn.Code[pc+2])<<8
+		fmt.Fprintf(&sb, "%4s %04d  %-6s %5d", line, pc, op, a)
+		if note := p.operand(fn, op, a); note != "" {
+			sb.WriteString("  ; " + note)
+		}
+		sb.WriteByte('\n')
+		pc += op.Size()
+	}
+	return sb.String()
+}
+
+// operand describes the operand a of op in fn.
+func (p *Program) operand(fn *Func, op Op, a int) string {
+	switch op {
+	case OpConst:
+		switch v := p.Consts[a].(type) {
+		case evaluator.Int:
+			return ssa.FormatConst(int64(v))
+		case evaluator.Float:
+			return ssa.FormatConst(float64(v))
+		case evaluator.Bool:
+			return ssa.FormatConst(bool(v))
+		}
+	case OpLoadGlobal, OpStoreGlobal:
+		return p.Globals[a].Name
+	case OpLoadLocal, OpStoreLocal:
+		return fn.Locals[a].Name
+	case OpDivInt, OpDivFloat:
+		pos := p.Positions[a]
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	case OpCall:
+		return p.Funcs[a].Name
+	case OpPrint:
+		parts := make([]string, len(p.Prints[a]))
+		for i, arg := range p.Prints[a] {
+			if arg.Type == semantic.String {
+				parts[i] = ssa.FormatConst(arg.Text)
+			} else {
+				parts[i] = arg.Type.String()
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
+
+// String disassembles every function of p, separated by blank lines.
+func (p *Program) String() string {
+	parts := make([]string, len(p.Funcs))
+	for i, fn := range p.Funcs {
+		parts[i] = p.Disassemble(fn)
+	}
+	return strings.Join(parts, "\n")
+}
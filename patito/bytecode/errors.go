@@ -0,0 +1,53 @@
+package bytecode
+
+import (
+	"errors"
+	"fmt"
+
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/token"
+)
+
+// The errors a run can stop with besides a *LimitError, wrapped in a
+// *RuntimeError.
+var (
+	ErrIntDivByZero   = errors.New("integer division by zero")
+	ErrFloatDivByZero = errors.New("float division by zero")
+	ErrStackOverflow  = errors.New(evaluator.StackOverflow)
+)
+
+// RuntimeError is how a run that fails stops: the error, the position where
+// it happened and the calls that were active then.
+type RuntimeError struct {
+	Pos    token.Position
+	Err    error        // one of the Err variables or a *LimitError
+	Stack  []StackFrame // innermost first, the last being main unless Elided
+	Elided int          // frames of the outermost calls left out of Stack
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%d:%d: runtime error: %v", e.Pos.Line, e.Pos.Column, e.Err)
+}
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// Trace formats the stack the way the evaluator does, see evaluator.Trace.
+func (e *RuntimeError) Trace(name string) string { return evaluator.Trace(name, e.Stack, e.Elided) }
+
+// StackFrame is a call that was active when a run failed.
+type StackFrame = evaluator.StackFrame
+
+// fail returns a *RuntimeError for err at pos, raised by fn, with the stack of
+// calls that led there.
+func (vm *VM) fail(err error, pos token.Position, fn *Func) *RuntimeError {
+	e := &RuntimeError{Pos: pos, Err: err}
+	e.Stack, e.Elided = evaluator.WordStack(len(vm.frames)+1, vm.args, func(i int) (string, []*semantic.Var, token.Position) {
+		if i > 0 {
+			fr := vm.frames[len(vm.frames)-i]
+			fn, pos = fr.fn, fr.fn.Pos(fr.pc-OpCall.Size())
+		}
+		return fn.Name, fn.Locals[:fn.Params], pos
+	})
+	return e
+}
@@ -0,0 +1,108 @@
+package bytecode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"patito/evaluator"
+)
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	src := `program p;
+var n : int;
+void ratio(a : int, b : float) [
+    var q : float;
+    {
+        a = a - 1;
+        q = b / a;
+        print(q);
+    }
+];
+void walk(k : int) [
+    {
+        if (k > 0) {
+            walk(k - 1);
+        } else {
+            ratio(k + 1, 2.5);
+        };
+    }
+];
+main {
+    n = 2;
+    walk(n);
+}
+end`
+	var out bytes.Buffer
+	err := New(compile(t, src), &out).Run()
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected *RuntimeError, got %v", err)
+	}
+	if !errors.Is(err, ErrFloatDivByZero) {
+		t.Errorf("expected the error to wrap ErrFloatDivByZero, got %v", rerr.Err)
+	}
+	if want := "7:17: runtime error: float division by zero"; err.Error() != want {
+		t.Errorf("expected=%q, got=%q", want, err.Error())
+	}
+	want := `ratio(a = 1, b = 2.5)
+	p.pat:7:17
+walk(k = 0)
+	p.pat:16:13
+walk(k = 1)
+	p.pat:14:13
+walk(k = 2)
+	p.pat:14:13
+main()
+	p.pat:22:5
+`
+	if got := rerr.Trace("p.pat"); got != want {
+		t.Errorf("trace wrong.\nexpected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	vm := New(compile(t, recurse), io.Discard)
+	err := vm.Run()
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) || !errors.Is(err, ErrStackOverflow) {
+		t.Fatalf("expected a stack overflow, got %v", err)
+	}
+	if len(rerr.Stack) != evaluator.MaxTrace || rerr.Elided != evaluator.MaxCalls+1-evaluator.MaxTrace {
+		t.Errorf("expected %d frames and %d elided, got %d and %d", evaluator.MaxTrace, evaluator.MaxCalls+1-evaluator.MaxTrace, len(rerr.Stack), rerr.Elided)
+	}
+	if f := rerr.Stack[0]; f.String() != fmt.Sprintf("down(k = %d)", evaluator.MaxCalls-1) || f.Pos.Line != 5 {
+		t.Errorf("innermost frame wrong: %s at %d:%d", f, f.Pos.Line, f.Pos.Column)
+	}
+
+	// A depth limit past the most calls there can be is a stack overflow too.
+	vm.Limits.Depth = evaluator.MaxCalls * 2
+	if err := vm.Run(); !errors.Is(err, ErrStackOverflow) {
+		t.Fatalf("expected a stack overflow, got %v", err)
+	}
+}
+
+func TestLimitErrorsAreRuntimeErrors(t *testing.T) {
+	vm := New(compile(t, recurse), io.Discard)
+	vm.Limits.Depth = 3
+	err := vm.Run()
+	var rerr *RuntimeError
+	var lerr *LimitError
+	if !errors.As(err, &rerr) || !errors.As(err, &lerr) || lerr.Limit != DepthLimit {
+		t.Fatalf("expected a *RuntimeError wrapping a DepthLimit, got %v", err)
+	}
+	want := `down(k = 2)
+	p.pat:5:9
+down(k = 1)
+	p.pat:5:9
+down(k = 0)
+	p.pat:5:9
+main()
+	p.pat:9:5
+`
+	if got := rerr.Trace("p.pat"); got != want {
+		t.Errorf("trace wrong.\nexpected:\n%s\ngot:\n%s", want, got)
+	}
+}
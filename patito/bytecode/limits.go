@@ -0,0 +1,107 @@
+package bytecode
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"patito/evaluator"
+)
+
+// Limits bounds what a run may use, for programs that cannot be trusted to
+// end or to stay small. A zero field means no limit, and a negative one is an
+// error.
+type Limits struct {
+	Steps  int64 // instructions executed
+	Depth  int   // calls active at once
+	Memory int   // cells of each segment: the globals, and the stack of locals and temporaries
+}
+
+// Validate reports the first of the limits that is negative.
+func (l Limits) Validate() error {
+	switch {
+	case l.Steps < 0:
+		return fmt.Errorf("negative instruction limit %d", l.Steps)
+	case l.Depth < 0:
+		return fmt.Errorf("negative call depth limit %d", l.Depth)
+	case l.Memory < 0:
+		return fmt.Errorf("negative memory limit %d", l.Memory)
+	}
+	return nil
+}
+
+// Limit names one of the limits a run can go over.
+type Limit int
+
+const (
+	StepLimit   Limit = iota + 1 // Limits.Steps
+	DepthLimit                   // Limits.Depth
+	MemoryLimit                  // Limits.Memory
+	TimeLimit                    // the context of RunContext was done
+)
+
+// LimitError reports the limit a run went over. The *RuntimeError that wraps
+// it tells where.
+type LimitError struct {
+	Limit   Limit
+	Max     int64  // the value of the limit, except for a TimeLimit
+	Segment string // "globals" or "stack", for a MemoryLimit
+	Err     error  // the error of the context, for a TimeLimit
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case StepLimit:
+		return fmt.Sprintf("instruction limit of %d exceeded", e.Max)
+	case DepthLimit:
+		return fmt.Sprintf("call depth limit of %d exceeded", e.Max)
+	case MemoryLimit:
+		return fmt.Sprintf("memory limit of %d cells exceeded by the %s", e.Max, e.Segment)
+	case TimeLimit:
+		return fmt.Sprintf("time limit exceeded: %v", e.Err)
+	}
+	return "limit exceeded"
+}
+
+func (e *LimitError) Unwrap() error { return e.Err }
+
+// checkEvery is the number of instructions between two looks at the context
+// of a run.
+const checkEvery = 1 << 12
+
+// checkpoint returns the number of instructions after which a run that has
+// executed steps must look at its limits again.
+func (vm *VM) checkpoint(steps int64) int64 {
+	next := steps + checkEvery
+	if vm.Limits.Steps > 0 {
+		next = min(next, vm.Limits.Steps)
+	}
+	return next
+}
+
+// overLimit reports whether a run that has executed steps must stop.
+func (vm *VM) overLimit(ctx context.Context, steps int64) error {
+	if vm.Limits.Steps > 0 && steps >= vm.Limits.Steps {
+		return &LimitError{Limit: StepLimit, Max: vm.Limits.Steps}
+	}
+	if err := ctx.Err(); err != nil {
+		return &LimitError{Limit: TimeLimit, Err: err}
+	}
+	return nil
+}
+
+// depthError returns the error for a call beyond the most that may be active.
+func (vm *VM) depthError() error {
+	if d := vm.Limits.Depth; d > 0 && d <= evaluator.MaxCalls {
+		return &LimitError{Limit: DepthLimit, Max: int64(d)}
+	}
+	return ErrStackOverflow
+}
+
+// limit returns n, or no limit at all when n is zero.
+func limit(n int) int {
+	if n == 0 {
+		return math.MaxInt
+	}
+	return n
+}
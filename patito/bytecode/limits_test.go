@@ -0,0 +1,129 @@
+package bytecode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+const forever = `program p;
+var i : int;
+main {
+    print("start");
+    while (0 < 1) do {
+        i = i + 1;
+    };
+}
+end`
+
+const recurse = `program p;
+void down(k : int) [
+    var a, b : int;
+    {
+        down(k + 1);
+    }
+];
+main {
+    down(0);
+}
+end`
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		src    string
+		limits Limits
+		limit  Limit
+		want   string
+	}{
+		{forever, Limits{Steps: 1000}, StepLimit, "5:5: runtime error: instruction limit of 1000 exceeded"},
+		{recurse, Limits{Depth: 50}, DepthLimit, "5:9: runtime error: call depth limit of 50 exceeded"},
+		{recurse, Limits{Memory: 300}, MemoryLimit, "5:9: runtime error: memory limit of 300 cells exceeded by the stack"},
+		{"program p; var a, b : int; c : float; main { print(a); } end", Limits{Memory: 2}, MemoryLimit,
+			"1:28: runtime error: memory limit of 2 cells exceeded by the globals"},
+		{"program p; main { print(1, 2, 3); } end", Limits{Memory: 2}, MemoryLimit,
+			"1:19: runtime error: memory limit of 2 cells exceeded by the stack"},
+	}
+	for i, tt := range tests {
+		vm := New(compile(t, tt.src), io.Discard)
+		vm.Limits = tt.limits
+		err := vm.Run()
+		var lerr *LimitError
+		if !errors.As(err, &lerr) {
+			t.Fatalf("tests[%d] - expected *LimitError, got %v", i, err)
+		}
+		if lerr.Limit != tt.limit {
+			t.Errorf("tests[%d] - limit wrong. expected=%d, got=%d", i, tt.limit, lerr.Limit)
+		}
+		if err.Error() != tt.want {
+			t.Errorf("tests[%d] - expected=%q, got=%q", i, tt.want, err.Error())
+		}
+	}
+}
+
+func TestLimitsAllowEnough(t *testing.T) {
+	// const, print and halt: exactly three instructions and one stack cell.
+	vm := New(compile(t, "program p; var x : int; main { print(1); } end"), io.Discard)
+	vm.Limits = Limits{Steps: 3, Depth: 1, Memory: 1}
+	if err := vm.Run(); err != nil {
+		t.Fatal(err)
+	}
+	vm.Limits.Steps = 2
+	if err := vm.Run(); err == nil {
+		t.Fatal("expected the third instruction to go over the limit")
+	}
+
+	vm = New(compile(t, recurse), io.Discard)
+	vm.Limits = Limits{Steps: 1e6, Depth: 10000}
+	err := vm.Run()
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != DepthLimit {
+		t.Fatalf("expected a DepthLimit, got %v", err)
+	}
+}
+
+func TestNegativeLimits(t *testing.T) {
+	tests := []struct {
+		limits Limits
+		want   string
+	}{
+		{Limits{Steps: -1}, "negative instruction limit -1"},
+		{Limits{Depth: -1}, "negative call depth limit -1"},
+		{Limits{Memory: -1}, "negative memory limit -1"},
+	}
+	for i, tt := range tests {
+		var out bytes.Buffer
+		vm := New(compile(t, "program p; var a : int; main { print(1); } end"), &out)
+		vm.Limits = tt.limits
+		err := vm.Run()
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("tests[%d] - expected=%q, got=%v", i, tt.want, err)
+		}
+		if out.Len() > 0 {
+			t.Errorf("tests[%d] - expected the program not to run, got %q", i, out.String())
+		}
+	}
+}
+
+func TestTimeLimit(t *testing.T) {
+	vm := New(compile(t, forever), io.Discard)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := vm.RunContext(ctx)
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != TimeLimit {
+		t.Fatalf("expected a TimeLimit, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the error to wrap context.DeadlineExceeded, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = vm.RunContext(ctx)
+	if want := "4:5: runtime error: time limit exceeded: context canceled"; err == nil || err.Error() != want {
+		t.Errorf("expected=%q, got=%v", want, err)
+	}
+}
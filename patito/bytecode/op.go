@@ -0,0 +1,101 @@
+// Package bytecode compiles checked Patito programs to a dense stack-machine
+// code and runs it. Each instruction is one opcode byte followed by its
+// operands, 16-bit little-endian indexes into the tables of the program or of
+// the function, so the interpreter decodes it without allocating and
+// dispatches it with a single switch.
+//
+// Types are resolved at compile time: every operator has an int and a float
+// opcode, conversions are explicit, and the stack holds raw 64-bit words, with
+// floats as their IEEE 754 bits and bools as 0 or 1.
+package bytecode
+
+// Op is an opcode.
+type Op byte
+
+const (
+	OpConst       Op = iota // push Consts[a]
+	OpLoadGlobal            // push global a
+	OpStoreGlobal           // pop into global a
+	OpLoadLocal             // push local a of the frame, params first
+	OpStoreLocal            // pop into local a
+
+	OpAddInt
+	OpSubInt
+	OpMulInt
+	OpDivInt // fails at Positions[a] when the divisor is zero
+	OpNegInt
+	OpLtInt
+	OpGtInt
+	OpLeInt
+	OpGeInt
+	OpEqInt
+	OpNeInt
+
+	OpAddFloat
+	OpSubFloat
+	OpMulFloat
+	OpDivFloat // fails at Positions[a] when the divisor is zero
+	OpNegFloat
+	OpLtFloat
+	OpGtFloat
+	OpLeFloat
+	OpGeFloat
+	OpEqFloat
+	OpNeFloat
+	OpIntToFloat
+
+	OpJump        // continue at a
+	OpJumpIfFalse // pop, and continue at a if it is false
+	OpCall        // call Funcs[a], whose args are on the stack
+	OpReturn      // return to the caller
+	OpPrint       // pop the values of Prints[a] and print them
+	OpHalt        // end the program
+
+	numOps
+)
+
+var opNames = [numOps]string{
+	OpConst: "const", OpLoadGlobal: "loadg", OpStoreGlobal: "storeg", OpLoadLocal: "loadl", OpStoreLocal: "storel",
+	OpAddInt: "addi", OpSubInt: "subi", OpMulInt: "muli", OpDivInt: "divi", OpNegInt: "negi",
+	OpLtInt: "lti", OpGtInt: "gti", OpLeInt: "lei", OpGeInt: "gei", OpEqInt: "eqi", OpNeInt: "nei",
+	OpAddFloat: "addf", OpSubFloat: "subf", OpMulFloat: "mulf", OpDivFloat: "divf", OpNegFloat: "negf",
+	OpLtFloat: "ltf", OpGtFloat: "gtf", OpLeFloat: "lef", OpGeFloat: "gef", OpEqFloat: "eqf", OpNeFloat: "nef", OpIntToFloat: "itof",
+	OpJump: "jump", OpJumpIfFalse: "jumpf", OpCall: "call", OpReturn: "ret", OpPrint: "print", OpHalt: "halt",
+}
+
+func (op Op) String() string {
+	if op < numOps {
+		return opNames[op]
+	}
+	return "op?"
+}
+
+// hasOperand reports whether op is followed by a 16-bit operand.
+func (op Op) hasOperand() bool {
+	switch op {
+	case OpConst, OpLoadGlobal, OpStoreGlobal, OpLoadLocal, OpStoreLocal,
+		OpDivInt, OpDivFloat, OpJump, OpJumpIfFalse, OpCall, OpPrint:
+		return true
+	}
+	return false
+}
+
+// effect is the change op makes to the height of the stack, for the ops whose
+// effect does not depend on their operand.
+func (op Op) effect() int {
+	switch op {
+	case OpConst, OpLoadGlobal, OpLoadLocal:
+		return 1
+	case OpNegInt, OpNegFloat, OpIntToFloat, OpJump, OpReturn, OpHalt:
+		return 0
+	}
+	return -1 // stores, binary operators and jumpf
+}
+
+// Size returns the number of bytes of an instruction with opcode op.
+func (op Op) Size() int {
+	if op.hasOperand() {
+		return 3
+	}
+	return 1
+}
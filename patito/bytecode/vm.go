@@ -0,0 +1,286 @@
+package bytecode
+
+import (
+	"context"
+	"io"
+	"math"
+	"strconv"
+
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// VM runs a compiled program. The stack holds the frames of the active calls
+// one after another, each with its params and locals followed by the values
+// its code pushes, so a call only moves the frame pointer.
+type VM struct {
+	Limits Limits
+
+	p      *Program
+	out    io.Writer
+	consts []uint64 // Consts as raw words
+	line   []byte   // the line print is writing
+
+	globals []uint64
+	stack   []uint64
+	frames  []frame  // callers of the running function
+	args    []uint64 // the args of every active call, outermost first, for traces
+}
+
+// frame is what a call saves to return to its caller.
+type frame struct {
+	fn *Func
+	pc int // of the instruction after the call
+	fp int // index of the first local of fn on the stack
+}
+
+// New returns a VM that runs p and prints to out.
+func New(p *Program, out io.Writer) *VM {
+	vm := &VM{p: p, out: out, consts: make([]uint64, len(p.Consts))}
+	for i, c := range p.Consts {
+		vm.consts[i] = word(c)
+	}
+	return vm
+}
+
+// word returns the raw stack word of a constant.
+func word(v evaluator.Value) uint64 {
+	switch v := v.(type) {
+	case evaluator.Int:
+		return uint64(v)
+	case evaluator.Float:
+		return math.Float64bits(float64(v))
+	case evaluator.Bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+func bit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Run runs the program from the start, with every global at zero. A division
+// by zero, a stack overflow or going over one of the Limits stops it with a
+// *RuntimeError.
+func (vm *VM) Run() error { return vm.RunContext(context.Background()) }
+
+// RunContext is like Run, but it also stops with a *RuntimeError that wraps a
+// *LimitError of TimeLimit once ctx is done.
+//
+// It does not start when Limits.Validate fails, and returns its error.
+func (vm *VM) RunContext(ctx context.Context) error {
+	if err := vm.Limits.Validate(); err != nil {
+		return err
+	}
+	p := vm.p
+	fn := p.Main()
+	maxDepth, maxMemory := min(limit(vm.Limits.Depth), evaluator.MaxCalls), limit(vm.Limits.Memory)
+	vm.frames, vm.args = vm.frames[:0], vm.args[:0]
+	if len(p.Globals) > maxMemory {
+		err := &LimitError{Limit: MemoryLimit, Max: int64(maxMemory), Segment: "globals"}
+		return vm.fail(err, p.Globals[maxMemory].Decl.Position(), fn)
+	}
+	if fn.MaxStack > maxMemory {
+		err := &LimitError{Limit: MemoryLimit, Max: int64(maxMemory), Segment: "stack"}
+		return vm.fail(err, fn.Pos(0), fn)
+	}
+	vm.globals = make([]uint64, len(p.Globals))
+	vm.stack = make([]uint64, min(max(1024, fn.MaxStack), maxMemory))
+	globals, stack, consts := vm.globals, vm.stack, vm.consts
+	code, pc, fp, sp := fn.Code, 0, 0, 0
+	steps, next := int64(0), int64(0)
+
+	for {
+		if steps == next {
+			if err := vm.overLimit(ctx, steps); err != nil {
+				return vm.fail(err, fn.Pos(pc), fn)
+			}
+			next = vm.checkpoint(steps)
+		}
+		steps++
+		op := Op(code[pc])
+		a := 0
+		if op.hasOperand() {
+			a = int(code[pc+1]) | int(code[pc+2])<<8
+			pc += 3
+		} else {
+			pc++
+		}
+
+		switch op {
+		case OpConst:
+			stack[sp] = consts[a]
+			sp++
+		case OpLoadGlobal:
+			stack[sp] = globals[a]
+			sp++
+		case OpStoreGlobal:
+			sp--
+			globals[a] = stack[sp]
+		case OpLoadLocal:
+			stack[sp] = stack[fp+a]
+			sp++
+		case OpStoreLocal:
+			sp--
+			stack[fp+a] = stack[sp]
+
+		case OpAddInt:
+			sp--
+			stack[sp-1] = uint64(int64(stack[sp-1]) + int64(stack[sp]))
+		case OpSubInt:
+			sp--
+			stack[sp-1] = uint64(int64(stack[sp-1]) - int64(stack[sp]))
+		case OpMulInt:
+			sp--
+			stack[sp-1] = uint64(int64(stack[sp-1]) * int64(stack[sp]))
+		case OpDivInt:
+			sp--
+			r := int64(stack[sp])
+			if r == 0 {
+				return vm.fail(ErrIntDivByZero, p.Positions[a], fn)
+			}
+			stack[sp-1] = uint64(int64(stack[sp-1]) / r)
+		case OpNegInt:
+			stack[sp-1] = uint64(-int64(stack[sp-1]))
+		case OpLtInt:
+			sp--
+			stack[sp-1] = bit(int64(stack[sp-1]) < int64(stack[sp]))
+		case OpGtInt:
+			sp--
+			stack[sp-1] = bit(int64(stack[sp-1]) > int64(stack[sp]))
+		case OpLeInt:
+			sp--
+			stack[sp-1] = bit(int64(stack[sp-1]) <= int64(stack[sp]))
+		case OpGeInt:
+			sp--
+			stack[sp-1] = bit(int64(stack[sp-1]) >= int64(stack[sp]))
+		case OpEqInt:
+			sp--
+			stack[sp-1] = bit(stack[sp-1] == stack[sp])
+		case OpNeInt:
+			sp--
+			stack[sp-1] = bit(stack[sp-1] != stack[sp])
+
+		case OpAddFloat:
+			sp--
+			stack[sp-1] = math.Float64bits(math.Float64frombits(stack[sp-1]) + math.Float64frombits(stack[sp]))
+		case OpSubFloat:
+			sp--
+			stack[sp-1] = math.Float64bits(math.Float64frombits(stack[sp-1]) - math.Float64frombits(stack[sp]))
+		case OpMulFloat:
+			sp--
+			stack[sp-1] = math.Float64bits(math.Float64frombits(stack[sp-1]) * math.Float64frombits(stack[sp]))
+		case OpDivFloat:
+			sp--
+			r := math.Float64frombits(stack[sp])
+			if r == 0 {
+				return vm.fail(ErrFloatDivByZero, p.Positions[a], fn)
+			}
+			stack[sp-1] = math.Float64bits(math.Float64frombits(stack[sp-1]) / r)
+		case OpNegFloat:
+			stack[sp-1] = math.Float64bits(-math.Float64frombits(stack[sp-1]))
+		case OpLtFloat:
+			sp--
+			stack[sp-1] = bit(math.Float64frombits(stack[sp-1]) < math.Float64frombits(stack[sp]))
+		case OpGtFloat:
+			sp--
+			stack[sp-1] = bit(math.Float64frombits(stack[sp-1]) > math.Float64frombits(stack[sp]))
+		case OpLeFloat:
+			sp--
+			stack[sp-1] = bit(math.Float64frombits(stack[sp-1]) <= math.Float64frombits(stack[sp]))
+		case OpGeFloat:
+			sp--
+			stack[sp-1] = bit(math.Float64frombits(stack[sp-1]) >= math.Float64frombits(stack[sp]))
+		case OpEqFloat:
+			sp--
+			stack[sp-1] = bit(math.Float64frombits(stack[sp-1]) == math.Float64frombits(stack[sp]))
+		case OpNeFloat:
+			sp--
+			stack[sp-1] = bit(math.Float64frombits(stack[sp-1]) != math.Float64frombits(stack[sp]))
+		case OpIntToFloat:
+			stack[sp-1] = math.Float64bits(float64(int64(stack[sp-1])))
+
+		case OpJump:
+			pc = a
+		case OpJumpIfFalse:
+			sp--
+			if stack[sp] == 0 {
+				pc = a
+			}
+		case OpCall:
+			callee := p.Funcs[a]
+			base := sp - callee.Params
+			top := base + len(callee.Locals)
+			need := top + callee.MaxStack
+			if len(vm.frames) >= maxDepth {
+				return vm.fail(vm.depthError(), fn.Pos(pc-3), fn)
+			}
+			if need > maxMemory {
+				err := &LimitError{Limit: MemoryLimit, Max: int64(maxMemory), Segment: "stack"}
+				return vm.fail(err, fn.Pos(pc-3), fn)
+			}
+			if need > len(stack) {
+				stack = append(stack, make([]uint64, min(need, maxMemory-len(stack)))...)
+				vm.stack = stack
+			}
+			clear(stack[sp:top])
+			vm.args = append(vm.args, stack[base:sp]...)
+			vm.frames = append(vm.frames, frame{fn: fn, pc: pc, fp: fp})
+			fn, code, pc, fp, sp = callee, callee.Code, 0, base, top
+		case OpReturn:
+			caller := vm.frames[len(vm.frames)-1]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.args = vm.args[:len(vm.args)-fn.Params]
+			sp = fp
+			fn, code, pc, fp = caller.fn, caller.fn.Code, caller.pc, caller.fp
+		case OpPrint:
+			args := p.Prints[a]
+			n := 0
+			for _, arg := range args {
+				if arg.Type != semantic.String {
+					n++
+				}
+			}
+			sp -= n
+			if err := vm.print(args, stack[sp:sp+n]); err != nil {
+				return err
+			}
+		case OpHalt:
+			return nil
+		default:
+			panic("bytecode: bad opcode " + strconv.Itoa(int(op)))
+		}
+	}
+}
+
+// print writes args, taking their values from values, separated by spaces.
+func (vm *VM) print(args []PrintArg, values []uint64) error {
+	line := vm.line[:0]
+	for i, arg := range args {
+		if i > 0 {
+			line = append(line, ' ')
+		}
+		switch arg.Type {
+		case semantic.String:
+			line = append(line, arg.Text...)
+			continue
+		case semantic.Int:
+			line = strconv.AppendInt(line, int64(values[0]), 10)
+		case semantic.Float:
+			line = strconv.AppendFloat(line, math.Float64frombits(values[0]), 'g', 6, 64)
+		case semantic.Bool:
+			line = strconv.AppendBool(line, values[0] != 0)
+		}
+		values = values[1:]
+	}
+	line = append(line, '\n')
+	vm.line = line
+	_, err := vm.out.Write(line)
+	return err
+}
@@ -0,0 +1,271 @@
+// Package cfg builds control-flow graphs for the bodies of Patito functions
+// and main. The graph is built over the AST: a basic block holds the
+// assignments, prints and calls that always run together, and ends either by
+// falling through to its only successor or by branching on the condition of an
+// if or while.
+//
+// An if ends the current block with its condition and continues in a join
+// block after both branches. A while gets a header block holding only its
+// condition; the end of the body jumps back to it.
+package cfg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"patito/ast"
+)
+
+// Block is a basic block.
+type Block struct {
+	ID    int
+	Stmts []ast.Statement
+	// Cond is the branch condition that ends the block, or nil when the block
+	// falls through. When set, Succs holds the true target then the false one.
+	Cond  ast.Expression
+	Succs []*Block
+	Preds []*Block
+}
+
+// Graph is the control-flow graph of one body. Entry is the first block and
+// Exit an empty block that every path which finishes ends in.
+type Graph struct {
+	Name   string // function name, or "main"
+	Entry  *Block
+	Exit   *Block
+	Blocks []*Block // indexed by ID
+}
+
+// Build returns the graph of body. name is only used for display.
+func Build(name string, body *ast.BlockStatement) *Graph {
+	b := &builder{g: &Graph{Name: name}}
+	b.g.Entry = b.newBlock()
+	b.cur = b.g.Entry
+	b.block(body)
+	if b.reusable() {
+		b.g.Exit = b.cur
+	} else {
+		b.g.Exit = b.newBlock()
+		link(b.cur, b.g.Exit)
+	}
+	return b.g
+}
+
+// BuildProgram returns the graphs of every function, in declaration order,
+// followed by the one of main.
+func BuildProgram(prog *ast.Program) []*Graph {
+	var graphs []*Graph
+	for _, fn := range prog.Funcs {
+		graphs = append(graphs, Build(fn.Name.Value, fn.Body))
+	}
+	return append(graphs, Build("main", prog.Main))
+}
+
+type builder struct {
+	g   *Graph
+	cur *Block // block that the next statement is appended to
+}
+
+func (b *builder) newBlock() *Block {
+	blk := &Block{ID: len(b.g.Blocks)}
+	b.g.Blocks = append(b.g.Blocks, blk)
+	return blk
+}
+
+// reusable reports whether the current block is an empty join that can stand
+// for the next block instead of falling through to it. The entry block is
+// never reused so that it has no predecessors.
+func (b *builder) reusable() bool {
+	return b.cur != b.g.Entry && len(b.cur.Stmts) == 0 && b.cur.Cond == nil
+}
+
+func link(from, to *Block) {
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+func (b *builder) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.IfStatement:
+			b.ifStatement(s)
+		case *ast.WhileStatement:
+			b.whileStatement(s)
+		case *ast.BlockStatement:
+			b.block(s)
+		default:
+			b.cur.Stmts = append(b.cur.Stmts, stmt)
+		}
+	}
+}
+
+func (b *builder) ifStatement(s *ast.IfStatement) {
+	cond := b.cur
+	cond.Cond = s.Condition
+
+	then := b.newBlock()
+	link(cond, then)
+	b.cur = then
+	b.block(s.Consequence)
+	thenEnd := b.cur
+
+	var elseEnd *Block
+	if s.Alternative != nil {
+		els := b.newBlock()
+		link(cond, els)
+		b.cur = els
+		b.block(s.Alternative)
+		elseEnd = b.cur
+	}
+
+	join := b.newBlock()
+	link(thenEnd, join)
+	if elseEnd != nil {
+		link(elseEnd, join)
+	} else {
+		link(cond, join)
+	}
+	b.cur = join
+}
+
+func (b *builder) whileStatement(s *ast.WhileStatement) {
+	header := b.cur
+	if !b.reusable() {
+		header = b.newBlock()
+		link(b.cur, header)
+	}
+	header.Cond = s.Condition
+
+	body := b.newBlock()
+	link(header, body)
+	b.cur = body
+	b.block(s.Body)
+	link(b.cur, header)
+
+	after := b.newBlock()
+	link(header, after)
+	b.cur = after
+}
+
+// Reachable returns the blocks that can be reached from Entry, indexed by ID.
+// Branches are followed whatever their condition.
+func (g *Graph) Reachable() []bool {
+	seen := make([]bool, len(g.Blocks))
+	var visit func(*Block)
+	visit = func(blk *Block) {
+		if seen[blk.ID] {
+			return
+		}
+		seen[blk.ID] = true
+		for _, s := range blk.Succs {
+			visit(s)
+		}
+	}
+	visit(g.Entry)
+	return seen
+}
+
+// Count returns the number of statements and of conditional branches in g:
+// the instructions a quadruple listing of it would need besides plain jumps.
+func (g *Graph) Count() (stmts, branches int) {
+	for _, blk := range g.Blocks {
+		stmts += len(blk.Stmts)
+		if blk.Cond != nil {
+			branches++
+		}
+	}
+	return stmts, branches
+}
+
+// ---------- Output ----------
+
+// lines renders the statements of blk, one per line, and its jump in the
+// GOTO/GOTOF style of quadruple listings.
+func (blk *Block) lines() []string {
+	var out []string
+	for _, stmt := range blk.Stmts {
+		out = append(out, strings.TrimSuffix(ast.Format(stmt), "\n"))
+	}
+	switch {
+	case blk.Cond != nil:
+		out = append(out, fmt.Sprintf("GOTOF %s B%d", ast.Format(blk.Cond), blk.Succs[1].ID))
+		out = append(out, fmt.Sprintf("GOTO B%d", blk.Succs[0].ID))
+	case len(blk.Succs) == 1:
+		out = append(out, fmt.Sprintf("GOTO B%d", blk.Succs[0].ID))
+	}
+	return out
+}
+
+func (g *Graph) label(blk *Block) string {
+	switch blk {
+	case g.Entry:
+		return fmt.Sprintf("B%d (entry)", blk.ID)
+	case g.Exit:
+		return fmt.Sprintf("B%d (exit)", blk.ID)
+	}
+	return fmt.Sprintf("B%d", blk.ID)
+}
+
+// String lists the blocks of g with their predecessors, statements and jumps.
+func (g *Graph) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:\n", g.Name)
+	for _, blk := range g.Blocks {
+		preds := make([]string, len(blk.Preds))
+		for i, p := range blk.Preds {
+			preds[i] = fmt.Sprintf("B%d", p.ID)
+		}
+		fmt.Fprintf(&sb, "%s preds=[%s]\n", g.label(blk), strings.Join(preds, " "))
+		for _, line := range blk.lines() {
+			fmt.Fprintf(&sb, "    %s\n", line)
+		}
+	}
+	return sb.String()
+}
+
+// WriteDot writes graphs as one Graphviz digraph with a cluster per graph.
+// Branch edges are labelled true and false.
+func WriteDot(w io.Writer, graphs []*Graph) error {
+	var sb strings.Builder
+	sb.WriteString("digraph cfg {\n")
+	sb.WriteString("    node [shape=box, fontname=\"monospace\"];\n")
+	for _, g := range graphs {
+		fmt.Fprintf(&sb, "    subgraph \"cluster_%s\" {\n", g.Name)
+		fmt.Fprintf(&sb, "        label=%s;\n", quote(g.Name))
+		for _, blk := range g.Blocks {
+			label := g.label(blk) + "\\l"
+			for _, stmt := range blk.Stmts {
+				label += escape(strings.TrimSuffix(ast.Format(stmt), "\n")) + "\\l"
+			}
+			if blk.Cond != nil {
+				label += escape(ast.Format(blk.Cond)) + " ?\\l"
+			}
+			fmt.Fprintf(&sb, "        \"%s_B%d\" [label=\"%s\"];\n", g.Name, blk.ID, label)
+		}
+		for _, blk := range g.Blocks {
+			for i, s := range blk.Succs {
+				attr := ""
+				if blk.Cond != nil {
+					attr = " [label=\"true\"]"
+					if i == 1 {
+						attr = " [label=\"false\"]"
+					}
+				}
+				fmt.Fprintf(&sb, "        \"%s_B%d\" -> \"%s_B%d\"%s;\n", g.Name, blk.ID, g.Name, s.ID, attr)
+			}
+		}
+		sb.WriteString("    }\n")
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
@@ -0,0 +1,168 @@
+package cfg
+
+import (
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	return prog
+}
+
+func TestBuild(t *testing.T) {
+	prog := parse(t, `program p;
+var i, n : int;
+void f(a : int) [
+    {
+        if (a > 0) {
+            print(a);
+        };
+    }
+];
+main {
+    i = 0;
+    while (i < 3) do {
+        if (i == 1) {
+            n = n + 1;
+        } else {
+            while (n < 2) do {
+                n = n + 2;
+            };
+        };
+        i = i + 1;
+    };
+    f(n);
+}
+end`)
+	graphs := BuildProgram(prog)
+	if len(graphs) != 2 {
+		t.Fatalf("expected 2 graphs, got %d", len(graphs))
+	}
+	expected := `f:
+B0 (entry) preds=[]
+    GOTOF a > 0 B2
+    GOTO B1
+B1 preds=[B0]
+    print(a);
+    GOTO B2
+B2 (exit) preds=[B1 B0]
+
+main:
+B0 (entry) preds=[]
+    i = 0;
+    GOTO B1
+B1 preds=[B0 B7]
+    GOTOF i < 3 B8
+    GOTO B2
+B2 preds=[B1]
+    GOTOF i == 1 B4
+    GOTO B3
+B3 preds=[B2]
+    n = n + 1;
+    GOTO B7
+B4 preds=[B2 B5]
+    GOTOF n < 2 B6
+    GOTO B5
+B5 preds=[B4]
+    n = n + 2;
+    GOTO B4
+B6 preds=[B4]
+    GOTO B7
+B7 preds=[B3 B6]
+    i = i + 1;
+    GOTO B1
+B8 preds=[B1]
+    f(n);
+    GOTO B9
+B9 (exit) preds=[B8]
+`
+	var got strings.Builder
+	for i, g := range graphs {
+		if i > 0 {
+			got.WriteString("\n")
+		}
+		got.WriteString(g.String())
+	}
+	if got.String() != expected {
+		t.Fatalf("wrong graphs.\nexpected:\n%s\ngot:\n%s", expected, got.String())
+	}
+
+	if stmts, branches := graphs[1].Count(); stmts != 5 || branches != 3 {
+		t.Errorf("main should have 5 statements and 3 branches, got %d and %d", stmts, branches)
+	}
+
+	// Every edge is recorded on both ends
+	for _, g := range graphs {
+		for _, blk := range g.Blocks {
+			for _, s := range blk.Succs {
+				if !contains(s.Preds, blk) {
+					t.Errorf("%s: B%d -> B%d is missing from the predecessors", g.Name, blk.ID, s.ID)
+				}
+			}
+		}
+	}
+}
+
+func contains(blocks []*Block, blk *Block) bool {
+	for _, b := range blocks {
+		if b == blk {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEmptyBodies(t *testing.T) {
+	g := Build("main", parse(t, "program p; main { } end").Main)
+	if len(g.Blocks) != 2 || g.Entry.Succs[0] != g.Exit || len(g.Exit.Succs) != 0 {
+		t.Fatalf("unexpected graph:\n%s", g)
+	}
+	g = Build("main", parse(t, "program p; main { while (1 < 2) do { }; } end").Main)
+	expected := "main:\nB0 (entry) preds=[]\n    GOTO B1\nB1 preds=[B0 B2]\n    GOTOF 1 < 2 B3\n    GOTO B2\nB2 preds=[B1]\n    GOTO B1\nB3 (exit) preds=[B1]\n"
+	if g.String() != expected {
+		t.Fatalf("unexpected graph:\n%s", g)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	g := Build("main", parse(t, "program p; var i : int; main { if (i > 0) { i = 1; }; } end").Main)
+	// A block nothing jumps to, as a pass that drops a branch would leave
+	g.Blocks = append(g.Blocks, &Block{ID: len(g.Blocks)})
+	got := g.Reachable()
+	for id, ok := range got {
+		if ok != (id < len(got)-1) {
+			t.Fatalf("unexpected reachability %v", got)
+		}
+	}
+}
+
+func TestWriteDot(t *testing.T) {
+	prog := parse(t, "program p; var i : int; main { print(\"i\", i); while (i < 2) do { i = i + 1; }; } end")
+	var sb strings.Builder
+	if err := WriteDot(&sb, BuildProgram(prog)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"digraph cfg {",
+		`subgraph "cluster_main" {`,
+		`"main_B0" [label="B0 (entry)\lprint(\"i\", i);\l"];`,
+		`"main_B1" [label="B1\li < 2 ?\l"];`,
+		`"main_B1" -> "main_B2" [label="true"];`,
+		`"main_B1" -> "main_B3" [label="false"];`,
+		`"main_B2" -> "main_B1";`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("missing %s in\n%s", want, sb.String())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"patito/cfg"
+	"patito/optimize"
+)
+
+// runCFG implements "patito cfg": it prints the control-flow graph of every
+// function and main, as a block listing or as a Graphviz digraph. With -stats
+// it prints the size of each graph before and after optimizing instead.
+func runCFG(args []string) int {
+	fs := flag.NewFlagSet("cfg", flag.ContinueOnError)
+	dot := fs.Bool("dot", false, "print a Graphviz digraph instead of a block listing")
+	stats := fs.Bool("stats", false, "print the size of each graph before and after optimizing")
+	level := optFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito cfg: %v\n", err)
+		return 1
+	}
+	prog, dir, ok := check(name, src)
+	if !ok {
+		return 1
+	}
+	var before []string
+	for _, g := range cfg.BuildProgram(prog) {
+		before = append(before, size(g))
+	}
+	if *level > 0 {
+		if errs := optimize.Optimize(prog, dir, src); len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+			}
+			return 1
+		}
+	}
+
+	graphs := cfg.BuildProgram(prog)
+	switch {
+	case *stats:
+		for i, g := range graphs {
+			fmt.Printf("%s: %s -> %s\n", g.Name, before[i], size(g))
+		}
+		return 0
+	case *dot:
+		if err := cfg.WriteDot(os.Stdout, graphs); err != nil {
+			fmt.Fprintf(os.Stderr, "patito cfg: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	for i, g := range graphs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(g)
+	}
+	return 0
+}
+
+func size(g *cfg.Graph) string {
+	stmts, branches := g.Count()
+	return fmt.Sprintf("%d blocks, %d statements, %d branches", len(g.Blocks), stmts, branches)
+}
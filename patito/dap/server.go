@@ -0,0 +1,374 @@
+// Package dap exposes the Patito debugger over the Debug Adapter Protocol, so
+// editors such as VS Code can set breakpoints, step and inspect variables in
+// .pat files.
+//
+// The server speaks Content-Length framed JSON over any reader and writer
+// (stdin and stdout for "patito dap"). It debugs a single program with a single
+// thread; the program is launched with the "launch" request, whose "program"
+// argument is the path of the source file.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"patito/debugger"
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+	"patito/wire"
+)
+
+// threadID is the only thread a Patito program has.
+const threadID = 1
+
+// globalsRef is the variablesReference of the globals scope; the locals of
+// stack frame i use localsRef + i.
+const (
+	globalsRef = 1
+	localsRef  = 2
+)
+
+type Server struct {
+	in *bufio.Reader
+
+	mu  sync.Mutex // guards out and seq, written by the program goroutine too
+	out io.Writer
+	seq int
+
+	d           *debugger.Debugger
+	path        string
+	stopOnEntry bool
+	launched    bool
+	configured  bool
+	started     bool
+	breakpoints []int         // lines requested before launch
+	running     chan struct{} // open while the program runs, nil otherwise
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out}
+}
+
+// Serve handles requests until the client disconnects or in is closed.
+func (s *Server) Serve() error {
+	for {
+		data, err := wire.Read(s.in)
+		if err != nil {
+			s.abort()
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			return fmt.Errorf("dap: %v", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+		body, step, err := s.handle(&req)
+		resp := &response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		s.send(resp)
+		if step != nil {
+			s.resume(step)
+		}
+
+		switch req.Command {
+		case "initialize":
+			s.send(&event{Type: "event", Event: "initialized"})
+		case "launch", "configurationDone":
+			if err == nil && s.launched && s.configured && !s.started {
+				s.started = true
+				s.resume(func() debugger.Stop { return s.d.Start(s.stopOnEntry) })
+			}
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+// send writes a response or event, numbering it.
+func (s *Server) send(msg any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	wire.Write(s.out, msg)
+}
+
+var errRunning = errors.New("the program is running")
+
+// handle runs req. For the requests that resume the program it also returns
+// the step to resume it with, which Serve starts once the response is out, so
+// that no stop is reported before it.
+func (s *Server) handle(req *request) (any, func() debugger.Stop, error) {
+	switch req.Command {
+	case "initialize":
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsTerminateRequest:         true,
+			SupportsEvaluateForHovers:        true,
+		}, nil, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, s.launch(args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		return map[string]any{"breakpoints": s.setBreakpoints(args)}, nil, nil
+	case "configurationDone":
+		s.configured = true
+		return nil, nil, nil
+	case "threads":
+		return map[string]any{"threads": []thread{{ID: threadID, Name: "main"}}}, nil, nil
+	case "continue", "next", "stepIn", "stepOut":
+		if err := s.paused(); err != nil {
+			return nil, nil, err
+		}
+		step := map[string]func() debugger.Stop{
+			"continue": s.d.Continue,
+			"next":     s.d.StepOver,
+			"stepIn":   s.d.StepInto,
+			"stepOut":  s.d.StepOut,
+		}[req.Command]
+		if req.Command == "continue" {
+			return map[string]any{"allThreadsContinued": true}, step, nil
+		}
+		return nil, step, nil
+	case "stackTrace":
+		if err := s.paused(); err != nil {
+			return nil, nil, err
+		}
+		return s.stackTrace(), nil, nil
+	case "scopes":
+		if err := s.paused(); err != nil {
+			return nil, nil, err
+		}
+		var args frameArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		frame := args.FrameID - 1
+		return map[string]any{"scopes": []scope{
+			{Name: "Locals", VariablesReference: localsRef + frame},
+			{Name: "Globals", VariablesReference: globalsRef},
+		}}, nil, nil
+	case "variables":
+		if err := s.paused(); err != nil {
+			return nil, nil, err
+		}
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		vars := s.d.Globals()
+		if args.VariablesReference >= localsRef {
+			vars = s.d.Locals(args.VariablesReference - localsRef)
+		}
+		list := make([]variable, 0, len(vars))
+		for _, v := range vars {
+			list = append(list, toVariable(v))
+		}
+		return map[string]any{"variables": list}, nil, nil
+	case "evaluate":
+		if err := s.paused(); err != nil {
+			return nil, nil, err
+		}
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, nil, err
+		}
+		name := strings.TrimSpace(args.Expression)
+		v, ok := s.d.Lookup(max(args.FrameID-1, 0), name)
+		if !ok {
+			return nil, nil, fmt.Errorf("no variable %s here", name)
+		}
+		return map[string]any{"result": v.Value.String(), "type": v.Type.String(), "variablesReference": 0}, nil, nil
+	case "disconnect", "terminate":
+		s.abort()
+		return nil, nil, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+// launch parses and checks the program; it starts once configuration is done.
+func (s *Server) launch(args launchArguments) error {
+	if s.launched {
+		return errors.New("a program was already launched")
+	}
+	if args.Program == "" {
+		return errors.New(`launch needs a "program" path`)
+	}
+	src, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(args.Program)
+
+	p := parser.New(lexer.New(string(src)))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return fmt.Errorf("%s:%s", name, strings.Join(errs, "\n"+name+":"))
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = name + ":" + e.Error()
+		}
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+
+	s.d = debugger.New(prog, dir, &outputWriter{s: s})
+	s.path = args.Program
+	s.stopOnEntry = args.StopOnEntry
+	s.launched = true
+	for _, line := range s.breakpoints {
+		s.d.SetBreakpoint(line)
+	}
+	return nil
+}
+
+// setBreakpoints replaces all the breakpoints. Lines without a statement move to
+// the next one that has it; before launch they are accepted as requested.
+func (s *Server) setBreakpoints(args setBreakpointsArguments) []breakpoint {
+	src := source{Name: filepath.Base(args.Source.Path), Path: args.Source.Path}
+	bps := make([]breakpoint, 0, len(args.Breakpoints))
+	if s.d == nil {
+		s.breakpoints = s.breakpoints[:0]
+		for _, bp := range args.Breakpoints {
+			s.breakpoints = append(s.breakpoints, bp.Line)
+			bps = append(bps, breakpoint{Verified: true, Line: bp.Line, Source: src})
+		}
+		return bps
+	}
+	s.d.ClearBreakpoints()
+	for _, bp := range args.Breakpoints {
+		if line, ok := s.d.SetBreakpoint(bp.Line); ok {
+			bps = append(bps, breakpoint{Verified: true, Line: line, Source: src})
+		} else {
+			bps = append(bps, breakpoint{Line: bp.Line, Message: "no statement at or after this line", Source: src})
+		}
+	}
+	return bps
+}
+
+func (s *Server) stackTrace() any {
+	src := source{Name: filepath.Base(s.path), Path: s.path}
+	stack := s.d.Stack()
+	frames := make([]stackFrame, len(stack))
+	for i, f := range stack {
+		frames[i] = stackFrame{ID: i + 1, Name: f.Func, Source: src, Line: f.Pos.Line, Column: f.Pos.Column}
+	}
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+func toVariable(v debugger.Variable) variable {
+	value := "<unset>"
+	if v.Value != nil {
+		value = v.Value.String()
+	}
+	return variable{Name: v.Name, Value: value, Type: v.Type.String()}
+}
+
+// ---------- Running the program ----------
+
+// paused returns an error unless the program is stopped mid-run.
+func (s *Server) paused() error {
+	if !s.started {
+		return errors.New("the program has not started")
+	}
+	if s.running != nil {
+		select {
+		case <-s.running:
+			s.running = nil
+		default:
+			return errRunning
+		}
+	}
+	if !s.d.Running() {
+		return errors.New("the program is not running")
+	}
+	return nil
+}
+
+// resume runs step on another goroutine so requests are still served, and
+// reports where the program stopped with an event.
+func (s *Server) resume(step func() debugger.Stop) {
+	done := make(chan struct{})
+	s.running = done
+	go func() {
+		stop := step()
+		switch stop.Reason {
+		case debugger.Exited, debugger.Failed:
+			code := 0
+			if stop.Reason == debugger.Failed {
+				code = 1
+				s.output("stderr", stop.Err.Error()+"\n")
+			}
+			s.send(&event{Type: "event", Event: "exited", Body: map[string]any{"exitCode": code}})
+			s.send(&event{Type: "event", Event: "terminated"})
+			close(done)
+		default:
+			close(done)
+			s.send(&event{Type: "event", Event: "stopped", Body: map[string]any{
+				"reason":            string(stop.Reason),
+				"threadId":          threadID,
+				"allThreadsStopped": true,
+			}})
+		}
+	}()
+}
+
+// abort stops the program, waiting for it if it is running, so the exited and
+// terminated events are sent before abort returns.
+func (s *Server) abort() {
+	if !s.started {
+		return
+	}
+	if err := s.paused(); err == errRunning {
+		s.d.Abort()
+	} else if s.d.Running() {
+		s.resume(s.d.Terminate)
+	}
+	if s.running != nil {
+		<-s.running
+		s.running = nil
+	}
+}
+
+func (s *Server) output(category, text string) {
+	s.send(&event{Type: "event", Event: "output", Body: map[string]any{"category": category, "output": text}})
+}
+
+// outputWriter turns what the program prints into output events.
+type outputWriter struct {
+	s *Server
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.s.output("stdout", string(p))
+	return len(p), nil
+}
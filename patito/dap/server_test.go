@@ -0,0 +1,291 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patito/wire"
+)
+
+const program = `program p;
+var g : int;
+void inc(n : int) [
+  var t : int;
+  {
+    t = n + 1;
+    g = g + t;
+  }
+];
+main {
+  g = 1;
+  inc(g);
+  print("g is", g);
+}
+end`
+
+// client is a scripted DAP client talking to a Server over pipes.
+type client struct {
+	t      *testing.T
+	w      io.WriteCloser
+	r      *bufio.Reader
+	seq    int
+	events []map[string]any // events read while waiting for responses
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, r: bufio.NewReader(outR), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(inR, outW).Serve()
+		outW.Close()
+	}()
+	t.Cleanup(func() { inW.Close() })
+	return c
+}
+
+func writeProgram(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "p.pat")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (c *client) read() map[string]any {
+	c.t.Helper()
+	data, err := wire.Read(c.r)
+	if err != nil {
+		c.t.Fatalf("reading from server: %v", err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatalf("bad message %s: %v", data, err)
+	}
+	return msg
+}
+
+// request sends a request and returns its response, keeping events for later.
+func (c *client) request(command string, args any) map[string]any {
+	c.t.Helper()
+	c.seq++
+	raw, _ := json.Marshal(args)
+	if err := wire.Write(c.w, request{Seq: c.seq, Type: "request", Command: command, Arguments: raw}); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.read()
+		if msg["type"] == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg["request_seq"] != float64(c.seq) || msg["command"] != command {
+			c.t.Fatalf("response does not match request %d %s: %v", c.seq, command, msg)
+		}
+		return msg
+	}
+}
+
+// ok sends a request that must succeed and returns the response body.
+func (c *client) ok(command string, args any) map[string]any {
+	c.t.Helper()
+	resp := c.request(command, args)
+	if resp["success"] != true {
+		c.t.Fatalf("%s failed: %v", command, resp["message"])
+	}
+	body, _ := resp["body"].(map[string]any)
+	return body
+}
+
+// event waits for the next event called name, skipping output events, and
+// returns its body.
+func (c *client) event(name string) map[string]any {
+	c.t.Helper()
+	for {
+		var msg map[string]any
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg["type"] != "event" {
+			c.t.Fatalf("expected event %s, got %v", name, msg)
+		}
+		if msg["event"] == "output" && name != "output" {
+			continue
+		}
+		if msg["event"] != name {
+			c.t.Fatalf("expected event %s, got %v", name, msg)
+		}
+		body, _ := msg["body"].(map[string]any)
+		return body
+	}
+}
+
+func (c *client) stopped(reason string, line int) {
+	c.t.Helper()
+	body := c.event("stopped")
+	if body["reason"] != reason {
+		c.t.Fatalf("expected to stop for %s, got %v", reason, body)
+	}
+	frames := c.ok("stackTrace", map[string]any{"threadId": threadID})["stackFrames"].([]any)
+	top := frames[0].(map[string]any)
+	if top["line"] != float64(line) {
+		c.t.Fatalf("expected to stop on line %d, got %v", line, top)
+	}
+}
+
+func (c *client) start(path string, stopOnEntry bool, lines ...int) {
+	c.t.Helper()
+	c.ok("initialize", map[string]any{"adapterID": "patito"})
+	c.event("initialized")
+	c.ok("launch", launchArguments{Program: path, StopOnEntry: stopOnEntry})
+	bps := make([]sourceBreakpoint, len(lines))
+	for i, l := range lines {
+		bps[i] = sourceBreakpoint{Line: l}
+	}
+	c.ok("setBreakpoints", setBreakpointsArguments{Source: source{Path: path}, Breakpoints: bps})
+	c.ok("configurationDone", nil)
+}
+
+func (c *client) variables(ref int) string {
+	c.t.Helper()
+	vars := c.ok("variables", variablesArguments{VariablesReference: ref})["variables"].([]any)
+	var parts []string
+	for _, v := range vars {
+		v := v.(map[string]any)
+		parts = append(parts, v["name"].(string)+":"+v["type"].(string)+"="+v["value"].(string))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBreakpointsAndVariables(t *testing.T) {
+	c := newClient(t)
+	path := writeProgram(t, program)
+	c.start(path, false, 5)
+
+	c.stopped("breakpoint", 6) // line 5 has no statement
+	frames := c.ok("stackTrace", map[string]any{"threadId": threadID})["stackFrames"].([]any)
+	if len(frames) != 2 || frames[0].(map[string]any)["name"] != "inc" || frames[1].(map[string]any)["name"] != "main" {
+		t.Fatalf("unexpected stack: %v", frames)
+	}
+	scopes := c.ok("scopes", frameArguments{FrameID: 1})["scopes"].([]any)
+	if len(scopes) != 2 {
+		t.Fatalf("unexpected scopes: %v", scopes)
+	}
+	locals := int(scopes[0].(map[string]any)["variablesReference"].(float64))
+	if got := c.variables(locals); got != "n:int=1 t:int=0" {
+		t.Fatalf("locals of inc: %s", got)
+	}
+	if got := c.variables(globalsRef); got != "g:int=1" {
+		t.Fatalf("globals: %s", got)
+	}
+	if res := c.ok("evaluate", evaluateArguments{Expression: "n", FrameID: 1}); res["result"] != "1" || res["type"] != "int" {
+		t.Fatalf("evaluate n: %v", res)
+	}
+	if resp := c.request("evaluate", evaluateArguments{Expression: "n", FrameID: 2}); resp["success"] != false {
+		t.Fatalf("n should not be visible from main: %v", resp)
+	}
+
+	c.ok("continue", map[string]any{"threadId": threadID})
+	if out := c.event("output"); out["output"] != "g is 3\n" || out["category"] != "stdout" {
+		t.Fatalf("unexpected output: %v", out)
+	}
+	if body := c.event("exited"); body["exitCode"] != float64(0) {
+		t.Fatalf("unexpected exit: %v", body)
+	}
+	c.event("terminated")
+	c.ok("disconnect", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	c := newClient(t)
+	c.start(writeProgram(t, program), true)
+
+	c.stopped("entry", 11)
+	c.ok("next", map[string]any{"threadId": threadID})
+	c.stopped("step", 12)
+	c.ok("stepIn", map[string]any{"threadId": threadID})
+	c.stopped("step", 6)
+	c.ok("stepOut", map[string]any{"threadId": threadID})
+	c.stopped("step", 13)
+	c.ok("disconnect", nil)
+	c.event("exited")
+	c.event("terminated")
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The response to a resuming request must come before the events of the stop
+// it causes, even when the program ends at once.
+func TestResponseBeforeEvents(t *testing.T) {
+	path := writeProgram(t, "program p; var x : int; main {\n  x = 1;\n} end")
+	for range 20 {
+		c := newClient(t)
+		c.start(path, true)
+		c.stopped("entry", 2)
+		c.seq++
+		raw, _ := json.Marshal(map[string]any{"threadId": threadID})
+		if err := wire.Write(c.w, request{Seq: c.seq, Type: "request", Command: "continue", Arguments: raw}); err != nil {
+			t.Fatal(err)
+		}
+		resp := c.read()
+		if resp["type"] != "response" || resp["command"] != "continue" {
+			t.Fatalf("expected the continue response first, got %v", resp)
+		}
+		exited := c.read()
+		if exited["event"] != "exited" || exited["seq"].(float64) <= resp["seq"].(float64) {
+			t.Fatalf("exited should follow response %v, got %v", resp["seq"], exited)
+		}
+		c.event("terminated")
+		c.ok("disconnect", nil)
+		if err := <-c.done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRuntimeErrorAndLaunchErrors(t *testing.T) {
+	c := newClient(t)
+	c.ok("initialize", nil)
+	c.event("initialized")
+	if resp := c.request("launch", launchArguments{Program: writeProgram(t, "program p; main { x = 1; } end")}); resp["success"] != false ||
+		!strings.Contains(resp["message"].(string), "p.pat:1:19: undeclared variable x") {
+		t.Fatalf("semantic errors should fail the launch: %v", resp)
+	}
+
+	c.ok("launch", launchArguments{Program: writeProgram(t, "program p; var x : int; main { x = 1 / x; } end")})
+	c.ok("configurationDone", nil)
+	if out := c.event("output"); out["category"] != "stderr" || !strings.Contains(out["output"].(string), "integer division by zero") {
+		t.Fatalf("runtime error should be reported: %v", out)
+	}
+	if body := c.event("exited"); body["exitCode"] != float64(1) {
+		t.Fatalf("unexpected exit: %v", body)
+	}
+	c.event("terminated")
+	if resp := c.request("stackTrace", nil); resp["success"] != false {
+		t.Fatalf("stackTrace after exit should fail: %v", resp)
+	}
+}
+
+func TestDisconnectWhileRunning(t *testing.T) {
+	c := newClient(t)
+	c.start(writeProgram(t, "program p; var x : int; main { while (x >= 0) do { x = x + 1; }; } end"), false)
+	c.request("threads", nil)
+	c.ok("disconnect", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
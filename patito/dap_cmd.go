@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"patito/dap"
+)
+
+// runDAP implements "patito dap": a Debug Adapter Protocol server on stdin and
+// stdout, meant to be started by an editor.
+func runDAP(args []string) int {
+	fs := flag.NewFlagSet("dap", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "patito dap: the program is given by the launch request, not on the command line")
+		return 2
+	}
+	if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "patito dap: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"patito/debugger"
+)
+
+const debugHelp = `commands:
+  break N (b)      set a breakpoint on line N
+  clear N          remove the breakpoint on line N
+  run (r)          start the program, or continue it
+  continue (c)     run until the next breakpoint
+  step (s)         next statement, entering calls
+  next (n)         next statement, stepping over calls
+  out (o)          run until the current function returns
+  stack (bt)       show the call stack
+  locals [F]       show params and locals of frame F (default 0)
+  globals          show global vars
+  print NAME (p)   show a var as seen from the current frame
+  list (l)         show the source around the current line
+  quit (q)         leave the debugger
+`
+
+// quadHelp lists the commands that only -quads has.
+const quadHelp = `with -quads, steps run one quad, and:
+  break F:N        set a breakpoint on quad N of function F (or main)
+  clear F:N        remove the breakpoint on quad N of F
+  quads [F]        show the quads of F (default the current function)
+`
+
+// runDebug implements "patito debug": a command-line debugger that reads
+// commands from stdin while the program's own output goes to stdout.
+func runDebug(args []string) int {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	quads := fs.Bool("quads", false, "debug the quadruples the program lowers to, see patito ssa -quads")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || fs.Arg(0) == "-" {
+		fmt.Fprintln(os.Stderr, "patito debug: expected a source file (commands are read from stdin)")
+		return 2
+	}
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito debug: %v\n", err)
+		return 1
+	}
+
+	prog, dir, ok := check(name, src)
+	if !ok {
+		return 1
+	}
+
+	s := &debugSession{
+		lines: strings.Split(src, "\n"),
+		out:   os.Stdout,
+	}
+	if *quads {
+		s.quads = debugger.NewQuads(prog, dir, os.Stdout)
+		s.d = s.quads
+	} else {
+		s.d = debugger.New(prog, dir, os.Stdout)
+	}
+	s.loop(os.Stdin)
+	return 0
+}
+
+// debugTarget is what the commands drive: a *debugger.Debugger, or a
+// *debugger.Quads with -quads.
+type debugTarget interface {
+	SetBreakpoint(line int) (int, bool)
+	ClearBreakpoint(line int)
+	Continue() debugger.Stop
+	StepInto() debugger.Stop
+	StepOver() debugger.Stop
+	StepOut() debugger.Stop
+	Terminate() debugger.Stop
+	Locals(frame int) []debugger.Variable
+	Globals() []debugger.Variable
+	Lookup(frame int, name string) (debugger.Variable, bool)
+}
+
+type debugSession struct {
+	d     debugTarget
+	quads *debugger.Quads // the same as d with -quads, nil otherwise
+	lines []string
+	out   io.Writer
+	pos   int // line of the last stop
+}
+
+func (s *debugSession) loop(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, "(pdb) ")
+		if !scanner.Scan() {
+			s.d.Terminate()
+			fmt.Fprintln(s.out)
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !s.command(fields[0], fields[1:]) {
+			s.d.Terminate()
+			return
+		}
+	}
+}
+
+// command runs one debugger command; it returns false when the user quits.
+func (s *debugSession) command(cmd string, args []string) bool {
+	switch cmd {
+	case "break", "b", "clear":
+		if len(args) != 1 {
+			fmt.Fprintf(s.out, "usage: %s LINE\n", cmd)
+			return true
+		}
+		if s.quads != nil && strings.Contains(args[0], ":") {
+			s.quadBreakpoint(cmd, args[0])
+			return true
+		}
+		line, err := strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Fprintf(s.out, "invalid line %q\n", args[0])
+			return true
+		}
+		if cmd == "clear" {
+			s.d.ClearBreakpoint(line)
+			return true
+		}
+		if actual, ok := s.d.SetBreakpoint(line); ok {
+			fmt.Fprintf(s.out, "breakpoint at line %d\n", actual)
+		} else {
+			fmt.Fprintf(s.out, "no statement at or after line %d\n", line)
+		}
+	case "run", "r", "continue", "c":
+		s.stopped(s.d.Continue())
+	case "step", "s":
+		s.stopped(s.d.StepInto())
+	case "next", "n":
+		s.stopped(s.d.StepOver())
+	case "out", "o":
+		s.stopped(s.d.StepOut())
+	case "stack", "bt":
+		for i, f := range s.stack() {
+			fmt.Fprintf(s.out, "#%d %s\n", i, f)
+		}
+	case "quads":
+		if s.quads == nil {
+			fmt.Fprintln(s.out, "quads needs patito debug -quads")
+			return true
+		}
+		s.listQuads(args)
+	case "locals", "globals":
+		vars := s.d.Globals()
+		if cmd == "locals" {
+			frame := 0
+			if len(args) > 0 {
+				frame, _ = strconv.Atoi(args[0])
+			}
+			vars = s.d.Locals(frame)
+		}
+		for _, v := range vars {
+			fmt.Fprintf(s.out, "%s %s : %s = %v\n", v.Scope, v.Name, v.Type, v.Value)
+		}
+	case "print", "p":
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, "usage: print NAME")
+			return true
+		}
+		if v, ok := s.d.Lookup(0, args[0]); ok {
+			fmt.Fprintf(s.out, "%s : %s = %v\n", v.Name, v.Type, v.Value)
+		} else {
+			fmt.Fprintf(s.out, "no variable %s here\n", args[0])
+		}
+	case "list", "l":
+		s.list()
+	case "help", "h":
+		fmt.Fprint(s.out, debugHelp)
+		if s.quads != nil {
+			fmt.Fprint(s.out, quadHelp)
+		}
+	case "quit", "q":
+		return false
+	default:
+		fmt.Fprintf(s.out, "unknown command %q (try help)\n", cmd)
+	}
+	return true
+}
+
+func (s *debugSession) stopped(stop debugger.Stop) {
+	switch stop.Reason {
+	case debugger.Exited:
+		fmt.Fprintln(s.out, "program exited")
+	case debugger.Failed:
+		fmt.Fprintf(s.out, "program failed: %v\n", stop.Err)
+	default:
+		s.pos = stop.Pos.Line
+		fmt.Fprintf(s.out, "stopped (%s) in %s\n", stop.Reason, s.stack()[0])
+		s.printLine(s.pos, true)
+		if s.quads != nil {
+			f := s.quads.Stack()[0]
+			fmt.Fprintf(s.out, ">%4d | %s\n", f.Quad, s.quads.Code(f.Func)[f.Quad])
+		}
+	}
+}
+
+// stack describes the frames of the call stack, innermost first.
+func (s *debugSession) stack() []string {
+	var frames []string
+	if s.quads != nil {
+		for _, f := range s.quads.Stack() {
+			frames = append(frames, fmt.Sprintf("%s quad %d at %d:%d", f.Func, f.Quad, f.Pos.Line, f.Pos.Column))
+		}
+		return frames
+	}
+	for _, f := range s.d.(*debugger.Debugger).Stack() {
+		frames = append(frames, fmt.Sprintf("%s at %d:%d", f.Func, f.Pos.Line, f.Pos.Column))
+	}
+	return frames
+}
+
+// quadBreakpoint sets or clears, for cmd "clear", the breakpoint on the quad
+// that arg, F:N, names.
+func (s *debugSession) quadBreakpoint(cmd, arg string) {
+	fn, n, _ := strings.Cut(arg, ":")
+	index, err := strconv.Atoi(n)
+	if err != nil {
+		fmt.Fprintf(s.out, "invalid quad %q\n", arg)
+		return
+	}
+	q := debugger.QuadRef{Func: fn, Index: index}
+	switch {
+	case cmd == "clear":
+		s.quads.ClearQuadBreakpoint(q)
+	case s.quads.SetQuadBreakpoint(q):
+		fmt.Fprintf(s.out, "breakpoint at quad %d of %s\n", index, fn)
+	default:
+		fmt.Fprintf(s.out, "no quad %d in %s\n", index, fn)
+	}
+}
+
+// listQuads shows the quads of the function args names, or of the one that is
+// running, with the line each comes from.
+func (s *debugSession) listQuads(args []string) {
+	fn, current := "main", -1
+	if stack := s.quads.Stack(); len(stack) > 0 {
+		fn, current = stack[0].Func, stack[0].Quad
+	}
+	if len(args) > 0 && args[0] != fn {
+		fn, current = args[0], -1
+	}
+	code := s.quads.Code(fn)
+	if code == nil {
+		fmt.Fprintf(s.out, "no function %s\n", fn)
+		return
+	}
+	for i, q := range code {
+		marker := " "
+		if i == current {
+			marker = ">"
+		}
+		fmt.Fprintf(s.out, "%s%4d | %s  ; line %d\n", marker, i, q, q.Pos.Line)
+	}
+}
+
+func (s *debugSession) list() {
+	if s.pos == 0 {
+		fmt.Fprintln(s.out, "program is not stopped")
+		return
+	}
+	for l := max(1, s.pos-3); l <= min(len(s.lines), s.pos+3); l++ {
+		s.printLine(l, l == s.pos)
+	}
+}
+
+func (s *debugSession) printLine(line int, current bool) {
+	if line < 1 || line > len(s.lines) {
+		return
+	}
+	marker := " "
+	if current {
+		marker = ">"
+	}
+	fmt.Fprintf(s.out, "%s%4d | %s\n", marker, line, s.lines[line-1])
+}
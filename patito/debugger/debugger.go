@@ -0,0 +1,346 @@
+// Package debugger provides source-level debugging for Patito programs: line
+// breakpoints, stepping into, over and out of function calls, a call stack with
+// source positions and inspection of variables by name.
+//
+// The program runs on its own goroutine through the evaluator. Every method that
+// resumes it (Start, Continue, Step*) blocks until the program stops again, and
+// the inspection methods may only be used while it is stopped.
+//
+// Quads debugs the quadruples a program lowers to instead, with breakpoints
+// on quads and steps of one quad.
+package debugger
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/token"
+)
+
+// Reason tells why the program stopped.
+type Reason string
+
+const (
+	Entry      Reason = "entry"      // before the first statement
+	Breakpoint Reason = "breakpoint" // reached a line with a breakpoint
+	Step       Reason = "step"       // a step command finished
+	Exited     Reason = "exited"     // main finished (or the session was terminated)
+	Failed     Reason = "error"      // the program stopped with a runtime error
+)
+
+// Stop describes where and why the program stopped.
+type Stop struct {
+	Reason Reason
+	Pos    token.Position // statement about to run; zero once the program is over
+	Err    error          // runtime error when Reason is Failed
+}
+
+// StackFrame is one entry of the call stack.
+type StackFrame struct {
+	Func string         // function name, or "main"
+	Pos  token.Position // statement running in that frame (the call, for callers)
+}
+
+// Variable is a variable visible in a frame, resolved with the function directory.
+type Variable struct {
+	Name  string
+	Type  semantic.Type
+	Scope semantic.Scope
+	Value evaluator.Value
+}
+
+type mode int
+
+const (
+	modeContinue mode = iota
+	modeEntry
+	modeStepInto
+	modeStepOver
+	modeStepOut
+)
+
+var errTerminated = errors.New("terminated by the debugger")
+
+type Debugger struct {
+	prog  *ast.Program
+	dir   *semantic.FuncDir
+	eval  *evaluator.Evaluator
+	lines map[int]bool // lines where at least one statement starts
+
+	mu          sync.Mutex // guards breakpoints, which may change while the program runs
+	breakpoints map[int]bool
+
+	mode       mode
+	depth      int         // stack depth when the current step started
+	terminated atomic.Bool // set by Terminate or Abort, read by the program goroutine
+	started    bool
+	last       Stop // last stop, returned again once the program is over
+
+	resume chan struct{}
+	stops  chan Stop
+}
+
+// New prepares a debugging session for a program that passed semantic.Check.
+// Anything the program prints goes to out.
+func New(prog *ast.Program, dir *semantic.FuncDir, out io.Writer) *Debugger {
+	d := &Debugger{
+		prog:        prog,
+		dir:         dir,
+		eval:        evaluator.New(out),
+		lines:       map[int]bool{},
+		breakpoints: map[int]bool{},
+		resume:      make(chan struct{}),
+		stops:       make(chan Stop),
+	}
+	for _, fn := range prog.Funcs {
+		d.collectLines(fn.Body)
+	}
+	d.collectLines(prog.Main)
+	d.eval.OnStatement = d.onStatement
+	return d
+}
+
+func (d *Debugger) collectLines(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		d.lines[stmt.Position().Line] = true
+		switch s := stmt.(type) {
+		case *ast.IfStatement:
+			d.collectLines(s.Consequence)
+			if s.Alternative != nil {
+				d.collectLines(s.Alternative)
+			}
+		case *ast.WhileStatement:
+			d.collectLines(s.Body)
+		}
+	}
+}
+
+// ---------- Breakpoints ----------
+
+// SetBreakpoint puts a breakpoint on the first line at or after line where a
+// statement starts. It returns that line, or false if there is none.
+// Breakpoints may be changed at any time, even while the program runs.
+func (d *Debugger) SetBreakpoint(line int) (int, bool) {
+	last := 0
+	for l := range d.lines {
+		last = max(last, l)
+	}
+	for l := line; l <= last; l++ {
+		if d.lines[l] {
+			d.mu.Lock()
+			d.breakpoints[l] = true
+			d.mu.Unlock()
+			return l, true
+		}
+	}
+	return 0, false
+}
+
+func (d *Debugger) ClearBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, line)
+}
+
+func (d *Debugger) ClearBreakpoints() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = map[int]bool{}
+}
+
+// Breakpoints returns the lines that have a breakpoint, in order.
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lines := make([]int, 0, len(d.breakpoints))
+	for l := range d.breakpoints {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// ---------- Execution control ----------
+
+// Start runs the program until the first breakpoint, or stops before the first
+// statement when stopOnEntry is set.
+func (d *Debugger) Start(stopOnEntry bool) Stop {
+	if d.started {
+		return d.last
+	}
+	d.started = true
+	if stopOnEntry {
+		d.mode = modeEntry
+	}
+	go func() {
+		err := d.eval.Run(d.prog)
+		stop := Stop{Reason: Exited}
+		if err != nil && err != errTerminated {
+			stop = Stop{Reason: Failed, Err: err}
+			var rerr *evaluator.RuntimeError
+			if errors.As(err, &rerr) {
+				stop.Pos = rerr.Pos
+			}
+		}
+		d.stops <- stop
+	}()
+	d.last = <-d.stops
+	return d.last
+}
+
+// Continue runs until the next breakpoint or the end of the program.
+func (d *Debugger) Continue() Stop { return d.resumeWith(modeContinue) }
+
+// StepInto runs until the next statement, entering called functions.
+func (d *Debugger) StepInto() Stop { return d.resumeWith(modeStepInto) }
+
+// StepOver runs until the next statement of the current function (or of a caller
+// once the current function returns).
+func (d *Debugger) StepOver() Stop { return d.resumeWith(modeStepOver) }
+
+// StepOut runs until the current function returns to its caller.
+func (d *Debugger) StepOut() Stop { return d.resumeWith(modeStepOut) }
+
+// Terminate abandons the program. The session is over afterwards.
+func (d *Debugger) Terminate() Stop {
+	if d.Running() {
+		d.terminated.Store(true)
+		d.resume <- struct{}{}
+		d.last = <-d.stops
+	}
+	return d.last
+}
+
+// Abort asks a program that is currently running (inside Continue or a Step
+// call on another goroutine) to stop before its next statement. That call then
+// returns with Reason Exited.
+func (d *Debugger) Abort() {
+	d.terminated.Store(true)
+}
+
+// Running reports whether the program has started and is still paused mid-run.
+func (d *Debugger) Running() bool {
+	return d.started && d.last.Reason != Exited && d.last.Reason != Failed
+}
+
+func (d *Debugger) resumeWith(m mode) Stop {
+	if !d.started {
+		return d.Start(false)
+	}
+	if !d.Running() {
+		return d.last
+	}
+	d.mode = m
+	d.depth = len(d.eval.Frames())
+	d.resume <- struct{}{}
+	d.last = <-d.stops
+	return d.last
+}
+
+// onStatement runs on the program goroutine before each statement.
+func (d *Debugger) onStatement(stmt ast.Statement) error {
+	if d.terminated.Load() {
+		return errTerminated
+	}
+	depth := len(d.eval.Frames())
+	reason := Reason("")
+	switch {
+	case d.mode == modeEntry:
+		reason = Entry
+	case d.mode == modeStepInto,
+		d.mode == modeStepOver && depth <= d.depth,
+		d.mode == modeStepOut && depth < d.depth:
+		reason = Step
+	case d.hasBreakpoint(stmt.Position().Line):
+		reason = Breakpoint
+	}
+	if reason == "" {
+		return nil
+	}
+
+	d.stops <- Stop{Reason: reason, Pos: stmt.Position()}
+	<-d.resume
+	if d.terminated.Load() {
+		return errTerminated
+	}
+	return nil
+}
+
+func (d *Debugger) hasBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.breakpoints[line]
+}
+
+// ---------- Inspection ----------
+
+// Stack returns the call stack, innermost frame first.
+func (d *Debugger) Stack() []StackFrame {
+	frames := d.eval.Frames()
+	stack := make([]StackFrame, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		name := "main"
+		if frames[i].Func != nil {
+			name = frames[i].Func.Name.Value
+		}
+		stack = append(stack, StackFrame{Func: name, Pos: frames[i].Pos})
+	}
+	return stack
+}
+
+// Locals returns the params and local vars of a frame (0 is the innermost), in
+// the order of the function's variable table. Main has no locals.
+func (d *Debugger) Locals(frame int) []Variable {
+	f := d.frame(frame)
+	if f == nil || f.Func == nil {
+		return nil
+	}
+	fn := d.dir.Lookup(f.Func.Name.Value)
+	if fn == nil {
+		return nil
+	}
+	var vars []Variable
+	for _, v := range fn.Vars.All() {
+		vars = append(vars, Variable{Name: v.Name, Type: v.Type, Scope: v.Scope, Value: f.Vars[v.Name]})
+	}
+	return vars
+}
+
+// Globals returns the global vars in declaration order.
+func (d *Debugger) Globals() []Variable {
+	var vars []Variable
+	for _, v := range d.dir.Globals.All() {
+		val, _ := d.eval.Global(v.Name)
+		vars = append(vars, Variable{Name: v.Name, Type: v.Type, Scope: v.Scope, Value: val})
+	}
+	return vars
+}
+
+// Lookup resolves name the way code running in the given frame would.
+func (d *Debugger) Lookup(frame int, name string) (Variable, bool) {
+	for _, v := range d.Locals(frame) {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	for _, v := range d.Globals() {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variable{}, false
+}
+
+func (d *Debugger) frame(i int) *evaluator.Frame {
+	frames := d.eval.Frames()
+	if !d.Running() || i < 0 || i >= len(frames) {
+		return nil
+	}
+	return frames[len(frames)-1-i]
+}
@@ -0,0 +1,137 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+const program = `program p;
+var g : int;
+void inc(n : int) [
+  var t : int;
+  {
+    t = n + 1;
+    g = g + t;
+  }
+];
+main {
+  g = 1;
+  inc(g);
+
+  inc(10);
+  print(g);
+}
+end`
+
+func TestBreakpointsAndInspection(t *testing.T) {
+	d, out := newDebugger(t, program)
+
+	if line, ok := d.SetBreakpoint(13); !ok || line != 14 {
+		t.Fatalf("breakpoint on an empty line should move to 14, got %d %v", line, ok)
+	}
+	if _, ok := d.SetBreakpoint(99); ok {
+		t.Fatalf("breakpoint past the last statement should fail")
+	}
+	d.SetBreakpoint(7)
+
+	expectStop(t, d.Start(false), Breakpoint, 7)
+	expectStack(t, d, "inc 7:5", "main 12:3")
+	expectVars(t, d.Locals(0), "param n : int = 1", "local t : int = 2")
+	expectVars(t, d.Globals(), "global g : int = 1")
+	if v, ok := d.Lookup(0, "g"); !ok || v.Value.String() != "1" {
+		t.Fatalf("lookup of global g from inc failed: %+v", v)
+	}
+	if d.Locals(1) != nil {
+		t.Fatalf("main should have no locals")
+	}
+
+	expectStop(t, d.Continue(), Breakpoint, 14)
+	expectStop(t, d.Continue(), Breakpoint, 7)
+	expectVars(t, d.Locals(0), "param n : int = 10", "local t : int = 11")
+	d.ClearBreakpoints()
+	expectStop(t, d.Continue(), Exited, 0)
+	if out.String() != "14\n" {
+		t.Fatalf("program output wrong: %q", out.String())
+	}
+	expectStop(t, d.Continue(), Exited, 0)
+}
+
+func TestStepping(t *testing.T) {
+	d, _ := newDebugger(t, program)
+
+	expectStop(t, d.Start(true), Entry, 11)
+	expectStop(t, d.StepOver(), Step, 12)
+	expectStop(t, d.StepInto(), Step, 6)
+	expectStack(t, d, "inc 6:5", "main 12:3")
+	expectStop(t, d.StepOver(), Step, 7)
+	expectStop(t, d.StepOver(), Step, 14) // leaves inc and continues in main
+	expectStop(t, d.StepInto(), Step, 6)
+	expectStop(t, d.StepOut(), Step, 15)
+	expectStack(t, d, "main 15:3")
+	expectStop(t, d.StepOver(), Exited, 0)
+}
+
+func TestRuntimeErrorAndTerminate(t *testing.T) {
+	d, _ := newDebugger(t, "program p; var x : int; main {\n  x = 1 / x;\n} end")
+	stop := d.Start(false)
+	if stop.Reason != Failed || stop.Pos.Line != 2 || stop.Err == nil {
+		t.Fatalf("expected a runtime error on line 2, got %+v", stop)
+	}
+
+	d, out := newDebugger(t, program)
+	expectStop(t, d.Start(true), Entry, 11)
+	expectStop(t, d.Terminate(), Exited, 0)
+	if d.Running() || out.Len() != 0 {
+		t.Fatalf("program kept running after Terminate")
+	}
+}
+
+func newDebugger(t *testing.T, input string) (*Debugger, *bytes.Buffer) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	var out bytes.Buffer
+	return New(prog, dir, &out), &out
+}
+
+func expectStop(t *testing.T, stop Stop, reason Reason, line int) {
+	t.Helper()
+	if stop.Reason != reason || stop.Pos.Line != line {
+		t.Fatalf("expected stop (%s) at line %d, got (%s) at line %d: %v", reason, line, stop.Reason, stop.Pos.Line, stop.Err)
+	}
+}
+
+func expectStack(t *testing.T, d *Debugger, expected ...string) {
+	t.Helper()
+	var got []string
+	for _, f := range d.Stack() {
+		got = append(got, fmt.Sprintf("%s %d:%d", f.Func, f.Pos.Line, f.Pos.Column))
+	}
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("stack wrong. expected=%q, got=%q", expected, got)
+	}
+}
+
+func expectVars(t *testing.T, vars []Variable, expected ...string) {
+	t.Helper()
+	var got []string
+	for _, v := range vars {
+		got = append(got, fmt.Sprintf("%s %s : %s = %s", v.Scope, v.Name, v.Type, v.Value))
+	}
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("vars wrong. expected=%q, got=%q", expected, got)
+	}
+}
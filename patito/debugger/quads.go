@@ -0,0 +1,294 @@
+package debugger
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/ssa"
+	"patito/token"
+)
+
+// QuadRef names a quad: the function it belongs to, or "main", and its index in
+// the function's lowered code.
+type QuadRef struct {
+	Func  string
+	Index int
+}
+
+// QuadFrame is one entry of the call stack of a Quads session.
+type QuadFrame struct {
+	Func string
+	Quad int            // next quad to run in that frame (the gosub, for callers)
+	Pos  token.Position // where that quad comes from in the source
+	act  *ssa.Activation
+}
+
+// Quads debugs the lowered form of a program, see ssa.Lower: breakpoints go on
+// quads as well as on lines, and a step runs one quad, or a whole gosub. The
+// positions the quads keep map every stop back to the source.
+//
+// Unlike Debugger, Quads runs the program on the calling goroutine, one quad
+// at a time, so its methods return once the program stops and must not be
+// called concurrently.
+type Quads struct {
+	dir *semantic.FuncDir
+	m   *ssa.Machine
+
+	quads map[QuadRef]bool
+	lines map[int]bool            // where a line breakpoint may go: lines some quad comes from
+	bps   map[int]bool            // line breakpoints
+	prev  map[*ssa.Activation]int // line of the quad each call ran last
+
+	started bool
+	last    Stop
+}
+
+// NewQuads prepares a debugging session of the quads of a program that passed
+// semantic.Check. Anything the program prints goes to out.
+func NewQuads(prog *ast.Program, dir *semantic.FuncDir, out io.Writer) *Quads {
+	d := &Quads{
+		dir:   dir,
+		m:     ssa.NewMachine(ssa.Build(prog, dir), out),
+		quads: map[QuadRef]bool{},
+		lines: map[int]bool{},
+		bps:   map[int]bool{},
+		prev:  map[*ssa.Activation]int{},
+	}
+	for _, code := range d.m.Code {
+		for _, q := range code {
+			d.lines[q.Pos.Line] = true
+		}
+	}
+	return d
+}
+
+// Code returns the quads of the function called name, or of main.
+func (d *Quads) Code(name string) []ssa.Quad { return d.m.Code[name] }
+
+// ---------- Breakpoints ----------
+
+// SetQuadBreakpoint puts a breakpoint on a quad, and reports whether it exists.
+func (d *Quads) SetQuadBreakpoint(q QuadRef) bool {
+	if q.Index < 0 || q.Index >= len(d.m.Code[q.Func]) {
+		return false
+	}
+	d.quads[q] = true
+	return true
+}
+
+func (d *Quads) ClearQuadBreakpoint(q QuadRef) { delete(d.quads, q) }
+
+// SetBreakpoint puts a breakpoint on the first line at or after line that some
+// quad comes from, and returns that line, or false if there is none. The
+// program stops before the first quad of the line each time it enters it.
+func (d *Quads) SetBreakpoint(line int) (int, bool) {
+	last := 0
+	for l := range d.lines {
+		last = max(last, l)
+	}
+	for l := line; l <= last; l++ {
+		if d.lines[l] {
+			d.bps[l] = true
+			return l, true
+		}
+	}
+	return 0, false
+}
+
+func (d *Quads) ClearBreakpoint(line int) { delete(d.bps, line) }
+
+func (d *Quads) ClearBreakpoints() {
+	d.quads = map[QuadRef]bool{}
+	d.bps = map[int]bool{}
+}
+
+// ---------- Execution control ----------
+
+// Start runs the program until the first breakpoint, or stops before the first
+// quad of main when stopOnEntry is set.
+func (d *Quads) Start(stopOnEntry bool) Stop {
+	if d.started {
+		return d.last
+	}
+	d.started = true
+	if stopOnEntry {
+		d.last = Stop{Reason: Entry, Pos: d.m.Next().Pos}
+		return d.last
+	}
+	d.last = Stop{Reason: Step} // so that Running holds
+	return d.run(modeContinue)
+}
+
+// Continue runs until the next breakpoint or the end of the program.
+func (d *Quads) Continue() Stop { return d.resumeWith(modeContinue) }
+
+// StepInto runs one quad: after a gosub, the program stops at the first quad
+// of the callee.
+func (d *Quads) StepInto() Stop { return d.resumeWith(modeStepInto) }
+
+// StepOver runs one quad, and the whole call when it is a gosub.
+func (d *Quads) StepOver() Stop { return d.resumeWith(modeStepOver) }
+
+// StepOut runs until the current function returns to its caller.
+func (d *Quads) StepOut() Stop { return d.resumeWith(modeStepOut) }
+
+// Terminate abandons the program. The session is over afterwards.
+func (d *Quads) Terminate() Stop {
+	if d.Running() {
+		d.last = Stop{Reason: Exited}
+	}
+	return d.last
+}
+
+// Running reports whether the program has started and is still paused mid-run.
+func (d *Quads) Running() bool {
+	return d.started && d.last.Reason != Exited && d.last.Reason != Failed
+}
+
+func (d *Quads) resumeWith(m mode) Stop {
+	if !d.started {
+		return d.Start(false)
+	}
+	if !d.Running() {
+		return d.last
+	}
+	return d.run(m)
+}
+
+// run steps the machine until m, or a breakpoint, stops it. The quad it
+// resumes from never stops it again.
+func (d *Quads) run(m mode) Stop {
+	depth := len(d.m.Frames)
+	for {
+		n := len(d.m.Frames)
+		a := d.m.Frames[n-1]
+		d.prev[a] = d.m.Next().Pos.Line
+		if err := d.m.Step(); err != nil {
+			d.last = Stop{Reason: Failed, Err: err}
+			var rerr *evaluator.RuntimeError
+			if errors.As(err, &rerr) {
+				d.last.Pos = rerr.Pos
+			}
+			return d.last
+		}
+		if len(d.m.Frames) < n {
+			delete(d.prev, a) // returned
+		}
+		if d.m.Done() {
+			d.last = Stop{Reason: Exited}
+			return d.last
+		}
+		reason := Reason("")
+		n = len(d.m.Frames)
+		switch {
+		case m == modeStepInto,
+			m == modeStepOver && n <= depth,
+			m == modeStepOut && n < depth:
+			reason = Step
+		case d.hasBreakpoint():
+			reason = Breakpoint
+		}
+		if reason != "" {
+			d.last = Stop{Reason: reason, Pos: d.m.Next().Pos}
+			return d.last
+		}
+	}
+}
+
+// hasBreakpoint reports whether the next quad has a breakpoint, or is the
+// first its call runs of a line that has one.
+func (d *Quads) hasBreakpoint() bool {
+	a := d.m.Frames[len(d.m.Frames)-1]
+	if d.quads[QuadRef{a.Func, a.PC}] {
+		return true
+	}
+	line := d.m.Next().Pos.Line
+	prev, ok := d.prev[a]
+	return d.bps[line] && (!ok || prev != line)
+}
+
+// ---------- Inspection ----------
+
+// Stack returns the call stack, innermost frame first.
+func (d *Quads) Stack() []QuadFrame {
+	if !d.Running() {
+		return nil
+	}
+	stack := make([]QuadFrame, 0, len(d.m.Frames))
+	for i := len(d.m.Frames) - 1; i >= 0; i-- {
+		a := d.m.Frames[i]
+		pc := a.PC
+		if i < len(d.m.Frames)-1 {
+			pc-- // the gosub
+		}
+		stack = append(stack, QuadFrame{Func: a.Func, Quad: pc, Pos: d.m.Code[a.Func][pc].Pos, act: a})
+	}
+	return stack
+}
+
+// Locals returns the params of a frame (0 is the innermost) in declaration
+// order, followed by the temps it has written. The local vars of the source
+// only live in temps once lowered, so they have no name of their own.
+func (d *Quads) Locals(frame int) []Variable {
+	stack := d.Stack()
+	if frame < 0 || frame >= len(stack) {
+		return nil
+	}
+	a := stack[frame].act
+	var vars []Variable
+	params := map[string]bool{}
+	if fn := d.dir.Lookup(a.Func); fn != nil {
+		for _, v := range fn.Params {
+			params[v.Name] = true
+			vars = append(vars, Variable{Name: v.Name, Type: v.Type, Scope: semantic.Param, Value: a.Vars[v.Name]})
+		}
+	}
+	var temps []Variable
+	for name, val := range a.Vars {
+		if !params[name] {
+			temps = append(temps, Variable{Name: name, Type: tempType[name[:2]], Scope: semantic.Local, Value: val})
+		}
+	}
+	slices.SortFunc(temps, func(x, y Variable) int {
+		if c := cmp.Compare(x.Name[:2], y.Name[:2]); c != 0 {
+			return c
+		}
+		i, _ := strconv.Atoi(x.Name[2:])
+		j, _ := strconv.Atoi(y.Name[2:])
+		return cmp.Compare(i, j)
+	})
+	return append(vars, temps...)
+}
+
+var tempType = map[string]semantic.Type{"_i": semantic.Int, "_f": semantic.Float, "_b": semantic.Bool}
+
+// Globals returns the global vars in declaration order.
+func (d *Quads) Globals() []Variable {
+	var vars []Variable
+	for _, v := range d.dir.Globals.All() {
+		vars = append(vars, Variable{Name: v.Name, Type: v.Type, Scope: v.Scope, Value: d.m.Globals[v.Name]})
+	}
+	return vars
+}
+
+// Lookup resolves name, a param, temp or global, the way the quads of the
+// given frame would.
+func (d *Quads) Lookup(frame int, name string) (Variable, bool) {
+	for _, v := range d.Locals(frame) {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	for _, v := range d.Globals() {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variable{}, false
+}
@@ -0,0 +1,129 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+// The quads of program:
+//
+//	inc:  0 = n _ _i0      (line 6)    main: 0 = 1 _ g          (line 11)
+//	      1 = g _ _i1      (line 6)          1 param 1 _ n      (line 12)
+//	      2 + _i0 1 _i0    (line 6)          2 gosub inc        (line 12)
+//	      3 + _i1 _i0 _i0  (line 7)          3 = g _ _i0        (line 12)
+//	      4 = _i0 _ g      (line 7)          4 param 10 _ n     (line 14)
+//	      5 endfunc        (line 7)          5 gosub inc        (line 14)
+//	                                         6 = g _ _i0        (line 14)
+//	                                         7 print _i0        (line 15)
+//	                                         8 println          (line 15)
+//	                                         9 end              (line 15)
+
+func TestQuadBreakpoints(t *testing.T) {
+	d, out := newQuads(t, program)
+
+	if d.SetQuadBreakpoint(QuadRef{"inc", 6}) || d.SetQuadBreakpoint(QuadRef{"f", 0}) {
+		t.Fatalf("breakpoints on quads that do not exist should fail")
+	}
+	d.SetQuadBreakpoint(QuadRef{"inc", 3})
+
+	expectStop(t, d.Start(false), Breakpoint, 7)
+	expectQuadStack(t, d, "inc 3 7:9", "main 2 12:3")
+	expectVars(t, d.Locals(0), "param n : int = 1", "local _i0 : int = 2", "local _i1 : int = 1")
+	if v, ok := d.Lookup(1, "g"); !ok || v.Value.String() != "1" {
+		t.Fatalf("lookup of global g from main failed: %+v", v)
+	}
+	expectStop(t, d.Continue(), Breakpoint, 7)
+	expectVars(t, d.Locals(0), "param n : int = 10", "local _i0 : int = 11", "local _i1 : int = 3")
+	d.ClearQuadBreakpoint(QuadRef{"inc", 3})
+	expectStop(t, d.Continue(), Exited, 0)
+	if out.String() != "14\n" {
+		t.Fatalf("program output wrong: %q", out.String())
+	}
+}
+
+// A line breakpoint stops at the first quad of the line, and not again at
+// the quads of the same line that run after the call returns.
+func TestQuadLineBreakpoints(t *testing.T) {
+	d, _ := newQuads(t, program)
+
+	if line, ok := d.SetBreakpoint(13); !ok || line != 14 {
+		t.Fatalf("breakpoint on an empty line should move to 14, got %d %v", line, ok)
+	}
+	d.SetBreakpoint(6)
+	expectStop(t, d.Start(false), Breakpoint, 6)
+	expectQuadStack(t, d, "inc 0 6:9", "main 2 12:3")
+	expectStop(t, d.Continue(), Breakpoint, 14)
+	expectQuadStack(t, d, "main 4 14:3")
+	expectStop(t, d.Continue(), Breakpoint, 6)
+	d.ClearBreakpoint(6)
+	expectStop(t, d.Continue(), Exited, 0)
+}
+
+func TestQuadStepping(t *testing.T) {
+	d, _ := newQuads(t, program)
+
+	expectStop(t, d.Start(true), Entry, 11)
+	expectStop(t, d.StepInto(), Step, 12)
+	expectStop(t, d.StepInto(), Step, 12)
+	expectQuadStack(t, d, "main 2 12:3")
+	expectStop(t, d.StepInto(), Step, 6) // into the gosub
+	expectQuadStack(t, d, "inc 0 6:9", "main 2 12:3")
+	expectStop(t, d.StepOut(), Step, 12)
+	expectQuadStack(t, d, "main 3 12:3")
+	if v, _ := d.Lookup(0, "g"); v.Value.String() != "3" {
+		t.Fatalf("g should be 3 after the first call, got %v", v.Value)
+	}
+	d.StepOver()
+	d.StepOver()
+	expectStop(t, d.StepOver(), Step, 14) // over the whole gosub
+	expectQuadStack(t, d, "main 6 14:3")
+	expectStop(t, d.Continue(), Exited, 0)
+}
+
+func TestQuadRuntimeErrorAndTerminate(t *testing.T) {
+	d, _ := newQuads(t, "program p; var x : int; main {\n  x = 1 / x;\n} end")
+	stop := d.Start(false)
+	if stop.Reason != Failed || stop.Pos.Line != 2 || stop.Err == nil {
+		t.Fatalf("expected a runtime error on line 2, got %+v", stop)
+	}
+
+	d, out := newQuads(t, program)
+	expectStop(t, d.Start(true), Entry, 11)
+	expectStop(t, d.Terminate(), Exited, 0)
+	expectStop(t, d.Continue(), Exited, 0)
+	if d.Running() || out.Len() != 0 {
+		t.Fatalf("program kept running after Terminate")
+	}
+}
+
+func newQuads(t *testing.T, input string) (*Quads, *bytes.Buffer) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	var out bytes.Buffer
+	return NewQuads(prog, dir, &out), &out
+}
+
+func expectQuadStack(t *testing.T, d *Quads, expected ...string) {
+	t.Helper()
+	var got []string
+	for _, f := range d.Stack() {
+		got = append(got, fmt.Sprintf("%s %d %d:%d", f.Func, f.Quad, f.Pos.Line, f.Pos.Column))
+	}
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("stack wrong. expected=%q, got=%q", expected, got)
+	}
+}
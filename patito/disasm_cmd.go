@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"patito/bytecode"
+	"patito/optimize"
+	"patito/regvm"
+)
+
+// runDisasm implements "patito disasm": it compiles a program to the bytecode
+// that "patito run -engine=stack" runs, or with -register to the code of the
+// register VM, and lists it.
+func runDisasm(args []string) int {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	register := fs.Bool("register", false, "list the code of the register VM")
+	level := optFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito disasm: %v\n", err)
+		return 1
+	}
+	prog, dir, ok := check(name, src)
+	if !ok {
+		return 1
+	}
+	if *level > 0 {
+		if errs := optimize.Optimize(prog, dir, src); len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+			}
+			return 1
+		}
+	}
+	var p fmt.Stringer
+	if *register {
+		p, err = regvm.Compile(prog, dir)
+	} else {
+		p, err = bytecode.Compile(prog, dir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito disasm: %v\n", err)
+		return 1
+	}
+	fmt.Print(p)
+	return 0
+}
@@ -0,0 +1,335 @@
+// Package evaluator runs Patito programs by walking the AST, in the style of the
+// evaluator from "Writing an Interpreter in Go". It expects trees that already
+// passed semantic.Check, so it only reports errors that depend on runtime values.
+package evaluator
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"patito/ast"
+	"patito/semantic"
+	"patito/token"
+)
+
+// RuntimeError is returned when a program fails while running (e.g. division by zero).
+// A division by zero or a stack overflow also holds the calls that were active.
+type RuntimeError struct {
+	Pos    token.Position
+	Msg    string
+	Stack  []StackFrame // innermost first, the last being main unless Elided
+	Elided int          // frames of the outermost calls left out of Stack
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%d:%d: runtime error: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// Trace formats the stack of e, see the function Trace.
+func (e *RuntimeError) Trace(name string) string { return Trace(name, e.Stack, e.Elided) }
+
+// Frame is one activation record: the function being run and its params and
+// locals. The bottom frame belongs to main and has no Vars of its own.
+type Frame struct {
+	Func *ast.FuncDecl // nil for main
+	Vars map[string]Value
+	Args []Value        // the params as the call passed them
+	Pos  token.Position // statement currently running in this frame
+}
+
+// Evaluator holds the global memory and the declared functions. Every call pushes
+// a fresh frame for its params and locals; globals are shared.
+type Evaluator struct {
+	out     io.Writer
+	funcs   map[string]*ast.FuncDecl
+	globals map[string]Value
+	frames  []*Frame
+	blocks  int // blocks being run, one inside the other
+
+	// OnStatement, when set, runs before every statement except blocks. Returning
+	// an error stops the program with that error; the debugger uses it to pause.
+	OnStatement func(stmt ast.Statement) error
+}
+
+func New(out io.Writer) *Evaluator {
+	return &Evaluator{
+		out:     out,
+		funcs:   map[string]*ast.FuncDecl{},
+		globals: map[string]Value{},
+		frames:  []*Frame{{}},
+	}
+}
+
+// Run declares the program's globals and functions and executes main.
+func (e *Evaluator) Run(prog *ast.Program) error {
+	e.DeclareVars(prog.Vars)
+	for _, fn := range prog.Funcs {
+		e.DeclareFunc(fn)
+	}
+	return e.Exec(prog.Main)
+}
+
+// DeclareVars allocates global variables, initialized to zero.
+func (e *Evaluator) DeclareVars(decls []*ast.VarDecl) {
+	allocate(e.globals, decls)
+}
+
+func (e *Evaluator) DeclareFunc(fn *ast.FuncDecl) {
+	e.funcs[fn.Name.Value] = fn
+}
+
+// Global returns the current value of a global variable.
+func (e *Evaluator) Global(name string) (Value, bool) {
+	v, ok := e.globals[name]
+	return v, ok
+}
+
+func allocate(mem map[string]Value, decls []*ast.VarDecl) {
+	for _, decl := range decls {
+		t := semantic.TypeOf(decl.Type)
+		for _, id := range decl.Names {
+			mem[id.Value] = zero(t)
+		}
+	}
+}
+
+// Frames returns the call stack, main first. It must not be modified.
+func (e *Evaluator) Frames() []*Frame { return e.frames }
+
+// memory returns the map that holds name: the current frame first, then globals.
+func (e *Evaluator) memory(name string) map[string]Value {
+	top := e.frames[len(e.frames)-1]
+	if _, ok := top.Vars[name]; ok {
+		return top.Vars
+	}
+	return e.globals
+}
+
+// ---------- Statements ----------
+
+// Exec runs one statement.
+func (e *Evaluator) Exec(stmt ast.Statement) error {
+	if _, ok := stmt.(*ast.BlockStatement); !ok {
+		e.frames[len(e.frames)-1].Pos = stmt.Position()
+		if e.OnStatement != nil {
+			if err := e.OnStatement(stmt); err != nil {
+				return err
+			}
+		}
+	}
+	switch s := stmt.(type) {
+	case *ast.BlockStatement:
+		if e.blocks == maxBlocks {
+			return e.fail(s.Pos, blocksOverflow)
+		}
+		e.blocks++
+		err := e.block(s)
+		e.blocks--
+		return err
+	case *ast.AssignStatement:
+		v, err := e.Eval(s.Value)
+		if err != nil {
+			return err
+		}
+		mem := e.memory(s.Name.Value)
+		mem[s.Name.Value] = convert(mem[s.Name.Value].Type(), v)
+	case *ast.PrintStatement:
+		return e.print(s)
+	case *ast.IfStatement:
+		cond, err := e.Eval(s.Condition)
+		if err != nil {
+			return err
+		}
+		if cond == Bool(true) {
+			return e.Exec(s.Consequence)
+		} else if s.Alternative != nil {
+			return e.Exec(s.Alternative)
+		}
+	case *ast.WhileStatement:
+		for {
+			cond, err := e.Eval(s.Condition)
+			if err != nil {
+				return err
+			}
+			if cond != Bool(true) {
+				break
+			}
+			if err := e.Exec(s.Body); err != nil {
+				return err
+			}
+		}
+	case *ast.CallStatement:
+		return e.call(s.Call)
+	default:
+		return &RuntimeError{Pos: stmt.Position(), Msg: fmt.Sprintf("unexpected statement %T", stmt)}
+	}
+	return nil
+}
+
+func (e *Evaluator) block(s *ast.BlockStatement) error {
+	for _, st := range s.Statements {
+		if err := e.Exec(st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// print writes its arguments separated by spaces and ends the line.
+func (e *Evaluator) print(s *ast.PrintStatement) error {
+	parts := make([]string, len(s.Expressions))
+	for i, exp := range s.Expressions {
+		if str, ok := exp.(*ast.StringLiteral); ok {
+			parts[i] = str.Value
+			continue
+		}
+		v, err := e.Eval(exp)
+		if err != nil {
+			return err
+		}
+		parts[i] = v.String()
+	}
+	_, err := fmt.Fprintln(e.out, strings.Join(parts, " "))
+	return err
+}
+
+func (e *Evaluator) call(call *ast.CallExpression) error {
+	fn, ok := e.funcs[call.Function.Value]
+	if !ok {
+		return &RuntimeError{Pos: call.Pos, Msg: "undeclared function " + call.Function.Value}
+	}
+	// Arguments are evaluated in the caller's frame before pushing the new one
+	frame := &Frame{Func: fn, Vars: map[string]Value{}, Args: make([]Value, len(fn.Params)), Pos: fn.Pos}
+	for i, p := range fn.Params {
+		v, err := e.Eval(call.Arguments[i])
+		if err != nil {
+			return err
+		}
+		frame.Args[i] = convert(semantic.TypeOf(p.Type), v)
+		frame.Vars[p.Name.Value] = frame.Args[i]
+	}
+	allocate(frame.Vars, fn.Vars)
+	if len(e.frames) > MaxCalls {
+		return e.fail(call.Pos, StackOverflow)
+	}
+
+	e.frames = append(e.frames, frame)
+	defer func() { e.frames = e.frames[:len(e.frames)-1] }()
+	return e.Exec(fn.Body)
+}
+
+// ---------- Expressions ----------
+
+// Eval computes the value of an expression.
+func (e *Evaluator) Eval(exp ast.Expression) (Value, error) {
+	switch x := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int(x.Value), nil
+	case *ast.FloatLiteral:
+		return Float(x.Value), nil
+	case *ast.BooleanLiteral:
+		return Bool(x.Value), nil
+	case *ast.Identifier:
+		v, ok := e.memory(x.Value)[x.Value]
+		if !ok {
+			return nil, &RuntimeError{Pos: x.Pos, Msg: "undeclared variable " + x.Value}
+		}
+		return v, nil
+	case *ast.PrefixExpression:
+		v, err := e.Eval(x.Right)
+		if err != nil {
+			return nil, err
+		}
+		if x.Operator == "-" {
+			switch n := v.(type) {
+			case Int:
+				return -n, nil
+			case Float:
+				return -n, nil
+			}
+		}
+		return v, nil
+	case *ast.InfixExpression:
+		left, err := e.Eval(x.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.Eval(x.Right)
+		if err != nil {
+			return nil, err
+		}
+		v, err := binary(x, left, right)
+		if err != nil {
+			return nil, e.fail(x.Right.Position(), err.Error())
+		}
+		return v, nil
+	}
+	return nil, &RuntimeError{Pos: exp.Position(), Msg: fmt.Sprintf("cannot evaluate %T", exp)}
+}
+
+// fail returns a *RuntimeError for msg at pos with the calls that are active.
+func (e *Evaluator) fail(pos token.Position, msg string) *RuntimeError {
+	err := &RuntimeError{Pos: pos, Msg: msg}
+	err.Stack, err.Elided = e.trace(pos)
+	return err
+}
+
+// binary applies an operator following the semantic cube: int with int stays int,
+// anything mixed with a float is computed in float. Its error is the message of
+// a division by zero.
+func binary(x *ast.InfixExpression, left, right Value) (Value, error) {
+	l, lok := left.(Int)
+	r, rok := right.(Int)
+	if lok && rok {
+		switch x.Operator {
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/":
+			if r == 0 {
+				return nil, errors.New("integer division by zero")
+			}
+			return l / r, nil
+		}
+		// Compare the ordering instead of the values: large ints lose precision as float64
+		return compare(x.Operator, float64(cmp.Compare(l, r)), 0), nil
+	}
+
+	lf, rf := toFloat(left), toFloat(right)
+	switch x.Operator {
+	case "+":
+		return Float(lf + rf), nil
+	case "-":
+		return Float(lf - rf), nil
+	case "*":
+		return Float(lf * rf), nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.New("float division by zero")
+		}
+		return Float(lf / rf), nil
+	}
+	return compare(x.Operator, lf, rf), nil
+}
+
+func compare(op string, l, r float64) Bool {
+	switch op {
+	case "<":
+		return l < r
+	case ">":
+		return l > r
+	case "<=":
+		return l <= r
+	case ">=":
+		return l >= r
+	case "==":
+		return l == r
+	}
+	return l != r
+}
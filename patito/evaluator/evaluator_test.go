@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"testing"
+
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"main { print(1 + 2 * 3, 7 / 2, 7 / 2.0, -3 - -4); }", "7 3 3.5 1\n"},
+		{"main { print(\"a\", 1 < 2, 2.5 >= 3, 2 == 2.0, 1 != 1); }", "a true false true false\n"},
+		{"var f : float; main { f = 3; print(f / 2, 1.0 / 3); }", "1.5 0.333333\n"},
+		{"var i, s : int; main { while (i < 5) do { i = i + 1; s = s + i; }; print(s); }", "15\n"},
+		{"var x : int; main { if (x > 0) { print(\"pos\"); } else { print(\"non-pos\"); }; }", "non-pos\n"},
+		{"var n : int;\nvoid fact(k : int, acc : int) [ { if (k > 1) { fact(k - 1, acc * k); } else { n = acc; }; } ];\nmain { fact(10, 1); print(n); }", "3628800\n"},
+		{"var x : int;\nvoid f(x : float) [ var y : int; { y = 7; x = x / 2; print(x, y); } ];\nmain { x = 5; f(x); print(x); }", "2.5 7\n5\n"},
+		{"var big : int; main { big = 9223372036854775807; print(big + 1, big > big - 1); }", "-9223372036854775808 true\n"},
+	}
+
+	for i, tt := range tests {
+		out, err := run(t, "program p; "+tt.input+" end")
+		if err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %v", i, err)
+		}
+		if out != tt.expected {
+			t.Fatalf("tests[%d] - output wrong. expected=%q, got=%q", i, tt.expected, out)
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var x : int; main { print(\"before\"); x = 1 / x; }", "1:57: runtime error: integer division by zero"},
+		{"var x : float; main { x = 2.5 / (x * 3); }", "1:45: runtime error: float division by zero"},
+	}
+
+	for i, tt := range tests {
+		_, err := run(t, "program p; "+tt.input+" end")
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("tests[%d] - expected *RuntimeError, got %v", i, err)
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("tests[%d] - expected=%q, got=%q", i, tt.expected, err.Error())
+		}
+	}
+}
+
+// TestNestedBlocks checks that calls nested in many blocks stop with a stack
+// overflow before they overflow the Go stack of the evaluator.
+func TestNestedBlocks(t *testing.T) {
+	body := "down(k + 1);"
+	for i := range 30 {
+		body = fmt.Sprintf("if (k > %d) { %s };", -i-1, body)
+	}
+	_, err := run(t, "program p; void down(k : int) [ { "+body+" } ]; main { down(0); } end")
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) || rerr.Msg != blocksOverflow {
+		t.Fatalf("expected a stack overflow, got %v", err)
+	}
+	if len(rerr.Stack) != MaxTrace || rerr.Stack[0].Func != "down" {
+		t.Errorf("expected %d frames of down, got %d starting with %s", MaxTrace, len(rerr.Stack), rerr.Stack[0])
+	}
+}
+
+// TestOverflowStack checks that MaxCalls and maxBlocks stop a program well
+// before it takes the Go stack it may: they must hold with -race too, which
+// takes more stack per call. The Go limit is lowered to a quarter of the
+// default to keep that margin.
+func TestOverflowStack(t *testing.T) {
+	defer debug.SetMaxStack(debug.SetMaxStack(256 << 20))
+	nested := "down(k + 1);"
+	for i := range 10 {
+		nested = fmt.Sprintf("if (k > %d) { %s };", -i-1, nested)
+	}
+	tests := []struct {
+		body string
+		msg  string
+	}{
+		{"n = k; if (k > -1) { down(k + 1); };", StackOverflow},
+		{"while (k > -1) do { down(k + 1); };", StackOverflow},
+		{nested, blocksOverflow},
+	}
+	for i, tt := range tests {
+		_, err := run(t, "program p; var n : int; void down(k : int) [ { "+tt.body+" } ]; main { down(0); } end")
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) || rerr.Msg != tt.msg {
+			t.Errorf("tests[%d] - expected %q, got %v", i, tt.msg, err)
+		}
+	}
+}
+
+func run(t *testing.T, input string) (string, error) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if _, errs := semantic.Check(prog); len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	var out bytes.Buffer
+	err := New(&out).Run(prog)
+	return out.String(), err
+}
@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"patito/semantic"
+	"patito/token"
+)
+
+// MaxCalls is the most calls that may be active at once, in the evaluator and
+// in the VMs alike, so that runaway recursion fails like any other runtime
+// error instead of taking all the stack or memory of the host. With maxBlocks,
+// it keeps the evaluator within a quarter of the 1 GB of stack Go allows a
+// goroutine, even with -race, which takes about twice as much per call.
+const MaxCalls = 1 << 16
+
+// MaxTrace is the most frames a stack trace keeps.
+const MaxTrace = 100
+
+// StackOverflow is the message of the error that a call beyond MaxCalls
+// raises.
+var StackOverflow = fmt.Sprintf("stack overflow: more than %d calls active", MaxCalls)
+
+// maxBlocks is the most blocks the evaluator runs one inside the other, calls
+// included. Each one takes Go stack, so a program with calls nested in many
+// ifs or whiles would overflow that first without this limit, even within
+// MaxCalls. It is four times MaxCalls, so that a recursion from within an if
+// or a while still stops at MaxCalls first.
+const maxBlocks = 1 << 18
+
+var blocksOverflow = fmt.Sprintf("stack overflow: more than %d blocks nested", maxBlocks)
+
+// StackFrame is a call that was active when a run failed.
+type StackFrame struct {
+	Func   string         // "main" for the body of the program
+	Pos    token.Position // where it was: the error for the innermost, else the call it was making
+	Params []string       // nil for main
+	Args   []Value        // what the call passed for each param
+}
+
+// String formats f as the call that was made.
+func (f StackFrame) String() string {
+	args := make([]string, len(f.Args))
+	for i, v := range f.Args {
+		args[i] = f.Params[i] + " = " + v.String()
+	}
+	return f.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Trace formats stack, innermost first, a call and then the position in name
+// of the statement running in it on each pair of lines, the way a Go panic
+// does. elided is the number of outermost calls left out.
+func Trace(name string, stack []StackFrame, elided int) string {
+	var sb strings.Builder
+	for _, f := range stack {
+		fmt.Fprintf(&sb, "%s\n\t%s:%d:%d\n", f, name, f.Pos.Line, f.Pos.Column)
+	}
+	if elided > 0 {
+		fmt.Fprintf(&sb, "...%d more calls\n", elided)
+	}
+	return sb.String()
+}
+
+// WordStack returns the stack of a VM that failed with depth calls active,
+// innermost first, and the number of outermost calls it leaves out, like the
+// stack of a *RuntimeError. call describes the call i steps out from the
+// innermost: the function, its params and where it was. The VM keeps the args
+// of the calls as words in args, one call after the other and the innermost
+// last.
+func WordStack(depth int, args []uint64, call func(i int) (fn string, params []*semantic.Var, pos token.Position)) ([]StackFrame, int) {
+	var stack []StackFrame
+	end := len(args)
+	for i := range depth {
+		if len(stack) == MaxTrace {
+			return stack, depth - i
+		}
+		fn, params, pos := call(i)
+		f := StackFrame{Func: fn, Pos: pos}
+		if len(params) > 0 {
+			f.Params = make([]string, len(params))
+			f.Args = make([]Value, len(params))
+			for j, p := range params {
+				f.Params[j] = p.Name
+				f.Args[j] = WordValue(p.Type, args[end-len(params)+j])
+			}
+		}
+		end -= len(params)
+		stack = append(stack, f)
+	}
+	return stack, 0
+}
+
+// WordValue returns the value of type t that the word w of a VM holds.
+func WordValue(t semantic.Type, w uint64) Value {
+	switch t {
+	case semantic.Float:
+		return Float(math.Float64frombits(w))
+	case semantic.Bool:
+		return Bool(w != 0)
+	}
+	return Int(int64(w))
+}
+
+// trace returns the stack of e for an error at pos, innermost first, and the
+// number of outermost calls it leaves out.
+func (e *Evaluator) trace(pos token.Position) ([]StackFrame, int) {
+	var stack []StackFrame
+	for i := len(e.frames) - 1; i >= 0; i-- {
+		if len(stack) == MaxTrace {
+			return stack, i + 1
+		}
+		fr := e.frames[i]
+		f := StackFrame{Func: "main", Pos: fr.Pos, Args: fr.Args}
+		if i == len(e.frames)-1 {
+			f.Pos = pos
+		}
+		if fr.Func != nil {
+			f.Func = fr.Func.Name.Value
+			for _, p := range fr.Func.Params {
+				f.Params = append(f.Params, p.Name.Value)
+			}
+		}
+		stack = append(stack, f)
+	}
+	return stack, 0
+}
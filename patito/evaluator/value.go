@@ -0,0 +1,58 @@
+package evaluator
+
+import (
+	"strconv"
+
+	"patito/semantic"
+)
+
+// Value is a runtime value. Every value knows its static type so the evaluator
+// can apply the same int/float rules as the semantic cube.
+type Value interface {
+	Type() semantic.Type
+	String() string // how print shows the value
+}
+
+type Int int64
+
+func (v Int) Type() semantic.Type { return semantic.Int }
+func (v Int) String() string      { return strconv.FormatInt(int64(v), 10) }
+
+type Float float64
+
+func (v Float) Type() semantic.Type { return semantic.Float }
+
+// String uses 6 significant digits like C's "%g", so every backend can print
+// floats exactly the same way.
+func (v Float) String() string { return strconv.FormatFloat(float64(v), 'g', 6, 64) }
+
+type Bool bool
+
+func (v Bool) Type() semantic.Type { return semantic.Bool }
+func (v Bool) String() string      { return strconv.FormatBool(bool(v)) }
+
+// zero returns the initial value of a variable of type t.
+func zero(t semantic.Type) Value {
+	if t == semantic.Float {
+		return Float(0)
+	}
+	return Int(0)
+}
+
+// convert promotes v to the type of a variable declared as t.
+func convert(t semantic.Type, v Value) Value {
+	if i, ok := v.(Int); ok && t == semantic.Float {
+		return Float(i)
+	}
+	return v
+}
+
+func toFloat(v Value) float64 {
+	switch v := v.(type) {
+	case Int:
+		return float64(v)
+	case Float:
+		return float64(v)
+	}
+	return 0
+}
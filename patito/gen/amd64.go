@@ -0,0 +1,598 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"patito/ast"
+	"patito/semantic"
+	"patito/ssa"
+)
+
+// amd64Prelude holds the runtime every assembly program uses, after the
+// functions of the program: fail and print_float, and the strings they and
+// print need. Patito names get the same prefixes as in the other targets, so
+// they never clash with these or with the C library.
+const amd64Prelude = `
+# fail writes the runtime error at %rdi to stderr, after what print wrote to
+# stdout, and exits with status 1.
+fail:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rdi
+	subq $8, %rsp
+	xorl %edi, %edi
+	call fflush@PLT
+	movq -8(%rbp), %rdi
+	movq stderr@GOTPCREL(%rip), %rax
+	movq (%rax), %rsi
+	call fputs@PLT
+	movl $1, %edi
+	call exit@PLT
+
+# print_float writes the prefix at %rdi and then %xmm0 the way print does: 6
+# significant digits, as %g, with Go's names for infinities and NaN.
+print_float:
+	pushq %rbp
+	movq %rsp, %rbp
+	movq %rdi, %rsi
+	leaq .Lnan(%rip), %rdx
+	ucomisd %xmm0, %xmm0
+	jp 1f
+	movq %xmm0, %rax
+	leaq .Lposinf(%rip), %rdx
+	movabsq $0x7ff0000000000000, %rcx
+	cmpq %rcx, %rax
+	je 1f
+	leaq .Lneginf(%rip), %rdx
+	movabsq $0xfff0000000000000, %rcx
+	cmpq %rcx, %rax
+	je 1f
+	leaq .Lfmt_float(%rip), %rdi
+	movl $1, %eax
+	call printf@PLT
+	popq %rbp
+	ret
+1:
+	leaq .Lfmt_str(%rip), %rdi
+	xorl %eax, %eax
+	call printf@PLT
+	popq %rbp
+	ret
+
+	.section .rodata
+.Lfmt_int:
+	.string "%s%ld"
+.Lfmt_float:
+	.string "%s%g"
+.Lfmt_str:
+	.string "%s%s"
+.Lnone:
+	.string ""
+.Lspace:
+	.string " "
+.Ltrue:
+	.string "true"
+.Lfalse:
+	.string "false"
+.Lnan:
+	.string "NaN"
+.Lposinf:
+	.string "+Inf"
+.Lneginf:
+	.string "-Inf"
+`
+
+// amd64Ints and amd64Floats are the registers the allocator hands out. The
+// code of each value uses %rax, %rcx and %rdx, or %xmm0 and %xmm1, as
+// scratch, and the C functions that print clobber all of these.
+var (
+	amd64Ints   = []string{"%r8", "%r9", "%r10", "%r11"}
+	amd64Floats = []string{"%xmm2", "%xmm3", "%xmm4", "%xmm5", "%xmm6", "%xmm7"}
+)
+
+// AMD64 writes prog, which passed semantic.Check with dir, as GNU assembly for
+// x86-64 Linux, to be linked with the C library, which prints. file is the
+// name of the source, for the positions of runtime errors.
+//
+// The code follows the SSA form of package ssa, lowered the way ssa.Lower
+// lowers it to quadruples, with phis copied through a temp on each incoming
+// edge, but with the types and positions the quadruples leave out. Each
+// function has an activation record on the stack:
+//
+//	16+8*i(%rbp)  param i, stored there by the caller
+//	 8(%rbp)      return address
+//	 0(%rbp)      the caller's %rbp
+//	-8*n(%rbp)    the slot of a value, or of the incoming temp of a phi
+//
+// A value that is only used in its own block, not across a call or print and
+// not by them, is a temp: it gets a register instead of a slot, while one is
+// free. Floats are computed with SSE. Int arithmetic wraps around, as x86 does,
+// and a division checks for zero and for -1 before idiv could trap.
+func AMD64(w io.Writer, prog *ast.Program, dir *semantic.FuncDir, file string) error {
+	p := ssa.Build(prog, dir)
+	if err := ssa.Verify(p); err != nil {
+		return fmt.Errorf("gen: invalid SSA: %v", err)
+	}
+	g := &amd64Gen{writer: &writer{}, file: file, strings: map[string]string{}}
+	g.line("# Code generated by patito build from %s. DO NOT EDIT.", file)
+	if len(p.Globals) > 0 {
+		g.line("")
+		g.line("\t.bss")
+		g.line("\t.p2align 3")
+		for _, v := range p.Globals {
+			g.line("v_%s:", v.Name)
+			g.line("\t.zero 8")
+		}
+	}
+	g.line("")
+	g.line("\t.text")
+	g.line("\t.globl main")
+	for _, fn := range p.Funcs {
+		g.function(fn)
+	}
+	g.sb.WriteString(amd64Prelude)
+	for _, s := range g.order {
+		g.line("%s:", g.strings[s])
+		g.line("\t.string %s", asQuote(s))
+	}
+	g.line("")
+	g.line("\t.section .note.GNU-stack,\"\",@progbits")
+	_, err := io.WriteString(w, g.sb.String())
+	return err
+}
+
+type amd64Gen struct {
+	*writer
+	file    string
+	strings map[string]string // label of each string in .rodata
+	order   []string          // strings in the order they were labeled
+
+	fn       *ssa.Func
+	prefix   string                // of the labels of the blocks of fn
+	loc      map[*ssa.Value]string // where each value lives
+	incoming map[*ssa.Value]string // slot of the incoming temp of each phi
+}
+
+// str returns the label of s in .rodata.
+func (g *amd64Gen) str(s string) string {
+	label, ok := g.strings[s]
+	if !ok {
+		label = fmt.Sprintf(".Lstr%d", len(g.order))
+		g.strings[s] = label
+		g.order = append(g.order, s)
+	}
+	return label
+}
+
+func (g *amd64Gen) function(fn *ssa.Func) {
+	g.fn = fn
+	name := "main"
+	if fn.Sem != nil {
+		name = "f_" + fn.Name
+	}
+	g.prefix = ".L" + name + "_"
+	frame := g.layout()
+
+	g.line("")
+	g.line("%s:", name)
+	g.line("\tpushq %%rbp")
+	g.line("\tmovq %%rsp, %%rbp")
+	if frame > 0 {
+		g.line("\tsubq $%d, %%rsp", frame)
+	}
+	for _, b := range fn.Blocks {
+		g.line("%s%s:", g.prefix, b)
+		for _, v := range b.Values {
+			g.value(v)
+		}
+		g.end(b)
+	}
+}
+
+// layout decides where each value of g.fn lives and returns the size of the
+// slots, rounded up so that calls find the stack aligned.
+func (g *amd64Gen) layout() int {
+	g.loc = map[*ssa.Value]string{}
+	g.incoming = map[*ssa.Value]string{}
+	slots := 0
+	slot := func() string {
+		slots++
+		return fmt.Sprintf("-%d(%%rbp)", 8*slots)
+	}
+	temps := g.temps()
+	for _, b := range g.fn.Blocks {
+		for _, v := range b.Values {
+			switch {
+			case v.Op == ssa.OpConst || v.Type == semantic.Void:
+				// constants are immediates, and void values have no result
+			case v.Op == ssa.OpParam:
+				g.loc[v] = fmt.Sprintf("%d(%%rbp)", 16+8*v.Index)
+			case temps[v] != "":
+				g.loc[v] = temps[v]
+			default:
+				g.loc[v] = slot()
+				if v.Op == ssa.OpPhi {
+					g.incoming[v] = slot()
+				}
+			}
+		}
+	}
+	return (8*slots + 15) / 16 * 16
+}
+
+// temps assigns registers to the values that qualify as temps, first come
+// first served within each block.
+func (g *amd64Gen) temps() map[*ssa.Value]string {
+	type use struct {
+		block *ssa.Block
+		index int
+		op    ssa.Op
+	}
+	uses := map[*ssa.Value][]use{}
+	for _, b := range g.fn.Blocks {
+		for i, v := range b.Values {
+			for _, arg := range v.Args {
+				uses[arg] = append(uses[arg], use{b, i, v.Op})
+			}
+		}
+		if b.Control != nil {
+			uses[b.Control] = append(uses[b.Control], use{b, len(b.Values), ssa.OpConst})
+		}
+	}
+
+	regs := map[*ssa.Value]string{}
+	for _, b := range g.fn.Blocks {
+		// last use of each temp of b, and which registers are free
+		last := map[*ssa.Value]int{}
+		calls := []int{}
+		for i, v := range b.Values {
+			if v.Op == ssa.OpCall || v.Op == ssa.OpPrint {
+				calls = append(calls, i)
+			}
+		}
+	values:
+		for i, v := range b.Values {
+			switch v.Op {
+			case ssa.OpConst, ssa.OpParam, ssa.OpPhi, ssa.OpStore, ssa.OpCall, ssa.OpPrint:
+				continue
+			}
+			end := i
+			for _, u := range uses[v] {
+				if u.block != b || u.op == ssa.OpCall || u.op == ssa.OpPrint || u.op == ssa.OpPhi {
+					continue values
+				}
+				end = max(end, u.index)
+			}
+			for _, c := range calls {
+				if c > i && c < end {
+					continue values
+				}
+			}
+			last[v] = end
+		}
+
+		busy := map[string]*ssa.Value{}
+		for i, v := range b.Values {
+			for r, owner := range busy {
+				if last[owner] <= i {
+					delete(busy, r)
+				}
+			}
+			if _, ok := last[v]; !ok {
+				continue
+			}
+			pool := amd64Ints
+			if v.Type == semantic.Float {
+				pool = amd64Floats
+			}
+			for _, r := range pool {
+				if busy[r] == nil {
+					busy[r] = v
+					regs[v] = r
+					break
+				}
+			}
+		}
+	}
+	return regs
+}
+
+// loadInt puts the int or bool v in the general register reg.
+func (g *amd64Gen) loadInt(v *ssa.Value, reg string) {
+	if v.Op != ssa.OpConst {
+		g.line("\tmovq %s, %s", g.loc[v], reg)
+		return
+	}
+	var n int64
+	switch c := v.Const.(type) {
+	case int64:
+		n = c
+	case bool:
+		if c {
+			n = 1
+		}
+	}
+	if n == int64(int32(n)) {
+		g.line("\tmovq $%d, %s", n, reg)
+	} else {
+		g.line("\tmovabsq $%d, %s", n, reg)
+	}
+}
+
+// loadFloat puts the float v in the SSE register reg, using %rax for
+// constants.
+func (g *amd64Gen) loadFloat(v *ssa.Value, reg string) {
+	if v.Op != ssa.OpConst {
+		g.line("\tmovsd %s, %s", g.loc[v], reg)
+		return
+	}
+	g.line("\tmovabsq $%d, %%rax", int64(math.Float64bits(v.Const.(float64))))
+	g.line("\tmovq %%rax, %s", reg)
+}
+
+// loadBits puts the bits of v, of any type, in %rax.
+func (g *amd64Gen) loadBits(v *ssa.Value) {
+	switch {
+	case v.Type == semantic.Float && v.Op == ssa.OpConst:
+		g.line("\tmovabsq $%d, %%rax", int64(math.Float64bits(v.Const.(float64))))
+	case v.Op == ssa.OpConst:
+		g.loadInt(v, "%rax")
+	default:
+		g.line("\tmovq %s, %%rax", g.loc[v])
+	}
+}
+
+// storeBits writes %rax, holding the bits of a value, to loc.
+func (g *amd64Gen) storeBits(loc string) {
+	g.line("\tmovq %%rax, %s", loc)
+}
+
+var amd64Sets = map[ssa.Op]string{
+	ssa.OpLt: "setl", ssa.OpGt: "setg", ssa.OpLe: "setle", ssa.OpGe: "setge", ssa.OpEq: "sete", ssa.OpNe: "setne",
+}
+
+func (g *amd64Gen) value(v *ssa.Value) {
+	if v.Op == ssa.OpConst {
+		return
+	}
+	g.line("\t# %s", v.LongString())
+	loc := g.loc[v]
+	switch v.Op {
+	case ssa.OpParam:
+		// already in its slot
+	case ssa.OpPhi:
+		g.line("\tmovq %s, %%rax", g.incoming[v])
+		g.storeBits(loc)
+	case ssa.OpLoad:
+		g.line("\tmovq v_%s(%%rip), %%rax", v.Name)
+		g.storeBits(loc)
+	case ssa.OpStore:
+		g.loadBits(v.Args[0])
+		g.line("\tmovq %%rax, v_%s(%%rip)", v.Name)
+	case ssa.OpCall:
+		g.call(v)
+	case ssa.OpPrint:
+		g.print(v)
+	case ssa.OpIntToFloat:
+		g.loadInt(v.Args[0], "%rax")
+		g.line("\tcvtsi2sdq %%rax, %%xmm0")
+		g.line("\tmovsd %%xmm0, %s", loc)
+	case ssa.OpNeg:
+		g.loadBits(v.Args[0])
+		if v.Type == semantic.Float {
+			g.line("\tbtcq $63, %%rax")
+		} else {
+			g.line("\tnegq %%rax")
+		}
+		g.storeBits(loc)
+	case ssa.OpDiv:
+		msg := "float division by zero"
+		if v.Type == semantic.Int {
+			msg = "integer division by zero"
+		}
+		fail := g.str(fmt.Sprintf("%s:%d:%d: runtime error: %s\n", g.file, v.Pos.Line, v.Pos.Column, msg))
+		if v.Type == semantic.Float {
+			// +0 and -0 are the floats whose bits are zero but for the sign
+			g.loadFloat(v.Args[1], "%xmm1")
+			g.line("\tmovq %%xmm1, %%rax")
+			g.line("\taddq %%rax, %%rax")
+			g.line("\tjnz 1f")
+			g.line("\tleaq %s(%%rip), %%rdi", fail)
+			g.line("\tcall fail")
+			g.line("1:")
+			g.loadFloat(v.Args[0], "%xmm0")
+			g.line("\tdivsd %%xmm1, %%xmm0")
+			g.line("\tmovsd %%xmm0, %s", loc)
+			return
+		}
+		g.loadInt(v.Args[0], "%rax")
+		g.loadInt(v.Args[1], "%rcx")
+		g.line("\ttestq %%rcx, %%rcx")
+		g.line("\tjnz 1f")
+		g.line("\tleaq %s(%%rip), %%rdi", fail)
+		g.line("\tcall fail")
+		g.line("1:")
+		// the minimum int divided by -1 overflows, which idiv traps
+		g.line("\tcmpq $-1, %%rcx")
+		g.line("\tjne 2f")
+		g.line("\tnegq %%rax")
+		g.line("\tjmp 3f")
+		g.line("2:")
+		g.line("\tcqto")
+		g.line("\tidivq %%rcx")
+		g.line("3:")
+		g.storeBits(loc)
+	case ssa.OpAdd, ssa.OpSub, ssa.OpMul:
+		if v.Type == semantic.Float {
+			op := map[ssa.Op]string{ssa.OpAdd: "addsd", ssa.OpSub: "subsd", ssa.OpMul: "mulsd"}[v.Op]
+			g.loadFloat(v.Args[0], "%xmm0")
+			g.loadFloat(v.Args[1], "%xmm1")
+			g.line("\t%s %%xmm1, %%xmm0", op)
+			g.line("\tmovsd %%xmm0, %s", loc)
+			return
+		}
+		op := map[ssa.Op]string{ssa.OpAdd: "addq", ssa.OpSub: "subq", ssa.OpMul: "imulq"}[v.Op]
+		g.loadInt(v.Args[0], "%rax")
+		g.loadInt(v.Args[1], "%rcx")
+		g.line("\t%s %%rcx, %%rax", op)
+		g.storeBits(loc)
+	default: // comparisons
+		if v.Args[0].Type == semantic.Float {
+			g.compareFloats(v)
+		} else {
+			g.loadInt(v.Args[0], "%rax")
+			g.loadInt(v.Args[1], "%rcx")
+			g.line("\tcmpq %%rcx, %%rax")
+			g.line("\t%s %%al", amd64Sets[v.Op])
+		}
+		g.line("\tmovzbl %%al, %%eax")
+		g.storeBits(loc)
+	}
+}
+
+// compareFloats sets %al to the result of the comparison v. ucomisd reports
+// an unordered pair, with a NaN, as below and equal at once, with the parity
+// flag set: only != holds then.
+func (g *amd64Gen) compareFloats(v *ssa.Value) {
+	g.loadFloat(v.Args[0], "%xmm0")
+	g.loadFloat(v.Args[1], "%xmm1")
+	switch v.Op {
+	case ssa.OpGt, ssa.OpGe:
+		g.line("\tucomisd %%xmm1, %%xmm0")
+	case ssa.OpLt, ssa.OpLe:
+		// a < b is b > a, which is false when unordered
+		g.line("\tucomisd %%xmm0, %%xmm1")
+	default:
+		g.line("\tucomisd %%xmm1, %%xmm0")
+	}
+	switch v.Op {
+	case ssa.OpGt, ssa.OpLt:
+		g.line("\tseta %%al")
+	case ssa.OpGe, ssa.OpLe:
+		g.line("\tsetae %%al")
+	case ssa.OpEq:
+		g.line("\tsete %%al")
+		g.line("\tsetnp %%cl")
+		g.line("\tandb %%cl, %%al")
+	case ssa.OpNe:
+		g.line("\tsetne %%al")
+		g.line("\tsetp %%cl")
+		g.line("\torb %%cl, %%al")
+	}
+}
+
+// call stores the args where the callee finds its params and calls it. The
+// area keeps the stack aligned to 16 bytes.
+func (g *amd64Gen) call(v *ssa.Value) {
+	area := (8*len(v.Args) + 15) / 16 * 16
+	if area > 0 {
+		g.line("\tsubq $%d, %%rsp", area)
+	}
+	for i, arg := range v.Args {
+		g.loadBits(arg)
+		g.line("\tmovq %%rax, %d(%%rsp)", 8*i)
+	}
+	g.line("\tcall f_%s", v.Name)
+	if area > 0 {
+		g.line("\taddq $%d, %%rsp", area)
+	}
+}
+
+// print writes each arg with printf, after a space but for the first, and
+// ends the line.
+func (g *amd64Gen) print(v *ssa.Value) {
+	for i, arg := range v.Args {
+		prefix := ".Lnone"
+		if i > 0 {
+			prefix = ".Lspace"
+		}
+		format := ".Lfmt_str"
+		switch arg.Type {
+		case semantic.Float:
+			g.loadFloat(arg, "%xmm0")
+			g.line("\tleaq %s(%%rip), %%rdi", prefix)
+			g.line("\tcall print_float")
+			continue
+		case semantic.Int:
+			format = ".Lfmt_int"
+			g.loadInt(arg, "%rdx")
+		case semantic.Bool:
+			g.loadInt(arg, "%rax")
+			g.line("\tleaq .Ltrue(%%rip), %%rdx")
+			g.line("\tleaq .Lfalse(%%rip), %%rcx")
+			g.line("\ttestq %%rax, %%rax")
+			g.line("\tcmove %%rcx, %%rdx")
+		case semantic.String:
+			g.line("\tleaq %s(%%rip), %%rdx", g.str(arg.Const.(string)))
+		}
+		g.line("\tleaq %s(%%rip), %%rdi", format)
+		g.line("\tleaq %s(%%rip), %%rsi", prefix)
+		g.line("\txorl %%eax, %%eax")
+		g.line("\tcall printf@PLT")
+	}
+	g.line("\tmovl $10, %%edi")
+	g.line("\tcall putchar@PLT")
+}
+
+// end writes the copies into the incoming temps of the phis of the
+// successors of b, and the jump or return that ends it.
+func (g *amd64Gen) end(b *ssa.Block) {
+	for _, s := range b.Succs {
+		k := 0
+		for s.Preds[k] != b {
+			k++
+		}
+		for _, v := range s.Values {
+			if v.Op == ssa.OpPhi {
+				g.line("\t# %s <- %s", v, v.Args[k])
+				g.loadBits(v.Args[k])
+				g.storeBits(g.incoming[v])
+			}
+		}
+	}
+	next := b.ID + 1
+	switch b.Kind {
+	case ssa.Plain:
+		if b.Succs[0].ID != next {
+			g.line("\tjmp %s%s", g.prefix, b.Succs[0])
+		}
+	case ssa.If:
+		g.loadInt(b.Control, "%rax")
+		g.line("\ttestq %%rax, %%rax")
+		g.line("\tje %s%s", g.prefix, b.Succs[1])
+		if b.Succs[0].ID != next {
+			g.line("\tjmp %s%s", g.prefix, b.Succs[0])
+		}
+	case ssa.Return:
+		if g.fn.Sem == nil {
+			g.line("\txorl %%eax, %%eax")
+		}
+		g.line("\tleave")
+		g.line("\tret")
+	}
+}
+
+// asQuote writes s as a string of GNU as, whose escapes are C's but for
+// trigraphs, which it does not have.
+func asQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&sb, `\%03o`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
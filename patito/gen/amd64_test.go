@@ -0,0 +1,30 @@
+package gen
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAMD64(t *testing.T) {
+	if testing.Short() {
+		t.Skip("assembles and links programs")
+	}
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("runs x86-64 Linux programs")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no cc command")
+	}
+	differential(t, ".s", AMD64, func(t *testing.T, dir, src string) (string, string) {
+		bin := filepath.Join(dir, "main")
+		build := exec.Command(cc, "-o", bin, src)
+		build.Dir = dir
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("cc: %v\n%s", err, out)
+		}
+		return run(t, exec.Command(bin))
+	})
+}
@@ -0,0 +1,453 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// cPrelude holds the headers and helpers every C program uses. Patito names
+// get the same prefixes as in Go (v_ for vars, f_ for functions) so they never
+// clash with these, with C keywords or with the C library.
+const cPrelude = `
+#include <inttypes.h>
+#include <math.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+/* fail reports a runtime error the way patito run does and exits. */
+static void fail(const char *pos, const char *msg) {
+	fflush(stdout);
+	fprintf(stderr, "%s: runtime error: %s\n", pos, msg);
+	exit(1);
+}
+
+/*
+ * Signed overflow is undefined in C, so int arithmetic goes through uint64_t,
+ * which wraps around, and back, which every C compiler we target defines as
+ * two's complement.
+ */
+static inline int64_t add_int(int64_t a, int64_t b) { return (int64_t)((uint64_t)a + (uint64_t)b); }
+static inline int64_t sub_int(int64_t a, int64_t b) { return (int64_t)((uint64_t)a - (uint64_t)b); }
+static inline int64_t mul_int(int64_t a, int64_t b) { return (int64_t)((uint64_t)a * (uint64_t)b); }
+static inline int64_t neg_int(int64_t a) { return (int64_t)(0 - (uint64_t)a); }
+
+static inline int64_t div_int(int64_t a, int64_t b, const char *pos) {
+	if (b == 0) {
+		fail(pos, "integer division by zero");
+	}
+	if (b == -1) {
+		return neg_int(a); /* INT64_MIN / -1 overflows */
+	}
+	return a / b;
+}
+
+static inline double div_float(double a, double b, const char *pos) {
+	if (b == 0) {
+		fail(pos, "float division by zero");
+	}
+	return a / b;
+}
+
+/*
+ * fmt_float formats f like print does: 6 significant digits, as %g, with the
+ * names Go gives to infinities and NaN. buf must hold 32 bytes.
+ */
+static inline const char *fmt_float(double f, char *buf) {
+	if (isnan(f)) {
+		return "NaN";
+	}
+	if (isinf(f)) {
+		return f > 0 ? "+Inf" : "-Inf";
+	}
+	snprintf(buf, 32, "%g", f);
+	return buf;
+}
+`
+
+// C writes prog, which passed semantic.Check with dir, as a C99 program.
+// Globals become file-scope vars and functions become C functions whose
+// locals are zeroed on every call. file is the name of the source, for the
+// positions of runtime errors.
+//
+// C leaves the order in which operands and args run to the compiler. That only
+// shows when two divisions by zero race to report their error, so a statement
+// with more than one division that may fail runs them first, into temps, in
+// the order the evaluator does.
+func C(w io.Writer, prog *ast.Program, dir *semantic.FuncDir, file string) error {
+	g := &cGen{scope: scope{dir: dir}, file: file}
+	g.line("// Code generated by patito build from %s. DO NOT EDIT.", file)
+	g.sb.WriteString(cPrelude)
+
+	if globals := dir.Globals.All(); len(globals) > 0 {
+		g.line("")
+		for _, v := range globals {
+			g.line("%s v_%s;", cType(v.Type), v.Name)
+		}
+	}
+	funcs := dir.Funcs()
+	if len(funcs) > 0 {
+		// prototypes let functions call each other in any order
+		g.line("")
+		for _, fn := range funcs {
+			g.line("void %s;", cSignature(fn))
+		}
+	}
+	for _, fn := range funcs {
+		g.fn, g.temps = fn, 0
+		g.line("")
+		g.line("void %s {", cSignature(fn))
+		g.indent++
+		for _, v := range fn.Vars.All() {
+			if v.Scope == semantic.Local {
+				// compilers warn about locals that are never used
+				g.line("%s v_%s = 0;", cType(v.Type), v.Name)
+				g.line("(void)v_%s;", v.Name)
+			}
+		}
+		g.block(fn.Decl.Body)
+		g.indent--
+		g.line("}")
+	}
+	g.fn, g.temps = nil, 0
+	g.line("")
+	g.line("int main(void) {")
+	g.indent++
+	g.block(prog.Main)
+	g.line("return 0;")
+	g.indent--
+	g.line("}")
+
+	_, err := io.WriteString(w, g.sb.String())
+	return err
+}
+
+type cGen struct {
+	scope
+	writer
+	file  string
+	temps int // temps declared so far in the function being translated
+
+	hoisting bool    // whether divisions go into temps
+	hoisted  []cTemp // temps of the statement being translated
+}
+
+// cTemp is a temp that holds the result of a division.
+type cTemp struct {
+	name, ctype, code string
+}
+
+func cType(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "double"
+	case semantic.Bool:
+		return "bool"
+	}
+	return "int64_t"
+}
+
+func cSignature(fn *semantic.Func) string {
+	params := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i] = fmt.Sprintf("%s v_%s", cType(p.Type), p.Name)
+	}
+	if len(params) == 0 {
+		params = []string{"void"}
+	}
+	return fmt.Sprintf("f_%s(%s)", fn.Name, joinComma(params))
+}
+
+func (g *cGen) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		g.statement(stmt)
+	}
+}
+
+func (g *cGen) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		v := g.lookup(s.Name.Value)
+		var value string
+		g.declare(g.ordered([]ast.Expression{s.Value}, func() { value = g.convert(v.Type, s.Value) }))
+		g.line("v_%s = %s;", v.Name, value)
+	case *ast.PrintStatement:
+		var args []string
+		g.declare(g.ordered(s.Expressions, func() { args = g.print(s.Expressions) }))
+		g.line("printf(%s);", joinComma(args))
+	case *ast.CallStatement:
+		callee := g.dir.Lookup(s.Call.Function.Value)
+		args := make([]string, len(s.Call.Arguments))
+		g.declare(g.ordered(s.Call.Arguments, func() {
+			for i, arg := range s.Call.Arguments {
+				args[i] = g.convert(callee.Params[i].Type, arg)
+			}
+		}))
+		g.line("f_%s(%s);", callee.Name, joinComma(args))
+	case *ast.IfStatement:
+		var cond string
+		g.declare(g.ordered([]ast.Expression{s.Condition}, func() { cond = g.top(s.Condition) }))
+		g.line("if (%s) {", cond)
+		g.indent++
+		g.block(s.Consequence)
+		g.indent--
+		if s.Alternative != nil {
+			g.line("} else {")
+			g.indent++
+			g.block(s.Alternative)
+			g.indent--
+		}
+		g.line("}")
+	case *ast.WhileStatement:
+		var cond string
+		temps := g.ordered([]ast.Expression{s.Condition}, func() { cond = g.top(s.Condition) })
+		if len(temps) > 0 {
+			// the condition runs on every iteration, so the temps are
+			// assigned inside it
+			steps := make([]string, 0, len(temps)+1)
+			for _, t := range temps {
+				g.line("%s %s;", t.ctype, t.name)
+				steps = append(steps, t.name+" = "+t.code)
+			}
+			cond = "(" + joinComma(append(steps, cond)) + ")"
+		}
+		g.line("while (%s) {", cond)
+		g.indent++
+		g.block(s.Body)
+		g.indent--
+		g.line("}")
+	case *ast.BlockStatement:
+		g.line("{")
+		g.indent++
+		g.block(s)
+		g.indent--
+		g.line("}")
+	}
+}
+
+// ordered runs translate, which translates exps, and returns the temps their
+// divisions went into, if there is more than one that may fail.
+func (g *cGen) ordered(exps []ast.Expression, translate func()) []cTemp {
+	n := 0
+	for _, exp := range exps {
+		n += g.divisions(exp)
+	}
+	g.hoisting, g.hoisted = n > 1, nil
+	translate()
+	temps := g.hoisted
+	g.hoisting, g.hoisted = false, nil
+	return temps
+}
+
+// declare writes temps as declarations that run before the statement.
+func (g *cGen) declare(temps []cTemp) {
+	for _, t := range temps {
+		g.line("%s %s = %s;", t.ctype, t.name, t.code)
+	}
+}
+
+// divisions counts the divisions in exp that run, and so may fail, at run
+// time.
+func (g *cGen) divisions(exp ast.Expression) int {
+	if _, ok := constant(exp); ok {
+		return 0
+	}
+	switch x := exp.(type) {
+	case *ast.PrefixExpression:
+		return g.divisions(x.Right)
+	case *ast.InfixExpression:
+		n := g.divisions(x.Left) + g.divisions(x.Right)
+		if x.Operator == "/" {
+			n++
+		}
+		return n
+	}
+	return 0
+}
+
+// print returns the args of the printf call that writes exps: the format,
+// with string literals in it, and the values.
+func (g *cGen) print(exps []ast.Expression) []string {
+	// the format is built with \x00 where PRId64 goes, between literals
+	var format strings.Builder
+	var args []string
+	for i, exp := range exps {
+		if i > 0 {
+			format.WriteString(" ")
+		}
+		switch t := g.typeOf(exp); {
+		case t == semantic.String:
+			format.WriteString(strings.ReplaceAll(exp.(*ast.StringLiteral).Value, "%", "%%"))
+		case t == semantic.Int:
+			format.WriteString("%\x00")
+			arg := g.top(exp)
+			if _, ok := constant(exp); ok || isLiteral(exp) {
+				// an int constant is an int in C, not an int64_t
+				arg = "(int64_t)" + g.expr(exp)
+			}
+			args = append(args, arg)
+		case t == semantic.Float:
+			format.WriteString("%s")
+			args = append(args, "fmt_float("+g.top(exp)+", (char[32]){0})")
+		case t == semantic.Bool:
+			format.WriteString("%s")
+			args = append(args, g.expr(exp)+` ? "true" : "false"`)
+		}
+	}
+	format.WriteString("\n")
+	pieces := strings.Split(format.String(), "\x00")
+	for i, p := range pieces {
+		pieces[i] = cQuote(p)
+	}
+	return append([]string{strings.Join(pieces, " PRId64 ")}, args...)
+}
+
+func isLiteral(exp ast.Expression) bool {
+	_, ok := exp.(*ast.IntegerLiteral)
+	return ok
+}
+
+// convert translates exp as a value of type t, promoting an int to float.
+func (g *cGen) convert(t semantic.Type, exp ast.Expression) string {
+	if t == semantic.Float && g.typeOf(exp) == semantic.Int {
+		return "(double)" + g.expr(exp)
+	}
+	return g.top(exp)
+}
+
+// top translates exp where it needs no parentheses of its own.
+func (g *cGen) top(exp ast.Expression) string {
+	s := g.expr(exp)
+	if _, ok := exp.(*ast.InfixExpression); ok && strings.HasPrefix(s, "(") {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// operand translates an operand of an operator whose other operand has type
+// other, promoting it to float if they differ.
+func (g *cGen) operand(exp ast.Expression, other semantic.Type) string {
+	if other == semantic.Float && g.typeOf(exp) == semantic.Int {
+		return "(double)" + g.expr(exp)
+	}
+	return g.expr(exp)
+}
+
+func (g *cGen) expr(exp ast.Expression) string {
+	if v, ok := constant(exp); ok {
+		return cValue(v)
+	}
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		return "v_" + x.Value
+	case *ast.IntegerLiteral:
+		return cValue(evaluator.Int(x.Value))
+	case *ast.FloatLiteral:
+		return cValue(evaluator.Float(x.Value))
+	case *ast.BooleanLiteral:
+		return cValue(evaluator.Bool(x.Value))
+	case *ast.StringLiteral:
+		return cQuote(x.Value)
+	case *ast.PrefixExpression:
+		if x.Operator != "-" {
+			return g.expr(x.Right)
+		}
+		if g.typeOf(x.Right) == semantic.Int {
+			return "neg_int(" + g.top(x.Right) + ")"
+		}
+		right := g.expr(x.Right)
+		if strings.HasPrefix(right, "-") {
+			return "-(" + right + ")"
+		}
+		return "-" + right
+	case *ast.InfixExpression:
+		lt, rt := g.typeOf(x.Left), g.typeOf(x.Right)
+		isInt := lt == semantic.Int && rt == semantic.Int
+		var l, r string
+		if isInt {
+			// int operators are helpers, so the operands are args
+			l, r = g.top(x.Left), g.top(x.Right)
+		} else {
+			l, r = g.operand(x.Left, rt), g.operand(x.Right, lt)
+		}
+		switch {
+		case x.Operator == "/":
+			div, ctype := "div_float", "double"
+			if isInt {
+				div, ctype = "div_int", "int64_t"
+			}
+			pos := x.Right.Position()
+			code := fmt.Sprintf("%s(%s, %s, %s)", div, l, r, cQuote(fmt.Sprintf("%s:%d:%d", g.file, pos.Line, pos.Column)))
+			if !g.hoisting {
+				return code
+			}
+			g.temps++
+			t := cTemp{name: fmt.Sprintf("t%d", g.temps), ctype: ctype, code: code}
+			g.hoisted = append(g.hoisted, t)
+			return t.name
+		case isInt && (x.Operator == "+" || x.Operator == "-" || x.Operator == "*"):
+			name := map[string]string{"+": "add_int", "-": "sub_int", "*": "mul_int"}[x.Operator]
+			return fmt.Sprintf("%s(%s, %s)", name, l, r)
+		}
+		return "(" + l + " " + x.Operator + " " + r + ")"
+	}
+	panic(fmt.Sprintf("gen: unexpected expression %T", exp))
+}
+
+// cValue writes a constant as a C expression of its type.
+func cValue(v evaluator.Value) string {
+	switch v := v.(type) {
+	case evaluator.Int:
+		if v == math.MinInt64 {
+			// the literal would be the negation of a number that does not fit
+			return "INT64_MIN"
+		}
+		return v.String()
+	case evaluator.Float:
+		f := float64(v)
+		switch {
+		case math.IsNaN(f):
+			return "NAN"
+		case math.IsInf(f, 1):
+			return "INFINITY"
+		case math.IsInf(f, -1):
+			return "-INFINITY"
+		}
+		return formatFloat(f)
+	}
+	return v.String()
+}
+
+// cQuote writes s as a C string literal. Bytes outside printable ASCII use
+// three-digit octal escapes, which never run into the next character.
+func cQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&sb, `\%03o`, c)
+		case c == '?':
+			// keeps "??" from reading as a trigraph
+			sb.WriteString(`\?`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
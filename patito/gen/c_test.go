@@ -0,0 +1,26 @@
+package gen
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestC(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds C programs")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no cc command")
+	}
+	differential(t, ".c", C, func(t *testing.T, dir, src string) (string, string) {
+		bin := filepath.Join(dir, "main")
+		build := exec.Command(cc, "-std=c99", "-pedantic-errors", "-Wall", "-Werror", "-O2", "-o", bin, src, "-lm")
+		build.Dir = dir
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("cc: %v\n%s", err, out)
+		}
+		return run(t, exec.Command(bin))
+	})
+}
@@ -0,0 +1,119 @@
+// Package gen translates checked Patito programs into the source code of other
+// languages, so that their compilers can build native programs that behave like
+// the evaluator: ints are 64-bit and wrap around, int / int truncates, a
+// division by zero stops the program with the same runtime error, and print
+// writes floats with 6 significant digits.
+//
+// Each target is one function that writes a whole program: Go, C, the
+// WebAssembly text format, x86-64 assembly and LLVM IR.
+package gen
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// scope resolves names inside the body being translated the way the checker
+// does: locals and params first, then globals.
+type scope struct {
+	dir *semantic.FuncDir
+	fn  *semantic.Func // function being translated, nil for main
+}
+
+func (s scope) lookup(name string) *semantic.Var {
+	if s.fn != nil {
+		if local := s.fn.Vars.Lookup(name); local != nil {
+			return local
+		}
+	}
+	return s.dir.Globals.Lookup(name)
+}
+
+func (s scope) typeOf(exp ast.Expression) semantic.Type {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		if v := s.lookup(x.Value); v != nil {
+			return v.Type
+		}
+	case *ast.IntegerLiteral:
+		return semantic.Int
+	case *ast.FloatLiteral:
+		return semantic.Float
+	case *ast.BooleanLiteral:
+		return semantic.Bool
+	case *ast.StringLiteral:
+		return semantic.String
+	case *ast.PrefixExpression:
+		return semantic.PrefixResultType(x.Operator, s.typeOf(x.Right))
+	case *ast.InfixExpression:
+		return semantic.ResultType(x.Operator, s.typeOf(x.Left), s.typeOf(x.Right))
+	}
+	return semantic.Invalid
+}
+
+// constant evaluates an operation on constants, so that a target whose
+// compiler folds constants with other rules (Go rejects an overflow instead of
+// wrapping) gets the value the evaluator computes. It fails for expressions
+// that read a var or that fail, such as a division by zero, which must happen
+// at run time.
+func constant(exp ast.Expression) (evaluator.Value, bool) {
+	switch exp.(type) {
+	case *ast.PrefixExpression, *ast.InfixExpression:
+	default:
+		return nil, false
+	}
+	if readsVar(exp) {
+		return nil, false
+	}
+	v, err := evaluator.New(io.Discard).Eval(exp)
+	return v, err == nil
+}
+
+func readsVar(exp ast.Expression) bool {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.PrefixExpression:
+		return readsVar(x.Right)
+	case *ast.InfixExpression:
+		return readsVar(x.Left) || readsVar(x.Right)
+	}
+	return false
+}
+
+// formatFloat writes f so that it reads back as the same float in C-like
+// languages: always with a point or an exponent. It does not handle infinities
+// or NaN, which have no literal.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func joinComma(list []string) string {
+	return strings.Join(list, ", ")
+}
+
+// writer accumulates the lines of the generated code with their indentation.
+type writer struct {
+	sb     strings.Builder
+	indent int
+}
+
+func (w *writer) line(format string, args ...any) {
+	if format == "" {
+		w.sb.WriteString("\n")
+		return
+	}
+	w.sb.WriteString(strings.Repeat("\t", w.indent))
+	fmt.Fprintf(&w.sb, format, args...)
+	w.sb.WriteString("\n")
+}
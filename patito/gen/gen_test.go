@@ -0,0 +1,172 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+func check(t *testing.T, src string) (*ast.Program, *semantic.FuncDir) {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	return prog, dir
+}
+
+// corpus holds the programs every backend must run like the evaluator, by
+// name. It covers recursion, globals assigned by callees, int overflow and
+// truncation, mixed arithmetic and comparisons, float printing and a runtime
+// error after some output, where the first of several divisions by zero must
+// be the one reported.
+func corpus(t *testing.T) map[string]string {
+	demo, err := os.ReadFile("../testdata/demo.pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{
+		"demo.pat": string(demo),
+		"fib.pat": `program fib;
+var n, r : int;
+void fib(k : int) [
+    var a, b : int;
+    {
+        if (k < 2) {
+            r = k;
+        } else {
+            fib(k - 1);
+            a = r;
+            fib(k - 2);
+            b = r;
+            r = a + b;
+        };
+    }
+];
+main {
+    n = 0;
+    while (n <= 15) do {
+        fib(n);
+        print(n, r);
+        n = n + 1;
+    };
+}
+end`,
+		"arith.pat": `program arith;
+var i, j : int;
+    f, g : float;
+void locals(n : int) [
+    var acc : int;
+        x : float;
+    {
+        print("fresh", acc, x);
+        acc = acc + n;
+        x = n / 3;
+        print(acc, x, n / 3.0);
+    }
+];
+main {
+    i = 9223372036854775807;
+    i = i + 1;
+    print(i, 9223372036854775807 + 1, -i);
+    print(7 / 2, -7 / 2, 7 / -2, 2.5 * 4, 1 / 3.0);
+    j = 3;
+    f = j;
+    g = f / 8;
+    print(f, g, 100000.0 * 10, 0.0001 / 10, 100000000000000000000.0, 123456789.0);
+    print(i < f, 3 == 3.0, 2 != 2, j >= 3, j <= 2.5, 1 > 2);
+    locals(5);
+    locals(7);
+    print(-(-j), +j, -(2.5));
+}
+end`,
+		"order.pat": `program order;
+var a, b : int;
+main {
+    print("100% done??\n", 7 / 2, 9 / 4.0);
+    b = 1;
+    while (a / b < 8 / b / 2) do {
+        a = a + 1;
+    };
+    print(a);
+    print(1 / a, 2 / b, 3 / (a - a), 4 / (b - b));
+}
+end`,
+		"divzero.pat": `program divzero;
+var i, z : int;
+main {
+    while (i < 3) do {
+        print(i, 10 / (2 - i));
+        i = i + 1;
+    };
+}
+end`,
+	}
+}
+
+// evaluate runs src with the evaluator and returns what it prints and the
+// runtime error it reports, as patito run would write it to stderr.
+func evaluate(t *testing.T, name, src string) (stdout, stderr string) {
+	t.Helper()
+	prog, _ := check(t, src)
+	var out bytes.Buffer
+	if err := evaluator.New(&out).Run(prog); err != nil {
+		return out.String(), name + ":" + err.Error() + "\n"
+	}
+	return out.String(), ""
+}
+
+// run runs a command and returns its output. A runtime error must exit with
+// status 1, like patito run.
+func run(t *testing.T, cmd *exec.Cmd) (stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 1 && errOut.Len() > 0 {
+		return out.String(), errOut.String()
+	}
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", cmd, err, errOut.String())
+	}
+	return out.String(), errOut.String()
+}
+
+// differential translates every program of the corpus with backend, runs the
+// file it writes in dir with execute and compares its output with the
+// evaluator's.
+func differential(t *testing.T, ext string, backend func(io.Writer, *ast.Program, *semantic.FuncDir, string) error, execute func(t *testing.T, dir, file string) (stdout, stderr string)) {
+	for name, src := range corpus(t) {
+		t.Run(name, func(t *testing.T) {
+			prog, dir := check(t, src)
+			var code bytes.Buffer
+			if err := backend(&code, prog, dir, name); err != nil {
+				t.Fatal(err)
+			}
+			tmp := t.TempDir()
+			file := filepath.Join(tmp, "main"+ext)
+			if err := os.WriteFile(file, code.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			stdout, stderr := execute(t, tmp, file)
+			wantOut, wantErr := evaluate(t, name, src)
+			if stdout != wantOut || stderr != wantErr {
+				t.Fatalf("output differs from the evaluator.\nexpected:\n%s%s\ngot:\n%s%s\ncode:\n%s", wantOut, wantErr, stdout, stderr, code.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package gen
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// goPrelude holds the helpers every Go program uses. Patito names get a prefix
+// (v_ for vars, f_ for functions) so they never clash with these, with Go
+// keywords or with predeclared identifiers.
+const goPrelude = `
+var inf, nan = math.Inf(1), math.NaN()
+
+// fail reports a runtime error the way patito run does and exits.
+func fail(pos, msg string) {
+	fmt.Fprintf(os.Stderr, "%s: runtime error: %s\n", pos, msg)
+	os.Exit(1)
+}
+
+func divInt(a, b int64, pos string) int64 {
+	if b == 0 {
+		fail(pos, "integer division by zero")
+	}
+	return a / b
+}
+
+func divFloat(a, b float64, pos string) float64 {
+	if b == 0 {
+		fail(pos, "float division by zero")
+	}
+	return a / b
+}
+
+// fmtFloat formats f like print does: 6 significant digits, as C's %g.
+func fmtFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', 6, 64)
+}
+`
+
+// Go writes prog, which passed semantic.Check with dir, as a Go main package.
+// Globals become package vars and functions become Go funcs whose locals are
+// declared, and so zeroed, on every call. file is the name of the source, for
+// the positions of runtime errors.
+func Go(w io.Writer, prog *ast.Program, dir *semantic.FuncDir, file string) error {
+	g := &goGen{scope: scope{dir: dir}, file: file}
+	g.line("// Code generated by patito build from %s. DO NOT EDIT.", file)
+	g.line("")
+	g.line("package main")
+	g.line("")
+	g.line("import (")
+	for _, pkg := range []string{"fmt", "math", "os", "strconv"} {
+		g.line("\t%q", pkg)
+	}
+	g.line(")")
+	g.sb.WriteString(goPrelude)
+
+	if globals := dir.Globals.All(); len(globals) > 0 {
+		g.line("")
+		g.line("var (")
+		for _, v := range globals {
+			g.line("\tv_%s %s", v.Name, goType(v.Type))
+		}
+		g.line(")")
+	}
+	for _, fn := range dir.Funcs() {
+		g.fn = fn
+		params := make([]string, len(fn.Params))
+		for i, p := range fn.Params {
+			params[i] = fmt.Sprintf("v_%s %s", p.Name, goType(p.Type))
+		}
+		g.line("")
+		g.line("func f_%s(%s) {", fn.Name, joinComma(params))
+		g.indent++
+		for _, v := range fn.Vars.All() {
+			if v.Scope == semantic.Local {
+				// Go rejects locals that are never used
+				g.line("var v_%s %s", v.Name, goType(v.Type))
+				g.line("_ = v_%s", v.Name)
+			}
+		}
+		g.block(fn.Decl.Body)
+		g.indent--
+		g.line("}")
+	}
+	g.fn = nil
+	g.line("")
+	g.line("func main() {")
+	g.indent++
+	g.block(prog.Main)
+	g.indent--
+	g.line("}")
+
+	// gofmt aligns the declarations
+	code, err := format.Source([]byte(g.sb.String()))
+	if err != nil {
+		return fmt.Errorf("gen: invalid Go code: %v", err)
+	}
+	_, err = w.Write(code)
+	return err
+}
+
+type goGen struct {
+	scope
+	writer
+	file string
+}
+
+func goType(t semantic.Type) string {
+	if t == semantic.Float {
+		return "float64"
+	}
+	return "int64"
+}
+
+func (g *goGen) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		g.statement(stmt)
+	}
+}
+
+func (g *goGen) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		v := g.lookup(s.Name.Value)
+		g.line("v_%s = %s", v.Name, g.convert(v.Type, s.Value))
+	case *ast.PrintStatement:
+		args := make([]string, len(s.Expressions))
+		for i, exp := range s.Expressions {
+			args[i] = g.top(exp)
+			if g.typeOf(exp) == semantic.Float {
+				args[i] = "fmtFloat(" + args[i] + ")"
+			}
+		}
+		g.line("fmt.Println(%s)", joinComma(args))
+	case *ast.CallStatement:
+		callee := g.dir.Lookup(s.Call.Function.Value)
+		args := make([]string, len(s.Call.Arguments))
+		for i, arg := range s.Call.Arguments {
+			args[i] = g.convert(callee.Params[i].Type, arg)
+		}
+		g.line("f_%s(%s)", callee.Name, joinComma(args))
+	case *ast.IfStatement:
+		g.line("if %s {", g.top(s.Condition))
+		g.indent++
+		g.block(s.Consequence)
+		g.indent--
+		if s.Alternative != nil {
+			g.line("} else {")
+			g.indent++
+			g.block(s.Alternative)
+			g.indent--
+		}
+		g.line("}")
+	case *ast.WhileStatement:
+		g.line("for %s {", g.top(s.Condition))
+		g.indent++
+		g.block(s.Body)
+		g.indent--
+		g.line("}")
+	case *ast.BlockStatement:
+		g.line("{")
+		g.indent++
+		g.block(s)
+		g.indent--
+		g.line("}")
+	}
+}
+
+// convert translates exp as a value of type t, promoting an int to float.
+func (g *goGen) convert(t semantic.Type, exp ast.Expression) string {
+	if t == semantic.Float {
+		return g.toFloat(exp, g.top(exp))
+	}
+	return g.top(exp)
+}
+
+// toFloat promotes code, the translation of exp, to float if exp is an int.
+func (g *goGen) toFloat(exp ast.Expression, code string) string {
+	if g.typeOf(exp) == semantic.Int {
+		return "float64(" + code + ")"
+	}
+	return code
+}
+
+// top translates exp where it needs no parentheses of its own.
+func (g *goGen) top(exp ast.Expression) string {
+	s := g.expr(exp)
+	if _, ok := exp.(*ast.InfixExpression); ok && strings.HasPrefix(s, "(") {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func (g *goGen) expr(exp ast.Expression) string {
+	if v, ok := constant(exp); ok {
+		return goValue(v)
+	}
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		return "v_" + x.Value
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(x.Value, 10)
+	case *ast.FloatLiteral:
+		return goValue(evaluator.Float(x.Value))
+	case *ast.BooleanLiteral:
+		return strconv.FormatBool(x.Value)
+	case *ast.StringLiteral:
+		return strconv.Quote(x.Value)
+	case *ast.PrefixExpression:
+		right := g.expr(x.Right)
+		if x.Operator != "-" {
+			return right
+		}
+		if strings.HasPrefix(right, "-") {
+			return "-(" + right + ")"
+		}
+		return "-" + right
+	case *ast.InfixExpression:
+		l, r := g.expr(x.Left), g.expr(x.Right)
+		lt, rt := g.typeOf(x.Left), g.typeOf(x.Right)
+		if lt != rt {
+			l, r = g.toFloat(x.Left, l), g.toFloat(x.Right, r)
+		}
+		if x.Operator == "/" {
+			div := "divInt"
+			if lt == semantic.Float || rt == semantic.Float {
+				div = "divFloat"
+			}
+			pos := x.Right.Position()
+			return fmt.Sprintf("%s(%s, %s, %q)", div, l, r, fmt.Sprintf("%s:%d:%d", g.file, pos.Line, pos.Column))
+		}
+		return "(" + l + " " + x.Operator + " " + r + ")"
+	}
+	panic(fmt.Sprintf("gen: unexpected expression %T", exp))
+}
+
+// goValue writes a constant as a Go expression of its type.
+func goValue(v evaluator.Value) string {
+	f, ok := v.(evaluator.Float)
+	switch {
+	case !ok:
+		return v.String()
+	case math.IsNaN(float64(f)):
+		return "nan"
+	case math.IsInf(float64(f), 1):
+		return "inf"
+	case math.IsInf(float64(f), -1):
+		return "-inf"
+	}
+	return formatFloat(float64(f))
+}
@@ -0,0 +1,26 @@
+package gen
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	differential(t, ".go", Go, func(t *testing.T, dir, src string) (string, string) {
+		bin := filepath.Join(dir, "main")
+		build := exec.Command(goTool, "build", "-o", bin, src)
+		build.Dir = dir
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("go build: %v\n%s", err, out)
+		}
+		return run(t, exec.Command(bin))
+	})
+}
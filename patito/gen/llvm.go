@@ -0,0 +1,341 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"patito/ast"
+	"patito/semantic"
+	"patito/ssa"
+)
+
+// llvmPrelude declares the C library functions the module calls and defines
+// the helpers every module uses. div_int checks for zero and for -1, since
+// sdiv is undefined for both.
+const llvmPrelude = `
+@stderr = external global ptr
+@.fmt_int = private unnamed_addr constant [7 x i8] c"%s%lld\00"
+@.fmt_float = private unnamed_addr constant [5 x i8] c"%s%g\00"
+@.fmt_str = private unnamed_addr constant [5 x i8] c"%s%s\00"
+@.none = private unnamed_addr constant [1 x i8] c"\00"
+@.space = private unnamed_addr constant [2 x i8] c" \00"
+@.true = private unnamed_addr constant [5 x i8] c"true\00"
+@.false = private unnamed_addr constant [6 x i8] c"false\00"
+@.nan = private unnamed_addr constant [4 x i8] c"NaN\00"
+@.posinf = private unnamed_addr constant [5 x i8] c"+Inf\00"
+@.neginf = private unnamed_addr constant [5 x i8] c"-Inf\00"
+
+declare i32 @printf(ptr, ...)
+declare i32 @putchar(i32)
+declare i32 @fflush(ptr)
+declare i32 @fputs(ptr, ptr)
+declare void @exit(i32) noreturn
+
+; fail writes the runtime error msg to stderr, after what print wrote to
+; stdout, and exits with status 1.
+define internal void @fail(ptr %msg) noreturn {
+	call i32 @fflush(ptr null)
+	%err = load ptr, ptr @stderr
+	call i32 @fputs(ptr %msg, ptr %err)
+	call void @exit(i32 1)
+	unreachable
+}
+
+; print_float writes prefix and then f the way print does: 6 significant
+; digits, as %g, with Go's names for infinities and NaN.
+define internal void @print_float(ptr %prefix, double %f) {
+entry:
+	%isnan = fcmp uno double %f, %f
+	%isposinf = fcmp oeq double %f, 0x7FF0000000000000
+	%isneginf = fcmp oeq double %f, 0xFFF0000000000000
+	%inf = select i1 %isposinf, ptr @.posinf, ptr @.neginf
+	%name = select i1 %isnan, ptr @.nan, ptr %inf
+	%isinf = or i1 %isposinf, %isneginf
+	%special = or i1 %isnan, %isinf
+	br i1 %special, label %named, label %number
+named:
+	call i32 (ptr, ...) @printf(ptr @.fmt_str, ptr %prefix, ptr %name)
+	ret void
+number:
+	call i32 (ptr, ...) @printf(ptr @.fmt_float, ptr %prefix, double %f)
+	ret void
+}
+
+define internal i64 @div_int(i64 %a, i64 %b, ptr %msg) {
+entry:
+	%zero = icmp eq i64 %b, 0
+	br i1 %zero, label %fail, label %nonzero
+fail:
+	call void @fail(ptr %msg)
+	unreachable
+nonzero:
+	%minus1 = icmp eq i64 %b, -1
+	br i1 %minus1, label %neg, label %div
+neg:
+	%n = sub i64 0, %a
+	ret i64 %n
+div:
+	%q = sdiv i64 %a, %b
+	ret i64 %q
+}
+
+define internal double @div_float(double %a, double %b, ptr %msg) {
+entry:
+	%zero = fcmp oeq double %b, 0.0
+	br i1 %zero, label %fail, label %div
+fail:
+	call void @fail(ptr %msg)
+	unreachable
+div:
+	%q = fdiv double %a, %b
+	ret double %q
+}
+`
+
+// LLVM writes prog, which passed semantic.Check with dir, as a module of LLVM
+// IR in the text format, with opaque pointers, to be linked with the C
+// library, which prints. file is the name of the source, for the positions of
+// runtime errors.
+//
+// The IR follows the SSA form of package ssa value by value: LLVM registers
+// are SSA values too, so params and locals need no alloca and the phis carry
+// over as they are. Globals become module globals, loaded and stored where the
+// SSA form does.
+func LLVM(w io.Writer, prog *ast.Program, dir *semantic.FuncDir, file string) error {
+	p := ssa.Build(prog, dir)
+	if err := ssa.Verify(p); err != nil {
+		return fmt.Errorf("gen: invalid SSA: %v", err)
+	}
+	g := &llvmGen{writer: &writer{}, file: file, strings: map[string]string{}}
+	var funcs strings.Builder
+	for _, fn := range p.Funcs {
+		g.writer = &writer{}
+		g.function(fn)
+		funcs.WriteString(g.sb.String())
+	}
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "; Code generated by patito build from %s. DO NOT EDIT.\n", file)
+	fmt.Fprintf(out, "source_filename = %s\n", llvmQuote(file, false))
+	if len(p.Globals) > 0 {
+		out.WriteString("\n")
+		for _, v := range p.Globals {
+			zero := "0"
+			if v.Type == semantic.Float {
+				zero = "0.0"
+			}
+			fmt.Fprintf(out, "@v_%s = internal global %s %s\n", v.Name, llvmType(v.Type), zero)
+		}
+	}
+	if len(g.order) > 0 {
+		out.WriteString("\n")
+		for _, s := range g.order {
+			fmt.Fprintf(out, "%s = private unnamed_addr constant [%d x i8] c%s\n", g.strings[s], len(s)+1, llvmQuote(s, true))
+		}
+	}
+	out.WriteString(llvmPrelude)
+	out.WriteString(funcs.String())
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+type llvmGen struct {
+	*writer
+	file    string
+	strings map[string]string // global of each string constant
+	order   []string          // strings in the order they were named
+
+	fn    *ssa.Func
+	temps int // extra registers of fn, for print
+}
+
+func llvmType(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "double"
+	case semantic.Bool:
+		return "i1"
+	case semantic.String:
+		return "ptr"
+	}
+	return "i64"
+}
+
+// str returns the global that holds s.
+func (g *llvmGen) str(s string) string {
+	name, ok := g.strings[s]
+	if !ok {
+		name = fmt.Sprintf("@.str%d", len(g.order))
+		g.strings[s] = name
+		g.order = append(g.order, s)
+	}
+	return name
+}
+
+func (g *llvmGen) function(fn *ssa.Func) {
+	g.fn, g.temps = fn, 0
+	g.line("")
+	if fn.Sem == nil {
+		g.line("define i32 @main() {")
+	} else {
+		params := make([]string, len(fn.Params))
+		for i, p := range fn.Params {
+			params[i] = fmt.Sprintf("%s %%v_%s", llvmType(p.Type), p.Name)
+		}
+		g.line("define internal void @f_%s(%s) {", fn.Name, joinComma(params))
+	}
+	for _, b := range fn.Blocks {
+		g.line("%s:", b)
+		g.indent++
+		for _, v := range b.Values {
+			g.value(v)
+		}
+		switch b.Kind {
+		case ssa.Plain:
+			g.line("br label %%%s", b.Succs[0])
+		case ssa.If:
+			g.line("br i1 %s, label %%%s, label %%%s", g.operand(b.Control), b.Succs[0], b.Succs[1])
+		case ssa.Return:
+			if fn.Sem == nil {
+				g.line("ret i32 0")
+			} else {
+				g.line("ret void")
+			}
+		}
+		g.indent--
+	}
+	g.line("}")
+}
+
+// operand writes v where an instruction reads it: constants inline, params by
+// their name and other values by their register.
+func (g *llvmGen) operand(v *ssa.Value) string {
+	switch v.Op {
+	case ssa.OpConst:
+		switch c := v.Const.(type) {
+		case int64:
+			return fmt.Sprint(c)
+		case float64:
+			// the hex form is exact, where a decimal one must be too
+			return fmt.Sprintf("0x%016X", math.Float64bits(c))
+		case bool:
+			return fmt.Sprint(c)
+		case string:
+			return g.str(c)
+		}
+	case ssa.OpParam:
+		return "%v_" + g.fn.Params[v.Index].Name
+	}
+	return "%" + v.String()
+}
+
+// typed writes v with its type, as an arg.
+func (g *llvmGen) typed(v *ssa.Value) string {
+	return llvmType(v.Type) + " " + g.operand(v)
+}
+
+var llvmInts = map[ssa.Op]string{
+	ssa.OpAdd: "add", ssa.OpSub: "sub", ssa.OpMul: "mul",
+	ssa.OpLt: "icmp slt", ssa.OpGt: "icmp sgt", ssa.OpLe: "icmp sle", ssa.OpGe: "icmp sge", ssa.OpEq: "icmp eq", ssa.OpNe: "icmp ne",
+}
+
+// llvmFloats are ordered comparisons, false with a NaN, but for !=, which is
+// unordered, and so true with a NaN, as in Go.
+var llvmFloats = map[ssa.Op]string{
+	ssa.OpAdd: "fadd", ssa.OpSub: "fsub", ssa.OpMul: "fmul",
+	ssa.OpLt: "fcmp olt", ssa.OpGt: "fcmp ogt", ssa.OpLe: "fcmp ole", ssa.OpGe: "fcmp oge", ssa.OpEq: "fcmp oeq", ssa.OpNe: "fcmp une",
+}
+
+func (g *llvmGen) value(v *ssa.Value) {
+	reg := "%" + v.String()
+	t := llvmType(v.Type)
+	switch v.Op {
+	case ssa.OpConst, ssa.OpParam:
+		// used inline
+	case ssa.OpPhi:
+		args := make([]string, len(v.Args))
+		for i, arg := range v.Args {
+			args[i] = fmt.Sprintf("[ %s, %%%s ]", g.operand(arg), v.Block.Preds[i])
+		}
+		g.line("%s = phi %s %s", reg, t, joinComma(args))
+	case ssa.OpLoad:
+		g.line("%s = load %s, ptr @v_%s", reg, t, v.Name)
+	case ssa.OpStore:
+		g.line("store %s, ptr @v_%s", g.typed(v.Args[0]), v.Name)
+	case ssa.OpCall:
+		args := make([]string, len(v.Args))
+		for i, arg := range v.Args {
+			args[i] = g.typed(arg)
+		}
+		g.line("call void @f_%s(%s)", v.Name, joinComma(args))
+	case ssa.OpPrint:
+		g.print(v)
+	case ssa.OpIntToFloat:
+		g.line("%s = sitofp %s to double", reg, g.typed(v.Args[0]))
+	case ssa.OpNeg:
+		if v.Type == semantic.Float {
+			g.line("%s = fneg %s", reg, g.typed(v.Args[0]))
+		} else {
+			g.line("%s = sub i64 0, %s", reg, g.operand(v.Args[0]))
+		}
+	case ssa.OpDiv:
+		msg := "float division by zero"
+		if v.Type == semantic.Int {
+			msg = "integer division by zero"
+		}
+		fail := g.str(fmt.Sprintf("%s:%d:%d: runtime error: %s\n", g.file, v.Pos.Line, v.Pos.Column, msg))
+		g.line("%s = call %s @div_%s(%s, %s, ptr %s)", reg, t, v.Type, g.typed(v.Args[0]), g.typed(v.Args[1]), fail)
+	default:
+		op := llvmInts[v.Op]
+		if v.Args[0].Type == semantic.Float {
+			op = llvmFloats[v.Op]
+		}
+		g.line("%s = %s %s, %s", reg, op, g.typed(v.Args[0]), g.operand(v.Args[1]))
+	}
+}
+
+// print writes each arg with printf, after a space but for the first, and
+// ends the line.
+func (g *llvmGen) print(v *ssa.Value) {
+	for i, arg := range v.Args {
+		prefix := "@.none"
+		if i > 0 {
+			prefix = "@.space"
+		}
+		switch arg.Type {
+		case semantic.Float:
+			g.line("call void @print_float(ptr %s, %s)", prefix, g.typed(arg))
+		case semantic.Int:
+			g.line("call i32 (ptr, ...) @printf(ptr @.fmt_int, ptr %s, %s)", prefix, g.typed(arg))
+		case semantic.Bool:
+			g.temps++
+			name := fmt.Sprintf("%%t%d", g.temps)
+			g.line("%s = select %s, ptr @.true, ptr @.false", name, g.typed(arg))
+			g.line("call i32 (ptr, ...) @printf(ptr @.fmt_str, ptr %s, ptr %s)", prefix, name)
+		case semantic.String:
+			g.line("call i32 (ptr, ...) @printf(ptr @.fmt_str, ptr %s, %s)", prefix, g.typed(arg))
+		}
+	}
+	g.line("call i32 @putchar(i32 10)")
+}
+
+// llvmQuote writes s as an LLVM string, with bytes outside printable ASCII as
+// two-digit hex escapes, and with the NUL that C expects if nul is set.
+func llvmQuote(s string, nul bool) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&sb, `\%02X`, c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	if nul {
+		sb.WriteString(`\00`)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLLVM(t *testing.T) {
+	for name, src := range corpus(t) {
+		prog, dir := check(t, src)
+		var code bytes.Buffer
+		if err := LLVM(&code, prog, dir, name); err != nil {
+			t.Fatal(err)
+		}
+		if err := validateLL(code.String()); err != nil {
+			t.Errorf("%s: %v\n%s", name, err, code.String())
+		}
+	}
+
+	if testing.Short() {
+		t.Skip("runs LLVM modules")
+	}
+	lli, err := exec.LookPath("lli")
+	if err != nil {
+		t.Skip("no lli command")
+	}
+	var flags []string
+	if version(t, lli) < 15 {
+		// opaque pointers became the default in LLVM 15
+		flags = append(flags, "-opaque-pointers")
+	}
+	differential(t, ".ll", LLVM, func(t *testing.T, dir, src string) (string, string) {
+		return run(t, exec.Command(lli, append(flags, src)...))
+	})
+}
+
+// version returns the major version of the LLVM tool at path.
+func version(t *testing.T, path string) int {
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`LLVM version (\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("no version in %q", out)
+	}
+	n, _ := strconv.Atoi(string(m[1]))
+	return n
+}
+
+var (
+	llDefined = regexp.MustCompile(`^\s*(%[\w.]+) =`)
+	llLocal   = regexp.MustCompile(`%[\w.]+`)
+	llGlobal  = regexp.MustCompile(`@[\w.]+`)
+)
+
+// validateLL checks the structure of an LLVM module where no LLVM tool can:
+// every global it uses is defined or declared, and in each function every
+// register and label it uses is defined and every block ends with a
+// terminator.
+func validateLL(code string) error {
+	globals := map[string]bool{}
+	for _, line := range strings.Split(code, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@"):
+			globals[strings.Fields(line)[0]] = true
+		case strings.HasPrefix(line, "declare "), strings.HasPrefix(line, "define "):
+			globals[llGlobal.FindString(line)] = true
+		}
+	}
+
+	var defined, used map[string]bool
+	last := "" // last instruction, empty at the start of a function
+	for n, line := range strings.Split(code, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if i := strings.Index(trimmed, ";"); i >= 0 && !strings.Contains(trimmed, `c"`) {
+			trimmed = strings.TrimSpace(trimmed[:i])
+		}
+		for _, g := range llGlobal.FindAllString(trimmed, -1) {
+			if !globals[g] {
+				return fmt.Errorf("line %d: %s is not defined", n+1, g)
+			}
+		}
+		switch {
+		case strings.HasPrefix(trimmed, "define "):
+			defined, used = map[string]bool{}, map[string]bool{}
+			for _, p := range llLocal.FindAllString(trimmed, -1) {
+				defined[p] = true
+			}
+			last = ""
+		case trimmed == "}":
+			if !isTerminator(last) {
+				return fmt.Errorf("line %d: the last block does not end with a terminator", n+1)
+			}
+			for name := range used {
+				if !defined[name] {
+					return fmt.Errorf("line %d: %s is used but not defined", n+1, name)
+				}
+			}
+			defined = nil
+		case defined == nil || trimmed == "":
+		case strings.HasSuffix(trimmed, ":"):
+			if last != "" && !isTerminator(last) {
+				return fmt.Errorf("line %d: the block before %s does not end with a terminator", n+1, trimmed)
+			}
+			defined["%"+strings.TrimSuffix(trimmed, ":")] = true
+			last = "label"
+		default:
+			if isTerminator(last) {
+				return fmt.Errorf("line %d: instruction after a terminator", n+1)
+			}
+			if m := llDefined.FindStringSubmatch(trimmed); m != nil {
+				if defined[m[1]] {
+					return fmt.Errorf("line %d: %s is defined twice", n+1, m[1])
+				}
+				defined[m[1]] = true
+				trimmed = trimmed[len(m[0]):]
+			}
+			for _, name := range llLocal.FindAllString(trimmed, -1) {
+				used[name] = true
+			}
+			last = strings.Fields(trimmed)[0]
+		}
+	}
+	return nil
+}
+
+func isTerminator(op string) bool {
+	return op == "br" || op == "ret" || op == "unreachable"
+}
+
+func TestValidateLL(t *testing.T) {
+	for _, bad := range []string{
+		"define void @f() {\nb0:\n\t%v1 = add i64 %v2, 1\n\tret void\n}\n",
+		"define void @f() {\nb0:\n\tbr label %b1\n}\n",
+		"define void @f() {\nb0:\n\t%v1 = add i64 1, 1\nb1:\n\tret void\n}\n",
+		"define void @f() {\nb0:\n\tcall void @g()\n\tret void\n}\n",
+	} {
+		if validateLL(bad) == nil {
+			t.Errorf("accepted\n%s", bad)
+		}
+	}
+}
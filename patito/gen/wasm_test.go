@@ -0,0 +1,474 @@
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"patito/evaluator"
+)
+
+// This file is a small WebAssembly interpreter that runs the text format
+// directly, for the subset of it that WAT writes, with the host functions a
+// Patito module imports. It traps where Wasm does, so a missing check in the
+// generated code shows up as a failure.
+
+var errExit = errors.New("exit")
+
+type wasmModule struct {
+	funcs   map[string]*wasmFunc
+	exports map[string]*wasmFunc
+	globals map[string]uint64
+	memory  []byte
+
+	out, errOut strings.Builder
+}
+
+type wasmFunc struct {
+	host    string // name of the import, for host functions
+	params  int
+	results int
+	locals  map[string]int // params first, then locals
+	nlocals int
+	body    []wasmInstr
+}
+
+type wasmInstr struct {
+	op, arg string
+	end     int // index of the matching end, for block, loop, if and else
+	els     int // index of the else of an if, or 0
+}
+
+// sexp is an atom, a string or a list of the text format.
+type sexp struct {
+	atom   string
+	quoted bool
+	list   []sexp
+	isList bool
+}
+
+func (s sexp) head() string {
+	if !s.isList || len(s.list) == 0 {
+		return ""
+	}
+	return s.list[0].atom
+}
+
+func parseSexp(src string) (sexp, error) {
+	i := 0
+	var parse func() (sexp, error)
+	skip := func() {
+		for i < len(src) {
+			switch {
+			case strings.HasPrefix(src[i:], ";;"):
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			case strings.ContainsRune(" \t\r\n", rune(src[i])):
+				i++
+			default:
+				return
+			}
+		}
+	}
+	parse = func() (sexp, error) {
+		skip()
+		if i >= len(src) {
+			return sexp{}, errors.New("unexpected end of input")
+		}
+		switch src[i] {
+		case '(':
+			i++
+			list := sexp{isList: true}
+			for {
+				skip()
+				if i < len(src) && src[i] == ')' {
+					i++
+					return list, nil
+				}
+				item, err := parse()
+				if err != nil {
+					return sexp{}, err
+				}
+				list.list = append(list.list, item)
+			}
+		case ')':
+			return sexp{}, fmt.Errorf("unexpected ) at %d", i)
+		case '"':
+			var sb strings.Builder
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] != '\\' {
+					sb.WriteByte(src[i])
+					continue
+				}
+				i++
+				if i < len(src) && (src[i] == '"' || src[i] == '\\') {
+					sb.WriteByte(src[i])
+					continue
+				}
+				if i+2 > len(src) {
+					return sexp{}, errors.New("bad escape")
+				}
+				b, err := strconv.ParseUint(src[i:i+2], 16, 8)
+				if err != nil {
+					return sexp{}, fmt.Errorf("bad escape %q", src[i:i+2])
+				}
+				sb.WriteByte(byte(b))
+				i++
+			}
+			if i >= len(src) {
+				return sexp{}, errors.New("unterminated string")
+			}
+			i++
+			return sexp{atom: sb.String(), quoted: true}, nil
+		}
+		start := i
+		for i < len(src) && !strings.ContainsRune(" \t\r\n()", rune(src[i])) {
+			i++
+		}
+		return sexp{atom: src[start:i]}, nil
+	}
+	s, err := parse()
+	if err == nil {
+		if skip(); i < len(src) {
+			err = fmt.Errorf("trailing input at %d", i)
+		}
+	}
+	return s, err
+}
+
+func loadWAT(src string) (*wasmModule, error) {
+	mod, err := parseSexp(src)
+	if err != nil {
+		return nil, err
+	}
+	if mod.head() != "module" {
+		return nil, errors.New("not a module")
+	}
+	m := &wasmModule{funcs: map[string]*wasmFunc{}, exports: map[string]*wasmFunc{}, globals: map[string]uint64{}}
+	for _, field := range mod.list[1:] {
+		switch field.head() {
+		case "import":
+			desc := field.list[3]
+			fn := &wasmFunc{host: field.list[2].atom}
+			for _, item := range desc.list[2:] {
+				if item.head() == "param" {
+					fn.params += len(item.list) - 1
+				}
+			}
+			m.funcs[desc.list[1].atom] = fn
+		case "memory":
+			pages, err := strconv.Atoi(field.list[len(field.list)-1].atom)
+			if err != nil {
+				return nil, err
+			}
+			m.memory = make([]byte, pages*65536)
+		case "data":
+			offset, err := strconv.Atoi(field.list[1].list[1].atom)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range field.list[2:] {
+				offset += copy(m.memory[offset:], s.atom)
+			}
+		case "global":
+			if len(field.list[3].list) != 2 {
+				return nil, fmt.Errorf("bad global %s", field.list[1].atom)
+			}
+			m.globals[field.list[1].atom] = 0
+		case "func":
+			if err := m.loadFunc(field); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown field %q", field.head())
+		}
+	}
+	return m, nil
+}
+
+// immediates lists the instructions that take an operand.
+var immediates = map[string]bool{
+	"i64.const": true, "f64.const": true, "i32.const": true,
+	"local.get": true, "local.set": true, "global.get": true, "global.set": true,
+	"call": true, "br": true, "br_if": true,
+}
+
+func (m *wasmModule) loadFunc(field sexp) error {
+	fn := &wasmFunc{locals: map[string]int{}}
+	items := field.list[1:]
+	if len(items) > 0 && !items[0].isList {
+		m.funcs[items[0].atom] = fn
+		items = items[1:]
+	}
+	for len(items) > 0 && items[0].isList {
+		switch item := items[0]; item.head() {
+		case "export":
+			m.exports[item.list[1].atom] = fn
+		case "param", "local":
+			fn.locals[item.list[1].atom] = fn.nlocals
+			fn.nlocals++
+			if item.head() == "param" {
+				fn.params++
+			}
+		case "result":
+			fn.results++
+		}
+		items = items[1:]
+	}
+	var open []int
+	for i := 0; i < len(items); i++ {
+		in := wasmInstr{op: items[i].atom}
+		if items[i].isList {
+			return fmt.Errorf("folded instruction %v", items[i])
+		}
+		hasLabel := (in.op == "block" || in.op == "loop") && i+1 < len(items) && strings.HasPrefix(items[i+1].atom, "$")
+		if immediates[in.op] || hasLabel {
+			i++
+			in.arg = items[i].atom
+		}
+		n := len(fn.body)
+		switch in.op {
+		case "block", "loop", "if":
+			open = append(open, n)
+		case "else":
+			fn.body[open[len(open)-1]].els = n
+		case "end":
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			fn.body[start].end = n
+			if els := fn.body[start].els; els > 0 {
+				fn.body[els].end = n
+			}
+		}
+		fn.body = append(fn.body, in)
+	}
+	if len(open) > 0 {
+		return errors.New("unterminated block")
+	}
+	return nil
+}
+
+func (m *wasmModule) call(fn *wasmFunc, args []uint64) (uint64, error) {
+	if fn.host != "" {
+		return 0, m.host(fn.host, args)
+	}
+	locals := make([]uint64, fn.nlocals)
+	copy(locals, args)
+	var stack []uint64
+	push := func(v uint64) { stack = append(stack, v) }
+	pop := func() uint64 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	b2i := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	type label struct {
+		name       string
+		start, end int
+		loop       bool
+	}
+	var labels []label
+
+	for pc := 0; pc < len(fn.body); pc++ {
+		in := fn.body[pc]
+		switch in.op {
+		case "i64.const":
+			v, err := strconv.ParseInt(in.arg, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			push(uint64(v))
+		case "i32.const":
+			v, err := strconv.ParseInt(in.arg, 10, 32)
+			if err != nil {
+				return 0, err
+			}
+			push(uint64(uint32(v)))
+		case "f64.const":
+			var f float64
+			switch in.arg {
+			case "inf":
+				f = math.Inf(1)
+			case "-inf":
+				f = math.Inf(-1)
+			case "nan":
+				f = math.NaN()
+			default:
+				var err error
+				if f, err = strconv.ParseFloat(in.arg, 64); err != nil {
+					return 0, err
+				}
+			}
+			push(math.Float64bits(f))
+		case "local.get", "local.set":
+			i, ok := fn.locals[in.arg]
+			if !ok {
+				return 0, fmt.Errorf("no local %s", in.arg)
+			}
+			if in.op == "local.get" {
+				push(locals[i])
+			} else {
+				locals[i] = pop()
+			}
+		case "global.get", "global.set":
+			if _, ok := m.globals[in.arg]; !ok {
+				return 0, fmt.Errorf("no global %s", in.arg)
+			}
+			if in.op == "global.get" {
+				push(m.globals[in.arg])
+			} else {
+				m.globals[in.arg] = pop()
+			}
+		case "call":
+			callee := m.funcs[in.arg]
+			if callee == nil {
+				return 0, fmt.Errorf("no function %s", in.arg)
+			}
+			args := append([]uint64(nil), stack[len(stack)-callee.params:]...)
+			stack = stack[:len(stack)-callee.params]
+			v, err := m.call(callee, args)
+			if err != nil {
+				return 0, err
+			}
+			if callee.results > 0 {
+				push(v)
+			}
+		case "block", "loop":
+			labels = append(labels, label{name: in.arg, start: pc, end: in.end, loop: in.op == "loop"})
+		case "if":
+			labels = append(labels, label{start: pc, end: in.end})
+			if pop() == 0 {
+				if in.els > 0 {
+					pc = in.els
+				} else {
+					pc = in.end - 1
+				}
+			}
+		case "else":
+			pc = in.end - 1
+		case "end":
+			labels = labels[:len(labels)-1]
+		case "br", "br_if":
+			if in.op == "br_if" && pop() == 0 {
+				break
+			}
+			k := len(labels) - 1
+			for k >= 0 && labels[k].name != in.arg {
+				k--
+			}
+			if k < 0 {
+				return 0, fmt.Errorf("no label %s", in.arg)
+			}
+			l := labels[k]
+			labels = labels[:k+1]
+			if l.loop {
+				pc = l.start
+			} else {
+				pc = l.end - 1
+			}
+		case "return":
+			pc = len(fn.body)
+		case "unreachable":
+			return 0, errors.New("unreachable executed")
+		case "i32.eqz", "i64.eqz":
+			push(b2i(pop() == 0))
+		case "f64.neg":
+			push(math.Float64bits(-math.Float64frombits(pop())))
+		case "f64.convert_i64_s":
+			push(math.Float64bits(float64(int64(pop()))))
+		default:
+			r, l := pop(), pop()
+			a, b := int64(l), int64(r)
+			x, y := math.Float64frombits(l), math.Float64frombits(r)
+			switch in.op {
+			case "i64.add":
+				push(uint64(a + b))
+			case "i64.sub":
+				push(uint64(a - b))
+			case "i64.mul":
+				push(uint64(a * b))
+			case "i64.div_s":
+				if b == 0 {
+					return 0, errors.New("integer divide by zero")
+				}
+				if a == math.MinInt64 && b == -1 {
+					return 0, errors.New("integer overflow")
+				}
+				push(uint64(a / b))
+			case "i64.eq":
+				push(b2i(a == b))
+			case "i64.ne":
+				push(b2i(a != b))
+			case "i64.lt_s":
+				push(b2i(a < b))
+			case "i64.gt_s":
+				push(b2i(a > b))
+			case "i64.le_s":
+				push(b2i(a <= b))
+			case "i64.ge_s":
+				push(b2i(a >= b))
+			case "f64.add":
+				push(math.Float64bits(x + y))
+			case "f64.sub":
+				push(math.Float64bits(x - y))
+			case "f64.mul":
+				push(math.Float64bits(x * y))
+			case "f64.div":
+				push(math.Float64bits(x / y))
+			case "f64.eq":
+				push(b2i(x == y))
+			case "f64.ne":
+				push(b2i(x != y))
+			case "f64.lt":
+				push(b2i(x < y))
+			case "f64.gt":
+				push(b2i(x > y))
+			case "f64.le":
+				push(b2i(x <= y))
+			case "f64.ge":
+				push(b2i(x >= y))
+			default:
+				return 0, fmt.Errorf("unknown instruction %s", in.op)
+			}
+		}
+	}
+	if fn.results > 0 {
+		return pop(), nil
+	}
+	return 0, nil
+}
+
+// host runs the functions a Patito module imports.
+func (m *wasmModule) host(name string, args []uint64) error {
+	switch name {
+	case "print_int":
+		m.out.WriteString(evaluator.Int(args[0]).String())
+	case "print_float":
+		m.out.WriteString(evaluator.Float(math.Float64frombits(args[0])).String())
+	case "print_bool":
+		m.out.WriteString(evaluator.Bool(args[0] != 0).String())
+	case "print_string", "fail":
+		ptr, n := uint32(args[0]), uint32(args[1])
+		if uint64(ptr)+uint64(n) > uint64(len(m.memory)) {
+			return errors.New("out of bounds memory access")
+		}
+		if name == "print_string" {
+			m.out.Write(m.memory[ptr : ptr+n])
+			return nil
+		}
+		m.errOut.Write(m.memory[ptr : ptr+n])
+		m.errOut.WriteString("\n")
+		return errExit
+	default:
+		return fmt.Errorf("no host function %s", name)
+	}
+	return nil
+}
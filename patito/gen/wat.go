@@ -0,0 +1,397 @@
+package gen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// watImports are the host functions a WebAssembly module imports from "env".
+// The print functions write one value the way print does, so the host formats
+// floats with 6 significant digits; print_string writes len bytes of memory
+// from ptr. fail writes the runtime error at ptr, a whole line without its
+// newline, to stderr and stops the program: it must not return.
+const watImports = `	(import "env" "print_int" (func $print_int (param i64)))
+	(import "env" "print_float" (func $print_float (param f64)))
+	(import "env" "print_bool" (func $print_bool (param i32)))
+	(import "env" "print_string" (func $print_string (param i32 i32)))
+	(import "env" "fail" (func $fail (param i32 i32)))
+`
+
+// watHelpers are the functions every module defines. i64.div_s traps on a
+// division by zero and on the overflow of the minimum int by -1, so div_int
+// checks both first.
+const watHelpers = `
+	(func $div_int (param $a i64) (param $b i64) (param $ptr i32) (param $len i32) (result i64)
+		local.get $b
+		i64.eqz
+		if
+			local.get $ptr
+			local.get $len
+			call $fail
+			unreachable
+		end
+		local.get $b
+		i64.const -1
+		i64.eq
+		if
+			i64.const 0
+			local.get $a
+			i64.sub
+			return
+		end
+		local.get $a
+		local.get $b
+		i64.div_s
+	)
+
+	(func $div_float (param $a f64) (param $b f64) (param $ptr i32) (param $len i32) (result f64)
+		local.get $b
+		f64.const 0
+		f64.eq
+		if
+			local.get $ptr
+			local.get $len
+			call $fail
+			unreachable
+		end
+		local.get $a
+		local.get $b
+		f64.div
+	)
+`
+
+// WAT writes prog, which passed semantic.Check with dir, as a WebAssembly
+// module in the text format. Globals become mutable Wasm globals and functions
+// become Wasm functions whose locals start at zero on every call; main is
+// exported as "main", along with the memory that holds the strings. file is
+// the name of the source, for the positions of runtime errors.
+func WAT(w io.Writer, prog *ast.Program, dir *semantic.FuncDir, file string) error {
+	g := &watGen{scope: scope{dir: dir}, file: file, data: map[string]int{}}
+	var funcs strings.Builder
+	for _, fn := range dir.Funcs() {
+		g.fn = fn
+		params := make([]string, len(fn.Params))
+		for i, p := range fn.Params {
+			params[i] = fmt.Sprintf(" (param $v_%s %s)", p.Name, watType(p.Type))
+		}
+		var locals []string
+		for _, v := range fn.Vars.All() {
+			if v.Scope == semantic.Local {
+				locals = append(locals, fmt.Sprintf("(local $v_%s %s)", v.Name, watType(v.Type)))
+			}
+		}
+		g.function(&funcs, fmt.Sprintf("$f_%s%s", fn.Name, strings.Join(params, "")), locals, fn.Decl.Body)
+	}
+	g.fn = nil
+	g.function(&funcs, `(export "main")`, nil, prog.Main)
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, ";; Code generated by patito build from %s. DO NOT EDIT.\n", file)
+	out.WriteString("(module\n")
+	out.WriteString(watImports)
+	fmt.Fprintf(out, "\t(memory (export \"memory\") %d)\n", len(g.memory)/65536+1)
+	if len(g.memory) > 0 {
+		fmt.Fprintf(out, "\t(data (i32.const 0) %s)\n", watQuote(g.memory))
+	}
+	for _, v := range dir.Globals.All() {
+		t := watType(v.Type)
+		fmt.Fprintf(out, "\t(global $v_%s (mut %s) (%s.const 0))\n", v.Name, t, t)
+	}
+	out.WriteString(watHelpers)
+	out.WriteString(funcs.String())
+	out.WriteString(")\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+type watGen struct {
+	scope
+	*writer // body of the function being translated
+	file    string
+
+	memory string         // contents of the data segment
+	data   map[string]int // offset of each string in memory
+	labels int            // labels used so far, for loops
+
+	// scratch locals of the function being translated, by type: print
+	// evaluates every value before it writes the first one
+	scratch map[string]int
+}
+
+func watType(t semantic.Type) string {
+	switch t {
+	case semantic.Float:
+		return "f64"
+	case semantic.Bool:
+		return "i32"
+	}
+	return "i64"
+}
+
+// function writes a Wasm function with the given name and params, locals and
+// body, followed by the scratch locals the body needs.
+func (g *watGen) function(out *strings.Builder, header string, locals []string, body *ast.BlockStatement) {
+	g.writer = &writer{indent: 2}
+	g.scratch = map[string]int{}
+	g.block(body)
+	for _, t := range []string{"i64", "f64", "i32"} {
+		for i := 0; i < g.scratch[t]; i++ {
+			locals = append(locals, fmt.Sprintf("(local $%s_%d %s)", t, i, t))
+		}
+	}
+	fmt.Fprintf(out, "\n\t(func %s\n", header)
+	for _, l := range locals {
+		fmt.Fprintf(out, "\t\t%s\n", l)
+	}
+	out.WriteString(g.sb.String())
+	out.WriteString("\t)\n")
+}
+
+// str places s in memory, once, and returns its offset and length.
+func (g *watGen) str(s string) (ptr, n int) {
+	ptr, ok := g.data[s]
+	if !ok {
+		ptr = len(g.memory)
+		g.data[s] = ptr
+		g.memory += s
+	}
+	return ptr, len(s)
+}
+
+func (g *watGen) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		g.statement(stmt)
+	}
+}
+
+func (g *watGen) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		v := g.lookup(s.Name.Value)
+		g.convert(v.Type, s.Value)
+		if v.Scope == semantic.Global {
+			g.line("global.set $v_%s", v.Name)
+		} else {
+			g.line("local.set $v_%s", v.Name)
+		}
+	case *ast.PrintStatement:
+		g.print(s.Expressions)
+	case *ast.CallStatement:
+		callee := g.dir.Lookup(s.Call.Function.Value)
+		for i, arg := range s.Call.Arguments {
+			g.convert(callee.Params[i].Type, arg)
+		}
+		g.line("call $f_%s", callee.Name)
+	case *ast.IfStatement:
+		g.expr(s.Condition)
+		g.line("if")
+		g.indent++
+		g.block(s.Consequence)
+		g.indent--
+		if s.Alternative != nil {
+			g.line("else")
+			g.indent++
+			g.block(s.Alternative)
+			g.indent--
+		}
+		g.line("end")
+	case *ast.WhileStatement:
+		g.labels++
+		n := g.labels
+		g.line("block $done%d", n)
+		g.indent++
+		g.line("loop $loop%d", n)
+		g.indent++
+		g.expr(s.Condition)
+		g.line("i32.eqz")
+		g.line("br_if $done%d", n)
+		g.block(s.Body)
+		g.line("br $loop%d", n)
+		g.indent--
+		g.line("end")
+		g.indent--
+		g.line("end")
+	case *ast.BlockStatement:
+		g.block(s)
+	}
+}
+
+// print evaluates every value of exps into a scratch local, so that a runtime
+// error stops the program before it writes any of them, and then writes them
+// separated by spaces.
+func (g *watGen) print(exps []ast.Expression) {
+	used := map[string]int{}
+	scratch := make([]string, len(exps))
+	for i, exp := range exps {
+		t := g.typeOf(exp)
+		if t == semantic.String {
+			continue
+		}
+		wt := watType(t)
+		scratch[i] = fmt.Sprintf("$%s_%d", wt, used[wt])
+		used[wt]++
+		g.scratch[wt] = max(g.scratch[wt], used[wt])
+		g.expr(exp)
+		g.line("local.set %s", scratch[i])
+	}
+	for i, exp := range exps {
+		sep := ""
+		if i > 0 {
+			sep = " "
+		}
+		switch t := g.typeOf(exp); t {
+		case semantic.String:
+			g.printString(sep + exp.(*ast.StringLiteral).Value)
+			continue
+		case semantic.Int, semantic.Float, semantic.Bool:
+			if sep != "" {
+				g.printString(sep)
+			}
+			g.line("local.get %s", scratch[i])
+			g.line("call $print_%s", t)
+		}
+	}
+	g.printString("\n")
+}
+
+func (g *watGen) printString(s string) {
+	ptr, n := g.str(s)
+	g.line("i32.const %d", ptr)
+	g.line("i32.const %d", n)
+	g.line("call $print_string")
+}
+
+// convert pushes exp as a value of type t, promoting an int to float.
+func (g *watGen) convert(t semantic.Type, exp ast.Expression) {
+	g.expr(exp)
+	if t == semantic.Float && g.typeOf(exp) == semantic.Int {
+		g.line("f64.convert_i64_s")
+	}
+}
+
+// watOps maps the operators to their instructions, without the type prefix.
+var watOps = map[string][2]string{ // int, float
+	"+":  {"add", "add"},
+	"-":  {"sub", "sub"},
+	"*":  {"mul", "mul"},
+	"<":  {"lt_s", "lt"},
+	">":  {"gt_s", "gt"},
+	"<=": {"le_s", "le"},
+	">=": {"ge_s", "ge"},
+	"==": {"eq", "eq"},
+	"!=": {"ne", "ne"},
+}
+
+// expr pushes the value of exp.
+func (g *watGen) expr(exp ast.Expression) {
+	if v, ok := constant(exp); ok {
+		g.value(v)
+		return
+	}
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		if v := g.lookup(x.Value); v.Scope == semantic.Global {
+			g.line("global.get $v_%s", v.Name)
+		} else {
+			g.line("local.get $v_%s", v.Name)
+		}
+	case *ast.IntegerLiteral:
+		g.value(evaluator.Int(x.Value))
+	case *ast.FloatLiteral:
+		g.value(evaluator.Float(x.Value))
+	case *ast.BooleanLiteral:
+		g.value(evaluator.Bool(x.Value))
+	case *ast.PrefixExpression:
+		switch {
+		case x.Operator != "-":
+			g.expr(x.Right)
+		case g.typeOf(x.Right) == semantic.Int:
+			g.line("i64.const 0")
+			g.expr(x.Right)
+			g.line("i64.sub")
+		default:
+			g.expr(x.Right)
+			g.line("f64.neg")
+		}
+	case *ast.InfixExpression:
+		lt, rt := g.typeOf(x.Left), g.typeOf(x.Right)
+		isInt := lt == semantic.Int && rt == semantic.Int
+		t := semantic.Float
+		if isInt {
+			t = semantic.Int
+		}
+		g.convert(t, x.Left)
+		g.convert(t, x.Right)
+		if x.Operator == "/" {
+			msg := "float division by zero"
+			if isInt {
+				msg = "integer division by zero"
+			}
+			pos := x.Right.Position()
+			ptr, n := g.str(fmt.Sprintf("%s:%d:%d: runtime error: %s", g.file, pos.Line, pos.Column, msg))
+			g.line("i32.const %d", ptr)
+			g.line("i32.const %d", n)
+			g.line("call $div_%s", t)
+			return
+		}
+		op := watOps[x.Operator][1]
+		if isInt {
+			op = watOps[x.Operator][0]
+		}
+		g.line("%s.%s", watType(t), op)
+	default:
+		panic(fmt.Sprintf("gen: unexpected expression %T", exp))
+	}
+}
+
+// value pushes a constant.
+func (g *watGen) value(v evaluator.Value) {
+	switch v := v.(type) {
+	case evaluator.Int:
+		g.line("i64.const %d", v)
+	case evaluator.Float:
+		f := float64(v)
+		s := "nan"
+		switch {
+		case math.IsInf(f, 1):
+			s = "inf"
+		case math.IsInf(f, -1):
+			s = "-inf"
+		case !math.IsNaN(f):
+			s = formatFloat(f)
+		}
+		g.line("f64.const %s", s)
+	case evaluator.Bool:
+		b := 0
+		if v {
+			b = 1
+		}
+		g.line("i32.const %d", b)
+	}
+}
+
+// watQuote writes s as a Wasm string, with bytes outside printable ASCII as
+// two-digit hex escapes.
+func watQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&sb, `\%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
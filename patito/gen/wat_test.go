@@ -0,0 +1,113 @@
+package gen
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patito/internal/vmtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestWAT compares the module written for each program of the corpus with its
+// golden file in testdata, and has a WebAssembly tool check that the module
+// is valid when one is installed.
+func TestWAT(t *testing.T) {
+	validate := watValidator(t)
+	for name, src := range corpus(t) {
+		t.Run(name, func(t *testing.T) {
+			prog, dir := check(t, src)
+			var code bytes.Buffer
+			if err := WAT(&code, prog, dir, name); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", strings.TrimSuffix(name, ".pat")+".wat")
+			if *update {
+				if err := os.WriteFile(golden, code.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(code.Bytes(), want) {
+				t.Errorf("module differs from %s, rerun with -update if the change is intended.\ngot:\n%s", golden, code.String())
+			}
+			if validate == nil {
+				return
+			}
+			file := filepath.Join(t.TempDir(), "main.wat")
+			if err := os.WriteFile(file, code.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := validate(file).CombinedOutput(); err != nil {
+				t.Errorf("invalid module: %v\n%s", err, out)
+			}
+		})
+	}
+}
+
+// TestWATRun runs the module written for each program of the corpus, and of
+// the corpus of the virtual machines, in the interpreter of wasm_test.go, and
+// compares what it prints with the evaluator. overflow.pat is left out: a
+// module has no cap on calls, its runtime traps once its stack is exhausted.
+func TestWATRun(t *testing.T) {
+	differential(t, ".wat", WAT, func(t *testing.T, dir, file string) (string, string) {
+		return runWAT(t, vmtest.Read(t, file))
+	})
+	for _, c := range vmtest.Corpus(t, "../testdata/vm/*.pat") {
+		if c.Name == "overflow" {
+			continue
+		}
+		t.Run("vm/"+c.Name, func(t *testing.T) {
+			prog, dir := check(t, c.Src)
+			var code bytes.Buffer
+			if err := WAT(&code, prog, dir, c.Name+".pat"); err != nil {
+				t.Fatal(err)
+			}
+			stdout, stderr := runWAT(t, code.String())
+			wantOut, wantErr := evaluate(t, c.Name+".pat", c.Src)
+			if stdout != wantOut || stderr != wantErr {
+				t.Fatalf("output differs from the evaluator.\nexpected:\n%s%s\ngot:\n%s%s", wantOut, wantErr, stdout, stderr)
+			}
+		})
+	}
+}
+
+// runWAT runs the main of a module in the text format, and returns what it
+// prints and what it reports on stderr.
+func runWAT(t *testing.T, src string) (stdout, stderr string) {
+	t.Helper()
+	m, err := loadWAT(src)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	main := m.exports["main"]
+	if main == nil {
+		t.Fatal("main is not exported")
+	}
+	if _, err := m.call(main, nil); err != nil && err != errExit {
+		t.Fatalf("run: %v\n%s", err, src)
+	}
+	return m.out.String(), m.errOut.String()
+}
+
+// watValidator returns the command that validates a module in the text
+// format, or nil when neither wasm-tools nor wat2wasm is installed.
+func watValidator(t *testing.T) func(file string) *exec.Cmd {
+	if path, err := exec.LookPath("wasm-tools"); err == nil {
+		return func(file string) *exec.Cmd { return exec.Command(path, "validate", file) }
+	}
+	if path, err := exec.LookPath("wat2wasm"); err == nil {
+		out := filepath.Join(t.TempDir(), "main.wasm")
+		return func(file string) *exec.Cmd { return exec.Command(path, file, "-o", out) }
+	}
+	t.Log("no wasm-tools or wat2wasm command, modules are not validated")
+	return nil
+}
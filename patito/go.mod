@@ -1,3 +1,10 @@
 module patito
 
 go 1.25.1
+
+require github.com/peterh/liner v1.2.2
+
+require (
+	github.com/mattn/go-runewidth v0.0.3 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
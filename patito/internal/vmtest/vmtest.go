@@ -0,0 +1,143 @@
+// Package vmtest holds what the tests of the virtual machines share: the
+// corpus of programs in testdata/vm that every engine must run like the
+// evaluator, each next to what it prints, and the programs of the benchmarks
+// in testdata/bench. Its own tests run the corpus and the benchmarks on every
+// engine; the packages of the engines only test what is their own.
+package vmtest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+// Case is a program of the corpus. Out is what it prints, in NAME.out, Err the
+// runtime error it stops with, in NAME.err, or "" when it ends, and Trace the
+// stack trace of that error for NAME.pat, in NAME.trace.
+type Case struct {
+	Name            string
+	Src             string
+	Out, Err, Trace string
+}
+
+// Corpus reads the cases whose sources match the patterns, relative to the
+// directory of the test.
+func Corpus(t testing.TB, patterns ...string) []Case {
+	t.Helper()
+	var cases []Case
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil || len(files) == 0 {
+			t.Fatalf("no programs match %s", pattern)
+		}
+		for _, file := range files {
+			base := strings.TrimSuffix(file, ".pat")
+			c := Case{Name: filepath.Base(base), Src: Read(t, file), Out: Read(t, base+".out")}
+			if errText, err := os.ReadFile(base + ".err"); err == nil {
+				c.Err = strings.TrimSuffix(string(errText), "\n")
+			}
+			if trace, err := os.ReadFile(base + ".trace"); err == nil {
+				c.Trace = string(trace)
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases
+}
+
+// Read returns the contents of file.
+func Read(t testing.TB, file string) string {
+	t.Helper()
+	src, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(src)
+}
+
+// Check parses and checks src, which must be a valid program.
+func Check(t testing.TB, src string) (*ast.Program, *semantic.FuncDir) {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	return prog, dir
+}
+
+// Engine is a way to run programs that the corpus checks against the
+// evaluator.
+type Engine struct {
+	Name string
+	// Load prepares prog, which passed semantic.Check, to print to out, and
+	// returns what runs it. The program may be run more than once.
+	Load func(prog *ast.Program, dir *semantic.FuncDir, out io.Writer) (run func() error, err error)
+}
+
+// Run runs every case of the corpus with e and reports where what the program
+// prints and the error it stops with differ from what the case expects. The
+// error must have a Trace method, like *evaluator.RuntimeError.
+func Run(t *testing.T, cases []Case, e Engine) {
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			prog, dir := Check(t, c.Src)
+			var out bytes.Buffer
+			run, err := e.Load(prog, dir, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = run()
+			if out.String() != c.Out {
+				t.Errorf("output wrong. expected=%q, got=%q", c.Out, out.String())
+			}
+			errText, trace := "", ""
+			if err != nil {
+				errText = err.Error()
+				var rerr interface{ Trace(name string) string }
+				if !errors.As(err, &rerr) {
+					t.Fatalf("expected an error with a trace, got %v", err)
+				}
+				trace = rerr.Trace(c.Name + ".pat")
+			}
+			if errText != c.Err {
+				t.Errorf("error wrong. expected=%q, got=%q", c.Err, errText)
+			}
+			if trace != c.Trace {
+				t.Errorf("trace wrong.\nexpected:\n%s\ngot:\n%s", c.Trace, trace)
+			}
+		})
+	}
+}
+
+// Benchmark runs the program in file with each engine, in a sub-benchmark
+// named after it. Loading the program is not measured.
+func Benchmark(b *testing.B, file string, engines []Engine) {
+	prog, dir := Check(b, Read(b, file))
+	for _, e := range engines {
+		b.Run(e.Name, func(b *testing.B) {
+			run, err := e.Load(prog, dir, io.Discard)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for b.Loop() {
+				if err := run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
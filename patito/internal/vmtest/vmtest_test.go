@@ -0,0 +1,80 @@
+package vmtest
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/bytecode"
+	"patito/evaluator"
+	"patito/regvm"
+	"patito/semantic"
+)
+
+var update = flag.Bool("update", false, "rewrite the expected outputs of the corpus from the evaluator")
+
+// engines are those that must run the corpus like the evaluator, which is
+// the first.
+var engines = []Engine{
+	{Name: "evaluator", Load: func(prog *ast.Program, _ *semantic.FuncDir, out io.Writer) (func() error, error) {
+		return func() error { return evaluator.New(out).Run(prog) }, nil
+	}},
+	{Name: "stack", Load: func(prog *ast.Program, dir *semantic.FuncDir, out io.Writer) (func() error, error) {
+		p, err := bytecode.Compile(prog, dir)
+		if err != nil {
+			return nil, err
+		}
+		return bytecode.New(p, out).Run, nil
+	}},
+	{Name: "register", Load: func(prog *ast.Program, dir *semantic.FuncDir, out io.Writer) (func() error, error) {
+		p, err := regvm.Compile(prog, dir)
+		if err != nil {
+			return nil, err
+		}
+		return regvm.New(p, out).Run, nil
+	}},
+}
+
+// TestEngines checks that every engine prints what the corpus expects and
+// stops with the same error. The expected outputs come from the evaluator.
+func TestEngines(t *testing.T) {
+	if *update {
+		writeExpected(t)
+	}
+	cases := Corpus(t, "../../testdata/demo.pat", "../../testdata/vm/*.pat")
+	for _, e := range engines {
+		t.Run(e.Name, func(t *testing.T) { Run(t, cases, e) })
+	}
+}
+
+func BenchmarkFib(b *testing.B)   { Benchmark(b, "../../testdata/bench/fib.pat", engines) }
+func BenchmarkLoops(b *testing.B) { Benchmark(b, "../../testdata/bench/loops.pat", engines) }
+
+func writeExpected(t *testing.T) {
+	files, _ := filepath.Glob("../../testdata/vm/*.pat")
+	for _, file := range append(files, "../../testdata/demo.pat") {
+		prog, _ := Check(t, Read(t, file))
+		var out bytes.Buffer
+		err := evaluator.New(&out).Run(prog)
+		base := strings.TrimSuffix(file, ".pat")
+		if err := os.WriteFile(base+".out", out.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(base + ".err")
+		os.Remove(base + ".trace")
+		if err != nil {
+			trace := err.(*evaluator.RuntimeError).Trace(filepath.Base(file))
+			if err := os.WriteFile(base+".err", []byte(err.Error()+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(base+".trace", []byte(trace), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
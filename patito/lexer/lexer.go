@@ -11,12 +11,15 @@ type Lexer struct {
 	currentIndex int    // position of current character being examined
 	nextIndex    int    // position of next character to read (enables 1-char lookahead)
 	ch           byte   // current character under examination (0 if at EOF)
+	line         int    // line of the current character (1-based)
+	column       int    // column of the current character (1-based)
+	comments     []token.Token
 }
 
 // New creates and initializes a new Lexer for the given input string.
 // It positions the lexer at the first character by calling readChar().
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // initialize by reading the first character
 	return l
 }
@@ -25,6 +28,12 @@ func New(input string) *Lexer {
 // It moves both currentIndex and nextIndex forward, and sets ch to the next character.
 // If we've reached the end of input, ch is set to 0 (NUL) to signal EOF.
 func (l *Lexer) readChar() {
+	// Keep line/column in sync with the character we are about to leave behind
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.nextIndex >= len(l.input) {
 		l.ch = 0 // ASCII NUL character represents EOF
 	} else {
@@ -55,6 +64,7 @@ func (l *Lexer) NextToken() token.Token {
 
 	// Skip any whitespace characters (spaces, tabs, newlines)
 	l.consumeWhitespace()
+	pos := token.Position{Line: l.line, Column: l.column}
 
 	// Determine token type based on current character
 	switch l.ch {
@@ -147,6 +157,7 @@ func (l *Lexer) NextToken() token.Token {
 		lit := l.readString()
 		tok.Type = token.STRING_TYPE
 		tok.Literal = lit
+		tok.Pos = pos
 		return tok // return early; readString() already consumed the closing quote
 
 	// End of input
@@ -161,6 +172,7 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = l.readIdentifier()
 			// Check if it's a reserved keyword; if not, it's an IDENT
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok // return early; readIdentifier() already consumed the identifier
 		} else if isDigit(l.ch) {
 			// Starts with a digit: read numeric literal (integer or float)
@@ -171,6 +183,7 @@ func (l *Lexer) NextToken() token.Token {
 			} else {
 				tok.Type = token.INT_TYPE
 			}
+			tok.Pos = pos
 			return tok // return early; readNumber() already consumed the number
 		} else {
 			// Unknown character - mark as illegal
@@ -181,17 +194,38 @@ func (l *Lexer) NextToken() token.Token {
 	// Advance to next character for single-character tokens
 	// (multi-character tokens return early above)
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
 // consumeWhitespace skips over all whitespace characters (space, tab, newline, carriage return).
 // It advances the lexer until a non-whitespace character is found.
 func (l *Lexer) consumeWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// readComment consumes a "//" comment up to the end of the line and records it.
+func (l *Lexer) readComment() {
+	pos := token.Position{Line: l.line, Column: l.column}
+	start := l.currentIndex
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: l.input[start:l.currentIndex], Pos: pos})
 }
 
+// Comments returns the comments skipped so far, including their "//".
+func (l *Lexer) Comments() []token.Token { return l.comments }
+
 // readIdentifier consumes and returns a complete identifier from the input.
 // Identifiers must start with a letter (A-Z or a-z), and can contain letters,
 // digits, and underscores after the first character.
@@ -48,3 +48,68 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "program p;\n  x = 1.5;\n\tprint(\"hi\")"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"program", 1, 1},
+		{"p", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"=", 2, 5},
+		{"1.5", 2, 7},
+		{";", 2, 10},
+		{"print", 3, 2},
+		{"(", 3, 7},
+		{"hi", 3, 8},
+		{")", 3, 12},
+		{"", 3, 13},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "x = 1 / 2; // half\n// a whole line\ny"
+
+	l := New(input)
+	var types []token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	expected := []token.TokenType{token.IDENT, token.ASSIGN, token.INT_TYPE, token.DIV, token.INT_TYPE, token.SEMICOLON, token.IDENT}
+	if len(types) != len(expected) {
+		t.Fatalf("comments should be skipped. got=%v", types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expected[i], types[i])
+		}
+	}
+
+	comments := l.Comments()
+	if len(comments) != 2 ||
+		comments[0].Literal != "// half" || comments[0].Pos != (token.Position{Line: 1, Column: 12}) ||
+		comments[1].Literal != "// a whole line" || comments[1].Pos != (token.Position{Line: 2, Column: 1}) {
+		t.Fatalf("comments wrong: %+v", comments)
+	}
+}
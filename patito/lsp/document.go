@@ -0,0 +1,315 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+	"patito/token"
+)
+
+type symbolKind int
+
+const (
+	globalVar symbolKind = iota
+	paramVar
+	localVar
+	function
+)
+
+// symbol is a declared name together with every place it is used.
+type symbol struct {
+	name string
+	kind symbolKind
+	typ  string        // int or float for vars, empty for functions
+	fn   *ast.FuncDecl // the function itself, or the one declaring a param/local
+	decl *ast.Identifier
+	refs []*ast.Identifier // every occurrence, the declaration first
+}
+
+// occurrence links an identifier in the source to the symbol it names.
+type occurrence struct {
+	id  *ast.Identifier
+	sym *symbol
+}
+
+// document is an open file and the result of analysing its current text.
+type document struct {
+	uri   string
+	text  string
+	lines []string
+
+	prog        *ast.Program
+	syntaxOK    bool
+	comments    bool // Format would drop them
+	diagnostics []Diagnostic
+
+	globals     map[string]*symbol
+	funcs       map[string]*symbol
+	locals      map[*ast.FuncDecl]map[string]*symbol
+	symbols     []*symbol // in declaration order
+	occurrences []occurrence
+}
+
+// newDocument parses and checks text. Semantic errors are only reported once
+// the syntax is correct, but names are resolved in whatever part of the tree
+// the parser could build so navigation keeps working while typing.
+func newDocument(uri, text string) *document {
+	d := &document{
+		uri:     uri,
+		text:    text,
+		lines:   strings.Split(text, "\n"),
+		globals: map[string]*symbol{},
+		funcs:   map[string]*symbol{},
+		locals:  map[*ast.FuncDecl]map[string]*symbol{},
+	}
+	l := lexer.New(text)
+	p := parser.New(l)
+	d.prog = p.ParseProgram()
+	d.comments = len(l.Comments()) > 0
+	for _, err := range p.SyntaxErrors() {
+		d.diagnose(err.Pos, err.Msg)
+	}
+	d.syntaxOK = len(p.SyntaxErrors()) == 0
+	if d.syntaxOK {
+		_, errs := semantic.Check(d.prog)
+		for _, err := range errs {
+			d.diagnose(err.Pos, err.Msg)
+		}
+	}
+	d.resolve()
+	return d
+}
+
+func (d *document) diagnose(pos token.Position, msg string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.wordRange(pos),
+		Severity: severityError,
+		Source:   "patito",
+		Message:  msg,
+	})
+}
+
+// ---------- Positions ----------
+
+// position converts a 1-based line and byte column to an LSP position.
+func (d *document) position(pos token.Position) Position {
+	line := pos.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return Position{Line: max(line, 0)}
+	}
+	text := d.lines[line]
+	col := min(max(pos.Column-1, 0), len(text))
+	return Position{Line: line, Character: len(utf16.Encode([]rune(text[:col])))}
+}
+
+// tokenPosition converts an LSP position back to a 1-based line and byte column.
+func (d *document) tokenPosition(p Position) token.Position {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return token.Position{Line: p.Line + 1, Column: 1}
+	}
+	text := d.lines[p.Line]
+	units, col := 0, 0
+	for col < len(text) && units < p.Character {
+		r, size := utf8.DecodeRuneInString(text[col:])
+		units += utf16.RuneLen(r)
+		col += size
+	}
+	return token.Position{Line: p.Line + 1, Column: col + 1}
+}
+
+func (d *document) identRange(id *ast.Identifier) Range {
+	end := id.Pos
+	end.Column += len(id.Value)
+	return Range{Start: d.position(id.Pos), End: d.position(end)}
+}
+
+// wordRange covers the identifier or number starting at pos, or one character.
+func (d *document) wordRange(pos token.Position) Range {
+	end := pos
+	if line := pos.Line - 1; line >= 0 && line < len(d.lines) {
+		text := d.lines[line]
+		for end.Column-1 < len(text) && isWordChar(text[end.Column-1]) {
+			end.Column++
+		}
+	}
+	if end == pos {
+		end.Column++
+	}
+	return Range{Start: d.position(pos), End: d.position(end)}
+}
+
+func isWordChar(ch byte) bool {
+	return ch == '_' || ch == '.' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
+
+func (d *document) fullRange() Range {
+	last := len(d.lines) - 1
+	return Range{End: d.position(token.Position{Line: last + 1, Column: len(d.lines[last]) + 1})}
+}
+
+// ---------- Name resolution ----------
+
+func (d *document) resolve() {
+	prog := d.prog
+	for _, decl := range prog.Vars {
+		for _, id := range decl.Names {
+			d.declare(d.globals, &symbol{name: id.Value, kind: globalVar, typ: decl.Type, decl: id})
+		}
+	}
+	for _, fn := range prog.Funcs {
+		if fn.Name != nil {
+			d.declare(d.funcs, &symbol{name: fn.Name.Value, kind: function, fn: fn, decl: fn.Name})
+		}
+	}
+	for _, fn := range prog.Funcs {
+		scope := map[string]*symbol{}
+		d.locals[fn] = scope
+		for _, p := range fn.Params {
+			d.declare(scope, &symbol{name: p.Name.Value, kind: paramVar, typ: p.Type, fn: fn, decl: p.Name})
+		}
+		for _, decl := range fn.Vars {
+			for _, id := range decl.Names {
+				d.declare(scope, &symbol{name: id.Value, kind: localVar, typ: decl.Type, fn: fn, decl: id})
+			}
+		}
+		d.block(fn.Body, scope)
+	}
+	d.block(prog.Main, nil)
+}
+
+// declare adds sym unless the name is already taken; a redeclaration is still
+// recorded as a use of the first declaration so it can be navigated.
+func (d *document) declare(scope map[string]*symbol, sym *symbol) {
+	if prev, ok := scope[sym.name]; ok {
+		d.use(sym.decl, prev)
+		return
+	}
+	scope[sym.name] = sym
+	d.symbols = append(d.symbols, sym)
+	d.use(sym.decl, sym)
+}
+
+func (d *document) use(id *ast.Identifier, sym *symbol) {
+	sym.refs = append(sym.refs, id)
+	d.occurrences = append(d.occurrences, occurrence{id: id, sym: sym})
+}
+
+func (d *document) block(block *ast.BlockStatement, scope map[string]*symbol) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			d.variable(s.Name, scope)
+			d.expr(s.Value, scope)
+		case *ast.PrintStatement:
+			for _, exp := range s.Expressions {
+				d.expr(exp, scope)
+			}
+		case *ast.IfStatement:
+			d.expr(s.Condition, scope)
+			d.block(s.Consequence, scope)
+			d.block(s.Alternative, scope)
+		case *ast.WhileStatement:
+			d.expr(s.Condition, scope)
+			d.block(s.Body, scope)
+		case *ast.CallStatement:
+			d.expr(s.Call, scope)
+		}
+	}
+}
+
+func (d *document) expr(exp ast.Expression, scope map[string]*symbol) {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		d.variable(x, scope)
+	case *ast.PrefixExpression:
+		d.expr(x.Right, scope)
+	case *ast.InfixExpression:
+		d.expr(x.Left, scope)
+		d.expr(x.Right, scope)
+	case *ast.CallExpression:
+		if x.Function != nil {
+			if sym, ok := d.funcs[x.Function.Value]; ok {
+				d.use(x.Function, sym)
+			}
+		}
+		for _, arg := range x.Arguments {
+			d.expr(arg, scope)
+		}
+	}
+}
+
+func (d *document) variable(id *ast.Identifier, scope map[string]*symbol) {
+	if id == nil {
+		return
+	}
+	if sym, ok := scope[id.Value]; ok {
+		d.use(id, sym)
+	} else if sym, ok := d.globals[id.Value]; ok {
+		d.use(id, sym)
+	}
+}
+
+// ---------- Queries ----------
+
+// symbolAt returns the symbol named by the identifier under pos.
+func (d *document) symbolAt(p Position) (*symbol, *ast.Identifier) {
+	pos := d.tokenPosition(p)
+	for _, occ := range d.occurrences {
+		id := occ.id
+		if id.Pos.Line == pos.Line && id.Pos.Column <= pos.Column && pos.Column <= id.Pos.Column+len(id.Value) {
+			return occ.sym, id
+		}
+	}
+	return nil, nil
+}
+
+// enclosingFunc returns the function whose declaration contains pos, if any.
+// A function spans from its "void" to the next function or main.
+func (d *document) enclosingFunc(p Position) *ast.FuncDecl {
+	pos := d.tokenPosition(p)
+	var found *ast.FuncDecl
+	for _, fn := range d.prog.Funcs {
+		if before(fn.Pos, pos) {
+			found = fn
+		}
+	}
+	if found != nil && d.prog.Main != nil && before(d.prog.Main.Pos, pos) {
+		return nil
+	}
+	return found
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column <= b.Column
+}
+
+// signature renders a function header, e.g. "void f(a : int, b : float)".
+func signature(fn *ast.FuncDecl) string {
+	params := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i] = p.Name.Value + " : " + p.Type
+	}
+	return fmt.Sprintf("void %s(%s)", fn.Name.Value, strings.Join(params, ", "))
+}
+
+// describe is the one-line summary shown on hover and in completions.
+func (s *symbol) describe() string {
+	switch s.kind {
+	case function:
+		return signature(s.fn)
+	case paramVar:
+		return fmt.Sprintf("%s : %s (param of %s)", s.name, s.typ, s.fn.Name.Value)
+	case localVar:
+		return fmt.Sprintf("%s : %s (local of %s)", s.name, s.typ, s.fn.Name.Value)
+	}
+	return fmt.Sprintf("%s : %s (global)", s.name, s.typ)
+}
@@ -0,0 +1,290 @@
+// Package lsp implements a Language Server Protocol server for Patito. It
+// publishes parser and semantic diagnostics whenever a document changes and
+// answers hover, go-to-definition, find-references, document symbol, completion
+// and formatting requests.
+//
+// Documents are synchronized in full: every change carries the whole text,
+// which is parsed and checked again.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"patito/ast"
+	"patito/wire"
+)
+
+var keywords = []string{
+	"program", "main", "end", "var", "void", "print",
+	"if", "else", "while", "do", "int", "float",
+}
+
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: map[string]*document{}}
+}
+
+// Serve handles messages until the client sends "exit" or in is closed.
+func (s *Server) Serve() error {
+	for {
+		data, err := wire.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return fmt.Errorf("lsp: %v", err)
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(&msg)
+		if msg.ID == nil {
+			continue // notifications get no response
+		}
+		if rerr != nil {
+			err = wire.Write(s.out, errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: *rerr})
+		} else {
+			err = wire.Write(s.out, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (any, *responseError) {
+	if s.shutdown && msg.Method != "exit" {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1, // full
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"documentSymbolProvider":     true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "patito"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.publish(params.TextDocument.URI, []Diagnostic{})
+		return nil, nil
+	case "textDocument/hover", "textDocument/definition", "textDocument/references", "textDocument/completion":
+		var params positionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := s.docs[params.TextDocument.URI]
+		if doc == nil {
+			return nil, nil
+		}
+		switch msg.Method {
+		case "textDocument/hover":
+			return hover(doc, params.Position), nil
+		case "textDocument/definition":
+			if sym, _ := doc.symbolAt(params.Position); sym != nil {
+				return Location{URI: doc.uri, Range: doc.identRange(sym.decl)}, nil
+			}
+			return nil, nil
+		case "textDocument/references":
+			return references(doc, params.Position, params.Context.IncludeDeclaration), nil
+		}
+		return completion(doc, params.Position), nil
+	case "textDocument/documentSymbol", "textDocument/formatting":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := s.docs[params.TextDocument.URI]
+		if doc == nil {
+			return nil, nil
+		}
+		if msg.Method == "textDocument/documentSymbol" {
+			return documentSymbols(doc), nil
+		}
+		return format(doc), nil
+	}
+	if msg.ID == nil {
+		return nil, nil // unknown notifications, such as "initialized", are ignored
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "unsupported method " + msg.Method}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// update analyses the new text of a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	diags := doc.diagnostics
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	s.publish(uri, diags)
+}
+
+func (s *Server) publish(uri string, diags []Diagnostic) {
+	wire.Write(s.out, notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diags},
+	})
+}
+
+// ---------- Requests ----------
+
+func hover(doc *document, pos Position) *Hover {
+	sym, id := doc.symbolAt(pos)
+	if sym == nil {
+		return nil
+	}
+	text := fmt.Sprintf("```patito\n%s\n```\ndeclared at line %d", sym.describe(), sym.decl.Pos.Line)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: doc.identRange(id)}
+}
+
+func references(doc *document, pos Position, includeDecl bool) []Location {
+	sym, _ := doc.symbolAt(pos)
+	if sym == nil {
+		return nil
+	}
+	locs := []Location{}
+	for _, id := range sym.refs {
+		if id == sym.decl && !includeDecl {
+			continue
+		}
+		locs = append(locs, Location{URI: doc.uri, Range: doc.identRange(id)})
+	}
+	return locs
+}
+
+// documentSymbols lists global vars and functions, with the params and locals
+// of each function as its children. A function's range runs up to the next
+// declaration.
+func documentSymbols(doc *document) []DocumentSymbol {
+	var syms []DocumentSymbol
+	children := map[string][]DocumentSymbol{}
+	for _, sym := range doc.symbols {
+		r := doc.identRange(sym.decl)
+		ds := DocumentSymbol{Name: sym.name, Detail: sym.typ, Kind: symbolVariable, Range: r, SelectionRange: r}
+		switch sym.kind {
+		case paramVar, localVar:
+			children[sym.fn.Name.Value] = append(children[sym.fn.Name.Value], ds)
+		case globalVar:
+			syms = append(syms, ds)
+		}
+	}
+	funcs := doc.prog.Funcs
+	for i, fn := range funcs {
+		sym := doc.funcs[fn.Name.Value]
+		if sym == nil || sym.fn != fn {
+			continue // a redeclaration
+		}
+		end := doc.fullRange().End
+		if i+1 < len(funcs) {
+			end = doc.position(funcs[i+1].Pos)
+		} else if doc.prog.Main != nil {
+			end = doc.position(doc.prog.Main.Pos)
+		}
+		syms = append(syms, DocumentSymbol{
+			Name:           fn.Name.Value,
+			Detail:         signature(fn),
+			Kind:           symbolFunction,
+			Range:          Range{Start: doc.position(fn.Pos), End: end},
+			SelectionRange: doc.identRange(fn.Name),
+			Children:       children[fn.Name.Value],
+		})
+	}
+	return syms
+}
+
+// completion offers the keywords and every name visible at pos.
+func completion(doc *document, pos Position) []CompletionItem {
+	var items []CompletionItem
+	for _, kw := range keywords {
+		items = append(items, CompletionItem{Label: kw, Kind: completionKeyword})
+	}
+	visible := map[string]*symbol{}
+	for name, sym := range doc.globals {
+		visible[name] = sym
+	}
+	for name, sym := range doc.funcs {
+		visible[name] = sym
+	}
+	if fn := doc.enclosingFunc(pos); fn != nil {
+		for name, sym := range doc.locals[fn] {
+			visible[name] = sym
+		}
+	}
+	names := make([]string, 0, len(visible))
+	for name := range visible {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sym := visible[name]
+		kind := completionVariable
+		if sym.kind == function {
+			kind = completionFunction
+		}
+		items = append(items, CompletionItem{Label: name, Kind: kind, Detail: sym.describe()})
+	}
+	return items
+}
+
+// format replaces the whole document with its canonical layout. Documents with
+// syntax errors are left alone, and so are documents with comments because the
+// tree does not keep them.
+func format(doc *document) []TextEdit {
+	if !doc.syntaxOK || doc.comments {
+		return nil
+	}
+	text := ast.Format(doc.prog)
+	if text == doc.text {
+		return []TextEdit{}
+	}
+	return []TextEdit{{Range: doc.fullRange(), NewText: text}}
+}
@@ -0,0 +1,298 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"patito/wire"
+)
+
+const uri = "file:///tmp/p.pat"
+
+const program = `program p;
+var g : int;
+void inc(n : int) [
+  var t : int;
+  {
+    t = n + 1;
+    g = g + t;
+  }
+];
+main {
+  g = 1;
+  inc(g);
+}
+end`
+
+// client is an in-process LSP client talking to a Server over pipes.
+type client struct {
+	t             *testing.T
+	w             io.WriteCloser
+	msgs          chan []byte // read by a goroutine so the server never blocks writing
+	id            int
+	notifications []message // received while waiting for responses
+	done          chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, msgs: make(chan []byte, 100), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(inR, outW).Serve()
+		outW.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(outR)
+		for {
+			data, err := wire.Read(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			c.msgs <- data
+		}
+	}()
+	t.Cleanup(func() { inW.Close() })
+	return c
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	raw, _ := json.Marshal(params)
+	if err := wire.Write(c.w, message{JSONRPC: "2.0", Method: method, Params: raw}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// call sends a request and decodes its result into result.
+func (c *client) call(method string, params any, result any) *responseError {
+	c.t.Helper()
+	c.id++
+	raw, _ := json.Marshal(params)
+	id, _ := json.Marshal(c.id)
+	if err := wire.Write(c.w, message{JSONRPC: "2.0", ID: id, Method: method, Params: raw}); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		data, ok := <-c.msgs
+		if !ok {
+			c.t.Fatalf("server closed the connection")
+		}
+		var resp struct {
+			message
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			c.t.Fatalf("bad message %s: %v", data, err)
+		}
+		if resp.ID == nil {
+			c.notifications = append(c.notifications, resp.message)
+			continue
+		}
+		if string(resp.ID) != string(id) {
+			c.t.Fatalf("response to %s has id %s", method, resp.ID)
+		}
+		if resp.Error == nil && result != nil {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				c.t.Fatalf("%s: bad result %s: %v", method, resp.Result, err)
+			}
+		}
+		return resp.Error
+	}
+}
+
+// diagnostics returns the next diagnostics published for uri. Notifications
+// are flushed by a round trip, since the server answers in order.
+func (c *client) diagnostics() []Diagnostic {
+	c.t.Helper()
+	if len(c.notifications) == 0 {
+		c.call("unknown/flush", nil, nil)
+	}
+	msg := c.notifications[0]
+	c.notifications = c.notifications[1:]
+	var params publishDiagnosticsParams
+	if msg.Method != "textDocument/publishDiagnostics" || json.Unmarshal(msg.Params, &params) != nil || params.URI != uri {
+		c.t.Fatalf("expected diagnostics, got %s %s", msg.Method, msg.Params)
+	}
+	return params.Diagnostics
+}
+
+func (c *client) open(text string) {
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "patito", "version": 1, "text": text},
+	})
+}
+
+func (c *client) change(text string) {
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]any{{"text": text}},
+	})
+}
+
+func at(line, char int) map[string]any {
+	return map[string]any{"textDocument": map[string]any{"uri": uri}, "position": Position{line, char}}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+	if err := c.call("initialize", map[string]any{"capabilities": map[string]any{}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.notify("initialized", map[string]any{})
+
+	c.open("program p; main { x = 1; } end")
+	diags := c.diagnostics()
+	if len(diags) != 1 || diags[0].Message != "undeclared variable x" ||
+		diags[0].Range != (Range{Position{0, 18}, Position{0, 19}}) {
+		t.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+
+	c.change("program p;\nmain {\n  print(1 +);\n}\nend")
+	diags = c.diagnostics()
+	if len(diags) == 0 || diags[0].Range.Start.Line != 2 || diags[0].Severity != severityError {
+		t.Fatalf("expected a syntax error on line 2, got %+v", diags)
+	}
+
+	c.change(program)
+	if diags := c.diagnostics(); len(diags) != 0 {
+		t.Fatalf("expected no diagnostics, got %+v", diags)
+	}
+
+	c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	if diags := c.diagnostics(); len(diags) != 0 {
+		t.Fatalf("closing should clear diagnostics, got %+v", diags)
+	}
+
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNavigation(t *testing.T) {
+	c := newClient(t)
+	c.open(program)
+	c.diagnostics()
+
+	var h Hover
+	c.call("textDocument/hover", at(6, 8), &h)
+	if !strings.Contains(h.Contents.Value, "g : int (global)") || h.Range != (Range{Position{6, 8}, Position{6, 9}}) {
+		t.Fatalf("unexpected hover for g: %+v", h)
+	}
+	c.call("textDocument/hover", at(5, 8), &h)
+	if !strings.Contains(h.Contents.Value, "n : int (param of inc)") || !strings.Contains(h.Contents.Value, "declared at line 3") {
+		t.Fatalf("unexpected hover for n: %+v", h)
+	}
+	c.call("textDocument/hover", at(11, 3), &h)
+	if !strings.Contains(h.Contents.Value, "void inc(n : int)") {
+		t.Fatalf("unexpected hover for inc: %+v", h)
+	}
+
+	var loc Location
+	c.call("textDocument/definition", at(6, 12), &loc)
+	if loc.URI != uri || loc.Range != (Range{Position{3, 6}, Position{3, 7}}) {
+		t.Fatalf("definition of t: %+v", loc)
+	}
+
+	refs := func(line, char int, decl bool) []int {
+		params := at(line, char)
+		params["context"] = map[string]any{"includeDeclaration": decl}
+		var locs []Location
+		c.call("textDocument/references", params, &locs)
+		var lines []int
+		for _, l := range locs {
+			lines = append(lines, l.Range.Start.Line)
+		}
+		return lines
+	}
+	if got := refs(10, 2, true); len(got) != 5 || got[0] != 1 {
+		t.Fatalf("references of g with declaration: %v", got)
+	}
+	if got := refs(10, 2, false); len(got) != 4 {
+		t.Fatalf("references of g: %v", got)
+	}
+
+	var syms []DocumentSymbol
+	c.call("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}, &syms)
+	if len(syms) != 2 || syms[0].Name != "g" || syms[1].Name != "inc" || syms[1].Kind != symbolFunction ||
+		len(syms[1].Children) != 2 || syms[1].Children[0].Name != "n" || syms[1].Children[1].Name != "t" {
+		t.Fatalf("unexpected symbols: %+v", syms)
+	}
+	if syms[1].Range.Start.Line != 2 || syms[1].Range.End.Line != 9 {
+		t.Fatalf("unexpected range for inc: %+v", syms[1].Range)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.open(program)
+	c.diagnostics()
+
+	labels := func(line, char int) map[string]int {
+		var items []CompletionItem
+		c.call("textDocument/completion", at(line, char), &items)
+		kinds := map[string]int{}
+		for _, it := range items {
+			kinds[it.Label] = it.Kind
+		}
+		return kinds
+	}
+	inside := labels(6, 4)
+	for label, kind := range map[string]int{"while": completionKeyword, "g": completionVariable, "inc": completionFunction, "n": completionVariable, "t": completionVariable} {
+		if inside[label] != kind {
+			t.Errorf("completion inside inc: %s should have kind %d, got %d", label, kind, inside[label])
+		}
+	}
+	if outside := labels(10, 2); outside["n"] != 0 || outside["t"] != 0 || outside["g"] == 0 {
+		t.Errorf("locals of inc should not be offered in main: %v", outside)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	c.open("program p; var g:int; main{g=1;}end")
+	c.diagnostics()
+
+	params := map[string]any{"textDocument": map[string]any{"uri": uri}, "options": map[string]any{"tabSize": 4}}
+	var edits []TextEdit
+	c.call("textDocument/formatting", params, &edits)
+	want := "program p;\nvar\n    g : int;\n\nmain {\n    g = 1;\n}\nend\n"
+	if len(edits) != 1 || edits[0].NewText != want || edits[0].Range != (Range{End: Position{0, 35}}) {
+		t.Fatalf("unexpected edits: %+v", edits)
+	}
+
+	c.change(want)
+	c.diagnostics()
+	c.call("textDocument/formatting", params, &edits)
+	if len(edits) != 0 {
+		t.Fatalf("formatted text should need no edits: %+v", edits)
+	}
+
+	c.change("program p; main { g = ; } end")
+	c.diagnostics()
+	edits = nil
+	c.call("textDocument/formatting", params, &edits)
+	if edits != nil {
+		t.Fatalf("text with syntax errors should not be formatted: %+v", edits)
+	}
+	c.change("program p; main { } end // keep me")
+	c.diagnostics()
+	c.call("textDocument/formatting", params, &edits)
+	if edits != nil {
+		t.Fatalf("formatting would drop comments: %+v", edits)
+	}
+
+	if err := c.call("textDocument/rename", params, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Fatalf("expected method not found, got %+v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"patito/lsp"
+)
+
+// runLSP implements "patito lsp": a Language Server Protocol server on stdin and
+// stdout, meant to be started by an editor.
+func runLSP(args []string) int {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "patito lsp: documents are sent by the editor, not given on the command line")
+		return 2
+	}
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "patito lsp: %v\n", err)
+		return 1
+	}
+	return 0
+}
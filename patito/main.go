@@ -0,0 +1,103 @@
+// Command patito is the command-line driver for the Patito compiler.
+//
+// Usage:
+//
+//	patito <command> [flags] [file.pat]
+//
+// When no file is given (or the file is "-") the source is read from stdin.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int // returns the process exit code
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"parse", "parse a program and dump its AST (-format=sexpr|json, -O1 to optimize)", runParse},
+		{"run", "check and run a program (-O0|-O1, -engine=eval|stack|register, -max-steps/-max-depth/-max-memory/-timeout bound stack, the default with them; eval and register are unbounded)", runRun},
+		{"repl", "start an interactive session", runRepl},
+		{"debug", "run a program under the source-level debugger (-quads to debug its quadruples)", runDebug},
+		{"dap", "serve the Debug Adapter Protocol on stdin/stdout", runDAP},
+		{"lsp", "serve the Language Server Protocol on stdin/stdout", runLSP},
+		{"vet", "report suspicious code (-checks=a,b to pick checks, -list to show them)", runVet},
+		{"cfg", "print the control-flow graph of each function (-dot for Graphviz, -stats for sizes)", runCFG},
+		{"ssa", "print each function in SSA form (-quads to lower it to quadruples, optimized at -O1)", runSSA},
+		{"disasm", "print the bytecode each function compiles to (-register for the register VM)", runDisasm},
+		{"build", "translate a program into another language (-target=go|c|wat|amd64|llvm, -o file)", runBuild},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "patito: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: patito <command> [flags] [file.pat]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+}
+
+// readSource returns the contents of the only positional argument, or stdin.
+func readSource(args []string) (name string, src string, err error) {
+	if len(args) > 1 {
+		return "", "", fmt.Errorf("expected at most one source file, got %d", len(args))
+	}
+	var data []byte
+	if len(args) == 0 || args[0] == "-" {
+		name = "<stdin>"
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		name = args[0]
+		data, err = os.ReadFile(name)
+	}
+	return name, string(data), err
+}
+
+// check parses and semantically checks src, printing any error to stderr
+// prefixed with name. It returns false when there were errors.
+func check(name, src string) (*ast.Program, *semantic.FuncDir, bool) {
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+		}
+		return nil, nil, false
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+		}
+		return nil, nil, false
+	}
+	return prog, dir, true
+}
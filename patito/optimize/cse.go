@@ -0,0 +1,295 @@
+package optimize
+
+import (
+	"strings"
+
+	"patito/ast"
+	"patito/semantic"
+)
+
+// CSE eliminates common subexpressions and propagates copies inside basic
+// blocks, in place. Within a run of assignments, prints and calls:
+//
+//   - after x = y, later reads of x read y directly;
+//   - after x = e, a later occurrence of e reads x instead, when x and e have
+//     the same type;
+//   - an int or float subexpression that occurs again is computed once into
+//     a new var, e.g. x = a*b + c; y = a*b - c becomes _t1 = a*b;
+//     x = _t1 + c; y = _t1 - c. Divisions are never moved, so a division by
+//     zero is still the first error reported.
+//
+// The new vars are made by scope.declare.
+//
+// A fact is forgotten as soon as its target or one of its operands is
+// assigned. A call forgets every fact that involves a global, since the callee
+// may assign it. Ifs and whiles end the block: the condition of an if is still
+// rewritten, but a while condition runs again after its body and never is.
+func CSE(prog *ast.Program, dir *semantic.FuncDir) {
+	c := &cse{scope: scope{dir: dir, prog: prog}}
+	for _, fn := range dir.Funcs() {
+		c.fn = fn
+		c.block(fn.Decl.Body)
+	}
+	c.fn = nil
+	c.block(prog.Main)
+}
+
+// fact records that target holds the value of exp.
+type fact struct {
+	target   *semantic.Var
+	key      string // exp in canonical form, to compare expressions
+	copyOf   string // the var exp reads when it is a plain identifier
+	operands map[*semantic.Var]bool
+}
+
+type cse struct {
+	scope
+	facts   []*fact
+	shared  map[ast.Expression]bool // first occurrences of subexpressions that occur again
+	pending []ast.Statement         // temps to assign before the current statement
+}
+
+func (c *cse) block(block *ast.BlockStatement) {
+	c.enter(block.Statements)
+	var out []ast.Statement
+	for i, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			target := c.lookup(s.Name.Value)
+			s.Value = c.expr(s.Value, target)
+			c.kill(func(v *semantic.Var) bool { return v == target })
+			c.remember(target, s.Value)
+		case *ast.PrintStatement:
+			for i, exp := range s.Expressions {
+				s.Expressions[i] = c.expr(exp, nil)
+			}
+		case *ast.CallStatement:
+			for i, arg := range s.Call.Arguments {
+				s.Call.Arguments[i] = c.expr(arg, nil)
+			}
+			c.kill(func(v *semantic.Var) bool { return v.Scope == semantic.Global })
+		case *ast.IfStatement:
+			s.Condition = c.expr(s.Condition, nil)
+			out = append(out, c.pending...)
+			c.nested(s.Consequence)
+			if s.Alternative != nil {
+				c.nested(s.Alternative)
+			}
+			out = append(out, stmt)
+			c.enter(block.Statements[i+1:])
+			continue
+		case *ast.WhileStatement:
+			c.nested(s.Body)
+			out = append(out, stmt)
+			c.enter(block.Statements[i+1:])
+			continue
+		case *ast.BlockStatement:
+			c.nested(s)
+			out = append(out, stmt)
+			c.enter(block.Statements[i+1:])
+			continue
+		}
+		out = append(out, c.pending...)
+		out = append(out, stmt)
+		c.pending = nil
+	}
+	block.Statements = out
+}
+
+// nested optimizes a block inside the current one, which starts a new basic
+// block.
+func (c *cse) nested(block *ast.BlockStatement) {
+	c.pending = nil
+	c.block(block)
+}
+
+// enter starts a basic block at stmts: it forgets every fact and finds the
+// subexpressions worth keeping in a temp.
+func (c *cse) enter(stmts []ast.Statement) {
+	c.facts, c.pending = nil, nil
+	c.shared = map[ast.Expression]bool{}
+	type occurrence struct {
+		first    ast.Expression
+		operands map[*semantic.Var]bool
+	}
+	seen := map[string]*occurrence{} // subexpressions available so far
+	var visit func(ast.Expression)
+	visit = func(exp ast.Expression) {
+		switch x := exp.(type) {
+		case *ast.PrefixExpression, *ast.InfixExpression:
+			key := ast.Format(exp)
+			if occ, ok := seen[key]; ok {
+				c.shared[occ.first] = true
+				return
+			}
+			occ := &occurrence{first: exp, operands: map[*semantic.Var]bool{}}
+			c.operands(exp, occ.operands)
+			seen[key] = occ
+			if prefix, ok := x.(*ast.PrefixExpression); ok {
+				visit(prefix.Right)
+			} else {
+				infix := x.(*ast.InfixExpression)
+				visit(infix.Left)
+				visit(infix.Right)
+			}
+		}
+	}
+	kill := func(match func(*semantic.Var) bool) {
+		for key, occ := range seen {
+			for v := range occ.operands {
+				if match(v) {
+					delete(seen, key)
+					break
+				}
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			visit(s.Value)
+			target := c.lookup(s.Name.Value)
+			kill(func(v *semantic.Var) bool { return v == target })
+		case *ast.PrintStatement:
+			for _, exp := range s.Expressions {
+				visit(exp)
+			}
+		case *ast.CallStatement:
+			for _, arg := range s.Call.Arguments {
+				visit(arg)
+			}
+			kill(func(v *semantic.Var) bool { return v.Scope == semantic.Global })
+		case *ast.IfStatement:
+			visit(s.Condition)
+			return
+		default:
+			return
+		}
+	}
+}
+
+// expr rewrites exp, the value assigned to target or nil, with the facts
+// known so far.
+func (c *cse) expr(exp ast.Expression, target *semantic.Var) ast.Expression {
+	return c.reuse(c.propagate(exp), target)
+}
+
+// propagate replaces the identifiers of exp that hold a copy of another var.
+func (c *cse) propagate(exp ast.Expression) ast.Expression {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		v := c.lookup(x.Value)
+		for _, f := range c.facts {
+			if f.copyOf != "" && f.target == v {
+				return &ast.Identifier{Pos: x.Pos, Value: f.copyOf}
+			}
+		}
+	case *ast.PrefixExpression:
+		x.Right = c.propagate(x.Right)
+	case *ast.InfixExpression:
+		x.Left, x.Right = c.propagate(x.Left), c.propagate(x.Right)
+	}
+	return exp
+}
+
+// reuse replaces the largest subexpressions of exp that a var already holds,
+// and moves the first occurrence of a shared one into a temp. The whole value
+// assigned to target is left for target itself to hold.
+func (c *cse) reuse(exp ast.Expression, target *semantic.Var) ast.Expression {
+	switch x := exp.(type) {
+	case *ast.PrefixExpression, *ast.InfixExpression:
+		key, t := ast.Format(exp), c.typeOf(exp)
+		if held := c.held(key, t); held != nil {
+			return &ast.Identifier{Pos: exp.Position(), Value: held.Name}
+		}
+		if prefix, ok := x.(*ast.PrefixExpression); ok {
+			prefix.Right = c.reuse(prefix.Right, nil)
+		} else {
+			infix := x.(*ast.InfixExpression)
+			infix.Left, infix.Right = c.reuse(infix.Left, nil), c.reuse(infix.Right, nil)
+		}
+		// Facts are recorded after rewriting, so look again in that form
+		if held := c.held(ast.Format(exp), t); held != nil {
+			return &ast.Identifier{Pos: exp.Position(), Value: held.Name}
+		}
+		if !c.shared[exp] || t != semantic.Int && t != semantic.Float || strings.Contains(key, "/") {
+			return exp
+		}
+		if c.holds(target, exp) {
+			return exp
+		}
+		temp := c.declare(t)
+		c.pending = append(c.pending, &ast.AssignStatement{
+			Pos:   exp.Position(),
+			Name:  &ast.Identifier{Pos: exp.Position(), Value: temp.Name},
+			Value: exp,
+		})
+		c.remember(temp, exp)
+		return &ast.Identifier{Pos: exp.Position(), Value: temp.Name}
+	}
+	return exp
+}
+
+// held returns the var that holds the expression with canonical form key and
+// type t, or nil.
+func (c *cse) held(key string, t semantic.Type) *semantic.Var {
+	for _, f := range c.facts {
+		if f.key == key && f.target.Type == t {
+			return f.target
+		}
+	}
+	return nil
+}
+
+// holds reports whether assigning exp to target is worth remembering: exp is
+// not a constant, has the type of target and does not read target itself.
+func (c *cse) holds(target *semantic.Var, exp ast.Expression) bool {
+	if target == nil || isConstant(exp) || c.typeOf(exp) != target.Type {
+		return false
+	}
+	operands := map[*semantic.Var]bool{}
+	c.operands(exp, operands)
+	return !operands[target]
+}
+
+// remember records that target now holds exp, if it is worth it.
+func (c *cse) remember(target *semantic.Var, exp ast.Expression) {
+	if !c.holds(target, exp) {
+		return
+	}
+	f := &fact{target: target, key: ast.Format(exp), operands: map[*semantic.Var]bool{}}
+	c.operands(exp, f.operands)
+	if id, ok := exp.(*ast.Identifier); ok {
+		f.copyOf = id.Value
+	}
+	c.facts = append(c.facts, f)
+}
+
+func (c *cse) operands(exp ast.Expression, set map[*semantic.Var]bool) {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		if v := c.lookup(x.Value); v != nil {
+			set[v] = true
+		}
+	case *ast.PrefixExpression:
+		c.operands(x.Right, set)
+	case *ast.InfixExpression:
+		c.operands(x.Left, set)
+		c.operands(x.Right, set)
+	}
+}
+
+// kill forgets the facts whose target or operands match.
+func (c *cse) kill(match func(*semantic.Var) bool) {
+	kept := c.facts[:0]
+	for _, f := range c.facts {
+		dead := match(f.target)
+		for v := range f.operands {
+			dead = dead || match(v)
+		}
+		if !dead {
+			kept = append(kept, f)
+		}
+	}
+	c.facts = kept
+}
@@ -0,0 +1,115 @@
+package optimize
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+const cseDecls = `program p;
+var a, b, c, x, y, z : int;
+    f : float;
+void g() [ { a = a + 1; } ];
+`
+
+func TestCSE(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = a * b + c; y = a * b - c;", "_t1 = a * b;\nx = _t1 + c;\ny = _t1 - c;"},
+		{"x = a * b; y = a * b + c;", "x = a * b;\ny = x + c;"},
+		{"x = a * b + c; y = a * b + c; z = a * b;", "_t1 = a * b;\nx = _t1 + c;\ny = x;\nz = _t1;"},
+		{"x = a; y = x + 1; print(x);", "x = a;\ny = a + 1;\nprint(a);"},
+		{"x = a; a = 2; print(x);", "x = a;\na = 2;\nprint(x);"},
+		{"x = a * b; a = 1; y = a * b;", "x = a * b;\na = 1;\ny = a * b;"},
+		{"x = a * b; x = 2; y = a * b;", "x = a * b;\nx = 2;\ny = a * b;"},
+		{"x = x * b; y = x * b;", "x = x * b;\ny = x * b;"},
+		// g may assign any global
+		{"x = a * b; g(); y = a * b;", "x = a * b;\ng();\ny = a * b;"},
+		// f holds a float, so a * b needs a temp of its own
+		{"f = a * b; y = a * b;", "_t1 = a * b;\nf = _t1;\ny = _t1;"},
+		{"x = a / b + c; y = a / b - c;", "x = a / b + c;\ny = a / b - c;"},
+		{"x = a / b; y = a / b;", "x = a / b;\ny = x;"},
+		{"x = a * b; if (a * b > c) { y = a * b; };", "x = a * b;\nif (x > c) {\n    y = a * b;\n};"},
+		{"x = a * b; while (a * b > c) do { y = a * b; };", "x = a * b;\nwhile (a * b > c) do {\n    y = a * b;\n};"},
+		{"print(a + b, a + b); print(-c, -c);", "_t1 = a + b;\nprint(_t1, _t1);\n_t2 = -c;\nprint(_t2, _t2);"},
+	}
+	for _, tt := range tests {
+		prog, dir := check(t, cseDecls+"main { "+tt.input+" } end")
+		CSE(prog, dir)
+		var got []string
+		for _, stmt := range prog.Main.Statements {
+			got = append(got, strings.TrimSuffix(ast.Format(stmt), "\n"))
+		}
+		if strings.Join(got, "\n") != tt.expected {
+			t.Errorf("%s:\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestCSETemps(t *testing.T) {
+	prog, dir := check(t, `program p;
+var g : int;
+void h(p : int) [
+    var l, m : int;
+    {
+        l = p * p + 1;
+        h(l);
+        m = p * p + 2;
+        print(m);
+    }
+];
+main { g = 1; print(g * g, g * g); } end`)
+	CSE(prog, dir)
+
+	body := ast.Format(prog.Funcs[0].Body)
+	if !strings.Contains(body, "_t1 = p * p;") || !strings.Contains(body, "m = _t1 + 2;") {
+		t.Fatalf("the call should not forget facts about locals:\n%s", body)
+	}
+	fn := dir.Lookup("h")
+	if v := fn.Vars.Lookup("_t1"); v == nil || v.Scope != semantic.Local || v.Type != semantic.Int {
+		t.Fatalf("expected _t1 to be an int local of h, got %+v", v)
+	}
+	if v := dir.Globals.Lookup("_t2"); v == nil || v.Scope != semantic.Global {
+		t.Fatalf("expected _t2 to be a global, got %+v", v)
+	}
+
+	// The rewritten tree still checks and declares the temps where they are used
+	text := ast.Format(prog)
+	if _, errs := semantic.Check(prog); len(errs) > 0 {
+		t.Fatalf("the optimized program does not check: %v\n%s", errs, text)
+	}
+}
+
+func TestCSEKeepsOutput(t *testing.T) {
+	src := cseDecls + `main {
+    a = 3; b = 4; c = 5;
+    x = a * b + c; y = a * b - c; z = a * b;
+    print(x, y, z);
+    f = a * b; x = a; a = x + 1; y = a * b;
+    print(f, x, y);
+    g();
+    z = a * b + c;
+    print(z, a * b + c);
+}
+end`
+	run := func(optimize bool) string {
+		prog, dir := check(t, src)
+		if optimize {
+			CSE(prog, dir)
+		}
+		var out bytes.Buffer
+		if err := evaluator.New(&out).Run(prog); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	if plain, optimized := run(false), run(true); plain != optimized {
+		t.Fatalf("CSE changed the output.\nbefore:\n%s\nafter:\n%s", plain, optimized)
+	}
+}
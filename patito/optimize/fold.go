@@ -0,0 +1,162 @@
+package optimize
+
+import (
+	"io"
+	"math"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// Fold folds constant int and float arithmetic and comparisons in prog, in
+// place, and simplifies the identities x*1, x/1, x+0, x-0 and (for ints) x*0.
+// Constants are computed by the evaluator, so folding never changes what a
+// program prints: ints wrap, int division truncates and mixed operands are
+// computed in float. Results that are not finite are left unfolded.
+//
+// prog must have passed semantic.Check with dir. A division whose divisor is a
+// constant zero is reported as an error instead of failing at run time.
+func Fold(prog *ast.Program, dir *semantic.FuncDir) []*semantic.Error {
+	f := &folder{scope: scope{dir: dir, prog: prog}}
+	for _, fn := range dir.Funcs() {
+		f.fn = fn
+		f.block(fn.Decl.Body)
+	}
+	f.fn = nil
+	f.block(prog.Main)
+	return f.errors
+}
+
+type folder struct {
+	scope
+	errors []*semantic.Error
+}
+
+func (f *folder) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			s.Value = f.expr(s.Value)
+		case *ast.PrintStatement:
+			for i, exp := range s.Expressions {
+				s.Expressions[i] = f.expr(exp)
+			}
+		case *ast.IfStatement:
+			s.Condition = f.expr(s.Condition)
+			f.block(s.Consequence)
+			if s.Alternative != nil {
+				f.block(s.Alternative)
+			}
+		case *ast.WhileStatement:
+			s.Condition = f.expr(s.Condition)
+			f.block(s.Body)
+		case *ast.CallStatement:
+			for i, arg := range s.Call.Arguments {
+				s.Call.Arguments[i] = f.expr(arg)
+			}
+		}
+	}
+}
+
+// expr returns the folded form of exp, which may be exp itself.
+func (f *folder) expr(exp ast.Expression) ast.Expression {
+	switch x := exp.(type) {
+	case *ast.PrefixExpression:
+		x.Right = f.expr(x.Right)
+		if x.Operator == "+" {
+			return x.Right
+		}
+		if isConstant(x.Right) {
+			return fold(x)
+		}
+	case *ast.InfixExpression:
+		x.Left, x.Right = f.expr(x.Left), f.expr(x.Right)
+		if x.Operator == "/" && isValue(x.Right, 0) {
+			pos := x.Right.Position()
+			f.errors = append(f.errors, &semantic.Error{Pos: pos, Msg: "division by constant zero"})
+			return x
+		}
+		if isConstant(x.Left) && isConstant(x.Right) {
+			return fold(x)
+		}
+		return f.simplify(x)
+	}
+	return exp
+}
+
+// simplify applies the algebraic identities that keep the type of the result.
+func (f *folder) simplify(x *ast.InfixExpression) ast.Expression {
+	result := f.typeOf(x)
+	same := func(e ast.Expression) bool { return f.typeOf(e) == result }
+	switch x.Operator {
+	case "*":
+		switch {
+		case isValue(x.Right, 1) && same(x.Left):
+			return x.Left
+		case isValue(x.Left, 1) && same(x.Right):
+			return x.Right
+		case result == semantic.Int && (isValue(x.Left, 0) && !mayFail(x.Right) || isValue(x.Right, 0) && !mayFail(x.Left)):
+			// The other operand can go unless it divides by zero, which must
+			// still fail
+			return &ast.IntegerLiteral{Pos: x.Pos, Value: 0}
+		}
+	case "/":
+		if isValue(x.Right, 1) && same(x.Left) {
+			return x.Left
+		}
+	case "+":
+		// Only for ints: with floats -0.0 + 0 is 0, not -0.0
+		if result == semantic.Int && isValue(x.Right, 0) {
+			return x.Left
+		}
+		if result == semantic.Int && isValue(x.Left, 0) {
+			return x.Right
+		}
+	case "-":
+		if result == semantic.Int && isValue(x.Right, 0) {
+			return x.Left
+		}
+	}
+	return x
+}
+
+// fold evaluates an expression whose operands are all constants.
+func fold(exp ast.Expression) ast.Expression {
+	v, err := evaluator.New(io.Discard).Eval(exp)
+	if err != nil {
+		return exp
+	}
+	pos := exp.Position()
+	switch v := v.(type) {
+	case evaluator.Int:
+		return &ast.IntegerLiteral{Pos: pos, Value: int64(v)}
+	case evaluator.Float:
+		if math.IsInf(float64(v), 0) || math.IsNaN(float64(v)) {
+			return exp
+		}
+		return &ast.FloatLiteral{Pos: pos, Value: float64(v)}
+	case evaluator.Bool:
+		return &ast.BooleanLiteral{Pos: pos, Value: bool(v)}
+	}
+	return exp
+}
+
+func isConstant(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.BooleanLiteral:
+		return true
+	}
+	return false
+}
+
+// isValue reports whether exp is an int or float constant equal to n.
+func isValue(exp ast.Expression, n float64) bool {
+	switch c := exp.(type) {
+	case *ast.IntegerLiteral:
+		return float64(c.Value) == n
+	case *ast.FloatLiteral:
+		return c.Value == n
+	}
+	return false
+}
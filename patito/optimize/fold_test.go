@@ -0,0 +1,109 @@
+package optimize
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+func check(t testing.TB, src string) (*ast.Program, *semantic.FuncDir) {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	return prog, dir
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"i = 2 * 3 + i * 1;", "i = 6 + i;"},
+		{"i = 7 / 2 - 10;", "i = -7;"},
+		{"f = 7 / 2.0;", "f = 3.5;"},
+		{"f = 1 + 0.5 * 3;", "f = 2.5;"},
+		{"i = 9223372036854775807 + 1;", "i = -9223372036854775808;"},
+		{"i = -(3 - 5) + +i;", "i = 2 + i;"},
+		{"i = 0 + i - 0;", "i = i;"},
+		{"i = i * 0 + 1 * i / 1;", "i = i;"},
+		{"f = f * 1 + f / 1.0;", "f = f + f;"},
+		{"f = f + 0;", "f = f + 0;"},         // -0.0 + 0 is not -0.0
+		{"f = i * 1.0;", "f = i * 1.0;"},     // the result is a float, i is an int
+		{"f = f * 0;", "f = f * 0;"},         // only for ints
+		{"i = i / i * 0;", "i = i / i * 0;"}, // i / i fails when i is zero
+		{"i = 0 * (3 / i);", "i = 0 * (3 / i);"},
+		{"i = (i / 2) * 0;", "i = 0;"},
+		{"print(1 < 2, 1.5 == 3 / 2);", "print(0 == 0, 0 != 0);"},
+		{"while (i < 2 * 5) do { i = i + 1 * 1; };", "while (i < 10) do {\n    i = i + 1;\n};"},
+	}
+	for _, tt := range tests {
+		prog, dir := check(t, "program p; var i : int; f : float; main { "+tt.input+" } end")
+		if errs := Fold(prog, dir); len(errs) > 0 {
+			t.Fatalf("%s: unexpected errors %v", tt.input, errs)
+		}
+		var got []string
+		for _, stmt := range prog.Main.Statements {
+			got = append(got, strings.TrimSuffix(ast.Format(stmt), "\n"))
+		}
+		if strings.Join(got, "\n") != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestFoldLocals(t *testing.T) {
+	// Inside f, x is a float local that shadows the int global
+	prog, dir := check(t, `program p; var x : int;
+void f() [ var x : float; { x = x * 1; print(x + 0); } ];
+main { x = x * 1; f(); } end`)
+	Fold(prog, dir)
+	if got := ast.Format(prog.Funcs[0].Body); !strings.Contains(got, "x = x;") || !strings.Contains(got, "print(x + 0);") {
+		t.Fatalf("unexpected body:\n%s", got)
+	}
+}
+
+func TestDivisionByConstantZero(t *testing.T) {
+	prog, dir := check(t, "program p; var i : int; f : float;\nmain { i = i / (2 - 2); f = 1 / 0.0; } end")
+	errs := Fold(prog, dir)
+	if len(errs) != 2 || errs[0].Error() != "2:17: division by constant zero" || errs[1].Error() != "2:33: division by constant zero" {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+// Optimizing must not change what a program prints.
+func TestOptimizeKeepsOutput(t *testing.T) {
+	src, err := os.ReadFile("../testdata/demo.pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(optimize bool) string {
+		prog, dir := check(t, string(src))
+		if optimize {
+			if errs := Optimize(prog, dir, string(src)); len(errs) > 0 {
+				t.Fatal(errs)
+			}
+		}
+		var out bytes.Buffer
+		if err := evaluator.New(&out).Run(prog); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	if plain, optimized := run(false), run(true); plain != optimized {
+		t.Fatalf("optimizing changed the output.\nbefore:\n%s\nafter:\n%s", plain, optimized)
+	}
+}
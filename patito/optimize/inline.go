@@ -0,0 +1,344 @@
+package optimize
+
+import (
+	"strings"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/semantic"
+	"patito/token"
+)
+
+// InlineSize is the largest function, counted in statements plus expression
+// nodes, that Inline copies into its callers without an inline directive.
+const InlineSize = 16
+
+// Directives reads the inlining hints of the functions of prog from src, the
+// text it was parsed from. A hint is a comment on the line of the "void" that
+// starts the function, or alone on the line above it:
+//
+//	//patito:inline
+//	void small(a : int) [ ... ];
+//
+// The result maps function names to "inline" or "noinline".
+func Directives(prog *ast.Program, src string) map[string]string {
+	hints := map[int]string{} // line of the comment that applies -> hint
+	lines := strings.Split(src, "\n")
+	l := lexer.New(src)
+	for l.NextToken().Type != token.EOF {
+	}
+	for _, c := range l.Comments() {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Literal, "//"))
+		hint, ok := strings.CutPrefix(text, "patito:")
+		if !ok || hint != "inline" && hint != "noinline" {
+			continue
+		}
+		line := c.Pos.Line
+		if strings.TrimSpace(lines[line-1][:c.Pos.Column-1]) == "" {
+			line++ // a comment on its own line applies to the next one
+		}
+		hints[line] = hint
+	}
+	directives := map[string]string{}
+	for _, fn := range prog.Funcs {
+		if hint, ok := hints[fn.Pos.Line]; ok {
+			directives[fn.Name.Value] = hint
+		}
+	}
+	return directives
+}
+
+// Inline replaces calls to small functions that are not recursive with a copy
+// of their body, in place. directives, as returned by Directives, may force a
+// function to be inlined whatever its size, or keep it from ever being.
+//
+// The params and locals of the callee become new vars of the caller (see
+// scope.declare). A call becomes the assignment of each argument to its param,
+// a zero for every local that may be read before it is assigned, since each
+// activation starts with zeroed locals, and the body. A function is not inlined
+// where the caller declares a local with the name of a global the callee uses,
+// as the copy would read the local. Calls inside the copy are inlined in turn.
+func Inline(prog *ast.Program, dir *semantic.FuncDir, directives map[string]string) {
+	in := &inliner{scope: scope{dir: dir, prog: prog}, inlinable: map[string]bool{}}
+	callees := map[string]map[string]bool{}
+	for _, fn := range dir.Funcs() {
+		callees[fn.Name] = map[string]bool{}
+		eachStatement(fn.Decl.Body, func(stmt ast.Statement) {
+			if call, ok := stmt.(*ast.CallStatement); ok {
+				callees[fn.Name][call.Call.Function.Value] = true
+			}
+		})
+	}
+	for _, fn := range dir.Funcs() {
+		switch {
+		case directives[fn.Name] == "noinline", reaches(callees, fn.Name, fn.Name, map[string]bool{}):
+		case directives[fn.Name] == "inline", size(fn.Decl.Body) <= InlineSize:
+			in.inlinable[fn.Name] = true
+		}
+	}
+
+	for _, fn := range dir.Funcs() {
+		in.fn = fn
+		in.block(fn.Decl.Body)
+	}
+	in.fn = nil
+	in.block(prog.Main)
+}
+
+// reaches reports whether from can call to, directly or not.
+func reaches(callees map[string]map[string]bool, from, to string, seen map[string]bool) bool {
+	for callee := range callees[from] {
+		if callee == to {
+			return true
+		}
+		if !seen[callee] {
+			seen[callee] = true
+			if reaches(callees, callee, to, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// size counts the statements and expression nodes under block.
+func size(block *ast.BlockStatement) int {
+	n := 0
+	count := func(exp ast.Expression) { eachExpression(exp, func(ast.Expression) { n++ }) }
+	eachStatement(block, func(stmt ast.Statement) {
+		n++
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			count(s.Value)
+		case *ast.PrintStatement:
+			for _, exp := range s.Expressions {
+				count(exp)
+			}
+		case *ast.CallStatement:
+			for _, arg := range s.Call.Arguments {
+				count(arg)
+			}
+		case *ast.IfStatement:
+			count(s.Condition)
+		case *ast.WhileStatement:
+			count(s.Condition)
+		}
+	})
+	return n
+}
+
+type inliner struct {
+	scope
+	inlinable map[string]bool
+}
+
+func (in *inliner) block(block *ast.BlockStatement) {
+	var out []ast.Statement
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.CallStatement:
+			if body := in.expand(s.Call); body != nil {
+				in.block(body)
+				out = append(out, body.Statements...)
+				continue
+			}
+		case *ast.IfStatement:
+			in.block(s.Consequence)
+			if s.Alternative != nil {
+				in.block(s.Alternative)
+			}
+		case *ast.WhileStatement:
+			in.block(s.Body)
+		case *ast.BlockStatement:
+			in.block(s)
+		}
+		out = append(out, stmt)
+	}
+	block.Statements = out
+}
+
+// expand returns the statements that replace call, or nil when the callee is
+// not inlined there.
+func (in *inliner) expand(call *ast.CallExpression) *ast.BlockStatement {
+	if !in.inlinable[call.Function.Value] {
+		return nil
+	}
+	callee := in.dir.Lookup(call.Function.Value)
+	if in.fn != nil {
+		shadowed := false
+		eachStatement(callee.Decl.Body, func(stmt ast.Statement) {
+			visit := func(id *ast.Identifier) {
+				if callee.Vars.Lookup(id.Value) == nil && in.fn.Vars.Lookup(id.Value) != nil {
+					shadowed = true
+				}
+			}
+			eachIdentifier(stmt, visit)
+		})
+		if shadowed {
+			return nil
+		}
+	}
+
+	c := &copier{names: map[string]string{}}
+	body := &ast.BlockStatement{Pos: call.Pos}
+	for i, p := range callee.Params {
+		v := in.declare(p.Type)
+		c.names[p.Name] = v.Name
+		body.Statements = append(body.Statements, &ast.AssignStatement{
+			Pos:   call.Pos,
+			Name:  &ast.Identifier{Pos: call.Pos, Value: v.Name},
+			Value: call.Arguments[i],
+		})
+	}
+	for _, local := range callee.Vars.All() {
+		if local.Scope != semantic.Local {
+			continue
+		}
+		v := in.declare(local.Type)
+		c.names[local.Name] = v.Name
+		if assignedFirst(callee.Decl.Body, local.Name) {
+			continue
+		}
+		var zero ast.Expression = &ast.IntegerLiteral{Pos: call.Pos}
+		if local.Type == semantic.Float {
+			zero = &ast.FloatLiteral{Pos: call.Pos}
+		}
+		body.Statements = append(body.Statements, &ast.AssignStatement{
+			Pos:   call.Pos,
+			Name:  &ast.Identifier{Pos: call.Pos, Value: v.Name},
+			Value: zero,
+		})
+	}
+	body.Statements = append(body.Statements, c.block(callee.Decl.Body).Statements...)
+	return body
+}
+
+// assignedFirst reports whether no statement of body can read the var called
+// name before a top-level assignment to it.
+func assignedFirst(body *ast.BlockStatement, name string) bool {
+	for _, stmt := range body.Statements {
+		mentioned := false
+		eachStatement(&ast.BlockStatement{Statements: []ast.Statement{stmt}}, func(s ast.Statement) {
+			eachIdentifier(s, func(id *ast.Identifier) {
+				if id.Value == name && id != target(s) {
+					mentioned = true
+				}
+			})
+		})
+		if mentioned {
+			return false
+		}
+		if as, ok := stmt.(*ast.AssignStatement); ok && as.Name.Value == name {
+			return true
+		}
+	}
+	return true
+}
+
+// target returns the var assigned by stmt, or nil.
+func target(stmt ast.Statement) *ast.Identifier {
+	if as, ok := stmt.(*ast.AssignStatement); ok {
+		return as.Name
+	}
+	return nil
+}
+
+// eachIdentifier calls f for every var named directly by stmt: its target and
+// the identifiers in its expressions, but not those of nested blocks.
+func eachIdentifier(stmt ast.Statement, f func(*ast.Identifier)) {
+	visit := func(exp ast.Expression) {
+		eachExpression(exp, func(e ast.Expression) {
+			if id, ok := e.(*ast.Identifier); ok {
+				f(id)
+			}
+		})
+	}
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		f(s.Name)
+		visit(s.Value)
+	case *ast.PrintStatement:
+		for _, exp := range s.Expressions {
+			visit(exp)
+		}
+	case *ast.CallStatement:
+		for _, arg := range s.Call.Arguments {
+			visit(arg)
+		}
+	case *ast.IfStatement:
+		visit(s.Condition)
+	case *ast.WhileStatement:
+		visit(s.Condition)
+	}
+}
+
+// copier makes deep copies of statements, renaming the vars in names.
+type copier struct {
+	names map[string]string
+}
+
+func (c *copier) ident(id *ast.Identifier) *ast.Identifier {
+	if name, ok := c.names[id.Value]; ok {
+		return &ast.Identifier{Pos: id.Pos, Value: name}
+	}
+	return &ast.Identifier{Pos: id.Pos, Value: id.Value}
+}
+
+func (c *copier) block(block *ast.BlockStatement) *ast.BlockStatement {
+	if block == nil {
+		return nil
+	}
+	out := &ast.BlockStatement{Pos: block.Pos, Statements: make([]ast.Statement, len(block.Statements))}
+	for i, stmt := range block.Statements {
+		out.Statements[i] = c.statement(stmt)
+	}
+	return out
+}
+
+func (c *copier) statement(stmt ast.Statement) ast.Statement {
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		return &ast.AssignStatement{Pos: s.Pos, Name: c.ident(s.Name), Value: c.expr(s.Value)}
+	case *ast.PrintStatement:
+		out := &ast.PrintStatement{Pos: s.Pos, Expressions: make([]ast.Expression, len(s.Expressions))}
+		for i, exp := range s.Expressions {
+			out.Expressions[i] = c.expr(exp)
+		}
+		return out
+	case *ast.IfStatement:
+		return &ast.IfStatement{Pos: s.Pos, Condition: c.expr(s.Condition), Consequence: c.block(s.Consequence), Alternative: c.block(s.Alternative)}
+	case *ast.WhileStatement:
+		return &ast.WhileStatement{Pos: s.Pos, Condition: c.expr(s.Condition), Body: c.block(s.Body)}
+	case *ast.CallStatement:
+		return &ast.CallStatement{Pos: s.Pos, Call: c.expr(s.Call).(*ast.CallExpression)}
+	case *ast.BlockStatement:
+		return c.block(s)
+	}
+	return stmt
+}
+
+func (c *copier) expr(exp ast.Expression) ast.Expression {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		return c.ident(x)
+	case *ast.IntegerLiteral:
+		return &ast.IntegerLiteral{Pos: x.Pos, Value: x.Value}
+	case *ast.FloatLiteral:
+		return &ast.FloatLiteral{Pos: x.Pos, Value: x.Value}
+	case *ast.BooleanLiteral:
+		return &ast.BooleanLiteral{Pos: x.Pos, Value: x.Value}
+	case *ast.StringLiteral:
+		return &ast.StringLiteral{Pos: x.Pos, Value: x.Value}
+	case *ast.PrefixExpression:
+		return &ast.PrefixExpression{Pos: x.Pos, Operator: x.Operator, Right: c.expr(x.Right)}
+	case *ast.InfixExpression:
+		return &ast.InfixExpression{Pos: x.Pos, Left: c.expr(x.Left), Operator: x.Operator, Right: c.expr(x.Right)}
+	case *ast.CallExpression:
+		out := &ast.CallExpression{Pos: x.Pos, Function: &ast.Identifier{Pos: x.Function.Pos, Value: x.Function.Value}}
+		for _, arg := range x.Arguments {
+			out.Arguments = append(out.Arguments, c.expr(arg))
+		}
+		return out
+	}
+	return exp
+}
@@ -0,0 +1,150 @@
+package optimize
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/evaluator"
+)
+
+func inlined(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	prog, dir := check(t, src)
+	Inline(prog, dir, Directives(prog, src))
+	return prog
+}
+
+func TestInline(t *testing.T) {
+	prog := inlined(t, `program p;
+var g : int;
+    f : float;
+void add(a : int, b : float) [
+    var t : float;
+    u : int;
+    {
+        t = a + b;
+        print(t, u);
+        g = g + a;
+    }
+];
+main { add(g * 2, f); } end`)
+	expected := `_t1 = g * 2;
+_t2 = f;
+_t4 = 0;
+_t3 = _t1 + _t2;
+print(_t3, _t4);
+g = g + _t1;
+`
+	if got := format(prog.Main.Statements); got != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func format(stmts []ast.Statement) string {
+	var sb strings.Builder
+	for _, stmt := range stmts {
+		sb.WriteString(ast.Format(stmt))
+	}
+	return sb.String()
+}
+
+func TestInlineChoices(t *testing.T) {
+	prog := inlined(t, `program p;
+var n : int;
+void rec(a : int) [ { if (a > 0) { rec(a - 1); }; } ];
+void even(a : int) [ { if (a > 0) { odd(a - 1); }; } ];
+void odd(a : int) [ { if (a > 0) { even(a - 1); }; } ];
+void big() [
+    {
+        n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+    }
+];
+//patito:inline
+void forced() [
+    {
+        n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+    }
+];
+void kept() [ { n = 1; } ]; //patito:noinline
+void outer() [ { inner(); } ];
+void inner() [ { n = 2; } ];
+main { rec(1); even(2); big(); forced(); kept(); outer(); } end`)
+	got := format(prog.Main.Statements)
+	for _, call := range []string{"rec(1);", "even(2);", "big();", "kept();"} {
+		if !strings.Contains(got, call) {
+			t.Errorf("%s should not be inlined:\n%s", call, got)
+		}
+	}
+	for _, call := range []string{"forced();", "outer();", "inner();"} {
+		if strings.Contains(got, call) {
+			t.Errorf("%s should be inlined:\n%s", call, got)
+		}
+	}
+	if !strings.Contains(got, "n = 2;") || strings.Count(got, "n = n + 1;") != 6 {
+		t.Errorf("unexpected inlined code:\n%s", got)
+	}
+}
+
+func TestInlineShadowed(t *testing.T) {
+	// Inside h, g is a local, so the copy of f would assign it instead of the global
+	prog := inlined(t, `program p;
+var g : int;
+void f() [ { g = 1; } ];
+void h() [ var g : int; { f(); g = 2; } ];
+main { f(); h(); } end`)
+	if got := format(prog.Funcs[1].Body.Statements); got != "f();\ng = 2;\n" {
+		t.Errorf("f should stay a call in h:\n%s", got)
+	}
+	// In main the copy of h has its own g, and f can be inlined into it
+	if got := format(prog.Main.Statements); got != "g = 1;\ng = 1;\n_t1 = 2;\n" {
+		t.Errorf("unexpected main:\n%s", got)
+	}
+}
+
+func TestInlineKeepsOutput(t *testing.T) {
+	src := `program p;
+var i, g : int;
+//patito:inline
+void count(n : int) [
+    var k, sum : int;
+    {
+        while (k < n) do {
+            sum = sum + k;
+            k = k + 1;
+        };
+        g = g + sum;
+        print(n, sum);
+    }
+];
+void twice(x : float) [ { print(x * 2); count(i); } ];
+main {
+    while (i < 4) do {
+        count(i);
+        twice(i / 2);
+        i = i + 1;
+    };
+    print(g);
+}
+end`
+	run := func(optimize bool) string {
+		prog, dir := check(t, src)
+		if optimize {
+			if errs := Optimize(prog, dir, src); len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if strings.Contains(ast.Format(prog.Main), "count(") {
+				t.Fatalf("count should be inlined:\n%s", ast.Format(prog.Main))
+			}
+		}
+		var out bytes.Buffer
+		if err := evaluator.New(&out).Run(prog); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	if plain, optimized := run(false), run(true); plain != optimized {
+		t.Fatalf("inlining changed the output.\nbefore:\n%s\nafter:\n%s", plain, optimized)
+	}
+}
@@ -0,0 +1,218 @@
+package optimize
+
+import (
+	"patito/ast"
+	"patito/semantic"
+)
+
+// LICM moves loop-invariant computations out of while loops, in place. An
+// int or float subexpression of a loop's condition or body is invariant when
+// none of the vars it reads is assigned inside the loop, directly or by a
+// function the loop calls. Patito has no break, so with no assignment inside
+// the loop the only definitions that reach it are the ones before it.
+//
+// Each invariant is computed once into a new var (see scope.declare) just
+// before the loop, the preheader, and the loop reads that var instead. The
+// outermost loop is handled first, so an expression that is invariant in
+// several nested loops leaves all of them. A division is only moved when its
+// divisor is a constant other than zero: the loop might never run, and the
+// hoisted code must not fail where the original did not.
+func LICM(prog *ast.Program, dir *semantic.FuncDir) {
+	l := &licm{scope: scope{dir: dir, prog: prog}}
+	l.globalWrites()
+	for _, fn := range dir.Funcs() {
+		l.fn = fn
+		l.block(fn.Decl.Body)
+	}
+	l.fn = nil
+	l.block(prog.Main)
+}
+
+type licm struct {
+	scope
+	writes map[string]map[*semantic.Var]bool // globals each function may assign, including through calls
+}
+
+func (l *licm) block(block *ast.BlockStatement) {
+	var out []ast.Statement
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.IfStatement:
+			l.block(s.Consequence)
+			if s.Alternative != nil {
+				l.block(s.Alternative)
+			}
+		case *ast.WhileStatement:
+			out = append(out, l.hoist(s)...)
+			l.block(s.Body)
+		case *ast.BlockStatement:
+			l.block(s)
+		}
+		out = append(out, stmt)
+	}
+	block.Statements = out
+}
+
+// hoist rewrites the invariants of loop and returns the statements of its
+// preheader.
+func (l *licm) hoist(loop *ast.WhileStatement) []ast.Statement {
+	h := &hoister{licm: l, assigned: map[*semantic.Var]bool{}, temps: map[string]*semantic.Var{}}
+	eachStatement(loop.Body, func(stmt ast.Statement) {
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			if v := l.lookup(s.Name.Value); v != nil {
+				h.assigned[v] = true
+			}
+		case *ast.CallStatement:
+			for g := range l.writes[s.Call.Function.Value] {
+				h.assigned[g] = true
+			}
+		}
+	})
+	loop.Condition = h.expr(loop.Condition)
+	eachStatement(loop.Body, func(stmt ast.Statement) {
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			s.Value = h.expr(s.Value)
+		case *ast.PrintStatement:
+			for i, exp := range s.Expressions {
+				s.Expressions[i] = h.expr(exp)
+			}
+		case *ast.CallStatement:
+			for i, arg := range s.Call.Arguments {
+				s.Call.Arguments[i] = h.expr(arg)
+			}
+		case *ast.IfStatement:
+			s.Condition = h.expr(s.Condition)
+		case *ast.WhileStatement:
+			s.Condition = h.expr(s.Condition)
+		}
+	})
+	return h.preheader
+}
+
+type hoister struct {
+	*licm
+	assigned  map[*semantic.Var]bool // vars the loop may assign
+	temps     map[string]*semantic.Var
+	preheader []ast.Statement
+}
+
+// expr replaces the largest invariant subexpressions of exp with temps.
+func (h *hoister) expr(exp ast.Expression) ast.Expression {
+	switch x := exp.(type) {
+	case *ast.PrefixExpression:
+		if h.invariant(exp) {
+			return h.temp(exp)
+		}
+		x.Right = h.expr(x.Right)
+	case *ast.InfixExpression:
+		if h.invariant(exp) {
+			return h.temp(exp)
+		}
+		x.Left, x.Right = h.expr(x.Left), h.expr(x.Right)
+	}
+	return exp
+}
+
+// invariant reports whether exp can be computed before the loop.
+func (h *hoister) invariant(exp ast.Expression) bool {
+	if t := h.typeOf(exp); t != semantic.Int && t != semantic.Float {
+		return false
+	}
+	ok := true
+	eachExpression(exp, func(e ast.Expression) {
+		if id, isID := e.(*ast.Identifier); isID {
+			if v := h.lookup(id.Value); v == nil || h.assigned[v] {
+				ok = false
+			}
+		}
+	})
+	return ok && !mayFail(exp)
+}
+
+// temp returns a read of the var that holds exp, computing it in the
+// preheader the first time.
+func (h *hoister) temp(exp ast.Expression) ast.Expression {
+	key := ast.Format(exp)
+	v, ok := h.temps[key]
+	if !ok {
+		v = h.declare(h.typeOf(exp))
+		h.temps[key] = v
+		h.preheader = append(h.preheader, &ast.AssignStatement{
+			Pos:   exp.Position(),
+			Name:  &ast.Identifier{Pos: exp.Position(), Value: v.Name},
+			Value: exp,
+		})
+	}
+	return &ast.Identifier{Pos: exp.Position(), Value: v.Name}
+}
+
+// globalWrites computes the globals that each function may assign.
+func (l *licm) globalWrites() {
+	l.writes = map[string]map[*semantic.Var]bool{}
+	callees := map[string][]string{}
+	for _, fn := range l.dir.Funcs() {
+		l.fn = fn
+		writes := map[*semantic.Var]bool{}
+		eachStatement(fn.Decl.Body, func(stmt ast.Statement) {
+			switch s := stmt.(type) {
+			case *ast.AssignStatement:
+				if v := l.lookup(s.Name.Value); v != nil && v.Scope == semantic.Global {
+					writes[v] = true
+				}
+			case *ast.CallStatement:
+				callees[fn.Name] = append(callees[fn.Name], s.Call.Function.Value)
+			}
+		})
+		l.writes[fn.Name] = writes
+	}
+	l.fn = nil
+	for changed := true; changed; {
+		changed = false
+		for caller, names := range callees {
+			for _, callee := range names {
+				for g := range l.writes[callee] {
+					if !l.writes[caller][g] {
+						l.writes[caller][g] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// eachStatement calls f for every statement under block, outer ones first.
+func eachStatement(block *ast.BlockStatement, f func(ast.Statement)) {
+	for _, stmt := range block.Statements {
+		f(stmt)
+		switch s := stmt.(type) {
+		case *ast.IfStatement:
+			eachStatement(s.Consequence, f)
+			if s.Alternative != nil {
+				eachStatement(s.Alternative, f)
+			}
+		case *ast.WhileStatement:
+			eachStatement(s.Body, f)
+		case *ast.BlockStatement:
+			eachStatement(s, f)
+		}
+	}
+}
+
+// eachExpression calls f for exp and every expression under it.
+func eachExpression(exp ast.Expression, f func(ast.Expression)) {
+	f(exp)
+	switch x := exp.(type) {
+	case *ast.PrefixExpression:
+		eachExpression(x.Right, f)
+	case *ast.InfixExpression:
+		eachExpression(x.Left, f)
+		eachExpression(x.Right, f)
+	case *ast.CallExpression:
+		for _, arg := range x.Arguments {
+			eachExpression(arg, f)
+		}
+	}
+}
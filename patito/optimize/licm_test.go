@@ -0,0 +1,130 @@
+package optimize
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+const licmDecls = `program p;
+var i, j, n, s : int;
+    k : float;
+void setn() [ { n = 1; } ];
+void other() [ { s = 1; } ];
+void indirect() [ { setn(); } ];
+`
+
+func TestLICM(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (i < n * 2) do { i = i + 1; };", "_t1 = n * 2;\nwhile (i < _t1) do {\n    i = i + 1;\n};"},
+		{"while (i < n) do { s = s + n * n + i; i = i + 1; };",
+			"_t1 = n * n;\nwhile (i < n) do {\n    s = s + _t1 + i;\n    i = i + 1;\n};"},
+		// The same invariant twice shares one temp
+		{"while (i < n) do { print(k * 2, k * 2); i = i + 1; };",
+			"_t1 = k * 2;\nwhile (i < n) do {\n    print(_t1, _t1);\n    i = i + 1;\n};"},
+		{"while (i < n) do { n = n - 1; s = n * 2; };", "while (i < n) do {\n    n = n - 1;\n    s = n * 2;\n};"},
+		// setn assigns n, even through indirect; other does not
+		{"while (i < n * 2) do { setn(); };", "while (i < n * 2) do {\n    setn();\n};"},
+		{"while (i < n * 2) do { indirect(); };", "while (i < n * 2) do {\n    indirect();\n};"},
+		{"while (i < n * 2) do { other(); };", "_t1 = n * 2;\nwhile (i < _t1) do {\n    other();\n};"},
+		// The loop may never run, so only divisions that cannot fail move
+		{"while (i < n) do { print(k / n + n / 2); };", "_t1 = n / 2;\nwhile (i < n) do {\n    print(k / n + _t1);\n};"},
+		{"while (i < n) do { j = 0; while (j < n) do { s = i * 2 + n * 3; j = j + 1; }; i = i + 1; };",
+			"_t1 = n * 3;\nwhile (i < n) do {\n    j = 0;\n    _t2 = i * 2 + _t1;\n    while (j < n) do {\n        s = _t2;\n        j = j + 1;\n    };\n    i = i + 1;\n};"},
+		{"if (i > 0) { while (i < -n) do { i = i + 1; }; };", "if (i > 0) {\n    _t1 = -n;\n    while (i < _t1) do {\n        i = i + 1;\n    };\n};"},
+	}
+	for _, tt := range tests {
+		prog, dir := check(t, licmDecls+"main { "+tt.input+" } end")
+		LICM(prog, dir)
+		var got []string
+		for _, stmt := range prog.Main.Statements {
+			got = append(got, strings.TrimSuffix(ast.Format(stmt), "\n"))
+		}
+		if strings.Join(got, "\n") != tt.expected {
+			t.Errorf("%s:\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestLICMInFunction(t *testing.T) {
+	prog, dir := check(t, `program p;
+var n : int;
+void f(m : int) [
+    var i : int;
+    { while (i < m * n) do { i = i + 1; }; }
+];
+main { n = 2; f(3); } end`)
+	LICM(prog, dir)
+	if got := ast.Format(prog.Funcs[0].Body.Statements[0]); got != "_t1 = m * n;\n" {
+		t.Fatalf("unexpected preheader %q", got)
+	}
+	if v := dir.Lookup("f").Vars.Lookup("_t1"); v == nil || v.Scope != semantic.Local {
+		t.Fatalf("expected _t1 to be a local of f, got %+v", v)
+	}
+}
+
+// nested is a numeric program where most of the inner loop is invariant.
+const nested = `program bench;
+var i, j, n, s : int;
+    x, y : float;
+main {
+    n = 60;
+    x = 1.5;
+    i = 0;
+    while (i < n * 2) do {
+        j = 0;
+        while (j < n * n / 4) do {
+            s = s + i * n * 3 + j;
+            y = x * x * 2.0 + i;
+            j = j + 1;
+        };
+        i = i + 1;
+    };
+    print(s, y);
+}
+end`
+
+func TestLICMKeepsOutput(t *testing.T) {
+	run := func(licm bool) string {
+		prog, dir := check(t, nested)
+		if licm {
+			LICM(prog, dir)
+		}
+		var out bytes.Buffer
+		if err := evaluator.New(&out).Run(prog); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	if plain, optimized := run(false), run(true); plain != optimized {
+		t.Fatalf("LICM changed the output.\nbefore:\n%s\nafter:\n%s", plain, optimized)
+	}
+}
+
+func BenchmarkLICM(b *testing.B) {
+	for _, licm := range []bool{false, true} {
+		name := "O0"
+		if licm {
+			name = "LICM"
+		}
+		b.Run(name, func(b *testing.B) {
+			prog, dir := check(b, nested)
+			if licm {
+				LICM(prog, dir)
+			}
+			for b.Loop() {
+				if err := evaluator.New(io.Discard).Run(prog); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Package optimize rewrites checked programs into equivalent ones that do less
+// work at run time. The passes work on the AST in place.
+package optimize
+
+import (
+	"fmt"
+
+	"patito/ast"
+	"patito/semantic"
+)
+
+// Optimize runs the passes of -O1 on a program that passed semantic.Check
+// with dir: Fold, Inline, LICM, CSE, then Prune. The later passes only run when
+// folding found no errors. src is the text prog was parsed from; it is only
+// read for inlining directives.
+func Optimize(prog *ast.Program, dir *semantic.FuncDir, src string) []*semantic.Error {
+	if errs := Fold(prog, dir); len(errs) > 0 {
+		return errs
+	}
+	Inline(prog, dir, Directives(prog, src))
+	LICM(prog, dir)
+	CSE(prog, dir)
+	Prune(prog)
+	return nil
+}
+
+// scope resolves names inside the body being optimized the way the checker
+// does: locals and params first, then globals.
+type scope struct {
+	prog *ast.Program
+	dir  *semantic.FuncDir
+	fn   *semantic.Func // function being optimized, nil for main
+}
+
+func (s scope) lookup(name string) *semantic.Var {
+	if s.fn != nil {
+		if local := s.fn.Vars.Lookup(name); local != nil {
+			return local
+		}
+	}
+	return s.dir.Globals.Lookup(name)
+}
+
+func (s scope) typeOf(exp ast.Expression) semantic.Type {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		if v := s.lookup(x.Value); v != nil {
+			return v.Type
+		}
+	case *ast.IntegerLiteral:
+		return semantic.Int
+	case *ast.FloatLiteral:
+		return semantic.Float
+	case *ast.BooleanLiteral:
+		return semantic.Bool
+	case *ast.PrefixExpression:
+		return semantic.PrefixResultType(x.Operator, s.typeOf(x.Right))
+	case *ast.InfixExpression:
+		return semantic.ResultType(x.Operator, s.typeOf(x.Left), s.typeOf(x.Right))
+	}
+	return semantic.Invalid
+}
+
+// declare adds a new var of type t to the body being optimized: a local of the
+// function, or a global in main, in both the tree and dir. It is named _t1,
+// _t2... which no source identifier can be, skipping the names earlier passes
+// took anywhere in the program.
+func (s scope) declare(t semantic.Type) *semantic.Var {
+	var name string
+	for n := 1; ; n++ {
+		name = fmt.Sprintf("_t%d", n)
+		if !s.taken(name) {
+			break
+		}
+	}
+	decl := &ast.VarDecl{Names: []*ast.Identifier{{Value: name}}, Type: t.String()}
+	v := &semantic.Var{Name: name, Type: t, Scope: semantic.Global, Decl: decl.Names[0]}
+	if s.fn != nil {
+		v.Scope = semantic.Local
+		s.fn.Vars.Add(v)
+		s.fn.Decl.Vars = append(s.fn.Decl.Vars, decl)
+	} else {
+		s.dir.Globals.Add(v)
+		s.prog.Vars = append(s.prog.Vars, decl)
+	}
+	return v
+}
+
+func (s scope) taken(name string) bool {
+	if s.dir.Globals.Lookup(name) != nil {
+		return true
+	}
+	for _, fn := range s.dir.Funcs() {
+		if fn.Vars.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package optimize
+
+import (
+	"strings"
+
+	"patito/ast"
+)
+
+// Prune removes the statements of prog that can never run or have no effect,
+// in place. It expects a program that went through Fold, so constant
+// conditions are BooleanLiterals:
+//
+//   - an if on a constant is replaced by the statements of the branch taken;
+//   - a while on false is removed;
+//   - a while on true never ends, since Patito has no break, so everything
+//     after it in the body is removed, and so is everything after a statement
+//     that contains such a loop on every path;
+//   - an assignment of a var to itself, such as the x = x that Fold leaves
+//     from x = x + 0, is removed;
+//   - an assignment to a temp made by another pass that is never read, such
+//     as the copy of a param that CSE propagated, is removed unless its value
+//     divides by something that may be zero.
+//
+// Patito has no block scope, so splicing a branch into its parent is safe.
+func Prune(prog *ast.Program) {
+	for _, fn := range prog.Funcs {
+		prune(fn.Body)
+		unusedTemps(fn.Body)
+	}
+	prune(prog.Main)
+	unusedTemps(prog.Main)
+}
+
+// unusedTemps removes the assignments to temps that body never reads. Temps
+// are only used in the body they were made for, even the globals of main.
+func unusedTemps(body *ast.BlockStatement) {
+	for {
+		read := map[string]bool{}
+		eachStatement(body, func(stmt ast.Statement) {
+			eachIdentifier(stmt, func(id *ast.Identifier) {
+				if id != target(stmt) {
+					read[id.Value] = true
+				}
+			})
+		})
+		if !dropAssignments(body, func(as *ast.AssignStatement) bool {
+			return strings.HasPrefix(as.Name.Value, "_") && !read[as.Name.Value] && !mayFail(as.Value)
+		}) {
+			return
+		}
+	}
+}
+
+// dropAssignments removes the assignments under block that match and reports
+// whether there was any.
+func dropAssignments(block *ast.BlockStatement, match func(*ast.AssignStatement) bool) bool {
+	dropped := false
+	kept := block.Statements[:0]
+	for _, stmt := range block.Statements {
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			if match(s) {
+				dropped = true
+				continue
+			}
+		case *ast.IfStatement:
+			dropped = dropAssignments(s.Consequence, match) || dropped
+			if s.Alternative != nil {
+				dropped = dropAssignments(s.Alternative, match) || dropped
+			}
+		case *ast.WhileStatement:
+			dropped = dropAssignments(s.Body, match) || dropped
+		case *ast.BlockStatement:
+			dropped = dropAssignments(s, match) || dropped
+		}
+		kept = append(kept, stmt)
+	}
+	block.Statements = kept
+	return dropped
+}
+
+// mayFail reports whether evaluating exp can fail: it divides by something
+// that is not a constant other than zero.
+func mayFail(exp ast.Expression) bool {
+	fails := false
+	eachExpression(exp, func(e ast.Expression) {
+		if x, ok := e.(*ast.InfixExpression); ok && x.Operator == "/" && (!isConstant(x.Right) || isValue(x.Right, 0)) {
+			fails = true
+		}
+	})
+	return fails
+}
+
+// prune rewrites the statements of block and reports whether running it can
+// finish.
+func prune(block *ast.BlockStatement) bool {
+	var kept []ast.Statement
+	completes := true
+	for _, stmt := range block.Statements {
+		if !completes {
+			break
+		}
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			if id, ok := s.Value.(*ast.Identifier); ok && id.Value == s.Name.Value {
+				continue
+			}
+		case *ast.IfStatement:
+			if cond, ok := s.Condition.(*ast.BooleanLiteral); ok {
+				taken := s.Alternative
+				if cond.Value {
+					taken = s.Consequence
+				}
+				if taken != nil {
+					completes = prune(taken)
+					kept = append(kept, taken.Statements...)
+				}
+				continue
+			}
+			then := prune(s.Consequence)
+			els := s.Alternative == nil || prune(s.Alternative)
+			completes = then || els
+		case *ast.WhileStatement:
+			if cond, ok := s.Condition.(*ast.BooleanLiteral); ok && !cond.Value {
+				continue
+			} else if ok {
+				completes = false
+			}
+			prune(s.Body)
+		case *ast.BlockStatement:
+			completes = prune(s)
+		}
+		kept = append(kept, stmt)
+	}
+	block.Statements = kept
+	return completes
+}
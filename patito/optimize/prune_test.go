@@ -0,0 +1,53 @@
+package optimize
+
+import (
+	"strings"
+	"testing"
+
+	"patito/ast"
+)
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (1 < 2) { i = 1; } else { i = 2; };", "i = 1;"},
+		{"if (1 > 2) { i = 1; } else { i = 2; }; i = 3;", "i = 2;\ni = 3;"},
+		{"if (1 > 2) { i = 1; }; i = 3;", "i = 3;"},
+		{"while (1 > 2) do { i = 1; }; i = 3;", "i = 3;"},
+		{"if (i > 0) { if (0 < 1) { print(i); }; };", "if (i > 0) {\n    print(i);\n};"},
+		{"while (0 == 0) do { i = i + 1; }; print(i);", "while (0 == 0) do {\n    i = i + 1;\n};"},
+		// Only the then branch loops forever, so the print can still run
+		{"if (i > 0) { while (1 == 1) do { }; }; print(i);", "if (i > 0) {\n    while (0 == 0) do {\n    };\n};\nprint(i);"},
+		{"if (i > 0) { while (1 == 1) do { }; } else { while (2 == 2) do { }; }; print(i);",
+			"if (i > 0) {\n    while (0 == 0) do {\n    };\n} else {\n    while (0 == 0) do {\n    };\n};"},
+		{"if (1 == 1) { while (1 == 1) do { }; print(1); }; print(2);", "while (0 == 0) do {\n};"},
+		{"i = i; i = i * 1 + 0; print(i);", "print(i);"},
+		// A condition that is not constant stays, even if it can never be true
+		{"while (i < i) do { i = 1; };", "while (i < i) do {\n    i = 1;\n};"},
+	}
+	for _, tt := range tests {
+		src := "program p; var i : int; main { " + tt.input + " } end"
+		prog, dir := check(t, src)
+		if errs := Optimize(prog, dir, src); len(errs) > 0 {
+			t.Fatalf("%s: unexpected errors %v", tt.input, errs)
+		}
+		var got []string
+		for _, stmt := range prog.Main.Statements {
+			got = append(got, strings.TrimSuffix(ast.Format(stmt), "\n"))
+		}
+		if strings.Join(got, "\n") != tt.expected {
+			t.Errorf("%s:\nexpected:\n%s\ngot:\n%s", tt.input, tt.expected, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestPruneFunctions(t *testing.T) {
+	src := "program p; void f() [ { if (1 > 2) { print(1); }; } ]; main { f(); } end"
+	prog, dir := check(t, src)
+	Optimize(prog, dir, src)
+	if n := len(prog.Funcs[0].Body.Statements); n != 0 {
+		t.Fatalf("expected an empty body, got %d statements", n)
+	}
+}
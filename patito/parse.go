@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/optimize"
+	"patito/parser"
+	"patito/semantic"
+)
+
+// runParse implements "patito parse": it prints the AST of a program as an
+// S-expression or as JSON, optionally after optimizing it. Syntax errors go
+// to stderr and exit with status 1.
+func runParse(args []string) int {
+	fs := flag.NewFlagSet("parse", flag.ContinueOnError)
+	format := fs.String("format", "sexpr", "output format: sexpr or json")
+	level := optFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "sexpr" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "patito parse: unknown format %q (want sexpr or json)\n", *format)
+		return 2
+	}
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito parse: %v\n", err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+		}
+		return 1
+	}
+	if *level > 0 {
+		// Folding needs the types of the operands, so check the program first
+		dir, errs := semantic.Check(prog)
+		if len(errs) == 0 {
+			errs = optimize.Optimize(prog, dir, src)
+		}
+		if len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+			}
+			return 1
+		}
+	}
+
+	switch *format {
+	case "json":
+		out, err := ast.EncodeJSON(prog)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "patito parse: %v\n", err)
+			return 1
+		}
+		os.Stdout.Write(out)
+	default:
+		fmt.Println(ast.SExpr(prog))
+	}
+	return 0
+}
@@ -1,6 +1,24 @@
+// Package parser implements a recursive-descent parser for the Patito language.
+// Each parseX method follows one rule of the grammar:
+//
+//	Programa   -> program ID ; VARS? FUNCS* main Body end
+//	VARS       -> var (ID (, ID)* : TYPE ;)+
+//	FUNCS      -> void ID ( (ID : TYPE (, ID : TYPE)*)? ) [ VARS? Body ] ;
+//	Body       -> { STATEMENT* }
+//	STATEMENT  -> ASSIGN | CONDITION | CYCLE | F_CALL | PRINT
+//	CONDITION  -> if ( EXPRESION ) Body (else Body)? ;
+//	CYCLE      -> while ( EXPRESION ) do Body ;
+//	PRINT      -> print ( (EXPRESION | CTE_STRING) (, ...)* ) ;
+//	EXPRESION  -> EXP ((> | < | >= | <= | == | !=) EXP)?
+//	EXP        -> TERMINO ((+ | -) TERMINO)*
+//	TERMINO    -> FACTOR ((* | /) FACTOR)*
+//	FACTOR     -> ( EXPRESION ) | (+ | -) FACTOR | ID | CTE
+//
+// The parser always keeps currToken on the next token that has not been consumed yet.
 package parser
 
 import (
+	"fmt"
 	"patito/ast"
 	"patito/lexer"
 	"patito/token"
@@ -12,6 +30,8 @@ type Parser struct {
 	currToken token.Token
 	peekToken token.Token
 	errors    []string
+	syntax    []*Error // the same errors, with their positions
+	fragment  bool     // parsing a REPL entry: end of input may replace the last ';'
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -21,81 +41,503 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Error is a syntax error at a position of the source.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// Errors returns the syntax errors found so far, formatted as "line:col: message".
 func (p *Parser) Errors() []string { return p.errors }
 
+// SyntaxErrors returns the same errors as Errors, for tools that need positions.
+func (p *Parser) SyntaxErrors() []*Error { return p.syntax }
+
 func (p *Parser) nextToken() {
 	p.currToken = p.peekToken
 	p.peekToken = p.l.NextToken()
 }
 
-func (p *Parser) ParseProgram() *ast.Program {
-	prog := &ast.Program{}
+func (p *Parser) errorf(pos token.Position, format string, args ...any) {
+	err := &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	p.errors = append(p.errors, err.Error())
+	p.syntax = append(p.syntax, err)
+}
+
+// expect consumes the current token if it has type t, otherwise it records an error
+// and leaves the token in place so the caller can recover.
+func (p *Parser) expect(t token.TokenType) bool {
+	if p.currToken.Type != t {
+		p.unexpected(strconv.Quote(string(t)))
+		return false
+	}
+	p.nextToken()
+	return true
+}
+
+func (p *Parser) unexpected(want string) {
+	got := p.currToken.Literal
+	switch p.currToken.Type {
+	case token.EOF:
+		got = "end of file"
+	case token.ILLEGAL:
+		got = "illegal character " + strconv.Quote(got)
+	default:
+		got = strconv.Quote(got)
+	}
+	p.errorf(p.currToken.Pos, "expected %s, got %s", want, got)
+}
+
+// expectSemicolon consumes the ';' that closes a statement or declaration.
+func (p *Parser) expectSemicolon() bool {
+	if p.fragment && p.currToken.Type == token.EOF {
+		return true
+	}
+	return p.expect(token.SEMICOLON)
+}
+
+// synchronize skips tokens after a syntax error until the end of the broken
+// statement (a ';', which is consumed) or the end of the enclosing block.
+// Nested braces inside the broken statement are skipped as a whole.
+func (p *Parser) synchronize() {
+	depth := 0
 	for p.currToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			prog.Decls = append(prog.Decls, stmt)
+		switch p.currToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
 		}
 		p.nextToken()
 	}
+}
+
+// ---------- Declarations ----------
+
+// ParseProgram parses a complete Patito program. When Errors() is not empty the
+// returned tree may be incomplete (missing functions or a nil Main).
+func (p *Parser) ParseProgram() *ast.Program {
+	prog := &ast.Program{Pos: p.currToken.Pos}
+	if !p.expect(token.PROGRAM) {
+		return prog
+	}
+	if prog.Name = p.parseIdentifier(); prog.Name == nil || !p.expectSemicolon() {
+		return prog
+	}
+	if p.currToken.Type == token.VAR {
+		if prog.Vars = p.parseVars(); prog.Vars == nil {
+			return prog
+		}
+	}
+	for p.currToken.Type == token.VOID {
+		fn := p.parseFunc()
+		if fn == nil {
+			return prog
+		}
+		prog.Funcs = append(prog.Funcs, fn)
+	}
+	if !p.expect(token.MAIN) {
+		return prog
+	}
+	if prog.Main = p.parseBlock(); prog.Main == nil {
+		return prog
+	}
+	if !p.expect(token.END) {
+		return prog
+	}
+	if p.currToken.Type != token.EOF {
+		p.unexpected("end of file")
+	}
 	return prog
 }
 
+// ParseFragment parses one REPL entry: any sequence of var sections, function
+// declarations, statements and bare expressions, returned in source order as
+// *ast.VarDecl, *ast.FuncDecl, ast.Statement or ast.Expression nodes. The last
+// item may omit its ';'. Parsing stops at the first syntax error.
+func (p *Parser) ParseFragment() []ast.Node {
+	p.fragment = true
+	var nodes []ast.Node
+	for p.currToken.Type != token.EOF && len(p.errors) == 0 {
+		switch p.currToken.Type {
+		case token.VAR:
+			for _, decl := range p.parseVars() {
+				nodes = append(nodes, decl)
+			}
+		case token.VOID:
+			if fn := p.parseFunc(); fn != nil {
+				nodes = append(nodes, fn)
+			}
+		case token.IF, token.WHILE, token.PRINT:
+			if stmt := p.parseStatement(); stmt != nil {
+				nodes = append(nodes, stmt)
+			}
+		default:
+			if p.currToken.Type == token.IDENT && (p.peekToken.Type == token.ASSIGN || p.peekToken.Type == token.LPAREN) {
+				if stmt := p.parseStatement(); stmt != nil {
+					nodes = append(nodes, stmt)
+				}
+				continue
+			}
+			if exp := p.parseExpression(); exp != nil && p.expectSemicolon() {
+				nodes = append(nodes, exp)
+			}
+		}
+	}
+	return nodes
+}
+
+// parseVars parses a "var" section. It returns nil if the section is malformed.
+func (p *Parser) parseVars() []*ast.VarDecl {
+	p.nextToken() // consume 'var'
+	if p.currToken.Type != token.IDENT {
+		p.unexpected("identifier")
+		return nil
+	}
+	var decls []*ast.VarDecl
+	for p.currToken.Type == token.IDENT && (!p.fragment || p.startsVarDecl()) {
+		decl := &ast.VarDecl{Pos: p.currToken.Pos}
+		for {
+			id := p.parseIdentifier()
+			if id == nil {
+				return nil
+			}
+			decl.Names = append(decl.Names, id)
+			if p.currToken.Type != token.COMMA {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expect(token.COLON) {
+			return nil
+		}
+		if decl.Type = p.parseType(); decl.Type == "" || !p.expectSemicolon() {
+			return nil
+		}
+		decls = append(decls, decl)
+	}
+	return decls
+}
+
+// startsVarDecl tells a declaration line ("x, y : int") apart from a statement
+// that follows a var section inside a REPL entry ("x = 1").
+func (p *Parser) startsVarDecl() bool {
+	return p.peekToken.Type == token.COMMA || p.peekToken.Type == token.COLON
+}
+
+func (p *Parser) parseType() string {
+	switch p.currToken.Type {
+	case token.INT, token.FLOAT:
+		t := p.currToken.Literal
+		p.nextToken()
+		return t
+	}
+	p.unexpected("type (int or float)")
+	return ""
+}
+
+func (p *Parser) parseFunc() *ast.FuncDecl {
+	fn := &ast.FuncDecl{Pos: p.currToken.Pos}
+	p.nextToken() // consume 'void'
+	if fn.Name = p.parseIdentifier(); fn.Name == nil || !p.expect(token.LPAREN) {
+		return nil
+	}
+	for p.currToken.Type != token.RPAREN {
+		if len(fn.Params) > 0 && !p.expect(token.COMMA) {
+			return nil
+		}
+		param := &ast.Param{Pos: p.currToken.Pos}
+		if param.Name = p.parseIdentifier(); param.Name == nil || !p.expect(token.COLON) {
+			return nil
+		}
+		if param.Type = p.parseType(); param.Type == "" {
+			return nil
+		}
+		fn.Params = append(fn.Params, param)
+	}
+	p.nextToken() // consume ')'
+	if !p.expect(token.LBRACKET) {
+		return nil
+	}
+	if p.currToken.Type == token.VAR {
+		if fn.Vars = p.parseVars(); fn.Vars == nil {
+			return nil
+		}
+	}
+	if fn.Body = p.parseBlock(); fn.Body == nil {
+		return nil
+	}
+	if !p.expect(token.RBRACKET) || !p.expectSemicolon() {
+		return nil
+	}
+	return fn
+}
+
+// ---------- Statements ----------
+
+// parseBlock parses { STATEMENT* }. Broken statements are reported and skipped so
+// that one typo does not hide the errors that follow it.
+func (p *Parser) parseBlock() *ast.BlockStatement {
+	block := &ast.BlockStatement{Pos: p.currToken.Pos}
+	if !p.expect(token.LBRACE) {
+		return nil
+	}
+	for p.currToken.Type != token.RBRACE && p.currToken.Type != token.EOF {
+		stmt := p.parseStatement()
+		if stmt == nil {
+			p.synchronize()
+			continue
+		}
+		block.Statements = append(block.Statements, stmt)
+	}
+	if !p.expect(token.RBRACE) {
+		return nil
+	}
+	return block
+}
+
 func (p *Parser) parseStatement() ast.Statement {
-	if p.currToken.Type == token.IDENT && p.peekToken.Type == token.ASSIGN {
+	switch p.currToken.Type {
+	case token.IDENT:
+		if p.peekToken.Type == token.LPAREN {
+			return p.parseCallStatement()
+		}
 		return p.parseAssignStatement()
+	case token.IF:
+		return p.parseIfStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.PRINT:
+		return p.parsePrintStatement()
 	}
+	p.unexpected("statement")
 	return nil
 }
 
-func (p *Parser) parseAssignStatement() *ast.AssignStatement {
-	stmt := &ast.AssignStatement{Name: &ast.Identifier{Value: p.currToken.Literal}}
-	p.nextToken()
-	p.nextToken()
-	stmt.Value = p.parseExpression()
-	if p.peekToken.Type == token.SEMICOLON {
+func (p *Parser) parseAssignStatement() ast.Statement {
+	stmt := &ast.AssignStatement{Pos: p.currToken.Pos}
+	stmt.Name = p.parseIdentifier()
+	if !p.expect(token.ASSIGN) {
+		return nil
+	}
+	if stmt.Value = p.parseExpression(); stmt.Value == nil || !p.expectSemicolon() {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseCallStatement() ast.Statement {
+	stmt := &ast.CallStatement{Pos: p.currToken.Pos}
+	if stmt.Call = p.parseCall(); stmt.Call == nil || !p.expectSemicolon() {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseCall() *ast.CallExpression {
+	call := &ast.CallExpression{Pos: p.currToken.Pos}
+	call.Function = p.parseIdentifier()
+	p.nextToken() // consume '('
+	for p.currToken.Type != token.RPAREN {
+		if len(call.Arguments) > 0 && !p.expect(token.COMMA) {
+			return nil
+		}
+		arg := p.parseExpression()
+		if arg == nil {
+			return nil
+		}
+		call.Arguments = append(call.Arguments, arg)
+	}
+	p.nextToken() // consume ')'
+	return call
+}
+
+func (p *Parser) parseIfStatement() ast.Statement {
+	stmt := &ast.IfStatement{Pos: p.currToken.Pos}
+	p.nextToken() // consume 'if'
+	if stmt.Condition = p.parseCondition(); stmt.Condition == nil {
+		return nil
+	}
+	if stmt.Consequence = p.parseBlock(); stmt.Consequence == nil {
+		return nil
+	}
+	if p.currToken.Type == token.ELSE {
 		p.nextToken()
+		if stmt.Alternative = p.parseBlock(); stmt.Alternative == nil {
+			return nil
+		}
+	}
+	if !p.expectSemicolon() {
+		return nil
+	}
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Pos: p.currToken.Pos}
+	p.nextToken() // consume 'while'
+	if stmt.Condition = p.parseCondition(); stmt.Condition == nil || !p.expect(token.DO) {
+		return nil
+	}
+	if stmt.Body = p.parseBlock(); stmt.Body == nil || !p.expectSemicolon() {
+		return nil
+	}
+	return stmt
+}
+
+// parseCondition parses the parenthesized expression of an if/while.
+func (p *Parser) parseCondition() ast.Expression {
+	if !p.expect(token.LPAREN) {
+		return nil
+	}
+	cond := p.parseExpression()
+	if cond == nil || !p.expect(token.RPAREN) {
+		return nil
+	}
+	return cond
+}
+
+func (p *Parser) parsePrintStatement() ast.Statement {
+	stmt := &ast.PrintStatement{Pos: p.currToken.Pos}
+	p.nextToken() // consume 'print'
+	if !p.expect(token.LPAREN) {
+		return nil
+	}
+	for {
+		var exp ast.Expression
+		if p.currToken.Type == token.STRING_TYPE {
+			exp = &ast.StringLiteral{Pos: p.currToken.Pos, Value: p.currToken.Literal}
+			p.nextToken()
+		} else if exp = p.parseExpression(); exp == nil {
+			return nil
+		}
+		stmt.Expressions = append(stmt.Expressions, exp)
+		if p.currToken.Type != token.COMMA {
+			break
+		}
 		p.nextToken()
 	}
+	if !p.expect(token.RPAREN) || !p.expectSemicolon() {
+		return nil
+	}
 	return stmt
 }
 
+// ---------- Expressions ----------
+
+// parseExpression parses EXPRESION: at most one relational operator per expression.
 func (p *Parser) parseExpression() ast.Expression {
-	left := p.parsePrimary()
-	for isOp(p.peekToken.Type) {
-		op := p.peekToken.Literal
+	left := p.parseExp()
+	if left == nil {
+		return nil
+	}
+	if isRelOp(p.currToken.Type) {
+		op := p.currToken.Literal
 		p.nextToken()
+		right := p.parseExp()
+		if right == nil {
+			return nil
+		}
+		left = &ast.InfixExpression{Pos: left.Position(), Left: left, Operator: op, Right: right}
+	}
+	return left
+}
+
+// parseExp parses EXP: left-associative chain of + and -.
+func (p *Parser) parseExp() ast.Expression {
+	left := p.parseTerm()
+	for left != nil && (p.currToken.Type == token.PLUS || p.currToken.Type == token.MINUS) {
+		op := p.currToken.Literal
 		p.nextToken()
-		right := p.parsePrimary()
-		left = &ast.InfixExpression{Left: left, Operator: op, Right: right}
+		right := p.parseTerm()
+		if right == nil {
+			return nil
+		}
+		left = &ast.InfixExpression{Pos: left.Position(), Left: left, Operator: op, Right: right}
 	}
 	return left
 }
 
-func (p *Parser) parsePrimary() ast.Expression {
-	switch p.currToken.Type {
-	case token.IDENT:
-		return &ast.Identifier{Value: p.currToken.Literal}
-	case token.INT_TYPE:
-		v, _ := strconv.ParseInt(p.currToken.Literal, 10, 64)
-		return &ast.IntegerLiteral{Value: v}
-	case token.FLOAT_TYPE:
-		f, _ := strconv.ParseFloat(p.currToken.Literal, 64)
-		return &ast.FloatLiteral{Value: f}
+// parseTerm parses TERMINO: left-associative chain of * and /.
+func (p *Parser) parseTerm() ast.Expression {
+	left := p.parseFactor()
+	for left != nil && (p.currToken.Type == token.MULT || p.currToken.Type == token.DIV) {
+		op := p.currToken.Literal
+		p.nextToken()
+		right := p.parseFactor()
+		if right == nil {
+			return nil
+		}
+		left = &ast.InfixExpression{Pos: left.Position(), Left: left, Operator: op, Right: right}
+	}
+	return left
+}
+
+func (p *Parser) parseFactor() ast.Expression {
+	tok := p.currToken
+	switch tok.Type {
 	case token.LPAREN:
 		p.nextToken()
 		exp := p.parseExpression()
-		for p.currToken.Type != token.RPAREN && p.currToken.Type != token.EOF {
-			p.nextToken()
+		if exp == nil || !p.expect(token.RPAREN) {
+			return nil
 		}
 		return exp
-	default:
-		return &ast.Identifier{Value: p.currToken.Literal}
+	case token.PLUS, token.MINUS:
+		p.nextToken()
+		right := p.parseFactor()
+		if right == nil {
+			return nil
+		}
+		return &ast.PrefixExpression{Pos: tok.Pos, Operator: tok.Literal, Right: right}
+	case token.IDENT:
+		return p.parseIdentifier()
+	case token.INT_TYPE:
+		p.nextToken()
+		v, err := strconv.ParseInt(tok.Literal, 10, 64)
+		if err != nil {
+			p.errorf(tok.Pos, "integer constant %s out of range", tok.Literal)
+			return nil
+		}
+		return &ast.IntegerLiteral{Pos: tok.Pos, Value: v}
+	case token.FLOAT_TYPE:
+		p.nextToken()
+		f, err := strconv.ParseFloat(tok.Literal, 64)
+		if err != nil {
+			p.errorf(tok.Pos, "float constant %s out of range", tok.Literal)
+			return nil
+		}
+		return &ast.FloatLiteral{Pos: tok.Pos, Value: f}
 	}
+	p.unexpected("expression")
+	return nil
+}
+
+func (p *Parser) parseIdentifier() *ast.Identifier {
+	if p.currToken.Type != token.IDENT {
+		p.unexpected("identifier")
+		return nil
+	}
+	id := &ast.Identifier{Pos: p.currToken.Pos, Value: p.currToken.Literal}
+	p.nextToken()
+	return id
 }
 
-func isOp(t string) bool {
+func isRelOp(t token.TokenType) bool {
 	switch t {
-	case token.PLUS, token.MINUS, token.MULT, token.DIV:
+	case token.EQ, token.NEQ, token.LT, token.GT, token.LEQ, token.GEQ:
 		return true
 	}
 	return false
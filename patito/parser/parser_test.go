@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/lexer"
+)
+
+func TestParseProgram(t *testing.T) {
+	input := `program demo;
+var x, y : int; z : float;
+void show(a : int, b : float) [
+    var t : float;
+    { t = a * b; print("t", t); }
+];
+main {
+    x = 1;
+    if (x > 0) { show(x, z); } else { y = 2; };
+    while (x < 10) do { x = x + 1; };
+}
+end`
+	prog := parse(t, input)
+
+	if prog.Name.Value != "demo" {
+		t.Fatalf("program name wrong. expected=%q, got=%q", "demo", prog.Name.Value)
+	}
+	if len(prog.Vars) != 2 || len(prog.Vars[0].Names) != 2 || prog.Vars[1].Type != "float" {
+		t.Fatalf("vars section wrong: %s", ast.SExpr(prog))
+	}
+	if len(prog.Funcs) != 1 {
+		t.Fatalf("expected 1 function, got %d", len(prog.Funcs))
+	}
+	fn := prog.Funcs[0]
+	if fn.Name.Value != "show" || len(fn.Params) != 2 || fn.Params[1].Type != "float" || len(fn.Vars) != 1 {
+		t.Fatalf("function wrong: %s", ast.SExpr(fn))
+	}
+	if len(prog.Main.Statements) != 3 {
+		t.Fatalf("expected 3 statements in main, got %d", len(prog.Main.Statements))
+	}
+	ifStmt, ok := prog.Main.Statements[1].(*ast.IfStatement)
+	if !ok || ifStmt.Alternative == nil {
+		t.Fatalf("statement 1 is not an if/else: %s", ast.SExpr(prog.Main.Statements[1]))
+	}
+	if _, ok := ifStmt.Consequence.Statements[0].(*ast.CallStatement); !ok {
+		t.Fatalf("expected call statement inside if, got %T", ifStmt.Consequence.Statements[0])
+	}
+	if _, ok := prog.Main.Statements[2].(*ast.WhileStatement); !ok {
+		t.Fatalf("statement 2 is not a while: %T", prog.Main.Statements[2])
+	}
+	if pos := prog.Main.Statements[2].Position(); pos.Line != 10 || pos.Column != 5 {
+		t.Fatalf("while position wrong. expected=10:5, got=%d:%d", pos.Line, pos.Column)
+	}
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a + b * c", "(a + (b * c))"},
+		{"a * b + c", "((a * b) + c)"},
+		{"a - b - c", "((a - b) - c)"},
+		{"a / b * c", "((a / b) * c)"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"-a * b", "((-a) * b)"},
+		{"a + b > c * 2", "((a + b) > (c * 2))"},
+		{"a <= 1.5", "(a <= 1.5)"},
+	}
+
+	for i, tt := range tests {
+		prog := parse(t, "program p; main { x = "+tt.input+"; } end")
+		assign := prog.Main.Statements[0].(*ast.AssignStatement)
+		if got := infix(assign.Value); got != tt.expected {
+			t.Fatalf("tests[%d] - expected=%q, got=%q", i, tt.expected, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"main { } end", []string{`1:1: expected "program", got "main"`}},
+		{"program p; main { x = ; } end", []string{`1:23: expected expression, got ";"`}},
+		{"program p; main { print(1) y = 2; x = 3 } end", []string{
+			`1:28: expected ";", got "y"`,
+			`1:41: expected ";", got "}"`,
+		}},
+		{"program p; var x : bool; main { } end", []string{`1:20: expected type (int or float), got "bool"`}},
+		{"program p; main { while (x) { }; } end", []string{`1:29: expected "do", got "{"`}},
+		{"program p; main { x = 1 $ 2; } end", []string{`1:25: expected ";", got illegal character "$"`}},
+		{"program p; main { } end end", []string{`1:25: expected end of file, got "end"`}},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if got := p.Errors(); strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Fatalf("tests[%d] - errors wrong.\nexpected=%q\ngot=%q", i, tt.expected, got)
+		}
+		for j, err := range p.SyntaxErrors() {
+			if err.Error() != tt.expected[j] {
+				t.Fatalf("tests[%d] - SyntaxErrors()[%d] = %q, expected %q", i, j, err, tt.expected[j])
+			}
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := New(lexer.New(input))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser has %d errors:\n%s", len(errs), strings.Join(errs, "\n"))
+	}
+	return prog
+}
+
+// infix renders an expression fully parenthesized so precedence is visible.
+func infix(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return "(" + infix(e.Left) + " " + e.Operator + " " + infix(e.Right) + ")"
+	case *ast.PrefixExpression:
+		return "(" + e.Operator + infix(e.Right) + ")"
+	case *ast.Identifier:
+		return e.Value
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(e.Value, 10)
+	case *ast.FloatLiteral:
+		return strconv.FormatFloat(e.Value, 'g', -1, 64)
+	}
+	return "?"
+}
+
+func TestParseFragment(t *testing.T) {
+	input := "var a, b : int; c : float;\nvoid f() [ { } ];\na = 1; f(); print(a); a + b * 2"
+	p := New(lexer.New(input))
+	nodes := p.ParseFragment()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	expected := []string{"*ast.VarDecl", "*ast.VarDecl", "*ast.FuncDecl", "*ast.AssignStatement",
+		"*ast.CallStatement", "*ast.PrintStatement", "*ast.InfixExpression"}
+	if len(nodes) != len(expected) {
+		t.Fatalf("expected %d nodes, got %d", len(expected), len(nodes))
+	}
+	for i, n := range nodes {
+		if got := fmt.Sprintf("%T", n); got != expected[i] {
+			t.Fatalf("nodes[%d] - expected=%s, got=%s", i, expected[i], got)
+		}
+	}
+
+	p = New(lexer.New("x = 1 y = 2"))
+	p.ParseFragment()
+	if errs := p.Errors(); len(errs) != 1 || errs[0] != `1:7: expected ";", got "y"` {
+		t.Fatalf("expected a missing ';' error, got %q", errs)
+	}
+}
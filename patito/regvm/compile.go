@@ -0,0 +1,449 @@
+package regvm
+
+import (
+	"fmt"
+	"math"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/token"
+)
+
+// Program is a compiled program.
+type Program struct {
+	Funcs   []*Func         // declared functions in order, then main
+	Globals []*semantic.Var // by index
+	Prints  [][]PrintArg    // what each print writes, by index
+}
+
+// Main returns the function that runs the body of the program.
+func (p *Program) Main() *Func { return p.Funcs[len(p.Funcs)-1] }
+
+// Func is the code of a function, or of main.
+type Func struct {
+	Name   string
+	Params int             // number of params, the first Locals
+	Locals []*semantic.Var // params and then locals, in the first registers
+	Size   int             // registers of the window, locals and temporaries
+	Consts []evaluator.Value
+	Code   []Inst
+	Pos    []token.Position // of each instruction: the divisor of a division, else its statement
+}
+
+// PrintArg is one part of a print: a string, written as it is, or a value of
+// Type taken from the next register.
+type PrintArg struct {
+	Type semantic.Type
+	Text string // for a String
+}
+
+// Compile translates prog, which passed semantic.Check with dir. It fails only
+// when a function needs more registers, constants or code than the operands
+// of its instructions can address.
+func Compile(prog *ast.Program, dir *semantic.FuncDir) (*Program, error) {
+	c := &compiler{
+		p:       &Program{Globals: dir.Globals.All()},
+		dir:     dir,
+		funcs:   map[string]int{},
+		globals: map[string]int{},
+	}
+	for i, g := range c.p.Globals {
+		c.globals[g.Name] = i
+	}
+	for i, fn := range dir.Funcs() {
+		c.funcs[fn.Name] = i
+	}
+	for _, fn := range dir.Funcs() {
+		c.function(fn, fn.Decl.Body)
+	}
+	c.function(nil, prog.Main)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.p, nil
+}
+
+type compiler struct {
+	p       *Program
+	dir     *semantic.FuncDir
+	funcs   map[string]int
+	globals map[string]int
+	err     error
+
+	sem    *semantic.Func // function being compiled, nil for main
+	fn     *Func
+	locals map[string]int // register of each param and local
+	consts map[constKey]int
+	free   int            // first register no local or live temporary holds
+	pos    token.Position // of the statement being compiled
+}
+
+// constKey tells constants apart by their bits, so that 0.0 and -0.0 are
+// different constants.
+type constKey struct {
+	t    semantic.Type
+	bits uint64
+}
+
+func (c *compiler) function(sem *semantic.Func, body *ast.BlockStatement) {
+	c.sem, c.locals, c.consts = sem, map[string]int{}, map[constKey]int{}
+	c.fn = &Func{Name: "main"}
+	if sem != nil {
+		c.fn.Name, c.fn.Params = sem.Name, len(sem.Params)
+		for _, v := range sem.Params {
+			c.local(v)
+		}
+		for _, v := range sem.Vars.All() {
+			if v.Scope == semantic.Local {
+				c.local(v)
+			}
+		}
+	}
+	c.free = len(c.fn.Locals)
+	c.fn.Size = c.free
+	if c.free > maxA+1 {
+		c.fail("function %s has too many variables", c.fn.Name)
+	}
+	c.block(body)
+	c.pos = body.Position()
+	c.emit(abc(OpReturn, 0, 0, 0))
+	c.p.Funcs = append(c.p.Funcs, c.fn)
+}
+
+func (c *compiler) local(v *semantic.Var) {
+	c.locals[v.Name] = len(c.fn.Locals)
+	c.fn.Locals = append(c.fn.Locals, v)
+}
+
+func (c *compiler) fail(format string, args ...any) {
+	if c.err == nil {
+		c.err = fmt.Errorf("regvm: "+format, args...)
+	}
+}
+
+// emit appends an instruction at the position of the current statement and
+// returns its address.
+func (c *compiler) emit(i Inst) int {
+	c.fn.Code = append(c.fn.Code, i)
+	c.fn.Pos = append(c.fn.Pos, c.pos)
+	return len(c.fn.Code) - 1
+}
+
+// jumpTo returns a jump from pc to target.
+func (c *compiler) jumpTo(pc, target int) Inst {
+	offset := target - (pc + 1)
+	if offset < -maxSBx || offset > maxSBx {
+		c.fail("function %s is too large", c.fn.Name)
+	}
+	return asbx(OpJump, 0, offset)
+}
+
+// patch makes the jump at pc continue at the next instruction emitted.
+func (c *compiler) patch(pc int) {
+	c.fn.Code[pc] = c.jumpTo(pc, len(c.fn.Code))
+}
+
+// reserve returns the next free register for a temporary.
+func (c *compiler) reserve() int {
+	r := c.free
+	c.free++
+	c.fn.Size = max(c.fn.Size, c.free)
+	if c.free > maxA+1 {
+		c.fail("function %s needs more than %d registers", c.fn.Name, maxA+1)
+	}
+	return r
+}
+
+// constant returns the index of v among the constants of the function.
+func (c *compiler) constant(v evaluator.Value) int {
+	var key constKey
+	switch v := v.(type) {
+	case evaluator.Int:
+		key = constKey{semantic.Int, uint64(v)}
+	case evaluator.Float:
+		key = constKey{semantic.Float, math.Float64bits(float64(v))}
+	case evaluator.Bool:
+		key = constKey{t: semantic.Bool}
+		if v {
+			key.bits = 1
+		}
+	}
+	k, ok := c.consts[key]
+	if !ok {
+		k = len(c.fn.Consts)
+		if k > maxBx {
+			c.fail("function %s has too many constants", c.fn.Name)
+		}
+		c.consts[key] = k
+		c.fn.Consts = append(c.fn.Consts, v)
+	}
+	return k
+}
+
+func (c *compiler) lookup(name string) *semantic.Var {
+	if c.sem != nil {
+		if v := c.sem.Vars.Lookup(name); v != nil {
+			return v
+		}
+	}
+	return c.dir.Globals.Lookup(name)
+}
+
+func (c *compiler) typeOf(exp ast.Expression) semantic.Type {
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		return c.lookup(x.Value).Type
+	case *ast.IntegerLiteral:
+		return semantic.Int
+	case *ast.FloatLiteral:
+		return semantic.Float
+	case *ast.BooleanLiteral:
+		return semantic.Bool
+	case *ast.StringLiteral:
+		return semantic.String
+	case *ast.PrefixExpression:
+		return c.typeOf(x.Right)
+	case *ast.InfixExpression:
+		return semantic.ResultType(x.Operator, c.typeOf(x.Left), c.typeOf(x.Right))
+	}
+	return semantic.Invalid
+}
+
+func (c *compiler) block(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		c.statement(stmt)
+	}
+}
+
+func (c *compiler) statement(stmt ast.Statement) {
+	if b, ok := stmt.(*ast.BlockStatement); ok {
+		c.block(b)
+		return
+	}
+	c.pos = stmt.Position()
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		v := c.lookup(s.Name.Value)
+		if r, ok := c.locals[v.Name]; ok {
+			c.exprTo(s.Value, v.Type, r)
+			return
+		}
+		free := c.free
+		r := c.register(s.Value, v.Type)
+		c.emit(abx(OpSetGlobal, r, c.globals[v.Name]))
+		c.free = free
+	case *ast.PrintStatement:
+		base := c.free
+		args := make([]PrintArg, len(s.Expressions))
+		for i, exp := range s.Expressions {
+			if str, ok := exp.(*ast.StringLiteral); ok {
+				args[i] = PrintArg{Type: semantic.String, Text: str.Value}
+				continue
+			}
+			args[i] = PrintArg{Type: c.typeOf(exp)}
+			c.exprTo(exp, args[i].Type, c.reserve())
+		}
+		c.p.Prints = append(c.p.Prints, args)
+		if len(c.p.Prints) > maxBx+1 {
+			c.fail("program has too many prints")
+		}
+		c.emit(abx(OpPrint, base, len(c.p.Prints)-1))
+		c.free = base
+	case *ast.CallStatement:
+		callee := c.dir.Lookup(s.Call.Function.Value)
+		base := c.free
+		for i, arg := range s.Call.Arguments {
+			c.exprTo(arg, callee.Params[i].Type, c.reserve())
+		}
+		c.emit(abx(OpCall, base, c.funcs[callee.Name]))
+		c.free = base
+	case *ast.IfStatement:
+		jumpElse := c.jumpIfFalse(s.Condition)
+		c.block(s.Consequence)
+		if s.Alternative == nil {
+			c.patch(jumpElse)
+			return
+		}
+		c.pos = s.Position()
+		jumpEnd := c.emit(0)
+		c.patch(jumpElse)
+		c.block(s.Alternative)
+		c.patch(jumpEnd)
+	case *ast.WhileStatement:
+		top := len(c.fn.Code)
+		exit := c.jumpIfFalse(s.Condition)
+		c.block(s.Body)
+		c.pos = s.Position()
+		pc := len(c.fn.Code)
+		c.emit(c.jumpTo(pc, top))
+		c.patch(exit)
+	}
+}
+
+// comparisons maps the relational operators to the op that tests them, whether
+// the operands go in swapped and the result that skips the jump after it.
+var comparisons = map[string]struct {
+	int, float Op
+	swap       bool
+	a          int
+}{
+	"<":  {OpLtInt, OpLtFloat, false, 0},
+	">":  {OpLtInt, OpLtFloat, true, 0},
+	"<=": {OpLeInt, OpLeFloat, false, 0},
+	">=": {OpLeInt, OpLeFloat, true, 0},
+	"==": {OpEqInt, OpEqFloat, false, 0},
+	"!=": {OpEqInt, OpEqFloat, false, 1},
+}
+
+// arithmetic maps the arithmetic operators to their int and float ops.
+var arithmetic = map[string][2]Op{
+	"+": {OpAddInt, OpAddFloat},
+	"-": {OpSubInt, OpSubFloat},
+	"*": {OpMulInt, OpMulFloat},
+	"/": {OpDivInt, OpDivFloat},
+}
+
+// operandType is the type both operands of x are converted to.
+func (c *compiler) operandType(x *ast.InfixExpression) semantic.Type {
+	if c.typeOf(x.Left) == semantic.Float || c.typeOf(x.Right) == semantic.Float {
+		return semantic.Float
+	}
+	return semantic.Int
+}
+
+// jumpIfFalse compiles the condition exp followed by a jump, to be patched,
+// that is taken when it is false, and returns the address of the jump.
+func (c *compiler) jumpIfFalse(exp ast.Expression) int {
+	free := c.free
+	if x, ok := exp.(*ast.InfixExpression); ok {
+		if cmp, ok := comparisons[x.Operator]; ok {
+			t := c.operandType(x)
+			b, k := c.operand(x.Left, t), c.operand(x.Right, t)
+			if cmp.swap {
+				b, k = k, b
+			}
+			op := cmp.int
+			if t == semantic.Float {
+				op = cmp.float
+			}
+			c.emit(abc(op, cmp.a, b, k))
+			c.free = free
+			return c.emit(0)
+		}
+	}
+	c.emit(abc(OpTest, c.register(exp, semantic.Bool), 0, 0))
+	c.free = free
+	return c.emit(0)
+}
+
+// operand returns the B or C operand that holds exp as a value of type t: a
+// constant, the register of a local, or a temporary it is computed into.
+func (c *compiler) operand(exp ast.Expression, t semantic.Type) int {
+	var v evaluator.Value
+	switch x := exp.(type) {
+	case *ast.IntegerLiteral:
+		v = evaluator.Int(x.Value)
+		if t == semantic.Float {
+			v = evaluator.Float(x.Value)
+		}
+	case *ast.FloatLiteral:
+		v = evaluator.Float(x.Value)
+	case *ast.BooleanLiteral:
+		v = evaluator.Bool(x.Value)
+	default:
+		return c.register(exp, t)
+	}
+	if k := c.constant(v); k < maxRK {
+		return k | bitRK
+	}
+	return c.register(exp, t)
+}
+
+// register returns a register that holds exp as a value of type t: the
+// register of a local, or a temporary it is computed into.
+func (c *compiler) register(exp ast.Expression, t semantic.Type) int {
+	if id, ok := exp.(*ast.Identifier); ok {
+		if r, ok := c.locals[id.Value]; ok && c.typeOf(id) == t {
+			return r
+		}
+	}
+	r := c.reserve()
+	c.exprTo(exp, t, r)
+	return r
+}
+
+// exprTo compiles exp into register dst as a value of type t, promoting an
+// int to float. It writes dst only once it has read everything else, so exp
+// may read the local that dst holds.
+func (c *compiler) exprTo(exp ast.Expression, t semantic.Type, dst int) {
+	convert := t == semantic.Float && c.typeOf(exp) == semantic.Int
+	switch x := exp.(type) {
+	case *ast.Identifier:
+		r, ok := c.locals[x.Value]
+		switch {
+		case !ok:
+			c.emit(abx(OpGetGlobal, dst, c.globals[x.Value]))
+		case convert:
+			c.emit(abc(OpIntToFloat, dst, r, 0))
+			return
+		case r != dst:
+			c.emit(abc(OpMove, dst, r, 0))
+		}
+	case *ast.IntegerLiteral:
+		v := evaluator.Value(evaluator.Int(x.Value))
+		if convert {
+			v = evaluator.Float(x.Value)
+		}
+		c.emit(abx(OpLoadK, dst, c.constant(v)))
+		return
+	case *ast.FloatLiteral:
+		c.emit(abx(OpLoadK, dst, c.constant(evaluator.Float(x.Value))))
+	case *ast.BooleanLiteral:
+		b := 0
+		if x.Value {
+			b = 1
+		}
+		c.emit(abc(OpLoadBool, dst, b, 0))
+	case *ast.PrefixExpression:
+		if x.Operator == "+" {
+			c.exprTo(x.Right, t, dst)
+			return
+		}
+		rt := c.typeOf(x.Right)
+		free := c.free
+		r := c.register(x.Right, rt)
+		c.free = free
+		if rt == semantic.Float {
+			c.emit(abc(OpNegFloat, dst, r, 0))
+		} else {
+			c.emit(abc(OpNegInt, dst, r, 0))
+		}
+	case *ast.InfixExpression:
+		ops, ok := arithmetic[x.Operator]
+		if !ok {
+			jump := c.jumpIfFalse(x)
+			c.emit(abc(OpLoadBool, dst, 1, 1))
+			c.patch(jump)
+			c.emit(abc(OpLoadBool, dst, 0, 0))
+			break
+		}
+		ot := c.operandType(x)
+		free := c.free
+		b, k := c.operand(x.Left, ot), c.operand(x.Right, ot)
+		c.free = free
+		op := ops[0]
+		if ot == semantic.Float {
+			op = ops[1]
+		}
+		pc := c.emit(abc(op, dst, b, k))
+		if op == OpDivInt || op == OpDivFloat {
+			c.fn.Pos[pc] = x.Right.Position()
+		}
+	default:
+		panic(fmt.Sprintf("regvm: unexpected expression %T", exp))
+	}
+	if convert {
+		c.emit(abc(OpIntToFloat, dst, dst, 0))
+	}
+}
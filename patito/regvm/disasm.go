@@ -0,0 +1,107 @@
+package regvm
+
+import (
+	"fmt"
+	"strings"
+
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/ssa"
+)
+
+// Disassemble lists the code of fn, one instruction per line with its
+// address, the line of the source it comes from, its operands and what they
+// stand for. A constant operand is written K and its index.
+func (p *Program) Disassemble(fn *Func) string {
+	var sb strings.Builder
+	params := make([]string, fn.Params)
+	for i, v := range fn.Locals[:fn.Params] {
+		params[i] = v.Name + " " + v.Type.String()
+	}
+	fmt.Fprintf(&sb, "func %s(%s): locals=%d registers=%d constants=%d\n",
+		fn.Name, strings.Join(params, ", "), len(fn.Locals), fn.Size, len(fn.Consts))
+	for pc, i := range fn.Code {
+		op := i.Op()
+		var operands string
+		switch op.mode() {
+		case modeABx:
+			operands = fmt.Sprintf("%d %d", i.A(), i.Bx())
+		case modeAsBx:
+			operands = fmt.Sprintf("%d %d", i.A(), i.SBx())
+		default:
+			operands = fmt.Sprintf("%d %s %s", i.A(), rkString(i.B()), rkString(i.C()))
+		}
+		line := fmt.Sprintf("%4d  %-6s %-9s %-11s", pc, fmt.Sprintf("[%d]", fn.Pos[pc].Line), op, operands)
+		if note := p.note(fn, pc, i); note != "" {
+			line += " ; " + note
+		}
+		sb.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return sb.String()
+}
+
+func rkString(x int) string {
+	if isK(x) {
+		return fmt.Sprintf("K%d", x&^bitRK)
+	}
+	return fmt.Sprint(x)
+}
+
+// note describes the operands of the instruction i at pc in fn.
+func (p *Program) note(fn *Func, pc int, i Inst) string {
+	switch op := i.Op(); op {
+	case OpLoadK:
+		return constString(fn.Consts[i.Bx()])
+	case OpGetGlobal, OpSetGlobal:
+		return p.Globals[i.Bx()].Name
+	case OpJump:
+		return fmt.Sprintf("to %d", pc+1+i.SBx())
+	case OpCall:
+		return p.Funcs[i.Bx()].Name
+	case OpPrint:
+		parts := make([]string, len(p.Prints[i.Bx()]))
+		for j, arg := range p.Prints[i.Bx()] {
+			if arg.Type == semantic.String {
+				parts[j] = ssa.FormatConst(arg.Text)
+			} else {
+				parts[j] = arg.Type.String()
+			}
+		}
+		return strings.Join(parts, ", ")
+	default:
+		if op.mode() != modeABC {
+			return ""
+		}
+		var parts []string
+		for _, x := range []int{i.B(), i.C()} {
+			if isK(x) {
+				parts = append(parts, constString(fn.Consts[x&^bitRK]))
+			}
+		}
+		if op == OpDivInt || op == OpDivFloat {
+			parts = append(parts, fmt.Sprintf("at %d:%d", fn.Pos[pc].Line, fn.Pos[pc].Column))
+		}
+		return strings.Join(parts, " ")
+	}
+}
+
+func constString(v evaluator.Value) string {
+	switch v := v.(type) {
+	case evaluator.Int:
+		return ssa.FormatConst(int64(v))
+	case evaluator.Float:
+		return ssa.FormatConst(float64(v))
+	case evaluator.Bool:
+		return ssa.FormatConst(bool(v))
+	}
+	return ""
+}
+
+// String disassembles every function of p, separated by blank lines.
+func (p *Program) String() string {
+	parts := make([]string, len(p.Funcs))
+	for i, fn := range p.Funcs {
+		parts[i] = p.Disassemble(fn)
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,23 @@
+package regvm
+
+import (
+	"patito/evaluator"
+	"patito/semantic"
+	"patito/token"
+)
+
+// fail returns an *evaluator.RuntimeError for msg at pos, raised by the
+// function numbered f, with the stack of calls that led there.
+func (vm *VM) fail(msg string, pos token.Position, f int) *evaluator.RuntimeError {
+	e := &evaluator.RuntimeError{Pos: pos, Msg: msg}
+	e.Stack, e.Elided = evaluator.WordStack(len(vm.frames)+1, vm.args, func(i int) (string, []*semantic.Var, token.Position) {
+		fn := vm.p.Funcs[f]
+		if i > 0 {
+			fr := vm.frames[len(vm.frames)-i]
+			fn = vm.p.Funcs[fr.fn]
+			pos = fn.Pos[fr.pc-1]
+		}
+		return fn.Name, fn.Locals[:fn.Params], pos
+	})
+	return e
+}
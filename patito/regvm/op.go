@@ -0,0 +1,137 @@
+// Package regvm compiles checked Patito programs to the code of a register
+// machine in the style of Lua 5 and runs it.
+//
+// Each call gets a window of registers on a shared register file: its params
+// first, then its locals and then the temporaries of its expressions. An
+// instruction names its operands by register, so a = b + c is a single ADD
+// with no pushes or pops, and a call passes its arguments by placing them at
+// the top of the caller's window, where the window of the callee starts.
+//
+// Instructions are 32-bit words laid out as in Lua 5.1:
+//
+//	 31      23      14     6     0
+//	|   B    |   C    |  A   | op |
+//	|       Bx        |  A   | op |
+//
+// A B or C with the RK bit set names a constant of the function instead of a
+// register. sBx is Bx less maxSBx, for jumps in both directions.
+package regvm
+
+import "fmt"
+
+// Op is an opcode.
+type Op uint8
+
+const (
+	OpMove      Op = iota // R[A] = R[B]
+	OpLoadK               // R[A] = K[Bx]
+	OpLoadBool            // R[A] = B; if C, skip the next instruction
+	OpGetGlobal           // R[A] = G[Bx]
+	OpSetGlobal           // G[Bx] = R[A]
+
+	OpAddInt // R[A] = RK(B) + RK(C)
+	OpSubInt
+	OpMulInt
+	OpDivInt // fails at Pos[pc] when RK(C) is zero
+	OpNegInt // R[A] = -R[B]
+
+	OpAddFloat
+	OpSubFloat
+	OpMulFloat
+	OpDivFloat
+	OpNegFloat
+	OpIntToFloat // R[A] = float(R[B])
+
+	OpEqInt // if (RK(B) == RK(C)) != A, skip the next instruction
+	OpLtInt
+	OpLeInt
+	OpEqFloat
+	OpLtFloat
+	OpLeFloat
+	OpTest // if (R[A] != 0) != C, skip the next instruction
+
+	OpJump   // pc += sBx
+	OpCall   // call Funcs[Bx] with a window starting at R[A], its args
+	OpReturn // return to the caller, or end the program from main
+	OpPrint  // print Prints[Bx], taking its values from R[A] on
+
+	numOps
+)
+
+var opNames = [numOps]string{
+	OpMove: "MOVE", OpLoadK: "LOADK", OpLoadBool: "LOADBOOL", OpGetGlobal: "GETGLOBAL", OpSetGlobal: "SETGLOBAL",
+	OpAddInt: "ADDI", OpSubInt: "SUBI", OpMulInt: "MULI", OpDivInt: "DIVI", OpNegInt: "NEGI",
+	OpAddFloat: "ADDF", OpSubFloat: "SUBF", OpMulFloat: "MULF", OpDivFloat: "DIVF", OpNegFloat: "NEGF", OpIntToFloat: "ITOF",
+	OpEqInt: "EQI", OpLtInt: "LTI", OpLeInt: "LEI", OpEqFloat: "EQF", OpLtFloat: "LTF", OpLeFloat: "LEF", OpTest: "TEST",
+	OpJump: "JMP", OpCall: "CALL", OpReturn: "RETURN", OpPrint: "PRINT",
+}
+
+func (op Op) String() string {
+	if op < numOps {
+		return opNames[op]
+	}
+	return fmt.Sprintf("Op(%d)", uint8(op))
+}
+
+// mode tells how the operands of an op are encoded.
+type mode int
+
+const (
+	modeABC mode = iota
+	modeABx
+	modeAsBx
+)
+
+func (op Op) mode() mode {
+	switch op {
+	case OpLoadK, OpGetGlobal, OpSetGlobal, OpCall, OpPrint:
+		return modeABx
+	case OpJump:
+		return modeAsBx
+	}
+	return modeABC
+}
+
+// Inst is an encoded instruction.
+type Inst uint32
+
+const (
+	sizeOp = 6
+	sizeA  = 8
+	sizeC  = 9
+	sizeB  = 9
+	sizeBx = sizeB + sizeC
+
+	posA = sizeOp
+	posC = posA + sizeA
+	posB = posC + sizeC
+
+	maxA   = 1<<sizeA - 1
+	maxBx  = 1<<sizeBx - 1
+	maxSBx = maxBx >> 1
+
+	// bitRK marks a B or C that names a constant; the constants a B or C can
+	// name are the first maxRK of the function.
+	bitRK = 1 << (sizeB - 1)
+	maxRK = bitRK
+)
+
+func abc(op Op, a, b, c int) Inst {
+	return Inst(op) | Inst(a)<<posA | Inst(b)<<posB | Inst(c)<<posC
+}
+
+func abx(op Op, a, bx int) Inst {
+	return Inst(op) | Inst(a)<<posA | Inst(bx)<<posC
+}
+
+func asbx(op Op, a, sbx int) Inst { return abx(op, a, sbx+maxSBx) }
+
+func (i Inst) Op() Op   { return Op(i & (1<<sizeOp - 1)) }
+func (i Inst) A() int   { return int(i>>posA) & maxA }
+func (i Inst) B() int   { return int(i >> posB) }
+func (i Inst) C() int   { return int(i>>posC) & (1<<sizeC - 1) }
+func (i Inst) Bx() int  { return int(i >> posC) }
+func (i Inst) SBx() int { return int(i>>posC) - maxSBx }
+
+// isK reports whether the B or C operand x names a constant.
+func isK(x int) bool { return x&bitRK != 0 }
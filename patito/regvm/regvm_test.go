@@ -0,0 +1,62 @@
+package regvm
+
+import (
+	"testing"
+
+	"patito/internal/vmtest"
+)
+
+func compile(t testing.TB, src string) *Program {
+	t.Helper()
+	prog, dir := vmtest.Check(t, src)
+	p, err := Compile(prog, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDisassemble(t *testing.T) {
+	p := compile(t, `program p;
+var r : int;
+void half(k : int) [
+    var h : float;
+    {
+        h = k / 2.0;
+        while (h > 1) do { h = h - 1; r = r + k / 2; };
+    }
+];
+main {
+    half(7);
+    print("r is", r, r < 10);
+}
+end`)
+	want := `func half(k int): locals=2 registers=5 constants=3
+   0  [6]    ITOF      2 0 0
+   1  [6]    DIVF      1 2 K0      ; 2.0 at 6:17
+   2  [7]    LTF       0 K1 1      ; 1.0
+   3  [7]    JMP       0 6         ; to 10
+   4  [7]    SUBF      1 1 K1      ; 1.0
+   5  [7]    GETGLOBAL 3 0         ; r
+   6  [7]    DIVI      4 0 K2      ; 2 at 7:51
+   7  [7]    ADDI      2 3 4
+   8  [7]    SETGLOBAL 2 0         ; r
+   9  [7]    JMP       0 -8        ; to 2
+  10  [5]    RETURN    0 0 0
+
+func main(): locals=0 registers=3 constants=2
+   0  [11]   LOADK     0 0         ; 7
+   1  [11]   CALL      0 0         ; half
+   2  [12]   GETGLOBAL 0 0         ; r
+   3  [12]   GETGLOBAL 2 0         ; r
+   4  [12]   LTI       0 2 K1      ; 10
+   5  [12]   JMP       0 1         ; to 7
+   6  [12]   LOADBOOL  1 1 1
+   7  [12]   LOADBOOL  1 0 0
+   8  [12]   PRINT     0 0         ; "r is", int, bool
+   9  [10]   RETURN    0 0 0
+`
+	if got := p.String(); got != want {
+		t.Errorf("disassembly wrong.\nexpected:\n%s\ngot:\n%s", want, got)
+	}
+}
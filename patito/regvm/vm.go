@@ -0,0 +1,228 @@
+package regvm
+
+import (
+	"io"
+	"math"
+	"strconv"
+
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// VM runs a compiled program. The windows of the active calls overlap on one
+// register file: a callee's window starts at the register where its caller
+// put the first argument.
+type VM struct {
+	p      *Program
+	out    io.Writer
+	consts [][]uint64 // Consts of each function as raw words
+	line   []byte     // the line print is writing
+
+	globals []uint64
+	regs    []uint64
+	frames  []frame  // callers of the running function
+	args    []uint64 // the args of every active call, outermost first, for traces
+}
+
+// frame is what a call saves to return to its caller.
+type frame struct {
+	fn   int // index in Funcs
+	pc   int // of the instruction after the call
+	base int // first register of the window
+}
+
+// New returns a VM that runs p and prints to out.
+func New(p *Program, out io.Writer) *VM {
+	vm := &VM{p: p, out: out, consts: make([][]uint64, len(p.Funcs))}
+	for i, fn := range p.Funcs {
+		vm.consts[i] = make([]uint64, len(fn.Consts))
+		for j, c := range fn.Consts {
+			vm.consts[i][j] = word(c)
+		}
+	}
+	return vm
+}
+
+// word returns the raw register word of a constant: an int as it is, a float
+// as its IEEE 754 bits and a bool as 0 or 1.
+func word(v evaluator.Value) uint64 {
+	switch v := v.(type) {
+	case evaluator.Int:
+		return uint64(v)
+	case evaluator.Float:
+		return math.Float64bits(float64(v))
+	case evaluator.Bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+// rk returns the value of the B or C operand x.
+func rk(r, k []uint64, x int) uint64 {
+	if x&bitRK != 0 {
+		return k[x&^bitRK]
+	}
+	return r[x]
+}
+
+func f64(w uint64) float64 { return math.Float64frombits(w) }
+func w64(f float64) uint64 { return math.Float64bits(f) }
+
+// Run runs the program from the start, with every global at zero. A division
+// by zero, or a call beyond evaluator.MaxCalls, stops it with an
+// *evaluator.RuntimeError that holds the stack of calls.
+func (vm *VM) Run() error {
+	p := vm.p
+	f := len(p.Funcs) - 1
+	fn := p.Funcs[f]
+	vm.globals = make([]uint64, len(p.Globals))
+	vm.regs = make([]uint64, max(1024, fn.Size))
+	vm.frames, vm.args = vm.frames[:0], vm.args[:0]
+	g, regs := vm.globals, vm.regs
+	code, k, r := fn.Code, vm.consts[f], regs
+	pc, base := 0, 0
+
+	for {
+		i := code[pc]
+		pc++
+		a := i.A()
+		switch i.Op() {
+		case OpMove:
+			r[a] = r[i.B()]
+		case OpLoadK:
+			r[a] = k[i.Bx()]
+		case OpLoadBool:
+			r[a] = uint64(i.B())
+			if i.C() != 0 {
+				pc++
+			}
+		case OpGetGlobal:
+			r[a] = g[i.Bx()]
+		case OpSetGlobal:
+			g[i.Bx()] = r[a]
+
+		case OpAddInt:
+			r[a] = uint64(int64(rk(r, k, i.B())) + int64(rk(r, k, i.C())))
+		case OpSubInt:
+			r[a] = uint64(int64(rk(r, k, i.B())) - int64(rk(r, k, i.C())))
+		case OpMulInt:
+			r[a] = uint64(int64(rk(r, k, i.B())) * int64(rk(r, k, i.C())))
+		case OpDivInt:
+			d := int64(rk(r, k, i.C()))
+			if d == 0 {
+				return vm.fail("integer division by zero", fn.Pos[pc-1], f)
+			}
+			r[a] = uint64(int64(rk(r, k, i.B())) / d)
+		case OpNegInt:
+			r[a] = uint64(-int64(r[i.B()]))
+
+		case OpAddFloat:
+			r[a] = w64(f64(rk(r, k, i.B())) + f64(rk(r, k, i.C())))
+		case OpSubFloat:
+			r[a] = w64(f64(rk(r, k, i.B())) - f64(rk(r, k, i.C())))
+		case OpMulFloat:
+			r[a] = w64(f64(rk(r, k, i.B())) * f64(rk(r, k, i.C())))
+		case OpDivFloat:
+			d := f64(rk(r, k, i.C()))
+			if d == 0 {
+				return vm.fail("float division by zero", fn.Pos[pc-1], f)
+			}
+			r[a] = w64(f64(rk(r, k, i.B())) / d)
+		case OpNegFloat:
+			r[a] = w64(-f64(r[i.B()]))
+		case OpIntToFloat:
+			r[a] = w64(float64(int64(r[i.B()])))
+
+		case OpEqInt:
+			if (rk(r, k, i.B()) == rk(r, k, i.C())) != (a != 0) {
+				pc++
+			}
+		case OpLtInt:
+			if (int64(rk(r, k, i.B())) < int64(rk(r, k, i.C()))) != (a != 0) {
+				pc++
+			}
+		case OpLeInt:
+			if (int64(rk(r, k, i.B())) <= int64(rk(r, k, i.C()))) != (a != 0) {
+				pc++
+			}
+		case OpEqFloat:
+			if (f64(rk(r, k, i.B())) == f64(rk(r, k, i.C()))) != (a != 0) {
+				pc++
+			}
+		case OpLtFloat:
+			if (f64(rk(r, k, i.B())) < f64(rk(r, k, i.C()))) != (a != 0) {
+				pc++
+			}
+		case OpLeFloat:
+			if (f64(rk(r, k, i.B())) <= f64(rk(r, k, i.C()))) != (a != 0) {
+				pc++
+			}
+		case OpTest:
+			if (r[a] != 0) != (i.C() != 0) {
+				pc++
+			}
+
+		case OpJump:
+			pc += i.SBx()
+		case OpCall:
+			callee := i.Bx()
+			cf := p.Funcs[callee]
+			nb := base + a
+			if len(vm.frames) == evaluator.MaxCalls {
+				return vm.fail(evaluator.StackOverflow, fn.Pos[pc-1], f)
+			}
+			if need := nb + cf.Size; need > len(regs) {
+				regs = append(regs, make([]uint64, need)...)
+				vm.regs = regs
+			}
+			clear(regs[nb+cf.Params : nb+len(cf.Locals)])
+			vm.args = append(vm.args, regs[nb:nb+cf.Params]...)
+			vm.frames = append(vm.frames, frame{fn: f, pc: pc, base: base})
+			f, fn, pc, base = callee, cf, 0, nb
+			code, k, r = fn.Code, vm.consts[f], regs[base:]
+		case OpReturn:
+			if len(vm.frames) == 0 {
+				return nil
+			}
+			caller := vm.frames[len(vm.frames)-1]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.args = vm.args[:len(vm.args)-fn.Params]
+			f, fn, pc, base = caller.fn, p.Funcs[caller.fn], caller.pc, caller.base
+			code, k, r = fn.Code, vm.consts[f], regs[base:]
+		case OpPrint:
+			if err := vm.print(p.Prints[i.Bx()], r[a:]); err != nil {
+				return err
+			}
+		default:
+			panic("regvm: bad opcode " + i.Op().String())
+		}
+	}
+}
+
+// print writes args, taking their values from values, separated by spaces.
+func (vm *VM) print(args []PrintArg, values []uint64) error {
+	line := vm.line[:0]
+	for i, arg := range args {
+		if i > 0 {
+			line = append(line, ' ')
+		}
+		switch arg.Type {
+		case semantic.String:
+			line = append(line, arg.Text...)
+			continue
+		case semantic.Int:
+			line = strconv.AppendInt(line, int64(values[0]), 10)
+		case semantic.Float:
+			line = strconv.AppendFloat(line, f64(values[0]), 'g', 6, 64)
+		case semantic.Bool:
+			line = strconv.AppendBool(line, values[0] != 0)
+		}
+		values = values[1:]
+	}
+	line = append(line, '\n')
+	vm.line = line
+	_, err := vm.out.Write(line)
+	return err
+}
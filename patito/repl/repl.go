@@ -0,0 +1,293 @@
+// Package repl implements the interactive Read-Eval-Print Loop for Patito.
+//
+// Each entry may declare vars and functions, run statements or evaluate bare
+// expressions; declarations stay visible in later entries. An entry keeps
+// reading lines until its braces, brackets and parentheses are balanced.
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+	"patito/ssa"
+	"patito/token"
+)
+
+const (
+	PROMPT          = ">> "
+	CONTINUE_PROMPT = ".. "
+)
+
+const help = `Enter var sections, functions, statements or expressions, e.g.
+  var x : int;
+  void twice(n : int) [ { print(n * 2); } ];
+  x = 21; twice(x);
+  x / 2.0
+Meta-commands (they apply to the last entry):
+  :tokens   show the tokens produced by the lexer
+  :ast      show the syntax tree produced by the parser
+  :quads    show the quadruples it compiles to, with those of the functions it declares
+  :help     show this message
+  :quit     leave the REPL
+`
+
+// errAborted is returned by a LineReader when the user cancels the current entry.
+var errAborted = errors.New("entry aborted")
+
+// LineReader returns the next line of input (without its newline), or io.EOF.
+type LineReader interface {
+	Prompt(prompt string) (string, error)
+}
+
+// Start runs the REPL over plain streams, echoing prompts to out.
+func Start(in io.Reader, out io.Writer) {
+	Run(&plainReader{scanner: bufio.NewScanner(in), out: out}, out)
+}
+
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) Prompt(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// Run reads entries from r until EOF or :quit and evaluates them in one session.
+func Run(r LineReader, out io.Writer) {
+	s := NewSession(out)
+	var lines []string
+	for {
+		prompt := PROMPT
+		if len(lines) > 0 {
+			prompt = CONTINUE_PROMPT
+		}
+		line, err := r.Prompt(prompt)
+		if err == errAborted {
+			lines = nil
+			continue
+		}
+		if err != nil {
+			fmt.Fprintln(out)
+			return
+		}
+		if len(lines) == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+		src := strings.Join(lines, "\n")
+		if depth(src) > 0 {
+			continue
+		}
+		lines = nil
+		if !s.Handle(src) {
+			return
+		}
+	}
+}
+
+// depth counts how many (, [ and { are still open in src.
+func depth(src string) int {
+	open := 0
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			open++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			open--
+		}
+	}
+	return open
+}
+
+// Session is the state shared by all the entries of one REPL run.
+type Session struct {
+	out     io.Writer
+	checker *semantic.Checker
+	eval    *evaluator.Evaluator
+	last    string          // source of the last entry that was not a meta-command
+	vars    []*ast.VarDecl  // declared so far, for :quads
+	funcs   []*ast.FuncDecl // declared so far, for :quads
+}
+
+func NewSession(out io.Writer) *Session {
+	return &Session{out: out, checker: semantic.NewChecker(), eval: evaluator.New(out)}
+}
+
+// Handle processes one complete entry. It returns false when the user asked to quit.
+func (s *Session) Handle(src string) bool {
+	trimmed := strings.TrimSpace(src)
+	if strings.HasPrefix(trimmed, ":") {
+		return s.meta(trimmed)
+	}
+	s.last = src
+
+	p := parser.New(lexer.New(src))
+	nodes := p.ParseFragment()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintf(s.out, "syntax error: %s\n", e)
+		}
+		return true
+	}
+	for _, n := range nodes {
+		if !s.run(n) {
+			break
+		}
+	}
+	return true
+}
+
+// run checks and executes one item of an entry; it returns false on error so the
+// rest of the entry is skipped.
+func (s *Session) run(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.VarDecl:
+		if !s.report(s.checker.DeclareVars([]*ast.VarDecl{n})) {
+			return false
+		}
+		s.eval.DeclareVars([]*ast.VarDecl{n})
+		s.vars = append(s.vars, n)
+	case *ast.FuncDecl:
+		if !s.report(s.checker.DeclareFunc(n)) {
+			return false
+		}
+		s.eval.DeclareFunc(n)
+		s.funcs = append(s.funcs, n)
+	case ast.Statement:
+		if !s.report(s.checker.CheckStatement(n)) {
+			return false
+		}
+		if err := s.eval.Exec(n); err != nil {
+			fmt.Fprintln(s.out, err)
+			return false
+		}
+	case ast.Expression:
+		t, errs := s.checker.CheckExpression(n)
+		if !s.report(errs) {
+			return false
+		}
+		if str, ok := n.(*ast.StringLiteral); ok {
+			fmt.Fprintf(s.out, "%q : %s\n", str.Value, t)
+			return true
+		}
+		v, err := s.eval.Eval(n)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			return false
+		}
+		fmt.Fprintf(s.out, "%s : %s\n", v, t)
+	}
+	return true
+}
+
+func (s *Session) report(errs []*semantic.Error) bool {
+	for _, e := range errs {
+		fmt.Fprintf(s.out, "error: %s\n", e)
+	}
+	return len(errs) == 0
+}
+
+func (s *Session) meta(cmd string) bool {
+	switch cmd {
+	case ":quit", ":q":
+		return false
+	case ":help":
+		fmt.Fprint(s.out, help)
+		return true
+	case ":tokens", ":ast", ":quads":
+	default:
+		fmt.Fprintf(s.out, "unknown command %s (try :help)\n", cmd)
+		return true
+	}
+	if s.last == "" {
+		fmt.Fprintln(s.out, "no previous input")
+		return true
+	}
+
+	if cmd == ":tokens" {
+		l := lexer.New(s.last)
+		for tok := l.NextToken(); ; tok = l.NextToken() {
+			fmt.Fprintf(s.out, "%d:%d\t%s\t%q\n", tok.Pos.Line, tok.Pos.Column, tok.Type, tok.Literal)
+			if tok.Type == token.EOF {
+				break
+			}
+		}
+		return true
+	}
+
+	p := parser.New(lexer.New(s.last))
+	nodes := p.ParseFragment()
+	if cmd == ":quads" {
+		if len(p.Errors()) == 0 {
+			s.quads(nodes)
+		}
+		for _, e := range p.Errors() {
+			fmt.Fprintf(s.out, "syntax error: %s\n", e)
+		}
+		return true
+	}
+	for _, n := range nodes {
+		fmt.Fprintln(s.out, ast.SExpr(n))
+	}
+	for _, e := range p.Errors() {
+		fmt.Fprintf(s.out, "syntax error: %s\n", e)
+	}
+	return true
+}
+
+// quads prints the quadruples of the functions that the entry nodes declare
+// and then of its statements, with bare expressions printed. They are
+// compiled as a program that has every declaration of the session so far and
+// the entry as its main.
+func (s *Session) quads(nodes []ast.Node) {
+	main := &ast.BlockStatement{}
+	var declared []string
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			declared = append(declared, n.Name.Value)
+		case ast.Statement:
+			main.Statements = append(main.Statements, n)
+		case ast.Expression:
+			main.Statements = append(main.Statements, &ast.PrintStatement{Pos: n.Position(), Expressions: []ast.Expression{n}})
+		}
+	}
+	prog := &ast.Program{Name: &ast.Identifier{Value: "repl"}, Vars: s.vars, Funcs: s.funcs, Main: main}
+	dir, errs := semantic.Check(prog)
+	if !s.report(errs) {
+		return
+	}
+	p := ssa.Build(prog, dir)
+	for _, name := range declared {
+		if fn := p.Func(name); fn != nil {
+			s.listQuads(p, fn)
+		}
+	}
+	if len(main.Statements) > 0 {
+		s.listQuads(p, p.Func("main"))
+	}
+}
+
+func (s *Session) listQuads(p *ssa.Program, fn *ssa.Func) {
+	fmt.Fprintf(s.out, "%s:\n", fn.Name)
+	for n, q := range ssa.Lower(p, fn) {
+		fmt.Fprintf(s.out, "%4d  %s\n", n, q)
+	}
+}
@@ -0,0 +1,109 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var x, y : int;", ""},
+		{"x = 21; y = x * 2", ""},
+		{"y", "42 : int\n"},
+		{"y / 4.0", "10.5 : float\n"},
+		{"x < y", "true : bool\n"},
+		{"void show(n : int) [ { print(\"n is\", n); } ];", ""},
+		{"show(x + 1);", "n is 22\n"},
+		{"x = 1.5;", "error: 1:5: cannot assign float to int variable x\n"},
+		{"z", "error: 1:1: undeclared variable z\n"},
+		{"x = ;", "syntax error: 1:5: expected expression, got \";\"\n"},
+		{"y / (x - x)", "1:6: runtime error: integer division by zero\n"},
+		{"var x : float;", "error: 1:5: x redeclared in this scope\n"},
+		{"x", "21 : int\n"},
+		{":nope", "unknown command :nope (try :help)\n"},
+	}
+
+	var out bytes.Buffer
+	s := NewSession(&out)
+	for i, tt := range tests {
+		out.Reset()
+		if !s.Handle(tt.input) {
+			t.Fatalf("tests[%d] - session ended early", i)
+		}
+		if out.String() != tt.expected {
+			t.Fatalf("tests[%d] - output wrong for %q.\nexpected=%q\ngot=%q", i, tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestMetaCommands(t *testing.T) {
+	var out bytes.Buffer
+	s := NewSession(&out)
+
+	s.Handle(":tokens")
+	if out.String() != "no previous input\n" {
+		t.Fatalf("expected no previous input, got %q", out.String())
+	}
+
+	s.Handle("var a : int;\na = 1")
+	out.Reset()
+	s.Handle(":tokens")
+	expected := "1:1\tvar\t\"var\"\n1:5\tIDENT\t\"a\"\n1:7\t:\t\":\"\n1:9\tint\t\"int\"\n1:12\t;\t\";\"\n" +
+		"2:1\tIDENT\t\"a\"\n2:3\t=\t\"=\"\n2:5\tINT\t\"1\"\n2:6\tEOF\t\"\"\n"
+	if out.String() != expected {
+		t.Fatalf(":tokens wrong.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	out.Reset()
+	s.Handle(":ast")
+	expected = "(VarDecl 1:5 int (Identifier 1:5 a))\n(AssignStatement 2:1 (Identifier 2:1 a) (IntegerLiteral 2:5 1))\n"
+	if out.String() != expected {
+		t.Fatalf(":ast wrong.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+
+	if s.Handle(":quit") {
+		t.Fatalf(":quit did not end the session")
+	}
+}
+
+func TestQuads(t *testing.T) {
+	var out bytes.Buffer
+	s := NewSession(&out)
+	s.Handle("var a : int;")
+	s.Handle("void twice(n : int) [ { a = n * 2; } ];\ntwice(3); a / 2.0")
+	out.Reset()
+	s.Handle(":quads")
+	expected := `twice:
+   0  =       n          _          _i0
+   1  *       _i0        2          _i0
+   2  =       _i0        _          a
+   3  endfunc _          _          _
+main:
+   0  param   3          _          n
+   1  gosub   twice      _          _
+   2  =       a          _          _i0
+   3  itof    _i0        _          _f0
+   4  /       _f0        2.0        _f0
+   5  print   _f0        _          _
+   6  println _          _          _
+   7  end     _          _          _
+`
+	if out.String() != expected {
+		t.Fatalf(":quads wrong.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestStartMultiLine(t *testing.T) {
+	input := "var i : int;\nwhile (i < 3) do {\n  print(i);\n  i = i + 1;\n};\ni\n"
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> >> .. .. .. 0\n1\n2\n>> 3 : int\n>> \n"
+	if out.String() != expected {
+		t.Fatalf("transcript wrong.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
@@ -0,0 +1,53 @@
+package repl
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/peterh/liner"
+)
+
+// StartTerminal runs the REPL on the process terminal with line editing. History
+// is loaded from and saved to historyPath (skipped when it is empty).
+func StartTerminal(out io.Writer, historyPath string) error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+
+	if historyPath != "" {
+		if f, err := os.Open(historyPath); err == nil {
+			line.ReadHistory(f)
+			f.Close()
+		}
+	}
+
+	Run(&terminalReader{line}, out)
+
+	if historyPath == "" {
+		return nil
+	}
+	f, err := os.Create(historyPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = line.WriteHistory(f)
+	return err
+}
+
+// terminalReader adapts liner to LineReader and records every line in the history.
+type terminalReader struct {
+	line *liner.State
+}
+
+func (r *terminalReader) Prompt(prompt string) (string, error) {
+	s, err := r.line.Prompt(prompt)
+	if err == liner.ErrPromptAborted {
+		return "", errAborted
+	}
+	if err == nil && strings.TrimSpace(s) != "" {
+		r.line.AppendHistory(s)
+	}
+	return s, err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"patito/repl"
+)
+
+// runRepl implements "patito repl". Line editing and history are only enabled
+// when stdin is a terminal; piped input is read line by line.
+func runRepl(args []string) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	history := fs.String("history", defaultHistoryPath(), "history file (empty to disable)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		repl.Start(os.Stdin, os.Stdout)
+		return 0
+	}
+	fmt.Println("Patito REPL. Type :help for help, :quit to leave.")
+	if err := repl.StartTerminal(os.Stdout, *history); err != nil {
+		fmt.Fprintf(os.Stderr, "patito repl: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".patito_history")
+}
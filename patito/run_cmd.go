@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"patito/bytecode"
+	"patito/evaluator"
+	"patito/optimize"
+	"patito/regvm"
+)
+
+// runRun implements "patito run": it checks a program and runs it with the
+// evaluator, or with -engine=stack or -engine=register compiled for one of the
+// VMs. Only the stack VM takes limits for untrusted programs, and runs them
+// when limits are given without -engine: the evaluator and the register VM
+// run without bounds on steps, memory or time. A runtime error is followed by
+// a stack trace. Compile and runtime errors go to stderr and
+// exit with status 1.
+func runRun(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	engine := fs.String("engine", "eval", "run with the tree-walking evaluator (eval), the stack VM (stack) or the register VM (register); only stack takes limits, and is the default with them")
+	var limits bytecode.Limits
+	fs.Int64Var(&limits.Steps, "max-steps", 0, "stop after this many instructions (0 for no limit)")
+	fs.IntVar(&limits.Depth, "max-depth", 0, "the most calls active at once (0 for no limit)")
+	fs.IntVar(&limits.Memory, "max-memory", 0, "the most cells of globals and of stack (0 for no limit)")
+	timeout := fs.Duration("timeout", 0, "stop after this long (0 for no limit)")
+	level := optFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if limits != (bytecode.Limits{}) || *timeout != 0 {
+		explicit := false
+		fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "engine" })
+		if !explicit {
+			*engine = "stack"
+		}
+		if *engine != "stack" {
+			fmt.Fprintf(os.Stderr, "patito run: limits need -engine=stack, -engine=%s runs without them\n", *engine)
+			return 2
+		}
+	}
+	if err := limits.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "patito run: %v\n", err)
+		return 2
+	}
+	if *timeout < 0 {
+		fmt.Fprintf(os.Stderr, "patito run: negative timeout %v\n", *timeout)
+		return 2
+	}
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito run: %v\n", err)
+		return 1
+	}
+	prog, dir, ok := check(name, src)
+	if !ok {
+		return 1
+	}
+	if *level > 0 {
+		if errs := optimize.Optimize(prog, dir, src); len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+			}
+			return 1
+		}
+	}
+	var run func() error
+	switch *engine {
+	case "eval":
+		run = func() error { return evaluator.New(os.Stdout).Run(prog) }
+	case "stack":
+		p, err := bytecode.Compile(prog, dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "patito run: %v\n", err)
+			return 1
+		}
+		vm := bytecode.New(p, os.Stdout)
+		vm.Limits = limits
+		run = func() error {
+			ctx := context.Background()
+			if *timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, *timeout)
+				defer cancel()
+			}
+			return vm.RunContext(ctx)
+		}
+	case "register":
+		p, err := regvm.Compile(prog, dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "patito run: %v\n", err)
+			return 1
+		}
+		run = regvm.New(p, os.Stdout).Run
+	default:
+		fmt.Fprintf(os.Stderr, "patito run: unknown engine %q\n", *engine)
+		return 2
+	}
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", name, err)
+		var rerr interface{ Trace(name string) string }
+		if errors.As(err, &rerr) {
+			fmt.Fprint(os.Stderr, rerr.Trace(name))
+		}
+		return 1
+	}
+	return 0
+}
+
+// optFlags registers -O0 and -O1 on fs and returns the selected optimization
+// level. The last flag given wins; the default is -O0.
+func optFlags(fs *flag.FlagSet) *int {
+	level := new(int)
+	fs.Var(optFlag{level, 0}, "O0", "disable optimizations (default)")
+	fs.Var(optFlag{level, 1}, "O1", "inline small functions, fold constants, move loop invariants, reuse common subexpressions and remove dead code")
+	return level
+}
+
+type optFlag struct {
+	level *int
+	value int
+}
+
+func (f optFlag) String() string   { return "" }
+func (f optFlag) IsBoolFlag() bool { return true }
+
+func (f optFlag) Set(s string) error {
+	if s == "true" {
+		*f.level = f.value
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package semantic
+
+import (
+	"fmt"
+
+	"patito/ast"
+	"patito/token"
+)
+
+// Error is a semantic error at a source position.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+// Error formats the error like the parser does: "line:col: message".
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// Checker builds the function directory and validates statements against it.
+// The exported methods are atomic: when they report errors nothing is declared,
+// which lets the REPL feed declarations one entry at a time.
+type Checker struct {
+	Dir     *FuncDir
+	current *Func // function whose body is being checked; nil for main
+	errors  []*Error
+}
+
+func NewChecker() *Checker {
+	return &Checker{Dir: NewFuncDir()}
+}
+
+// Check analyzes a whole program. Functions may be called before the point where
+// they are declared (and recursively), so all signatures are collected first.
+func Check(prog *ast.Program) (*FuncDir, []*Error) {
+	c := NewChecker()
+	c.declareVars(c.Dir.Globals, Global, prog.Vars)
+	var funcs []*Func
+	for _, decl := range prog.Funcs {
+		funcs = append(funcs, c.declareFunc(decl))
+	}
+	for _, fn := range funcs {
+		c.checkBody(fn)
+	}
+	if prog.Main != nil {
+		c.checkBlock(prog.Main)
+	}
+	return c.Dir, c.errors
+}
+
+// DeclareVars adds a var section to the global scope.
+func (c *Checker) DeclareVars(decls []*ast.VarDecl) []*Error {
+	added := c.declareVars(c.Dir.Globals, Global, decls)
+	errs := c.collect()
+	if len(errs) > 0 {
+		for _, v := range added {
+			c.Dir.Globals.remove(v.Name)
+		}
+	}
+	return errs
+}
+
+// DeclareFunc adds a function to the directory and checks its body.
+func (c *Checker) DeclareFunc(decl *ast.FuncDecl) []*Error {
+	fn := c.declareFunc(decl)
+	if len(c.errors) == 0 {
+		c.checkBody(fn)
+	}
+	errs := c.collect()
+	if len(errs) > 0 && c.Dir.Lookup(fn.Name) == fn {
+		c.Dir.remove(fn.Name)
+	}
+	return errs
+}
+
+// CheckStatement validates a statement that runs in the global (main) scope.
+func (c *Checker) CheckStatement(stmt ast.Statement) []*Error {
+	c.checkStatement(stmt)
+	return c.collect()
+}
+
+// CheckExpression returns the type of an expression evaluated in the global scope.
+func (c *Checker) CheckExpression(exp ast.Expression) (Type, []*Error) {
+	t := c.expr(exp)
+	return t, c.collect()
+}
+
+// LookupVar resolves a name the way code inside fn would (fn may be nil for main).
+func (c *Checker) LookupVar(fn *Func, name string) *Var {
+	if fn != nil {
+		if v := fn.Vars.Lookup(name); v != nil {
+			return v
+		}
+	}
+	return c.Dir.Globals.Lookup(name)
+}
+
+func (c *Checker) collect() []*Error {
+	errs := c.errors
+	c.errors = nil
+	return errs
+}
+
+func (c *Checker) errorf(pos token.Position, format string, args ...any) {
+	c.errors = append(c.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// ---------- Declarations ----------
+
+func (c *Checker) declareVars(table *VarTable, scope Scope, decls []*ast.VarDecl) []*Var {
+	var added []*Var
+	for _, decl := range decls {
+		t := TypeOf(decl.Type)
+		for _, id := range decl.Names {
+			v := &Var{Name: id.Value, Type: t, Scope: scope, Decl: id}
+			if !table.Add(v) {
+				c.errorf(id.Pos, "%s redeclared in this scope", id.Value)
+				continue
+			}
+			added = append(added, v)
+		}
+	}
+	return added
+}
+
+// declareFunc builds the directory entry for decl. A function whose name is
+// already taken is still returned so its body can be checked.
+func (c *Checker) declareFunc(decl *ast.FuncDecl) *Func {
+	fn := &Func{Name: decl.Name.Value, Vars: NewVarTable(), Decl: decl}
+	for _, p := range decl.Params {
+		v := &Var{Name: p.Name.Value, Type: TypeOf(p.Type), Scope: Param, Decl: p.Name}
+		if !fn.Vars.Add(v) {
+			c.errorf(p.Name.Pos, "duplicate parameter %s in function %s", v.Name, fn.Name)
+			continue
+		}
+		fn.Params = append(fn.Params, v)
+	}
+	c.declareVars(fn.Vars, Local, decl.Vars)
+	if !c.Dir.add(fn) {
+		c.errorf(decl.Name.Pos, "function %s redeclared", fn.Name)
+	}
+	return fn
+}
+
+func (c *Checker) checkBody(fn *Func) {
+	if fn.Decl.Body == nil {
+		return
+	}
+	c.current = fn
+	c.checkBlock(fn.Decl.Body)
+	c.current = nil
+}
+
+// ---------- Statements ----------
+
+func (c *Checker) checkBlock(block *ast.BlockStatement) {
+	for _, stmt := range block.Statements {
+		c.checkStatement(stmt)
+	}
+}
+
+func (c *Checker) checkStatement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		v := c.lookup(s.Name)
+		t := c.expr(s.Value)
+		if v != nil && t != Invalid && !Assignable(v.Type, t) {
+			c.errorf(s.Value.Position(), "cannot assign %s to %s variable %s", t, v.Type, v.Name)
+		}
+	case *ast.PrintStatement:
+		for _, e := range s.Expressions {
+			c.expr(e)
+		}
+	case *ast.IfStatement:
+		c.condition(s.Condition)
+		c.checkBlock(s.Consequence)
+		if s.Alternative != nil {
+			c.checkBlock(s.Alternative)
+		}
+	case *ast.WhileStatement:
+		c.condition(s.Condition)
+		c.checkBlock(s.Body)
+	case *ast.CallStatement:
+		c.call(s.Call)
+	case *ast.BlockStatement:
+		c.checkBlock(s)
+	default:
+		c.errorf(stmt.Position(), "unexpected statement %T", stmt)
+	}
+}
+
+func (c *Checker) condition(exp ast.Expression) {
+	if t := c.expr(exp); t != Invalid && t != Bool {
+		c.errorf(exp.Position(), "condition must be a relational expression, got %s", t)
+	}
+}
+
+func (c *Checker) call(call *ast.CallExpression) {
+	fn := c.Dir.Lookup(call.Function.Value)
+	if fn == nil {
+		c.errorf(call.Function.Pos, "undeclared function %s", call.Function.Value)
+	} else if len(call.Arguments) != len(fn.Params) {
+		c.errorf(call.Pos, "function %s expects %d arguments, got %d", fn.Name, len(fn.Params), len(call.Arguments))
+	}
+	for i, arg := range call.Arguments {
+		t := c.expr(arg)
+		if fn == nil || i >= len(fn.Params) || t == Invalid {
+			continue
+		}
+		if p := fn.Params[i]; !Assignable(p.Type, t) {
+			c.errorf(arg.Position(), "cannot use %s as %s argument %s of %s", t, p.Type, p.Name, fn.Name)
+		}
+	}
+}
+
+// ---------- Expressions ----------
+
+func (c *Checker) lookup(id *ast.Identifier) *Var {
+	v := c.LookupVar(c.current, id.Value)
+	if v == nil {
+		c.errorf(id.Pos, "undeclared variable %s", id.Value)
+	}
+	return v
+}
+
+// expr returns the type of exp, reporting errors along the way. Invalid means an
+// error was already reported for exp, so callers should not report it again.
+func (c *Checker) expr(exp ast.Expression) Type {
+	switch e := exp.(type) {
+	case *ast.Identifier:
+		if v := c.lookup(e); v != nil {
+			return v.Type
+		}
+		return Invalid
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.FloatLiteral:
+		return Float
+	case *ast.BooleanLiteral:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.PrefixExpression:
+		t := c.expr(e.Right)
+		if t == Invalid {
+			return Invalid
+		}
+		res := PrefixResultType(e.Operator, t)
+		if res == Invalid {
+			c.errorf(e.Pos, "invalid operation: %s%s", e.Operator, t)
+		}
+		return res
+	case *ast.InfixExpression:
+		left, right := c.expr(e.Left), c.expr(e.Right)
+		if left == Invalid || right == Invalid {
+			return Invalid
+		}
+		res := ResultType(e.Operator, left, right)
+		if res == Invalid {
+			c.errorf(e.Pos, "invalid operation: %s %s %s", left, e.Operator, right)
+		}
+		return res
+	case *ast.CallExpression:
+		c.call(e)
+		c.errorf(e.Pos, "function %s is void and cannot be used as a value", e.Function.Value)
+		return Invalid
+	}
+	c.errorf(exp.Position(), "unexpected expression %T", exp)
+	return Invalid
+}
@@ -0,0 +1,146 @@
+package semantic
+
+import (
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/lexer"
+	"patito/parser"
+)
+
+func TestCheckBuildsFuncDir(t *testing.T) {
+	input := `program p;
+var x, y : int; z : float;
+void f(a : int, b : float) [ var t : int; { t = a; g(t); } ];
+void g(n : int) [ { print(n); } ];
+main { f(x, z); f(1, 2); }
+end`
+	dir, errs := check(t, input)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if got := len(dir.Globals.All()); got != 3 {
+		t.Fatalf("expected 3 globals, got %d", got)
+	}
+	if v := dir.Globals.Lookup("z"); v == nil || v.Type != Float || v.Scope != Global {
+		t.Fatalf("global z wrong: %+v", v)
+	}
+	f := dir.Lookup("f")
+	if f == nil || len(f.Params) != 2 || f.Params[1].Type != Float {
+		t.Fatalf("function f wrong: %+v", f)
+	}
+	if v := f.Vars.Lookup("t"); v == nil || v.Scope != Local || v.Type != Int {
+		t.Fatalf("local t wrong: %+v", v)
+	}
+	if names := funcNames(dir); names != "f g" {
+		t.Fatalf("functions out of order: %s", names)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var x : int; x : float; main { }", "x redeclared in this scope"},
+		{"main { x = 1; }", "undeclared variable x"},
+		{"var x : int; main { x = 1.5; }", "cannot assign float to int variable x"},
+		{"var x : int; main { if (x) { }; }", "condition must be a relational expression, got int"},
+		{"var x : int; main { while (x + 1.0) do { }; }", "condition must be a relational expression, got float"},
+		{"var x : int; main { x = (x > 1) + 2; }", "invalid operation: bool + int"},
+		{"var x : int; main { x = -(x < 1); }", "invalid operation: -bool"},
+		{"main { f(1); }", "undeclared function f"},
+		{"void f(a : int) [ { } ]; main { f(1, 2); }", "function f expects 1 arguments, got 2"},
+		{"void f(a : int) [ { } ]; main { f(1.5); }", "cannot use float as int argument a of f"},
+		{"void f(a : int, a : float) [ { } ]; main { }", "duplicate parameter a in function f"},
+		{"void f(a : int) [ var a : int; { } ]; main { }", "a redeclared in this scope"},
+		{"void f() [ { } ]; void f() [ { } ]; main { }", "function f redeclared"},
+		{"void f() [ var t : int; { } ]; main { t = 1; }", "undeclared variable t"},
+	}
+
+	for i, tt := range tests {
+		_, errs := check(t, "program p; "+tt.input+" end")
+		if len(errs) != 1 || errs[0].Msg != tt.expected {
+			t.Fatalf("tests[%d] - expected=%q, got=%v", i, tt.expected, errs)
+		}
+	}
+}
+
+func TestCheckErrorPositions(t *testing.T) {
+	_, errs := check(t, "program p;\nvar x : int;\nmain {\n  x = y;\n  x = 2.5 * x;\n}\nend")
+	expected := []string{"4:7: undeclared variable y", "5:7: cannot assign float to int variable x"}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errs)
+	}
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Fatalf("errors[%d] - expected=%q, got=%q", i, expected[i], e.Error())
+		}
+	}
+}
+
+func TestCheckerIsAtomic(t *testing.T) {
+	c := NewChecker()
+	if errs := c.DeclareVars(vars(t, "var x : int;")); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	// y is fine but x is a duplicate: neither should be declared
+	if errs := c.DeclareVars(vars(t, "var y, x : float;")); len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	if c.Dir.Globals.Lookup("y") != nil {
+		t.Fatalf("y was declared by a failed DeclareVars")
+	}
+	if v := c.Dir.Globals.Lookup("x"); v.Type != Int {
+		t.Fatalf("x changed type to %s", v.Type)
+	}
+
+	typ, errs := c.CheckExpression(expr(t, "x * 2.5"))
+	if len(errs) > 0 || typ != Float {
+		t.Fatalf("expected float without errors, got %s %v", typ, errs)
+	}
+}
+
+func check(t *testing.T, input string) (*FuncDir, []*Error) {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	prog := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return Check(prog)
+}
+
+func vars(t *testing.T, input string) []*ast.VarDecl {
+	t.Helper()
+	var decls []*ast.VarDecl
+	for _, n := range fragment(t, input) {
+		decls = append(decls, n.(*ast.VarDecl))
+	}
+	return decls
+}
+
+func expr(t *testing.T, input string) ast.Expression {
+	t.Helper()
+	return fragment(t, input)[0].(ast.Expression)
+}
+
+func fragment(t *testing.T, input string) []ast.Node {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	nodes := p.ParseFragment()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return nodes
+}
+
+func funcNames(dir *FuncDir) string {
+	var names []string
+	for _, f := range dir.Funcs() {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, " ")
+}
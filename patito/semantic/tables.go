@@ -0,0 +1,113 @@
+package semantic
+
+import "patito/ast"
+
+// Scope tells where a variable was declared.
+type Scope int
+
+const (
+	Global Scope = iota
+	Param
+	Local
+)
+
+func (s Scope) String() string {
+	switch s {
+	case Param:
+		return "param"
+	case Local:
+		return "local"
+	}
+	return "global"
+}
+
+// Var is one entry of a variable table.
+type Var struct {
+	Name  string
+	Type  Type
+	Scope Scope
+	Decl  *ast.Identifier // the identifier in the declaration, for positions
+}
+
+// VarTable keeps the variables of one scope in declaration order.
+type VarTable struct {
+	vars  map[string]*Var
+	order []*Var
+}
+
+func NewVarTable() *VarTable {
+	return &VarTable{vars: map[string]*Var{}}
+}
+
+// Lookup returns the variable called name, or nil.
+func (vt *VarTable) Lookup(name string) *Var { return vt.vars[name] }
+
+// Add inserts v; it returns false (and does nothing) if the name is taken.
+func (vt *VarTable) Add(v *Var) bool {
+	if _, ok := vt.vars[v.Name]; ok {
+		return false
+	}
+	vt.vars[v.Name] = v
+	vt.order = append(vt.order, v)
+	return true
+}
+
+// All returns the variables in declaration order.
+func (vt *VarTable) All() []*Var { return vt.order }
+
+func (vt *VarTable) remove(name string) {
+	delete(vt.vars, name)
+	for i, v := range vt.order {
+		if v.Name == name {
+			vt.order = append(vt.order[:i], vt.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// Func is one entry of the function directory. Vars holds both the parameters
+// (first, in order) and the local variables. Temps is the most temps of each
+// type that its quadruples use at once, filled in when ssa.Lower lowers it.
+type Func struct {
+	Name   string
+	Params []*Var
+	Vars   *VarTable
+	Temps  map[Type]int
+	Decl   *ast.FuncDecl
+}
+
+// FuncDir is the function directory plus the global variable table.
+type FuncDir struct {
+	Globals *VarTable
+	funcs   map[string]*Func
+	order   []*Func
+}
+
+func NewFuncDir() *FuncDir {
+	return &FuncDir{Globals: NewVarTable(), funcs: map[string]*Func{}}
+}
+
+// Lookup returns the function called name, or nil.
+func (fd *FuncDir) Lookup(name string) *Func { return fd.funcs[name] }
+
+// Funcs returns the functions in declaration order.
+func (fd *FuncDir) Funcs() []*Func { return fd.order }
+
+func (fd *FuncDir) add(fn *Func) bool {
+	if _, ok := fd.funcs[fn.Name]; ok {
+		return false
+	}
+	fd.funcs[fn.Name] = fn
+	fd.order = append(fd.order, fn)
+	return true
+}
+
+func (fd *FuncDir) remove(name string) {
+	delete(fd.funcs, name)
+	for i, fn := range fd.order {
+		if fn.Name == name {
+			fd.order = append(fd.order[:i], fd.order[i+1:]...)
+			return
+		}
+	}
+}
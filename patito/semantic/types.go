@@ -0,0 +1,96 @@
+// Package semantic implements the semantic analysis of Patito programs: the
+// function directory, the variable tables of every scope and the semantic cube
+// that decides the result type of each operator.
+package semantic
+
+// Type is the static type of a variable or expression.
+type Type int
+
+const (
+	Invalid Type = iota // result of an operation the cube does not allow
+	Int
+	Float
+	Bool   // result of relational operators; only usable as a condition or in print
+	String // string constants; only usable inside print
+	Void
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case Bool:
+		return "bool"
+	case String:
+		return "string"
+	case Void:
+		return "void"
+	}
+	return "invalid"
+}
+
+// TypeOf maps a type keyword from the source ("int", "float") to its Type.
+func TypeOf(name string) Type {
+	switch name {
+	case "int":
+		return Int
+	case "float":
+		return Float
+	}
+	return Invalid
+}
+
+// operands is the (left, right) pair used as key in the semantic cube.
+type operands struct {
+	left, right Type
+}
+
+var arithmetic = map[operands]Type{
+	{Int, Int}:     Int,
+	{Int, Float}:   Float,
+	{Float, Int}:   Float,
+	{Float, Float}: Float,
+}
+
+var relational = map[operands]Type{
+	{Int, Int}:     Bool,
+	{Int, Float}:   Bool,
+	{Float, Int}:   Bool,
+	{Float, Float}: Bool,
+}
+
+// cube is the semantic cube: operator -> (left, right) -> result type.
+// Missing entries are type errors.
+var cube = map[string]map[operands]Type{
+	"+":  arithmetic,
+	"-":  arithmetic,
+	"*":  arithmetic,
+	"/":  arithmetic, // int / int stays int (truncated division)
+	"<":  relational,
+	">":  relational,
+	"<=": relational,
+	">=": relational,
+	"==": relational,
+	"!=": relational,
+}
+
+// ResultType looks up the result of applying a binary operator, or Invalid.
+func ResultType(op string, left, right Type) Type {
+	return cube[op][operands{left, right}]
+}
+
+// PrefixResultType looks up the result of a unary sign applied to t, or Invalid.
+func PrefixResultType(op string, t Type) Type {
+	if (op == "+" || op == "-") && (t == Int || t == Float) {
+		return t
+	}
+	return Invalid
+}
+
+// Assignable reports whether a value of type from can be stored in a variable of
+// type to. Ints are promoted to float; nothing is narrowed implicitly.
+func Assignable(to, from Type) bool {
+	return to == from && (to == Int || to == Float) || to == Float && from == Int
+}
@@ -0,0 +1,432 @@
+package ssa
+
+import (
+	"patito/ast"
+	"patito/cfg"
+	"patito/semantic"
+)
+
+// Build translates a program that passed semantic.Check into SSA form. The
+// construction follows Braun et al., "Simple and Efficient Construction of
+// Static Single Assignment Form": a var is looked up through the predecessors
+// of a block only when it is read, and a phi is only made where two different
+// definitions meet. Blocks that cannot be reached are left out.
+func Build(prog *ast.Program, dir *semantic.FuncDir) *Program {
+	graphs := map[string]*cfg.Graph{}
+	for _, fn := range dir.Funcs() {
+		graphs[fn.Name] = cfg.Build(fn.Name, fn.Decl.Body)
+	}
+	main := cfg.Build("main", prog.Main)
+
+	b := &builder{dir: dir}
+	b.globalWrites(graphs)
+	p := &Program{Globals: dir.Globals.All()}
+	for _, fn := range dir.Funcs() {
+		p.Funcs = append(p.Funcs, b.build(graphs[fn.Name], fn))
+	}
+	p.Funcs = append(p.Funcs, b.build(main, nil))
+	return p
+}
+
+type builder struct {
+	dir    *semantic.FuncDir
+	writes map[string]map[*semantic.Var]bool // globals each function may assign, including through calls
+
+	fn       *Func
+	cur      *Block
+	defs     map[*semantic.Var]map[*Block]*Value // the definition of each var that is current at the end of a block
+	filled   map[*Block]bool                     // blocks whose statements were translated
+	sealed   map[*Block]bool                     // blocks whose predecessors are all filled
+	pending  map[*Block][]incomplete             // phis of unsealed blocks that still need their args
+	initials int                                 // values at the start of the entry for the vars read before any assignment
+}
+
+type incomplete struct {
+	x   *semantic.Var
+	phi *Value
+}
+
+// globalWrites computes the globals that each function may assign.
+func (b *builder) globalWrites(graphs map[string]*cfg.Graph) {
+	b.writes = map[string]map[*semantic.Var]bool{}
+	callees := map[string][]string{}
+	for _, fn := range b.dir.Funcs() {
+		b.writes[fn.Name] = map[*semantic.Var]bool{}
+		for _, blk := range graphs[fn.Name].Blocks {
+			for _, stmt := range blk.Stmts {
+				switch s := stmt.(type) {
+				case *ast.AssignStatement:
+					if fn.Vars.Lookup(s.Name.Value) == nil {
+						b.writes[fn.Name][b.dir.Globals.Lookup(s.Name.Value)] = true
+					}
+				case *ast.CallStatement:
+					callees[fn.Name] = append(callees[fn.Name], s.Call.Function.Value)
+				}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for caller, names := range callees {
+			for _, callee := range names {
+				for g := range b.writes[callee] {
+					if !b.writes[caller][g] {
+						b.writes[caller][g] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// build translates the graph of sem, or of main when sem is nil.
+func (b *builder) build(g *cfg.Graph, sem *semantic.Func) *Func {
+	b.fn = &Func{Name: g.Name, Sem: sem}
+	if sem != nil {
+		b.fn.Params = sem.Params
+	}
+	b.defs = map[*semantic.Var]map[*Block]*Value{}
+	b.filled, b.sealed = map[*Block]bool{}, map[*Block]bool{}
+	b.pending = map[*Block][]incomplete{}
+	b.initials = 0
+
+	reachable := g.Reachable()
+	blocks := make([]*Block, len(g.Blocks)) // by cfg ID
+	for _, blk := range g.Blocks {
+		if reachable[blk.ID] {
+			blocks[blk.ID] = &Block{ID: len(b.fn.Blocks)}
+			b.fn.Blocks = append(b.fn.Blocks, blocks[blk.ID])
+		}
+	}
+	for _, blk := range g.Blocks {
+		if !reachable[blk.ID] {
+			continue
+		}
+		to := blocks[blk.ID]
+		for _, s := range blk.Succs {
+			to.Succs = append(to.Succs, blocks[s.ID])
+			blocks[s.ID].Preds = append(blocks[s.ID].Preds, to)
+		}
+		switch {
+		case blk.Cond != nil:
+			to.Kind = If
+		case len(blk.Succs) == 0:
+			to.Kind = Return
+		}
+	}
+
+	for _, blk := range g.Blocks {
+		if !reachable[blk.ID] {
+			continue
+		}
+		b.cur = blocks[blk.ID]
+		b.sealReady()
+		for _, stmt := range blk.Stmts {
+			b.statement(stmt)
+		}
+		if blk.Cond != nil {
+			b.cur.Control = b.expr(blk.Cond)
+		}
+		b.filled[b.cur] = true
+	}
+	b.sealReady()
+	b.removeTrivialPhis()
+	b.renumber()
+	return b.fn
+}
+
+// sealReady seals the blocks whose predecessors have all been filled.
+func (b *builder) sealReady() {
+	for _, blk := range b.fn.Blocks {
+		if b.sealed[blk] {
+			continue
+		}
+		ready := true
+		for _, p := range blk.Preds {
+			ready = ready && b.filled[p]
+		}
+		if ready {
+			b.sealed[blk] = true
+			for _, inc := range b.pending[blk] {
+				b.addPhiArgs(inc.x, inc.phi)
+			}
+			delete(b.pending, blk)
+		}
+	}
+}
+
+// ---------- Variables ----------
+
+func (b *builder) lookup(name string) *semantic.Var {
+	if b.fn.Sem != nil {
+		if x := b.fn.Sem.Vars.Lookup(name); x != nil {
+			return x
+		}
+	}
+	return b.dir.Globals.Lookup(name)
+}
+
+func (b *builder) write(x *semantic.Var, blk *Block, v *Value) {
+	if b.defs[x] == nil {
+		b.defs[x] = map[*Block]*Value{}
+	}
+	b.defs[x][blk] = v
+}
+
+// read returns the value of x at the end of blk, or at the current point when
+// blk is the block being filled.
+func (b *builder) read(x *semantic.Var, blk *Block) *Value {
+	if v, ok := b.defs[x][blk]; ok {
+		return v
+	}
+	var v *Value
+	switch {
+	case !b.sealed[blk]:
+		// Some predecessor is not filled yet: its args are added on sealing
+		v = b.phi(blk, x)
+		b.pending[blk] = append(b.pending[blk], incomplete{x, v})
+	case len(blk.Preds) == 0:
+		v = b.initial(x)
+	case len(blk.Preds) == 1:
+		v = b.read(x, blk.Preds[0])
+	default:
+		// Define the phi first so that a loop back to blk finds it
+		v = b.phi(blk, x)
+		b.write(x, blk, v)
+		b.addPhiArgs(x, v)
+	}
+	b.write(x, blk, v)
+	return v
+}
+
+func (b *builder) addPhiArgs(x *semantic.Var, phi *Value) {
+	for _, p := range phi.Block.Preds {
+		phi.Args = append(phi.Args, b.read(x, p))
+	}
+}
+
+// phi makes an empty phi for x at the start of blk.
+func (b *builder) phi(blk *Block, x *semantic.Var) *Value {
+	v := b.newValue(OpPhi, x.Type)
+	v.Pos = x.Decl.Pos
+	v.Block = blk
+	n := 0
+	for n < len(blk.Values) && blk.Values[n].Op == OpPhi {
+		n++
+	}
+	blk.Values = insert(blk.Values, n, v)
+	return v
+}
+
+// initial returns the value that x has when the body starts: its argument for
+// a param, zero for a local and the contents of memory for a global.
+func (b *builder) initial(x *semantic.Var) *Value {
+	var v *Value
+	switch x.Scope {
+	case semantic.Param:
+		v = b.newValue(OpParam, x.Type)
+		for i, p := range b.fn.Params {
+			if p == x {
+				v.Index = i
+			}
+		}
+	case semantic.Local:
+		v = b.newValue(OpConst, x.Type)
+		v.Const = zero(x.Type)
+	default:
+		v = b.newValue(OpLoad, x.Type)
+		v.Name = x.Name
+	}
+	v.Pos = x.Decl.Pos
+	v.Block = b.fn.Entry()
+	b.fn.Entry().Values = insert(b.fn.Entry().Values, b.initials, v)
+	b.initials++
+	return v
+}
+
+func zero(t semantic.Type) any {
+	if t == semantic.Float {
+		return float64(0)
+	}
+	return int64(0)
+}
+
+func insert(values []*Value, i int, v *Value) []*Value {
+	values = append(values, nil)
+	copy(values[i+1:], values[i:])
+	values[i] = v
+	return values
+}
+
+// removeTrivialPhis drops the phis whose args are all the same value or the
+// phi itself, and uses that value instead. Removing one can make others
+// trivial, so it repeats until none is left.
+func (b *builder) removeTrivialPhis() {
+	replaced := map[*Value]*Value{}
+	resolve := func(v *Value) *Value {
+		for replaced[v] != nil {
+			v = replaced[v]
+		}
+		return v
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, blk := range b.fn.Blocks {
+			for _, v := range blk.Values {
+				if v.Op != OpPhi || replaced[v] != nil {
+					continue
+				}
+				var same *Value
+				trivial := true
+				for _, arg := range v.Args {
+					arg = resolve(arg)
+					if arg == v || arg == same {
+						continue
+					}
+					if same != nil {
+						trivial = false
+						break
+					}
+					same = arg
+				}
+				if trivial && same != nil {
+					replaced[v] = same
+					changed = true
+				}
+			}
+		}
+	}
+	for _, blk := range b.fn.Blocks {
+		kept := blk.Values[:0]
+		for _, v := range blk.Values {
+			if replaced[v] != nil {
+				continue
+			}
+			for i, arg := range v.Args {
+				v.Args[i] = resolve(arg)
+			}
+			kept = append(kept, v)
+		}
+		blk.Values = kept
+		if blk.Control != nil {
+			blk.Control = resolve(blk.Control)
+		}
+	}
+}
+
+// renumber gives the values IDs in the order they appear. Stores, calls and
+// prints compute nothing and keep ID 0.
+func (b *builder) renumber() {
+	b.fn.values = 0
+	for _, blk := range b.fn.Blocks {
+		for _, v := range blk.Values {
+			v.ID = 0
+			if v.Type != semantic.Void {
+				b.fn.values++
+				v.ID = b.fn.values
+			}
+		}
+	}
+}
+
+// ---------- Statements and expressions ----------
+
+func (b *builder) newValue(op Op, t semantic.Type, args ...*Value) *Value {
+	b.fn.values++
+	return &Value{ID: b.fn.values, Op: op, Type: t, Args: args}
+}
+
+// emit appends a new value to the current block.
+func (b *builder) emit(op Op, t semantic.Type, args ...*Value) *Value {
+	v := b.newValue(op, t, args...)
+	v.Block = b.cur
+	b.cur.Values = append(b.cur.Values, v)
+	return v
+}
+
+func (b *builder) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.AssignStatement:
+		x := b.lookup(s.Name.Value)
+		v := b.convert(x.Type, b.expr(s.Value))
+		b.write(x, b.cur, v)
+		if x.Scope == semantic.Global {
+			store := b.emit(OpStore, semantic.Void, v)
+			store.Name, store.Pos = x.Name, s.Pos
+		}
+	case *ast.PrintStatement:
+		args := make([]*Value, len(s.Expressions))
+		for i, exp := range s.Expressions {
+			args[i] = b.expr(exp)
+		}
+		b.emit(OpPrint, semantic.Void, args...).Pos = s.Pos
+	case *ast.CallStatement:
+		callee := b.dir.Lookup(s.Call.Function.Value)
+		args := make([]*Value, len(s.Call.Arguments))
+		for i, arg := range s.Call.Arguments {
+			args[i] = b.convert(callee.Params[i].Type, b.expr(arg))
+		}
+		call := b.emit(OpCall, semantic.Void, args...)
+		call.Name, call.Pos = callee.Name, s.Pos
+		// The callee sees the globals in memory, and may change them
+		for _, g := range b.dir.Globals.All() {
+			if b.writes[callee.Name][g] {
+				load := b.emit(OpLoad, g.Type)
+				load.Name, load.Pos = g.Name, s.Pos
+				b.write(g, b.cur, load)
+			}
+		}
+	}
+}
+
+func (b *builder) expr(exp ast.Expression) *Value {
+	var v *Value
+	switch x := exp.(type) {
+	case *ast.IntegerLiteral:
+		v = b.emit(OpConst, semantic.Int)
+		v.Const = x.Value
+	case *ast.FloatLiteral:
+		v = b.emit(OpConst, semantic.Float)
+		v.Const = x.Value
+	case *ast.BooleanLiteral:
+		v = b.emit(OpConst, semantic.Bool)
+		v.Const = x.Value
+	case *ast.StringLiteral:
+		v = b.emit(OpConst, semantic.String)
+		v.Const = x.Value
+	case *ast.Identifier:
+		return b.read(b.lookup(x.Value), b.cur)
+	case *ast.PrefixExpression:
+		right := b.expr(x.Right)
+		if x.Operator != "-" {
+			return right
+		}
+		v = b.emit(OpNeg, right.Type, right)
+	case *ast.InfixExpression:
+		left, right := b.expr(x.Left), b.expr(x.Right)
+		if left.Type != right.Type {
+			left, right = b.convert(semantic.Float, left), b.convert(semantic.Float, right)
+		}
+		v = b.emit(binaryOps[x.Operator], semantic.ResultType(x.Operator, left.Type, right.Type), left, right)
+		if v.Op == OpDiv {
+			// Where the evaluator reports a division by zero
+			v.Pos = x.Right.Position()
+			return v
+		}
+	default:
+		panic("ssa: unexpected expression " + ast.Format(exp))
+	}
+	v.Pos = exp.Position()
+	return v
+}
+
+// convert promotes v to the type t of the var or param it is stored in.
+func (b *builder) convert(t semantic.Type, v *Value) *Value {
+	if t == semantic.Float && v.Type == semantic.Int {
+		conv := b.emit(OpIntToFloat, semantic.Float, v)
+		conv.Pos = v.Pos
+		return conv
+	}
+	return v
+}
@@ -0,0 +1,213 @@
+package ssa
+
+import (
+	"fmt"
+	"strconv"
+
+	"patito/token"
+)
+
+// Quad is one quadruple of the lowered form: Result = Arg1 Op Arg2 for the
+// operations, or a jump to the quad numbered Result.
+//
+// The operands are the names of globals and params, literal constants as
+// FormatConst writes them, and temps: "_iN", "_fN" and "_bN" are the int,
+// float and bool temps numbered N. None can clash with a var of the program,
+// whose names cannot start with an underscore, or with the temps that package
+// optimize declares.
+//
+// The ops are:
+//
+//	=  a _ r          copy a into r
+//	+ - * /  a b r    arithmetic, both operands of the same type
+//	< > <= >= == !=  a b r
+//	neg a _ r         r = -a
+//	itof a _ r        r = float(a)
+//	param a _ p       pass a as the param p of the next call
+//	gosub f _ _       call f
+//	print a _ _       print a, separated from the previous one by a space
+//	println _ _ _     end the line
+//	goto _ _ n        jump to quad n
+//	gotof c _ n       jump to quad n when c is false
+//	endfunc _ _ _     return from the function
+//	end _ _ _         end the program, at the end of main
+//
+// Pos maps the quad back to the source: the statement or expression it comes
+// from, or for the copies and jumps that have none, the quad before it.
+type Quad struct {
+	Op, Arg1, Arg2, Result string
+	Pos                    token.Position
+}
+
+func (q Quad) String() string {
+	arg := func(s string) string {
+		if s == "" {
+			return "_"
+		}
+		return s
+	}
+	return fmt.Sprintf("%-7s %-10s %-10s %s", q.Op, arg(q.Arg1), arg(q.Arg2), arg(q.Result))
+}
+
+var quadOps = map[Op]string{
+	OpNeg: "neg", OpIntToFloat: "itof",
+	OpAdd: "+", OpSub: "-", OpMul: "*", OpDiv: "/",
+	OpLt: "<", OpGt: ">", OpLe: "<=", OpGe: ">=", OpEq: "==", OpNe: "!=",
+}
+
+// Lower translates fn, a function of p, out of SSA into quadruples. Phis are
+// replaced by copies the way Sreedhar et al. call method I: each predecessor
+// copies its arg into a temp of the phi just before it jumps, and the block
+// starts by copying that temp into the phi's own. The extra temp keeps copies
+// on different edges, or phis of the same block that read each other, from
+// overwriting a value that is still needed.
+//
+// Values share temps once they are dead, see allocTemps. Lower records how
+// many temps of each type fn needs in fn.Temps, and in the function directory
+// for a function other than main.
+//
+// Blocks are laid out in order, and a jump to the block that follows is left
+// out.
+func Lower(p *Program, fn *Func) []Quad {
+	t := allocTemps(fn)
+	fn.Temps = t.peak
+	if fn.Sem != nil {
+		fn.Sem.Temps = t.peak
+	}
+	var quads []Quad
+	start := make([]int, len(fn.Blocks))
+	type fixup struct {
+		quad  int
+		block *Block
+	}
+	var fixups []fixup // jumps whose target is not laid out yet
+	jump := func(op, cond string, target *Block, pos token.Position) {
+		fixups = append(fixups, fixup{len(quads), target})
+		quads = append(quads, Quad{Op: op, Arg1: cond, Pos: pos})
+	}
+	name := func(v *Value) string {
+		if v.Op == OpConst {
+			return FormatConst(v.Const)
+		}
+		return t.value[v]
+	}
+
+	for _, b := range fn.Blocks {
+		start[b.ID] = len(quads)
+		for _, v := range b.Values {
+			first := len(quads)
+			switch v.Op {
+			case OpConst:
+				// Used directly as an operand
+			case OpPhi:
+				quads = append(quads, Quad{Op: "=", Arg1: t.phi[v], Result: name(v)})
+			case OpParam:
+				quads = append(quads, Quad{Op: "=", Arg1: fn.Params[v.Index].Name, Result: name(v)})
+			case OpLoad:
+				quads = append(quads, Quad{Op: "=", Arg1: v.Name, Result: name(v)})
+			case OpStore:
+				quads = append(quads, Quad{Op: "=", Arg1: name(v.Args[0]), Result: v.Name})
+			case OpCall:
+				params := p.Func(v.Name).Params
+				for i, arg := range v.Args {
+					quads = append(quads, Quad{Op: "param", Arg1: name(arg), Result: params[i].Name})
+				}
+				quads = append(quads, Quad{Op: "gosub", Arg1: v.Name})
+			case OpPrint:
+				for _, arg := range v.Args {
+					quads = append(quads, Quad{Op: "print", Arg1: name(arg)})
+				}
+				quads = append(quads, Quad{Op: "println"})
+			case OpNeg, OpIntToFloat:
+				quads = append(quads, Quad{Op: quadOps[v.Op], Arg1: name(v.Args[0]), Result: name(v)})
+			default:
+				quads = append(quads, Quad{Op: quadOps[v.Op], Arg1: name(v.Args[0]), Arg2: name(v.Args[1]), Result: name(v)})
+			}
+			if !atDecl(v) {
+				for i := first; i < len(quads); i++ {
+					quads[i].Pos = v.Pos
+				}
+			}
+		}
+
+		// Feed the phis of the successors
+		for _, s := range b.Succs {
+			k := 0
+			for s.Preds[k] != b {
+				k++
+			}
+			for _, v := range s.Values {
+				if v.Op == OpPhi {
+					quads = append(quads, Quad{Op: "=", Arg1: name(v.Args[k]), Result: t.phi[v]})
+				}
+			}
+		}
+
+		next := b.ID + 1
+		switch b.Kind {
+		case Plain:
+			if b.Succs[0].ID != next {
+				jump("goto", "", b.Succs[0], token.Position{})
+			}
+		case If:
+			jump("gotof", name(b.Control), b.Succs[1], b.Control.Pos)
+			if b.Succs[0].ID != next {
+				jump("goto", "", b.Succs[0], token.Position{})
+			}
+		case Return:
+			if fn.Sem == nil {
+				quads = append(quads, Quad{Op: "end"})
+			} else {
+				quads = append(quads, Quad{Op: "endfunc"})
+			}
+		}
+	}
+	for _, f := range fixups {
+		quads[f.quad].Result = strconv.Itoa(start[f.block.ID])
+	}
+	fillPos(quads)
+	return quads
+}
+
+// atDecl reports whether the position of v is the declaration of a var, not
+// code: a phi, or the value a var has when the body starts.
+func atDecl(v *Value) bool {
+	switch v.Op {
+	case OpPhi, OpParam:
+		return true
+	case OpLoad:
+		return v.Block.ID == 0 && !v.Block.hasCallBefore(v)
+	}
+	return false
+}
+
+// hasCallBefore reports whether a call comes before v in b.
+func (b *Block) hasCallBefore(v *Value) bool {
+	for _, w := range b.Values {
+		if w == v {
+			return false
+		}
+		if w.Op == OpCall {
+			return true
+		}
+	}
+	return false
+}
+
+// fillPos gives the quads without a position the one of the quad before them,
+// or of the first quad that has one.
+func fillPos(quads []Quad) {
+	var pos token.Position
+	for _, q := range quads {
+		if q.Pos.Line > 0 {
+			pos = q.Pos
+			break
+		}
+	}
+	for i := range quads {
+		if quads[i].Pos.Line == 0 {
+			quads[i].Pos = pos
+		}
+		pos = quads[i].Pos
+	}
+}
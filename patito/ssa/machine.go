@@ -0,0 +1,274 @@
+package ssa
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"patito/evaluator"
+	"patito/token"
+)
+
+// Machine runs the lowered form of a program one quad at a time. It reads
+// every operand from its text, so it is slow, but it can stop between any two
+// quads, which is what a debugger of the lowered code needs.
+type Machine struct {
+	Code    map[string][]Quad // of every function and main, by name
+	Globals map[string]evaluator.Value
+	Frames  []*Activation // main first, the running call last; empty once the program ended
+
+	params map[string][]string        // names of the params of each function
+	args   map[string]evaluator.Value // passed by the param quads so far
+	out    io.Writer
+	line   []string // the line print is writing
+}
+
+// Activation is the record of a call running on a Machine: its params by
+// name, and its temps.
+type Activation struct {
+	Func string
+	PC   int // of the next quad to run
+	Vars map[string]evaluator.Value
+	Args map[string]evaluator.Value // the params as the call passed them
+}
+
+// NewMachine lowers every function of p and returns a Machine about to run the
+// first quad of main, printing to out.
+func NewMachine(p *Program, out io.Writer) *Machine {
+	m := &Machine{
+		Code:    map[string][]Quad{},
+		Globals: map[string]evaluator.Value{},
+		params:  map[string][]string{},
+		args:    map[string]evaluator.Value{},
+		out:     out,
+	}
+	for _, fn := range p.Funcs {
+		m.Code[fn.Name] = Lower(p, fn)
+		for _, v := range fn.Params {
+			m.params[fn.Name] = append(m.params[fn.Name], v.Name)
+		}
+	}
+	for _, g := range p.Globals {
+		m.Globals[g.Name] = constValue(zero(g.Type))
+	}
+	m.Frames = []*Activation{{Func: "main", Vars: map[string]evaluator.Value{}}}
+	return m
+}
+
+// Done reports whether the program ended.
+func (m *Machine) Done() bool { return len(m.Frames) == 0 }
+
+// Next returns the quad that Step runs next, in the running call.
+func (m *Machine) Next() Quad {
+	a := m.Frames[len(m.Frames)-1]
+	return m.Code[a.Func][a.PC]
+}
+
+// Run runs the program to its end, or until a runtime error.
+func (m *Machine) Run() error {
+	for !m.Done() {
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step runs the next quad. A division by zero, or a gosub beyond
+// evaluator.MaxCalls, stops the program with an *evaluator.RuntimeError.
+func (m *Machine) Step() error {
+	a := m.Frames[len(m.Frames)-1]
+	q := m.Code[a.Func][a.PC]
+	a.PC++
+	switch q.Op {
+	case "=":
+		m.set(q.Result, m.get(q.Arg1))
+	case "neg":
+		switch x := m.get(q.Arg1).(type) {
+		case evaluator.Int:
+			m.set(q.Result, -x)
+		case evaluator.Float:
+			m.set(q.Result, -x)
+		}
+	case "itof":
+		m.set(q.Result, evaluator.Float(m.get(q.Arg1).(evaluator.Int)))
+	case "param":
+		m.args[q.Result] = m.get(q.Arg1)
+	case "gosub":
+		if len(m.Frames) > evaluator.MaxCalls {
+			a.PC--
+			return m.fail(q.Pos, evaluator.StackOverflow)
+		}
+		callee := &Activation{Func: q.Arg1, Vars: map[string]evaluator.Value{}, Args: m.args}
+		for name, v := range m.args {
+			callee.Vars[name] = v
+		}
+		m.args = map[string]evaluator.Value{}
+		m.Frames = append(m.Frames, callee)
+	case "print":
+		if s, err := strconv.Unquote(q.Arg1); err == nil {
+			m.line = append(m.line, s)
+		} else {
+			m.line = append(m.line, m.get(q.Arg1).String())
+		}
+	case "println":
+		line := strings.Join(m.line, " ")
+		m.line = m.line[:0]
+		if _, err := fmt.Fprintln(m.out, line); err != nil {
+			return err
+		}
+	case "goto":
+		a.PC, _ = strconv.Atoi(q.Result)
+	case "gotof":
+		if m.get(q.Arg1) == evaluator.Bool(false) {
+			a.PC, _ = strconv.Atoi(q.Result)
+		}
+	case "endfunc", "end":
+		m.Frames = m.Frames[:len(m.Frames)-1]
+	default:
+		v, msg := binary(q.Op, m.get(q.Arg1), m.get(q.Arg2))
+		if msg != "" {
+			a.PC--
+			return m.fail(q.Pos, msg)
+		}
+		m.set(q.Result, v)
+	}
+	return nil
+}
+
+// get returns the value of the operand s: a var of the running call, a
+// global or a constant.
+func (m *Machine) get(s string) evaluator.Value {
+	a := m.Frames[len(m.Frames)-1]
+	if v, ok := a.Vars[s]; ok {
+		return v
+	}
+	if v, ok := m.Globals[s]; ok {
+		return v
+	}
+	return parseConst(s)
+}
+
+func (m *Machine) set(s string, v evaluator.Value) {
+	a := m.Frames[len(m.Frames)-1]
+	if _, ok := a.Vars[s]; !ok {
+		if _, ok := m.Globals[s]; ok {
+			m.Globals[s] = v
+			return
+		}
+	}
+	a.Vars[s] = v
+}
+
+// fail returns the error msg at pos with the calls that are active.
+func (m *Machine) fail(pos token.Position, msg string) *evaluator.RuntimeError {
+	err := &evaluator.RuntimeError{Pos: pos, Msg: msg}
+	for i := len(m.Frames) - 1; i >= 0; i-- {
+		if len(err.Stack) == evaluator.MaxTrace {
+			err.Elided = i + 1
+			break
+		}
+		a := m.Frames[i]
+		f := evaluator.StackFrame{Func: a.Func, Pos: pos, Params: m.params[a.Func]}
+		if i < len(m.Frames)-1 {
+			f.Pos = m.Code[a.Func][a.PC-1].Pos // the gosub
+		}
+		for _, name := range f.Params {
+			f.Args = append(f.Args, a.Args[name])
+		}
+		err.Stack = append(err.Stack, f)
+	}
+	return err
+}
+
+// parseConst reads a constant the way FormatConst writes it.
+func parseConst(s string) evaluator.Value {
+	if s == "true" || s == "false" {
+		return evaluator.Bool(s == "true")
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return evaluator.Int(i)
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return evaluator.Float(f)
+}
+
+func constValue(c any) evaluator.Value {
+	switch c := c.(type) {
+	case int64:
+		return evaluator.Int(c)
+	case float64:
+		return evaluator.Float(c)
+	case bool:
+		return evaluator.Bool(c)
+	}
+	return nil
+}
+
+// binary applies op to operands of the same type. Its message is the one of a
+// division by zero, or "".
+func binary(op string, left, right evaluator.Value) (evaluator.Value, string) {
+	if l, ok := left.(evaluator.Int); ok {
+		r := right.(evaluator.Int)
+		switch op {
+		case "+":
+			return l + r, ""
+		case "-":
+			return l - r, ""
+		case "*":
+			return l * r, ""
+		case "/":
+			if r == 0 {
+				return nil, "integer division by zero"
+			}
+			return l / r, ""
+		}
+		return compare(op, cmp.Compare(l, r)), ""
+	}
+	l, r := left.(evaluator.Float), right.(evaluator.Float)
+	switch op {
+	case "+":
+		return l + r, ""
+	case "-":
+		return l - r, ""
+	case "*":
+		return l * r, ""
+	case "/":
+		if r == 0 {
+			return nil, "float division by zero"
+		}
+		return l / r, ""
+	}
+	switch op {
+	case "<":
+		return evaluator.Bool(l < r), ""
+	case ">":
+		return evaluator.Bool(l > r), ""
+	case "<=":
+		return evaluator.Bool(l <= r), ""
+	case ">=":
+		return evaluator.Bool(l >= r), ""
+	case "==":
+		return evaluator.Bool(l == r), ""
+	}
+	return evaluator.Bool(l != r), ""
+}
+
+// compare turns the ordering c of two ints into the result of op.
+func compare(op string, c int) evaluator.Bool {
+	switch op {
+	case "<":
+		return c < 0
+	case ">":
+		return c > 0
+	case "<=":
+		return c <= 0
+	case ">=":
+		return c >= 0
+	case "==":
+		return c == 0
+	}
+	return c != 0
+}
@@ -0,0 +1,72 @@
+package ssa
+
+import "strconv"
+
+// Peephole simplifies the quads of a function a few at a time, and renumbers
+// the jumps to match. It repeats until nothing changes:
+//
+//   - a jump to a goto jumps to where that goto goes instead, and the quads
+//     no jump reaches any more are removed;
+//   - a jump to the quad that follows it is removed;
+//   - an operation into a temp followed by a copy of the temp, t = a + b;
+//     x = t, becomes x = a + b when nothing else reads t;
+//   - a copy of a var into itself is removed.
+func Peephole(quads []Quad) []Quad {
+	quads = append([]Quad(nil), quads...)
+	for changed := true; changed; {
+		changed = threadJumps(quads)
+		keep := reachable(quads)
+		leader := leaders(quads)
+		liveOut := liveTemps(quads)
+		for i, q := range quads {
+			if !keep[i] {
+				changed = true // unreachable, or merged into the quad before
+				continue
+			}
+			target, _ := strconv.Atoi(q.Result)
+			switch {
+			case (q.Op == "goto" || q.Op == "gotof") && target == i+1,
+				q.Op == "=" && q.Arg1 == q.Result:
+				keep[i] = false
+			case i+1 < len(quads) && mergesWithCopy(q, quads[i+1]) && !leader[i+1] && !liveOut[i+1][q.Result]:
+				quads[i].Result = quads[i+1].Result
+				keep[i+1] = false
+			default:
+				continue
+			}
+			changed = true
+		}
+		quads = compact(quads, keep)
+	}
+	return quads
+}
+
+// threadJumps makes the jumps to a goto jump to its target, following chains
+// of gotos but not a loop of them.
+func threadJumps(quads []Quad) bool {
+	changed := false
+	for i, q := range quads {
+		if q.Op != "goto" && q.Op != "gotof" {
+			continue
+		}
+		target, _ := strconv.Atoi(q.Result)
+		seen := map[int]bool{i: true}
+		for target < len(quads) && quads[target].Op == "goto" && !seen[target] {
+			seen[target] = true
+			target, _ = strconv.Atoi(quads[target].Result)
+		}
+		if r := strconv.Itoa(target); r != q.Result {
+			quads[i].Result = r
+			changed = true
+		}
+	}
+	return changed
+}
+
+// mergesWithCopy reports whether q computes a temp that next copies.
+func mergesWithCopy(q, next Quad) bool {
+	if !isTemp(q.Result) || next.Op != "=" || next.Arg1 != q.Result {
+		return false
+	}
+	return q.Op == "=" || q.Op == "neg" || q.Op == "itof" || binaryOps[q.Op] != 0
+}
@@ -0,0 +1,244 @@
+package ssa
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"patito/evaluator"
+)
+
+// Prune removes the quads of a function, as Lower returns them, that can never
+// run or have no effect, and renumbers the jumps to match. It repeats until
+// nothing changes:
+//
+//   - an operation on constants becomes a copy of its result, unless it
+//     divides by zero;
+//   - a temp that holds a constant is replaced by it in the rest of its basic
+//     block;
+//   - a gotof on a constant becomes a goto when it is false, and is removed
+//     when it is true;
+//   - quads that no path from the first reaches are removed;
+//   - an assignment to a temp that nothing reads before it is written again
+//     is removed, unless it divides by something that may be zero.
+func Prune(quads []Quad) []Quad {
+	quads = append([]Quad(nil), quads...)
+	for changed := true; changed; {
+		changed = foldQuads(quads)
+		changed = propagate(quads) || changed
+		keep := reachable(quads)
+		unusedQuads(quads, keep)
+		before := len(quads)
+		quads = compact(quads, keep)
+		changed = changed || len(quads) < before
+	}
+	return quads
+}
+
+// foldQuads replaces the operations on constants by copies of their result.
+func foldQuads(quads []Quad) bool {
+	changed := false
+	for i, q := range quads {
+		var x evaluator.Value
+		switch {
+		case q.Op == "itof" && isConst(q.Arg1):
+			x = evaluator.Float(parseConst(q.Arg1).(evaluator.Int))
+		case q.Op == "neg" && isConst(q.Arg1):
+			switch c := parseConst(q.Arg1).(type) {
+			case evaluator.Int:
+				x = -c
+			case evaluator.Float:
+				x = -c
+			}
+		case binaryOps[q.Op] != 0 && isConst(q.Arg1) && isConst(q.Arg2):
+			var msg string
+			x, msg = binary(q.Op, parseConst(q.Arg1), parseConst(q.Arg2))
+			if f, ok := x.(evaluator.Float); msg != "" || ok && math.IsNaN(float64(f)) {
+				continue // the division by zero is the program's to fail
+			}
+		default:
+			continue
+		}
+		quads[i] = Quad{Op: "=", Arg1: formatValue(x), Result: q.Result, Pos: q.Pos}
+		changed = true
+	}
+	return changed
+}
+
+// propagate replaces the temps known to hold a constant by the constant, from
+// the copy that sets them to the end of the basic block.
+func propagate(quads []Quad) bool {
+	leader := leaders(quads)
+	known := map[string]string{}
+	changed := false
+	for i := range quads {
+		if leader[i] {
+			clear(known)
+		}
+		q := &quads[i]
+		for _, arg := range []*string{&q.Arg1, &q.Arg2} {
+			if c, ok := known[*arg]; ok {
+				*arg = c
+				changed = true
+			}
+		}
+		if isTemp(q.Result) {
+			delete(known, q.Result)
+			if q.Op == "=" && isConst(q.Arg1) {
+				known[q.Result] = q.Arg1
+			}
+		}
+	}
+	return changed
+}
+
+// leaders marks the quads that start a basic block: the first, the targets
+// of the jumps and the quads that follow them.
+func leaders(quads []Quad) map[int]bool {
+	leader := map[int]bool{0: true}
+	for i, q := range quads {
+		if q.Op == "goto" || q.Op == "gotof" {
+			n, _ := strconv.Atoi(q.Result)
+			leader[n] = true
+			leader[i+1] = true
+		}
+	}
+	return leader
+}
+
+// succs returns the quads that may run after quad i. A gotof on a constant
+// only has the path it takes.
+func succs(quads []Quad, i int) []int {
+	q := quads[i]
+	target, _ := strconv.Atoi(q.Result)
+	switch {
+	case q.Op == "goto", q.Op == "gotof" && q.Arg1 == "false":
+		return []int{target}
+	case q.Op == "gotof" && q.Arg1 != "true":
+		return []int{target, i + 1}
+	case q.Op == "endfunc", q.Op == "end":
+		return nil
+	}
+	return []int{i + 1}
+}
+
+// reachable marks the quads that some path from the first one reaches, but
+// not the gotofs on true, which never jump.
+func reachable(quads []Quad) []bool {
+	keep := make([]bool, len(quads))
+	seen := make([]bool, len(quads)+1)
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if seen[i] || i == len(quads) {
+			continue
+		}
+		seen[i] = true
+		q := quads[i]
+		keep[i] = q.Op != "gotof" || q.Arg1 != "true"
+		work = append(work, succs(quads, i)...)
+	}
+	return keep
+}
+
+// unusedQuads unmarks in keep the assignments to temps that are dead: no
+// path from them reads the temp before it is written again. A division by
+// something that may be zero stays.
+func unusedQuads(quads []Quad, keep []bool) {
+	liveOut := liveTemps(quads)
+	for i, q := range quads {
+		if !keep[i] || !isTemp(q.Result) || liveOut[i][q.Result] {
+			continue
+		}
+		if q.Op == "/" && (!isConst(q.Arg2) || parseConst(q.Arg2) == evaluator.Int(0) || parseConst(q.Arg2) == evaluator.Float(0)) {
+			continue
+		}
+		keep[i] = false
+	}
+}
+
+// liveTemps returns the temps that are live after each quad: some path from
+// it reads them before writing them.
+func liveTemps(quads []Quad) []map[string]bool {
+	liveOut := make([]map[string]bool, len(quads))
+	for i := range quads {
+		liveOut[i] = map[string]bool{}
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(quads) - 1; i >= 0; i-- {
+			for _, s := range succs(quads, i) {
+				if s == len(quads) {
+					continue
+				}
+				q := quads[s]
+				for t := range liveOut[s] {
+					if t != q.Result && !liveOut[i][t] {
+						liveOut[i][t] = true
+						changed = true
+					}
+				}
+				for _, t := range []string{q.Arg1, q.Arg2} {
+					if isTemp(t) && !liveOut[i][t] {
+						liveOut[i][t] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return liveOut
+}
+
+// compact returns the quads kept, with the jumps renumbered. A jump to a quad
+// that is removed goes to the next one kept, which is the one that would
+// have run after it.
+func compact(quads []Quad, keep []bool) []Quad {
+	index := make([]int, len(quads)+1)
+	n := 0
+	for i := range quads {
+		index[i] = n
+		if keep[i] {
+			n++
+		}
+	}
+	index[len(quads)] = n
+	var kept []Quad
+	for i, q := range quads {
+		if !keep[i] {
+			continue
+		}
+		if q.Op == "gotof" && q.Arg1 == "false" {
+			q.Op, q.Arg1 = "goto", ""
+		}
+		if q.Op == "goto" || q.Op == "gotof" {
+			target, _ := strconv.Atoi(q.Result)
+			q.Result = strconv.Itoa(index[target])
+		}
+		kept = append(kept, q)
+	}
+	return kept
+}
+
+// isConst reports whether the operand s is a constant rather than a name.
+func isConst(s string) bool {
+	if s == "true" || s == "false" {
+		return true
+	}
+	return s != "" && strings.ContainsRune("0123456789+-.", rune(s[0]))
+}
+
+// isTemp reports whether the operand s is a temp of Lower.
+func isTemp(s string) bool { return strings.HasPrefix(s, "_") && len(s) > 2 }
+
+// formatValue writes v the way FormatConst writes the constant it stands for.
+func formatValue(v evaluator.Value) string {
+	switch v := v.(type) {
+	case evaluator.Int:
+		return FormatConst(int64(v))
+	case evaluator.Float:
+		return FormatConst(float64(v))
+	}
+	return FormatConst(bool(v.(evaluator.Bool)))
+}
@@ -0,0 +1,215 @@
+// Package ssa holds an intermediate representation of Patito programs in
+// static single assignment form, built from the control-flow graphs of package
+// cfg. Every Value is assigned once; where control flow merges, phi values pick
+// the definition of the predecessor that was taken.
+//
+// Params and locals live only in values. Globals are shared with the functions
+// a body calls, so they stay in memory: every assignment to a global is also
+// stored, and after a call each global the callee may assign is loaded again.
+// Between those points a global is renamed like any other var.
+//
+// Implicit conversions are explicit in the IR: an int that is used as a float,
+// in mixed arithmetic or when assigned to a float var, goes through OpIntToFloat.
+package ssa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"patito/semantic"
+	"patito/token"
+)
+
+// Op is the operation a Value performs.
+type Op int
+
+const (
+	OpConst      Op = iota // Const
+	OpParam                // the param numbered Index
+	OpLoad                 // the global Name
+	OpStore                // Name = Args[0]
+	OpPhi                  // Args[i] when coming from Block.Preds[i]
+	OpNeg                  // -Args[0]
+	OpIntToFloat           // Args[0] converted to float
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv // fails at Pos when Args[1] is zero
+	OpLt
+	OpGt
+	OpLe
+	OpGe
+	OpEq
+	OpNe
+	OpCall  // Name(Args...), which may assign any global
+	OpPrint // prints Args separated by spaces and ends the line
+)
+
+var opNames = [...]string{
+	OpConst: "const", OpParam: "param", OpLoad: "load", OpStore: "store", OpPhi: "phi",
+	OpNeg: "neg", OpIntToFloat: "itof",
+	OpAdd: "add", OpSub: "sub", OpMul: "mul", OpDiv: "div",
+	OpLt: "lt", OpGt: "gt", OpLe: "le", OpGe: "ge", OpEq: "eq", OpNe: "ne",
+	OpCall: "call", OpPrint: "print",
+}
+
+func (op Op) String() string { return opNames[op] }
+
+// binaryOps maps the operators of the language to their Op.
+var binaryOps = map[string]Op{
+	"+": OpAdd, "-": OpSub, "*": OpMul, "/": OpDiv,
+	"<": OpLt, ">": OpGt, "<=": OpLe, ">=": OpGe, "==": OpEq, "!=": OpNe,
+}
+
+// Value is an instruction and the value it computes. Stores, calls and prints
+// compute nothing: they have type Void and no ID.
+type Value struct {
+	ID    int
+	Op    Op
+	Type  semantic.Type
+	Args  []*Value
+	Const any    // int64, float64, bool or string, for OpConst
+	Index int    // for OpParam
+	Name  string // global for OpLoad and OpStore, function for OpCall
+	Pos   token.Position
+	Block *Block
+}
+
+func (v *Value) String() string { return "v" + strconv.Itoa(v.ID) }
+
+// LongString formats the instruction that defines v.
+func (v *Value) LongString() string {
+	var sb strings.Builder
+	if v.Type != semantic.Void {
+		fmt.Fprintf(&sb, "%s = ", v)
+	}
+	sb.WriteString(v.Op.String())
+	if v.Type != semantic.Void {
+		fmt.Fprintf(&sb, " <%s>", v.Type)
+	}
+	switch v.Op {
+	case OpConst:
+		sb.WriteString(" " + FormatConst(v.Const))
+	case OpParam:
+		fmt.Fprintf(&sb, " %d", v.Index)
+	case OpLoad, OpStore, OpCall:
+		sb.WriteString(" " + v.Name)
+	}
+	for i, arg := range v.Args {
+		if v.Op == OpPhi {
+			fmt.Fprintf(&sb, " [b%d: %s]", v.Block.Preds[i].ID, arg)
+		} else {
+			sb.WriteString(" " + arg.String())
+		}
+	}
+	return sb.String()
+}
+
+// FormatConst writes a constant the way Patito source would, except that a
+// float always has a point or an exponent so it reads back as a float.
+func FormatConst(c any) string {
+	switch c := c.(type) {
+	case int64:
+		return strconv.FormatInt(c, 10)
+	case float64:
+		s := strconv.FormatFloat(c, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEIN") {
+			s += ".0"
+		}
+		return s
+	case bool:
+		return strconv.FormatBool(c)
+	case string:
+		return strconv.Quote(c)
+	}
+	return fmt.Sprint(c)
+}
+
+// Kind is the way a Block ends.
+type Kind int
+
+const (
+	Plain  Kind = iota // jumps to Succs[0]
+	If                 // jumps to Succs[0] when Control is true, else to Succs[1]
+	Return             // leaves the function, or ends the program in main
+)
+
+// Block is a basic block. Its phis come first in Values.
+type Block struct {
+	ID      int
+	Values  []*Value
+	Kind    Kind
+	Control *Value // the condition of an If
+	Succs   []*Block
+	Preds   []*Block
+}
+
+func (b *Block) String() string { return "b" + strconv.Itoa(b.ID) }
+
+// Func is a function, or main, in SSA form.
+type Func struct {
+	Name   string                // "main" for the body of the program
+	Params []*semantic.Var       // nil for main
+	Blocks []*Block              // indexed by ID; Blocks[0] is the entry
+	Sem    *semantic.Func        // nil for main
+	Temps  map[semantic.Type]int // temps of each type its quads need, once lowered
+	values int                   // number of values made so far, for IDs
+}
+
+// Entry returns the block where fn starts.
+func (fn *Func) Entry() *Block { return fn.Blocks[0] }
+
+// Program is a whole program in SSA form.
+type Program struct {
+	Globals []*semantic.Var
+	Funcs   []*Func // in declaration order, followed by main
+}
+
+// Func returns the function called name, or nil.
+func (p *Program) Func(name string) *Func {
+	for _, fn := range p.Funcs {
+		if fn.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// String dumps fn, one block after another with its predecessors.
+func (fn *Func) String() string {
+	var sb strings.Builder
+	params := make([]string, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i] = p.Name + " " + p.Type.String()
+	}
+	fmt.Fprintf(&sb, "func %s(%s):\n", fn.Name, strings.Join(params, ", "))
+	for _, b := range fn.Blocks {
+		preds := make([]string, len(b.Preds))
+		for i, p := range b.Preds {
+			preds[i] = p.String()
+		}
+		fmt.Fprintf(&sb, "%s: preds=[%s]\n", b, strings.Join(preds, " "))
+		for _, v := range b.Values {
+			fmt.Fprintf(&sb, "    %s\n", v.LongString())
+		}
+		switch b.Kind {
+		case Plain:
+			fmt.Fprintf(&sb, "    goto %s\n", b.Succs[0])
+		case If:
+			fmt.Fprintf(&sb, "    if %s goto %s else %s\n", b.Control, b.Succs[0], b.Succs[1])
+		case Return:
+			sb.WriteString("    return\n")
+		}
+	}
+	return sb.String()
+}
+
+// String dumps every function of p, separated by blank lines.
+func (p *Program) String() string {
+	parts := make([]string, len(p.Funcs))
+	for i, fn := range p.Funcs {
+		parts[i] = fn.String()
+	}
+	return strings.Join(parts, "\n")
+}
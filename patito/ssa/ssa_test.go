@@ -0,0 +1,506 @@
+package ssa
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/lexer"
+	"patito/optimize"
+	"patito/parser"
+	"patito/semantic"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func check(t *testing.T, src string) (*ast.Program, *semantic.FuncDir) {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	return prog, dir
+}
+
+func build(t *testing.T, src string) *Program {
+	t.Helper()
+	p := Build(check(t, src))
+	if err := Verify(p); err != nil {
+		t.Fatalf("%v\n%s", err, p)
+	}
+	return p
+}
+
+func TestBuild(t *testing.T) {
+	p := build(t, `program p;
+var g : float;
+void f(n : int) [
+    var i, s : int;
+    {
+        while (i < n) do {
+            if (i > 2) {
+                s = s + i;
+            };
+            i = i + 1;
+        };
+        g = s;
+    }
+];
+main {
+    f(4);
+    print(g + 1);
+}
+end`)
+	expected := `func f(n int):
+b0: preds=[]
+    v1 = const <int> 0
+    v2 = param <int> 0
+    v3 = const <int> 0
+    goto b1
+b1: preds=[b0 b4]
+    v4 = phi <int> [b0: v1] [b4: v12]
+    v5 = phi <int> [b0: v3] [b4: v10]
+    v6 = lt <bool> v4 v2
+    if v6 goto b2 else b5
+b2: preds=[b1]
+    v7 = const <int> 2
+    v8 = gt <bool> v4 v7
+    if v8 goto b3 else b4
+b3: preds=[b2]
+    v9 = add <int> v5 v4
+    goto b4
+b4: preds=[b2 b3]
+    v10 = phi <int> [b2: v5] [b3: v9]
+    v11 = const <int> 1
+    v12 = add <int> v4 v11
+    goto b1
+b5: preds=[b1]
+    v13 = itof <float> v5
+    store g v13
+    goto b6
+b6: preds=[b5]
+    return
+`
+	if got := p.Funcs[0].String(); got != expected {
+		t.Fatalf("wrong SSA.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	src := `program p;
+var i : int;
+main {
+    i = 1;
+    while (i < 3) do {
+        i = i + 1;
+    };
+    print(i);
+}
+end`
+	tests := []struct {
+		name    string
+		corrupt func(fn *Func)
+		err     string
+	}{
+		{"phi args", func(fn *Func) {
+			phi := fn.Blocks[1].Values[0]
+			phi.Args = phi.Args[:1]
+		}, "1 args for 2 predecessors"},
+		{"dominance", func(fn *Func) {
+			// Read the value computed in the loop body after the loop
+			body, after := fn.Blocks[2], fn.Blocks[3]
+			after.Values[0].Args[0] = body.Values[1]
+		}, "does not dominate"},
+		{"edges", func(fn *Func) {
+			fn.Blocks[2].Preds = nil
+		}, "missing from its preds"},
+		{"types", func(fn *Func) {
+			fn.Blocks[2].Values[0].Type = semantic.Float
+		}, "is not float"},
+	}
+	for _, tt := range tests {
+		p := build(t, src)
+		tt.corrupt(p.Funcs[0])
+		err := Verify(p)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error about %q, got %v\n%s", tt.name, tt.err, err, p)
+		}
+	}
+}
+
+// Lowering must keep what a program prints, phis included.
+func TestLowerKeepsOutput(t *testing.T) {
+	demo, err := os.ReadFile("../testdata/demo.pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	programs := []string{string(demo), `program swap;
+var a, b, t, n : int;
+void fib(k : int) [
+    var x, y, z : int;
+    {
+        x = 0;
+        y = 1;
+        while (k > 0) do {
+            z = x + y;
+            x = y;
+            y = z;
+            k = k - 1;
+        };
+        a = x;
+    }
+];
+void count(k : int) [
+    {
+        if (k > 0) {
+            n = n + 1;
+            count(k - 1);
+        };
+    }
+];
+main {
+    a = 1;
+    b = 2;
+    while (n < 3) do {
+        t = a;
+        a = b;
+        b = t;
+        n = n + 1;
+        print(a, b);
+    };
+    fib(10);
+    print("fib", a);
+    n = 0;
+    count(5);
+    print(n, n / 2, n / 2.0, -n * 1.5);
+    if (n > 4) {
+        b = 7;
+    } else {
+        t = 8;
+    };
+    print(b, t, 1 < 2.5, 3 == 3);
+}
+end`}
+	for _, src := range programs {
+		for _, opt := range []bool{false, true} {
+			prog, dir := check(t, src)
+			if opt {
+				if errs := optimize.Optimize(prog, dir, src); len(errs) > 0 {
+					t.Fatal(errs)
+				}
+			}
+			var want bytes.Buffer
+			if err := evaluator.New(&want).Run(prog); err != nil {
+				t.Fatal(err)
+			}
+			p := Build(prog, dir)
+			if err := Verify(p); err != nil {
+				t.Fatalf("%v\n%s", err, p)
+			}
+			got, err := runQuads(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want.String() {
+				t.Fatalf("lowered program prints differently.\nexpected:\n%s\ngot:\n%s\n%s", want.String(), got, p)
+			}
+		}
+	}
+}
+
+// runQuads runs the lowered form of p and returns what it prints.
+func runQuads(p *Program) (string, error) {
+	var out strings.Builder
+	err := NewMachine(p, &out).Run()
+	return out.String(), err
+}
+
+func TestLower(t *testing.T) {
+	p := build(t, `program p;
+var a, b : int;
+main {
+    while (a < 3) do {
+        a = a + 1;
+        b = a * 2;
+    };
+    print(b);
+}
+end`)
+	var sb strings.Builder
+	for i, q := range Lower(p, p.Funcs[0]) {
+		fmt.Fprintf(&sb, "%d: %s\n", i, strings.TrimRight(q.String(), " "))
+	}
+	expected := `0: =       a          _          _i0
+1: =       b          _          _i1
+2: =       _i0        _          _i2
+3: =       _i1        _          _i3
+4: =       _i2        _          _i0
+5: =       _i3        _          _i1
+6: <       _i0        3          _b0
+7: gotof   _b0        _          15
+8: +       _i0        1          _i0
+9: =       _i0        _          a
+10: *       _i0        2          _i1
+11: =       _i1        _          b
+12: =       _i0        _          _i2
+13: =       _i1        _          _i3
+14: goto    _          _          4
+15: print   _i1        _          _
+16: println _          _          _
+17: end     _          _          _
+`
+	if got := sb.String(); got != expected {
+		t.Fatalf("wrong quads.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLowerRecyclesTemps(t *testing.T) {
+	p := build(t, `program p;
+var g : float;
+void f(n : int) [
+    var i, s : int;
+    {
+        while (i < n) do {
+            s = s + (i * 2 + 1) * (i - 3) + (n / 2 - i) * (i + n);
+            i = i + 1;
+        };
+        g = s / 2.0 + n;
+    }
+];
+main {
+    f(10);
+    print(g * 2.0 + 1.0);
+}
+end`)
+	// Eleven values of the loop body fit in two ints besides n, i, s and the
+	// incoming values of the phis of i and s.
+	tests := []struct {
+		name  string
+		temps map[semantic.Type]int
+	}{
+		{"f", map[semantic.Type]int{semantic.Int: 7, semantic.Float: 2, semantic.Bool: 1}},
+		{"main", map[semantic.Type]int{semantic.Float: 1}},
+	}
+	for _, tt := range tests {
+		fn := p.Func(tt.name)
+		seen := map[string]bool{}
+		for _, q := range Lower(p, fn) {
+			if strings.HasPrefix(q.Result, "_") {
+				seen[q.Result] = true
+			}
+		}
+		if !maps.Equal(fn.Temps, tt.temps) {
+			t.Errorf("%s - wrong temps. expected=%v, got=%v", tt.name, tt.temps, fn.Temps)
+		}
+		total := 0
+		for _, n := range fn.Temps {
+			total += n
+		}
+		if len(seen) != total {
+			t.Errorf("%s - %d temps written, but %d recorded", tt.name, len(seen), total)
+		}
+	}
+	if got := p.Func("f").Sem.Temps; !maps.Equal(got, p.Func("f").Temps) {
+		t.Errorf("function directory has temps=%v, expected=%v", got, p.Func("f").Temps)
+	}
+}
+
+// Prune folds the constant conditions, drops the branches they never take and
+// the copies left dead, and renumbers the jumps that remain.
+func TestPrune(t *testing.T) {
+	src := `program p;
+var x, y : int;
+main {
+  y = 4;
+  if (2 > 3) { x = 5; } else { x = 2 * 3; };
+  while (y > 0) do {
+    if (1 < 2) { y = y - 1; };
+  };
+  print(x, y, 7 / 2);
+}
+end`
+	p := build(t, src)
+	var sb strings.Builder
+	quads := Lower(p, p.Funcs[0])
+	if len(quads) != 31 {
+		t.Fatalf("expected 31 quads before pruning, got %d", len(quads))
+	}
+	quads = Prune(quads)
+	for i, q := range quads {
+		fmt.Fprintf(&sb, "%d: %s\n", i, strings.TrimRight(q.String(), " "))
+	}
+	expected := `0: =       4          _          y
+1: goto    _          _          2
+2: =       6          _          x
+3: =       4          _          _i3
+4: =       6          _          _i4
+5: =       _i3        _          _i0
+6: =       _i4        _          _i1
+7: >       _i0        0          _b0
+8: gotof   _b0        _          16
+9: -       _i0        1          _i0
+10: =       _i0        _          y
+11: =       _i0        _          _i5
+12: =       _i5        _          _i0
+13: =       _i0        _          _i3
+14: =       _i1        _          _i4
+15: goto    _          _          5
+16: print   _i1        _          _
+17: print   _i0        _          _
+18: print   3          _          _
+19: println _          _          _
+20: end     _          _          _
+`
+	if got := sb.String(); got != expected {
+		t.Fatalf("wrong quads.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	var out strings.Builder
+	m := NewMachine(p, &out)
+	m.Code["main"] = quads
+	if err := m.Run(); err != nil || out.String() != "6 0 3\n" {
+		t.Fatalf("pruned quads print %q, %v", out.String(), err)
+	}
+}
+
+// Pruning must keep what the quads of a program print, and a division by
+// zero whose result is never used must still fail.
+func TestPruneKeepsOutput(t *testing.T) {
+	demo, err := os.ReadFile("../testdata/demo.pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{string(demo), `program p;
+var g : int;
+void f() [
+  var t : int;
+  {
+    t = 1 / g;
+  }
+];
+main {
+  print(1);
+  f();
+}
+end`} {
+		p := build(t, src)
+		var want, got strings.Builder
+		wantErr := NewMachine(p, &want).Run()
+		m := NewMachine(p, &got)
+		for name, code := range m.Code {
+			m.Code[name] = Prune(code)
+		}
+		if err := m.Run(); got.String() != want.String() || fmt.Sprint(err) != fmt.Sprint(wantErr) {
+			t.Fatalf("pruned quads print %q, %v; expected %q, %v", got.String(), err, want.String(), wantErr)
+		}
+	}
+}
+
+// TestPeephole compares the quads of each program in testdata with its golden
+// listings, NAME.before as Lower writes them and NAME.after once through
+// Peephole, and checks that both print the same.
+func TestPeephole(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.pat")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no programs in testdata: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := build(t, string(src))
+			var want strings.Builder
+			before := NewMachine(p, &want)
+			wantErr := before.Run()
+
+			var got strings.Builder
+			after := NewMachine(p, &got)
+			for name, code := range after.Code {
+				after.Code[name] = Peephole(code)
+			}
+			if err := after.Run(); got.String() != want.String() || fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Fatalf("peephole quads print %q, %v; expected %q, %v", got.String(), err, want.String(), wantErr)
+			}
+			for ext, m := range map[string]*Machine{".before": before, ".after": after} {
+				golden := strings.TrimSuffix(file, ".pat") + ext
+				listing := quadListing(p, m)
+				if *update {
+					if err := os.WriteFile(golden, []byte(listing), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				expected, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if listing != string(expected) {
+					t.Errorf("quads differ from %s, rerun with -update if the change is intended.\ngot:\n%s", golden, listing)
+				}
+			}
+		})
+	}
+}
+
+// Peephole threads jumps through chains of gotos, then removes the gotos left
+// unreachable, a loop of them included, and the jumps to the next quad.
+func TestPeepholeJumps(t *testing.T) {
+	quads := Peephole([]Quad{
+		{Op: "gotof", Arg1: "c", Result: "3"},
+		{Op: "=", Arg1: "1", Result: "x"},
+		{Op: "goto", Result: "5"},
+		{Op: "=", Arg1: "2", Result: "x"},
+		{Op: "goto", Result: "6"},
+		{Op: "goto", Result: "6"},
+		{Op: "goto", Result: "8"},
+		{Op: "goto", Result: "7"},
+		{Op: "=", Arg1: "x", Result: "x"},
+		{Op: "print", Arg1: "x"},
+		{Op: "println"},
+		{Op: "end"},
+	})
+	var sb strings.Builder
+	for i, q := range quads {
+		fmt.Fprintf(&sb, "%d: %s\n", i, strings.TrimRight(q.String(), " "))
+	}
+	expected := `0: gotof   c          _          3
+1: =       1          _          x
+2: goto    _          _          4
+3: =       2          _          x
+4: print   x          _          _
+5: println _          _          _
+6: end     _          _          _
+`
+	if got := sb.String(); got != expected {
+		t.Fatalf("wrong quads.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+// quadListing writes the code of m the way patito ssa -quads does, function
+// by function in the order of p.
+func quadListing(p *Program, m *Machine) string {
+	var sb strings.Builder
+	for i, fn := range p.Funcs {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "%s:\n", fn.Name)
+		for n, q := range m.Code[fn.Name] {
+			fmt.Fprintf(&sb, "%4d  %s\n", n, strings.TrimRight(q.String(), " "))
+		}
+	}
+	return sb.String()
+}
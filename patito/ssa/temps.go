@@ -0,0 +1,159 @@
+package ssa
+
+import (
+	"strconv"
+
+	"patito/semantic"
+)
+
+// temps is where the lowered form of a function keeps its values: a temp of
+// the right type for each value that is not a constant, and one for the
+// incoming value of each phi.
+type temps struct {
+	value map[*Value]string
+	phi   map[*Value]string
+	peak  map[semantic.Type]int
+}
+
+var tempPrefix = map[semantic.Type]string{semantic.Int: "_i", semantic.Float: "_f", semantic.Bool: "_b"}
+
+// allocTemps gives the values of fn their temps. A value frees its temp once
+// its last use is behind it, and values that are never live at the same time
+// share one, so a loop that computes a long expression needs only as many
+// temps as the expression has values alive at once, not one per operator.
+//
+// The temp of a phi's incoming value is written at the end of every
+// predecessor and read at the start of the block, so it is not a single
+// definition like the others and is never shared.
+func allocTemps(fn *Func) *temps {
+	graph := interference(fn)
+	t := &temps{value: map[*Value]string{}, phi: map[*Value]string{}, peak: map[semantic.Type]int{}}
+	slot := map[*Value]int{}
+	for _, b := range fn.Blocks {
+		for _, v := range b.Values {
+			if !hasTemp(v) {
+				continue
+			}
+			taken := map[int]bool{}
+			for w := range graph[v] {
+				if s, ok := slot[w]; ok && w.Type == v.Type {
+					taken[s] = true
+				}
+			}
+			s := 0
+			for taken[s] {
+				s++
+			}
+			slot[v] = s
+			t.value[v] = tempPrefix[v.Type] + strconv.Itoa(s)
+			t.peak[v.Type] = max(t.peak[v.Type], s+1)
+		}
+	}
+	for _, b := range fn.Blocks {
+		for _, v := range b.Values {
+			if v.Op == OpPhi {
+				t.phi[v] = tempPrefix[v.Type] + strconv.Itoa(t.peak[v.Type])
+				t.peak[v.Type]++
+			}
+		}
+	}
+	return t
+}
+
+// hasTemp reports whether v is kept in a temp: constants are used as
+// operands directly, and stores, calls and prints compute nothing.
+func hasTemp(v *Value) bool {
+	return v.Op != OpConst && v.Type != semantic.Void
+}
+
+// interference returns, for each value of fn, the values that are live where
+// it is defined, which must not share its temp.
+func interference(fn *Func) map[*Value]map[*Value]bool {
+	liveOut := liveness(fn)
+	graph := map[*Value]map[*Value]bool{}
+	edge := func(v, w *Value) {
+		if graph[v] == nil {
+			graph[v] = map[*Value]bool{}
+		}
+		graph[v][w] = true
+	}
+	for _, b := range fn.Blocks {
+		live := copySet(liveOut[b])
+		for i := len(b.Values) - 1; i >= 0; i-- {
+			v := b.Values[i]
+			if hasTemp(v) {
+				delete(live, v)
+				for w := range live {
+					edge(v, w)
+					edge(w, v)
+				}
+			}
+			if v.Op != OpPhi {
+				use(live, v.Args...)
+			}
+		}
+	}
+	return graph
+}
+
+// liveness returns the values that are live at the end of each block of fn.
+// A phi arg is live at the end of the predecessor it comes from, where it is
+// copied, and the Control of an If is live until its jump.
+func liveness(fn *Func) map[*Block]map[*Value]bool {
+	liveIn := map[*Block]map[*Value]bool{}
+	liveOut := map[*Block]map[*Value]bool{}
+	for changed := true; changed; {
+		changed = false
+		for i := len(fn.Blocks) - 1; i >= 0; i-- {
+			b := fn.Blocks[i]
+			out := map[*Value]bool{}
+			for _, s := range b.Succs {
+				for v := range liveIn[s] {
+					out[v] = true
+				}
+				for _, v := range s.Values {
+					if v.Op == OpPhi {
+						for k, p := range s.Preds {
+							if p == b {
+								use(out, v.Args[k])
+							}
+						}
+					}
+				}
+			}
+			if b.Kind == If {
+				use(out, b.Control)
+			}
+			in := copySet(out)
+			for j := len(b.Values) - 1; j >= 0; j-- {
+				v := b.Values[j]
+				delete(in, v)
+				if v.Op != OpPhi {
+					use(in, v.Args...)
+				}
+			}
+			if len(in) != len(liveIn[b]) || len(out) != len(liveOut[b]) {
+				changed = true
+			}
+			liveIn[b], liveOut[b] = in, out
+		}
+	}
+	return liveOut
+}
+
+// use adds the args that live in temps to live.
+func use(live map[*Value]bool, args ...*Value) {
+	for _, arg := range args {
+		if hasTemp(arg) {
+			live[arg] = true
+		}
+	}
+}
+
+func copySet(s map[*Value]bool) map[*Value]bool {
+	c := make(map[*Value]bool, len(s))
+	for v := range s {
+		c[v] = true
+	}
+	return c
+}
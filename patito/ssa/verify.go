@@ -0,0 +1,314 @@
+package ssa
+
+import (
+	"fmt"
+
+	"patito/semantic"
+)
+
+// Verify checks the invariants of p and returns the first one that does not
+// hold, or nil:
+//
+//   - blocks are numbered in order, reachable from the entry, and every edge
+//     appears both in the Succs of its source and in the Preds of its target;
+//   - each block ends the way its Kind says, with a bool Control on an If;
+//   - phis come first in their block and have one arg per predecessor;
+//   - every value is used where its definition dominates the use: earlier in
+//     the same block or in a dominating block, or at the end of the matching
+//     predecessor for a phi arg;
+//   - operand and result types follow the semantic cube, with conversions
+//     explicit, and loads, stores and calls name globals and functions that
+//     exist, with args of the types of the params.
+func Verify(p *Program) error {
+	globals := map[string]*semantic.Var{}
+	for _, g := range p.Globals {
+		globals[g.Name] = g
+	}
+	for _, fn := range p.Funcs {
+		v := &verifier{p: p, fn: fn, globals: globals}
+		if err := v.verify(); err != nil {
+			return fmt.Errorf("%s: %w", fn.Name, err)
+		}
+	}
+	return nil
+}
+
+type verifier struct {
+	p       *Program
+	fn      *Func
+	globals map[string]*semantic.Var
+	idom    []*Block // immediate dominators, by block ID
+	index   map[*Value]int
+}
+
+func (vr *verifier) verify() error {
+	if len(vr.fn.Blocks) == 0 {
+		return fmt.Errorf("no blocks")
+	}
+	for i, b := range vr.fn.Blocks {
+		if b.ID != i {
+			return fmt.Errorf("%s is at index %d", b, i)
+		}
+		if err := vr.edges(b); err != nil {
+			return fmt.Errorf("%s: %w", b, err)
+		}
+	}
+	if len(vr.fn.Entry().Preds) > 0 {
+		return fmt.Errorf("entry %s has predecessors", vr.fn.Entry())
+	}
+	vr.dominators()
+	vr.index = map[*Value]int{}
+	ids := map[int]bool{}
+	for _, b := range vr.fn.Blocks {
+		if vr.idom[b.ID] == nil {
+			return fmt.Errorf("%s is not reachable", b)
+		}
+		for i, v := range b.Values {
+			if v.Type != semantic.Void && ids[v.ID] {
+				return fmt.Errorf("%s is defined twice", v)
+			}
+			ids[v.ID] = true
+			vr.index[v] = i
+		}
+	}
+	for _, b := range vr.fn.Blocks {
+		for i, v := range b.Values {
+			if err := vr.value(b, i, v); err != nil {
+				return fmt.Errorf("%s: %s: %w", b, v.LongString(), err)
+			}
+		}
+		if b.Control != nil {
+			if err := vr.use(b, len(b.Values), b.Control); err != nil {
+				return fmt.Errorf("%s: control: %w", b, err)
+			}
+		}
+	}
+	return nil
+}
+
+// edges checks the shape of the end of b and that its edges are recorded on
+// both sides.
+func (vr *verifier) edges(b *Block) error {
+	want := map[Kind]int{Plain: 1, If: 2, Return: 0}[b.Kind]
+	if len(b.Succs) != want {
+		return fmt.Errorf("%d successors, want %d", len(b.Succs), want)
+	}
+	if (b.Kind == If) != (b.Control != nil) {
+		return fmt.Errorf("control %v does not match the kind of block", b.Control)
+	}
+	if b.Control != nil && b.Control.Type != semantic.Bool {
+		return fmt.Errorf("control %s is %s, not bool", b.Control, b.Control.Type)
+	}
+	count := func(list []*Block, x *Block) int {
+		n := 0
+		for _, y := range list {
+			if y == x {
+				n++
+			}
+		}
+		return n
+	}
+	for _, s := range b.Succs {
+		if count(s.Preds, b) != count(b.Succs, s) {
+			return fmt.Errorf("edge to %s is missing from its preds", s)
+		}
+	}
+	for _, p := range b.Preds {
+		if count(p.Succs, b) != count(b.Preds, p) {
+			return fmt.Errorf("edge from %s is missing from its succs", p)
+		}
+	}
+	return nil
+}
+
+// dominators computes the immediate dominators with the iterative algorithm of
+// Cooper, Harvey and Kennedy. Blocks that cannot be reached get none.
+func (vr *verifier) dominators() {
+	blocks := vr.fn.Blocks
+	post := make([]int, len(blocks)) // postorder number, by ID
+	seen := make([]bool, len(blocks))
+	var order []*Block
+	var visit func(*Block)
+	visit = func(b *Block) {
+		seen[b.ID] = true
+		for _, s := range b.Succs {
+			if !seen[s.ID] {
+				visit(s)
+			}
+		}
+		post[b.ID] = len(order)
+		order = append(order, b)
+	}
+	visit(vr.fn.Entry())
+
+	vr.idom = make([]*Block, len(blocks))
+	vr.idom[0] = vr.fn.Entry()
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for post[a.ID] < post[b.ID] {
+				a = vr.idom[a.ID]
+			}
+			for post[b.ID] < post[a.ID] {
+				b = vr.idom[b.ID]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := len(order) - 2; i >= 0; i-- { // reverse postorder, skipping the entry
+			b := order[i]
+			var idom *Block
+			for _, p := range b.Preds {
+				switch {
+				case vr.idom[p.ID] == nil:
+				case idom == nil:
+					idom = p
+				default:
+					idom = intersect(p, idom)
+				}
+			}
+			if vr.idom[b.ID] != idom {
+				vr.idom[b.ID] = idom
+				changed = true
+			}
+		}
+	}
+}
+
+func (vr *verifier) dominates(a, b *Block) bool {
+	for b != a {
+		if b == vr.fn.Entry() {
+			return false
+		}
+		b = vr.idom[b.ID]
+	}
+	return true
+}
+
+// use checks that arg is available at position i of block b.
+func (vr *verifier) use(b *Block, i int, arg *Value) error {
+	j, ok := vr.index[arg]
+	switch {
+	case !ok || arg.Block == nil || vr.fn.Blocks[arg.Block.ID] != arg.Block:
+		return fmt.Errorf("%s is not defined in %s", arg, vr.fn.Name)
+	case arg.Block == b && j >= i:
+		return fmt.Errorf("%s is used before it is defined", arg)
+	case !vr.dominates(arg.Block, b):
+		return fmt.Errorf("the definition of %s in %s does not dominate %s", arg, arg.Block, b)
+	}
+	return nil
+}
+
+func (vr *verifier) value(b *Block, i int, v *Value) error {
+	if v.Block != b {
+		return fmt.Errorf("belongs to %v", v.Block)
+	}
+	if v.Op == OpPhi {
+		if i > 0 && b.Values[i-1].Op != OpPhi {
+			return fmt.Errorf("phi after other values")
+		}
+		if len(v.Args) != len(b.Preds) {
+			return fmt.Errorf("%d args for %d predecessors", len(v.Args), len(b.Preds))
+		}
+		for k, arg := range v.Args {
+			p := b.Preds[k]
+			if err := vr.use(p, len(p.Values), arg); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, arg := range v.Args {
+			if err := vr.use(b, i, arg); err != nil {
+				return err
+			}
+		}
+	}
+	return vr.types(v)
+}
+
+// types checks the arity and the types of v and its args.
+func (vr *verifier) types(v *Value) error {
+	arity := map[Op]int{OpConst: 0, OpParam: 0, OpLoad: 0, OpStore: 1, OpNeg: 1, OpIntToFloat: 1}
+	if n, ok := arity[v.Op]; ok && len(v.Args) != n {
+		return fmt.Errorf("%d args, want %d", len(v.Args), n)
+	}
+	if v.Op >= OpAdd && v.Op <= OpNe && len(v.Args) != 2 {
+		return fmt.Errorf("%d args, want 2", len(v.Args))
+	}
+	numeric := func(t semantic.Type) bool { return t == semantic.Int || t == semantic.Float }
+
+	switch v.Op {
+	case OpConst:
+		var t semantic.Type
+		switch v.Const.(type) {
+		case int64:
+			t = semantic.Int
+		case float64:
+			t = semantic.Float
+		case bool:
+			t = semantic.Bool
+		case string:
+			t = semantic.String
+		}
+		if t != v.Type {
+			return fmt.Errorf("constant %v is not %s", v.Const, v.Type)
+		}
+	case OpParam:
+		params := vr.fn.Params
+		if v.Index < 0 || v.Index >= len(params) || params[v.Index].Type != v.Type {
+			return fmt.Errorf("no %s param %d", v.Type, v.Index)
+		}
+	case OpLoad, OpStore:
+		g := vr.globals[v.Name]
+		if g == nil {
+			return fmt.Errorf("no global %s", v.Name)
+		}
+		if v.Op == OpLoad && v.Type != g.Type || v.Op == OpStore && (v.Type != semantic.Void || v.Args[0].Type != g.Type) {
+			return fmt.Errorf("global %s is %s", g.Name, g.Type)
+		}
+	case OpPhi:
+		for _, arg := range v.Args {
+			if arg.Type != v.Type {
+				return fmt.Errorf("%s is %s", arg, arg.Type)
+			}
+		}
+	case OpNeg:
+		if !numeric(v.Type) || v.Args[0].Type != v.Type {
+			return fmt.Errorf("negates %s", v.Args[0].Type)
+		}
+	case OpIntToFloat:
+		if v.Type != semantic.Float || v.Args[0].Type != semantic.Int {
+			return fmt.Errorf("converts %s", v.Args[0].Type)
+		}
+	case OpAdd, OpSub, OpMul, OpDiv, OpLt, OpGt, OpLe, OpGe, OpEq, OpNe:
+		l, r := v.Args[0].Type, v.Args[1].Type
+		want := l
+		if v.Op >= OpLt {
+			want = semantic.Bool
+		}
+		if l != r || !numeric(l) || v.Type != want {
+			return fmt.Errorf("%s %s %s gives %s", l, v.Op, r, v.Type)
+		}
+	case OpCall:
+		callee := vr.p.Func(v.Name)
+		if callee == nil || callee.Sem == nil {
+			return fmt.Errorf("no function %s", v.Name)
+		}
+		if len(v.Args) != len(callee.Params) {
+			return fmt.Errorf("%d args for %d params", len(v.Args), len(callee.Params))
+		}
+		for k, arg := range v.Args {
+			if arg.Type != callee.Params[k].Type {
+				return fmt.Errorf("%s is %s, param %s is %s", arg, arg.Type, callee.Params[k].Name, callee.Params[k].Type)
+			}
+		}
+	case OpPrint:
+	default:
+		return fmt.Errorf("unknown op %d", v.Op)
+	}
+	if (v.Op == OpStore || v.Op == OpCall || v.Op == OpPrint) != (v.Type == semantic.Void) {
+		return fmt.Errorf("%s has type %s", v.Op, v.Type)
+	}
+	return nil
+}
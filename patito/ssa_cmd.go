@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"patito/optimize"
+	"patito/semantic"
+	"patito/ssa"
+)
+
+// runSSA implements "patito ssa": it prints every function and main in SSA
+// form, or with -quads lowered back to quadruples, each function headed by
+// the temps of each type it needs. At -O1 the quadruples go through
+// ssa.Prune and ssa.Peephole, and the header also gives their count before.
+func runSSA(args []string) int {
+	fs := flag.NewFlagSet("ssa", flag.ContinueOnError)
+	quads := fs.Bool("quads", false, "print the quadruples that the SSA form lowers to")
+	level := optFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito ssa: %v\n", err)
+		return 1
+	}
+	prog, dir, ok := check(name, src)
+	if !ok {
+		return 1
+	}
+	if *level > 0 {
+		if errs := optimize.Optimize(prog, dir, src); len(errs) > 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+			}
+			return 1
+		}
+	}
+
+	p := ssa.Build(prog, dir)
+	if err := ssa.Verify(p); err != nil {
+		fmt.Fprintf(os.Stderr, "patito ssa: invalid SSA: %v\n", err)
+		return 1
+	}
+	if !*quads {
+		fmt.Print(p)
+		return 0
+	}
+	for i, fn := range p.Funcs {
+		if i > 0 {
+			fmt.Println()
+		}
+		quads := ssa.Lower(p, fn)
+		fmt.Printf("%s: temps int=%d float=%d bool=%d", fn.Name,
+			fn.Temps[semantic.Int], fn.Temps[semantic.Float], fn.Temps[semantic.Bool])
+		if *level > 0 {
+			before := len(quads)
+			quads = ssa.Peephole(ssa.Prune(quads))
+			fmt.Printf(" quads=%d (%d before optimizing)", len(quads), before)
+		}
+		fmt.Println()
+		for n, q := range quads {
+			fmt.Printf("%4d  %s\n", n, q)
+		}
+	}
+	return 0
+}
@@ -2,9 +2,16 @@ package token
 
 type TokenType string
 
+// Position is a 1-based line/column location in the source.
+type Position struct {
+	Line   int
+	Column int
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // where the first character of the token appears
 }
 
 const (
@@ -17,6 +24,10 @@ const (
 	FLOAT_TYPE  TokenType = "FLOAT"  // 12.12
 	STRING_TYPE TokenType = "STRING" // "Hola"
 
+	// Comments run from "//" to the end of the line. The lexer skips them like
+	// whitespace and keeps them aside (see Lexer.Comments).
+	COMMENT TokenType = "COMMENT"
+
 	// Assignment operator
 	ASSIGN TokenType = "="
 
@@ -0,0 +1,254 @@
+package vet
+
+import (
+	"maps"
+
+	"patito/ast"
+	"patito/cfg"
+	"patito/evaluator"
+	"patito/semantic"
+)
+
+// ---------- uninitialized and maybeuninit ----------
+
+// state is what the analysis knows at a point of a body: the vars that some
+// path from the entry assigns, and those that every path does.
+type state struct {
+	may, must map[*semantic.Var]bool
+}
+
+func (s *state) clone() *state {
+	return &state{may: maps.Clone(s.may), must: maps.Clone(s.must)}
+}
+
+func (s *state) equal(o *state) bool {
+	return maps.Equal(s.may, o.may) && maps.Equal(s.must, o.must)
+}
+
+// definiteAssigns computes the globals that each function assigns on every
+// path that returns, including through the functions it calls. It starts from
+// none and grows until nothing changes, so a recursive call is not counted.
+func (v *vetter) definiteAssigns() {
+	graphs := map[string]*cfg.Graph{}
+	for _, fn := range v.dir.Funcs() {
+		graphs[fn.Name] = cfg.Build(fn.Name, fn.Decl.Body)
+		v.definite[fn.Name] = map[*semantic.Var]bool{}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range v.dir.Funcs() {
+			v.current = fn
+			exit := v.flow(graphs[fn.Name])[graphs[fn.Name].Exit.ID]
+			if exit == nil {
+				continue // the function never returns
+			}
+			for x := range exit.must {
+				if x.Scope == semantic.Global && !v.definite[fn.Name][x] {
+					v.definite[fn.Name][x] = true
+					changed = true
+				}
+			}
+		}
+	}
+	v.current = nil
+}
+
+// exposedReads computes the globals that each function may read before it
+// assigns them, including through the functions it calls: those a call from
+// main must find assigned. It grows until nothing changes.
+func (v *vetter) exposedReads() {
+	graphs := map[string]*cfg.Graph{}
+	for _, fn := range v.dir.Funcs() {
+		graphs[fn.Name] = cfg.Build(fn.Name, fn.Decl.Body)
+		v.exposed[fn.Name] = map[*semantic.Var]bool{}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range v.dir.Funcs() {
+			v.current = fn
+			g := graphs[fn.Name]
+			v.scan(g, v.flow(g), func(exp ast.Expression, s *state) {
+				v.readsOf(exp, func(x *semantic.Var, _ *ast.Identifier, _ string) {
+					if x.Scope == semantic.Global && !s.must[x] && !v.exposed[fn.Name][x] {
+						v.exposed[fn.Name][x] = true
+						changed = true
+					}
+				})
+			})
+		}
+	}
+	v.current = nil
+}
+
+// scan calls read with each expression of g that can run, and the state
+// before it. The condition that ends a block comes after its statements.
+func (v *vetter) scan(g *cfg.Graph, in []*state, read func(exp ast.Expression, s *state)) {
+	for _, blk := range g.Blocks {
+		if in[blk.ID] == nil {
+			continue
+		}
+		s := in[blk.ID].clone()
+		for _, stmt := range blk.Stmts {
+			switch st := stmt.(type) {
+			case *ast.AssignStatement:
+				read(st.Value, s)
+			case *ast.PrintStatement:
+				for _, exp := range st.Expressions {
+					read(exp, s)
+				}
+			case *ast.CallStatement:
+				read(st.Call, s)
+			}
+			v.transfer(stmt, s)
+		}
+		if blk.Cond != nil {
+			read(blk.Cond, s)
+		}
+	}
+}
+
+// readsOf calls f with each var that exp reads, and the identifier that reads
+// it. A call reads the globals its callee exposes, see exposedReads: for
+// those the identifier is the name of the callee, which f also gets.
+func (v *vetter) readsOf(exp ast.Expression, f func(x *semantic.Var, id *ast.Identifier, callee string)) {
+	walkExpr(exp, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if x := v.lookup(n.Value); x != nil {
+				f(x, n, "")
+			}
+		case *ast.CallExpression:
+			for _, x := range v.dir.Globals.All() {
+				if v.exposed[n.Function.Value][x] {
+					f(x, n.Function, n.Function.Value)
+				}
+			}
+		}
+	})
+}
+
+// flow runs the analysis on g and returns the state at the start of each
+// block, indexed by ID; it is nil for the blocks that cannot be reached,
+// including those behind a branch whose condition is constant.
+func (v *vetter) flow(g *cfg.Graph) []*state {
+	in := make([]*state, len(g.Blocks))
+	out := make([]*state, len(g.Blocks))
+	in[g.Entry.ID] = &state{may: map[*semantic.Var]bool{}, must: map[*semantic.Var]bool{}}
+	for changed := true; changed; {
+		changed = false
+		for _, blk := range g.Blocks {
+			if blk != g.Entry {
+				in[blk.ID] = join(blk, out)
+			}
+			if in[blk.ID] == nil {
+				continue
+			}
+			s := in[blk.ID].clone()
+			for _, stmt := range blk.Stmts {
+				v.transfer(stmt, s)
+			}
+			if out[blk.ID] == nil || !out[blk.ID].equal(s) {
+				out[blk.ID] = s
+				changed = true
+			}
+		}
+	}
+	return in
+}
+
+// join merges the states at the end of the predecessors of blk that were
+// reached so far. Those not reached yet are left out, so that a loop header
+// starts with what holds on entry and only loses facts as the back edge is
+// analysed.
+func join(blk *cfg.Block, out []*state) *state {
+	var s *state
+	for _, p := range blk.Preds {
+		o := out[p.ID]
+		switch {
+		case o == nil || !takes(p, blk):
+		case s == nil:
+			s = o.clone()
+		default:
+			maps.Copy(s.may, o.may)
+			maps.DeleteFunc(s.must, func(x *semantic.Var, _ bool) bool { return !o.must[x] })
+		}
+	}
+	return s
+}
+
+// takes reports whether the branch that ends p can go to s: not when its
+// condition is constant and picks the other successor.
+func takes(p, s *cfg.Block) bool {
+	if p.Cond == nil {
+		return true
+	}
+	cond, isConst := constant(p.Cond)
+	if !isConst {
+		return true
+	}
+	if cond == evaluator.Bool(true) {
+		return p.Succs[0] == s
+	}
+	return p.Succs[1] == s
+}
+
+// transfer updates s with the assignments of stmt. A call assigns the globals
+// its callee may assign on some path, and definitely those it always does.
+func (v *vetter) transfer(stmt ast.Statement, s *state) {
+	switch st := stmt.(type) {
+	case *ast.AssignStatement:
+		if x := v.lookup(st.Name.Value); x != nil {
+			s.may[x], s.must[x] = true, true
+		}
+	case *ast.CallStatement:
+		maps.Copy(s.may, v.assigns[st.Call.Function.Value])
+		maps.Copy(s.must, v.definite[st.Call.Function.Value])
+	}
+}
+
+// uninitialized reports the reads of tracked vars in body: as errors those
+// that no assignment can reach, and as warnings those that some path reaches
+// without assigning the var first. A call reads the globals its callee may
+// read before assigning them. Each var is reported once, at its first read
+// with the worst finding.
+func (v *vetter) uninitialized(body *ast.BlockStatement) {
+	g := cfg.Build("", body)
+	first := map[*semantic.Var]*Finding{}
+	var order []*semantic.Var // of the first finding of each var, for those at the same call
+	v.scan(g, v.flow(g), func(exp ast.Expression, s *state) {
+		v.readsOf(exp, func(x *semantic.Var, id *ast.Identifier, callee string) {
+			if s.must[x] || !v.tracked(x) {
+				return
+			}
+			by := ""
+			if callee != "" {
+				by = " by " + callee
+			}
+			f := &Finding{Pos: id.Pos, Code: "maybeuninit", Msg: x.Name + " may be read" + by + " before it is assigned", Warning: true}
+			if !s.may[x] {
+				f = &Finding{Pos: id.Pos, Code: "uninitialized", Msg: x.Name + " is read" + by + " before it is assigned"}
+			}
+			prev := first[x]
+			if prev == nil {
+				order = append(order, x)
+			}
+			if prev == nil || prev.Warning && !f.Warning || prev.Warning == f.Warning && before(f.Pos, prev.Pos) {
+				first[x] = f
+			}
+		})
+	})
+	for _, x := range order {
+		f := first[x]
+		v.report(f.Code, f.Pos, "%s", f.Msg)
+	}
+}
+
+// tracked reports whether x must be assigned inside the current body before it
+// is read: the locals of a function, or any global in main. Globals read inside
+// a function may have been assigned by its caller.
+func (v *vetter) tracked(x *semantic.Var) bool {
+	if v.current == nil {
+		return x.Scope == semantic.Global
+	}
+	return x.Scope == semantic.Local
+}
@@ -0,0 +1,418 @@
+// Package vet reports suspicious constructs in Patito programs that compile
+// but are probably mistakes: unused declarations, reads of vars that were never
+// assigned, code that can never run, constant loop conditions, shadowed
+// globals and empty if blocks.
+//
+// Most checks report errors. Those that cannot be sure, such as maybeuninit,
+// report warnings instead.
+//
+// Every finding carries the code of the check that produced it. A finding is
+// suppressed by a comment on the same line, or alone on the line above:
+//
+//	x = y; // vet:ignore uninitialized
+//	// vet:ignore unused, shadow
+//	// vet:ignore
+//
+// A comment without codes suppresses every check on that line.
+package vet
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"patito/ast"
+	"patito/evaluator"
+	"patito/lexer"
+	"patito/semantic"
+	"patito/token"
+)
+
+// Check describes one of the analyses.
+type Check struct {
+	Code    string // stable name, used to enable and suppress it
+	Doc     string
+	Warning bool // its findings are warnings rather than errors
+}
+
+var Checks = []Check{
+	{"unused", "vars and functions that are declared but never used", false},
+	{"uninitialized", "vars read before any assignment to them can have run", false},
+	{"maybeuninit", "vars read where only some paths have assigned them", true},
+	{"unreachable", "statements that can never run", false},
+	{"constcond", "while loops whose condition is a constant", false},
+	{"shadow", "params and local vars with the name of a global", false},
+	{"emptyif", "if and else blocks without statements", false},
+}
+
+// Finding is one problem reported by a check.
+type Finding struct {
+	Pos     token.Position
+	Code    string
+	Msg     string
+	Warning bool
+}
+
+func (f *Finding) String() string {
+	if f.Warning {
+		return fmt.Sprintf("%d:%d: warning: %s [%s]", f.Pos.Line, f.Pos.Column, f.Msg, f.Code)
+	}
+	return fmt.Sprintf("%d:%d: %s [%s]", f.Pos.Line, f.Pos.Column, f.Msg, f.Code)
+}
+
+// Run analyses a program that passed semantic.Check. checks holds the codes
+// to run, nil runs them all. src is the text prog was parsed from; it is only
+// read for suppression comments. Findings are sorted by position.
+func Run(prog *ast.Program, dir *semantic.FuncDir, src string, checks map[string]bool) []*Finding {
+	v := &vetter{
+		dir:      dir,
+		checks:   checks,
+		reads:    map[*semantic.Var]bool{},
+		writes:   map[*semantic.Var]bool{},
+		called:   map[string]bool{},
+		assigns:  map[string]map[*semantic.Var]bool{},
+		callees:  map[string]map[string]bool{},
+		definite: map[string]map[*semantic.Var]bool{},
+		exposed:  map[string]map[*semantic.Var]bool{},
+	}
+	v.usage(prog)
+	v.definiteAssigns()
+	v.exposedReads()
+	v.unused()
+	v.shadow()
+	for _, fn := range dir.Funcs() {
+		v.current = fn
+		v.body(fn.Decl.Body)
+	}
+	v.current = nil
+	v.body(prog.Main)
+
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		return before(v.findings[i].Pos, v.findings[j].Pos)
+	})
+	return suppress(v.findings, src)
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+type vetter struct {
+	dir      *semantic.FuncDir
+	checks   map[string]bool
+	findings []*Finding
+	current  *semantic.Func // function being analysed, nil for main
+
+	reads    map[*semantic.Var]bool
+	writes   map[*semantic.Var]bool
+	called   map[string]bool
+	assigns  map[string]map[*semantic.Var]bool // globals each function may assign, including through calls
+	definite map[string]map[*semantic.Var]bool // globals each function always assigns, see definiteAssigns
+	exposed  map[string]map[*semantic.Var]bool // globals each function may read before assigning, see exposedReads
+	callees  map[string]map[string]bool
+
+	dead int // > 0 inside code already reported as unreachable
+}
+
+func (v *vetter) report(code string, pos token.Position, format string, args ...any) {
+	if v.checks != nil && !v.checks[code] || code == "unreachable" && v.dead > 0 {
+		return
+	}
+	f := &Finding{Pos: pos, Code: code, Msg: fmt.Sprintf(format, args...)}
+	for _, c := range Checks {
+		f.Warning = f.Warning || c.Code == code && c.Warning
+	}
+	v.findings = append(v.findings, f)
+}
+
+// lookup resolves a name the way the checker does: locals first, then globals.
+func (v *vetter) lookup(name string) *semantic.Var {
+	if v.current != nil {
+		if local := v.current.Vars.Lookup(name); local != nil {
+			return local
+		}
+	}
+	return v.dir.Globals.Lookup(name)
+}
+
+// ---------- Usage ----------
+
+// usage records which vars are read and written, which functions are called and
+// which globals each function may assign.
+func (v *vetter) usage(prog *ast.Program) {
+	for _, fn := range v.dir.Funcs() {
+		v.current = fn
+		v.assigns[fn.Name] = map[*semantic.Var]bool{}
+		v.callees[fn.Name] = map[string]bool{}
+		walk(fn.Decl.Body, v.use)
+	}
+	v.current = nil
+	walk(prog.Main, v.use)
+
+	// Propagate the assignments of callees to their callers until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for caller, callees := range v.callees {
+			for callee := range callees {
+				for g := range v.assigns[callee] {
+					if !v.assigns[caller][g] {
+						v.assigns[caller][g] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+func (v *vetter) use(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.AssignStatement:
+		if target := v.lookup(n.Name.Value); target != nil {
+			v.writes[target] = true
+			if target.Scope == semantic.Global && v.current != nil {
+				v.assigns[v.current.Name][target] = true
+			}
+		}
+	case *ast.Identifier:
+		if x := v.lookup(n.Value); x != nil {
+			v.reads[x] = true
+		}
+	case *ast.CallExpression:
+		v.called[n.Function.Value] = true
+		if v.current != nil {
+			v.callees[v.current.Name][n.Function.Value] = true
+		}
+	}
+}
+
+// walk calls f for every statement and expression under block, in source
+// order. The target of an assignment and the name of a called function are not
+// visited as identifiers.
+func walk(block *ast.BlockStatement, f func(ast.Node)) {
+	for _, stmt := range block.Statements {
+		f(stmt)
+		switch s := stmt.(type) {
+		case *ast.AssignStatement:
+			walkExpr(s.Value, f)
+		case *ast.PrintStatement:
+			for _, exp := range s.Expressions {
+				walkExpr(exp, f)
+			}
+		case *ast.IfStatement:
+			walkExpr(s.Condition, f)
+			walk(s.Consequence, f)
+			if s.Alternative != nil {
+				walk(s.Alternative, f)
+			}
+		case *ast.WhileStatement:
+			walkExpr(s.Condition, f)
+			walk(s.Body, f)
+		case *ast.CallStatement:
+			walkExpr(s.Call, f)
+		}
+	}
+}
+
+func walkExpr(exp ast.Expression, f func(ast.Node)) {
+	f(exp)
+	switch x := exp.(type) {
+	case *ast.PrefixExpression:
+		walkExpr(x.Right, f)
+	case *ast.InfixExpression:
+		walkExpr(x.Left, f)
+		walkExpr(x.Right, f)
+	case *ast.CallExpression:
+		for _, arg := range x.Arguments {
+			walkExpr(arg, f)
+		}
+	}
+}
+
+// ---------- unused and shadow ----------
+
+func (v *vetter) unused() {
+	check := func(x *semantic.Var) {
+		switch {
+		case v.reads[x]:
+		case v.writes[x]:
+			v.report("unused", x.Decl.Pos, "%s is assigned but never used", x.Name)
+		default:
+			v.report("unused", x.Decl.Pos, "%s declared and not used", x.Name)
+		}
+	}
+	for _, g := range v.dir.Globals.All() {
+		check(g)
+	}
+	for _, fn := range v.dir.Funcs() {
+		if !v.called[fn.Name] {
+			v.report("unused", fn.Decl.Name.Pos, "function %s is never called", fn.Name)
+		}
+		// Params are part of the signature, so only locals are reported
+		for _, x := range fn.Vars.All() {
+			if x.Scope == semantic.Local {
+				check(x)
+			}
+		}
+	}
+}
+
+func (v *vetter) shadow() {
+	for _, fn := range v.dir.Funcs() {
+		for _, x := range fn.Vars.All() {
+			if g := v.dir.Globals.Lookup(x.Name); g != nil {
+				v.report("shadow", x.Decl.Pos, "%s %s shadows the global declared at %d:%d", x.Scope, x.Name, g.Decl.Pos.Line, g.Decl.Pos.Column)
+			}
+		}
+	}
+}
+
+// ---------- Statements ----------
+
+// body runs the checks that follow the control flow of a function or main.
+func (v *vetter) body(block *ast.BlockStatement) {
+	v.uninitialized(block)
+	v.block(block)
+}
+
+// block checks the statements of block. It returns false when the block can
+// never finish, i.e. it runs into a loop that never ends.
+func (v *vetter) block(block *ast.BlockStatement) bool {
+	completes := true
+	for _, stmt := range block.Statements {
+		if !completes && v.dead == 0 {
+			v.report("unreachable", stmt.Position(), "unreachable code")
+			// Report the rest of the block only once
+			v.dead++
+			defer func() { v.dead-- }()
+		}
+		if !v.statement(stmt) {
+			completes = false
+		}
+	}
+	return completes
+}
+
+// deadBlock checks a block that can never run, without reporting it again.
+func (v *vetter) deadBlock(block *ast.BlockStatement) bool {
+	v.dead++
+	defer func() { v.dead-- }()
+	return v.block(block)
+}
+
+func (v *vetter) statement(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.IfStatement:
+		return v.ifStatement(s)
+	case *ast.WhileStatement:
+		return v.whileStatement(s)
+	}
+	return true
+}
+
+func (v *vetter) ifStatement(s *ast.IfStatement) bool {
+	if len(s.Consequence.Statements) == 0 {
+		v.report("emptyif", s.Pos, "empty if block")
+	}
+	if s.Alternative != nil && len(s.Alternative.Statements) == 0 {
+		v.report("emptyif", s.Alternative.Pos, "empty else block")
+	}
+
+	cond, isConst := constant(s.Condition)
+	if isConst && cond == evaluator.Bool(false) && len(s.Consequence.Statements) > 0 {
+		v.report("unreachable", s.Consequence.Statements[0].Position(), "unreachable code: the condition at %d:%d is always false", s.Condition.Position().Line, s.Condition.Position().Column)
+	}
+	if isConst && cond == evaluator.Bool(true) && s.Alternative != nil && len(s.Alternative.Statements) > 0 {
+		v.report("unreachable", s.Alternative.Statements[0].Position(), "unreachable code: the condition at %d:%d is always true", s.Condition.Position().Line, s.Condition.Position().Column)
+	}
+
+	thenBlock, elseBlock := v.block, v.block
+	if isConst && cond == evaluator.Bool(false) {
+		thenBlock = v.deadBlock
+	} else if isConst {
+		elseBlock = v.deadBlock
+	}
+	thenCompletes := thenBlock(s.Consequence)
+	elseCompletes := true
+	if s.Alternative != nil {
+		elseCompletes = elseBlock(s.Alternative)
+	}
+	switch {
+	case isConst && cond == evaluator.Bool(true):
+		return thenCompletes
+	case isConst:
+		return elseCompletes
+	}
+	return thenCompletes || elseCompletes
+}
+
+func (v *vetter) whileStatement(s *ast.WhileStatement) bool {
+	cond, isConst := constant(s.Condition)
+	if isConst {
+		v.report("constcond", s.Condition.Position(), "while condition is always %s", cond)
+		if cond == evaluator.Bool(false) && len(s.Body.Statements) > 0 {
+			v.report("unreachable", s.Body.Statements[0].Position(), "unreachable code: the loop at %d:%d never runs", s.Pos.Line, s.Pos.Column)
+		}
+	}
+	if isConst && cond == evaluator.Bool(false) {
+		v.deadBlock(s.Body)
+	} else {
+		v.block(s.Body)
+	}
+	// Patito has no break or return, so a loop that is always true never ends
+	return !isConst || cond != evaluator.Bool(true)
+}
+
+// constant evaluates exp when it does not depend on any variable.
+func constant(exp ast.Expression) (evaluator.Value, bool) {
+	isConst := true
+	walkExpr(exp, func(n ast.Node) {
+		if _, ok := n.(*ast.Identifier); ok {
+			isConst = false
+		}
+	})
+	if !isConst {
+		return nil, false
+	}
+	val, err := evaluator.New(io.Discard).Eval(exp)
+	return val, err == nil
+}
+
+// ---------- Suppression ----------
+
+// suppress drops the findings silenced by "vet:ignore" comments in src.
+func suppress(findings []*Finding, src string) []*Finding {
+	all := map[int]bool{}       // lines where every check is silenced
+	codes := map[int][]string{} // lines where only some are
+	lines := strings.Split(src, "\n")
+	l := lexer.New(src)
+	for l.NextToken().Type != token.EOF {
+	}
+	for _, c := range l.Comments() {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Literal, "//"))
+		rest, ok := strings.CutPrefix(text, "vet:ignore")
+		if !ok || rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+		line := c.Pos.Line
+		if strings.TrimSpace(lines[line-1][:c.Pos.Column-1]) == "" {
+			line++ // a comment on its own line applies to the next one
+		}
+		list := strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(list) == 0 {
+			all[line] = true
+		}
+		codes[line] = append(codes[line], list...)
+	}
+
+	var kept []*Finding
+	for _, f := range findings {
+		if all[f.Pos.Line] || slices.Contains(codes[f.Pos.Line], f.Code) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
@@ -0,0 +1,261 @@
+package vet
+
+import (
+	"strings"
+	"testing"
+
+	"patito/lexer"
+	"patito/parser"
+	"patito/semantic"
+)
+
+func run(t *testing.T, src string, checks map[string]bool) []string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	prog := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors: %v", errs)
+	}
+	dir, errs := semantic.Check(prog)
+	if len(errs) > 0 {
+		t.Fatalf("semantic errors: %v", errs)
+	}
+	var out []string
+	for _, f := range Run(prog, dir, src, checks) {
+		out = append(out, f.String())
+	}
+	return out
+}
+
+func expect(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("findings wrong.\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestChecks(t *testing.T) {
+	src := `program p;
+var a, b, unused, written : int;
+void f(a : int) [
+  var t, u : int;
+  {
+    print(t);
+    t = a;
+    print(t);
+  }
+];
+void g() [
+  {
+    b = 1;
+  }
+];
+main {
+  written = 1;
+  print(b);
+  g();
+  print(b);
+  if (a > 0) {
+  } else {
+  };
+  while (1 < 2) do {
+    a = a + 1;
+  };
+  print(a);
+}
+end`
+	expect(t, run(t, src, nil),
+		"2:11: unused declared and not used [unused]",
+		"2:19: written is assigned but never used [unused]",
+		"3:6: function f is never called [unused]",
+		"3:8: param a shadows the global declared at 2:5 [shadow]",
+		"4:10: u declared and not used [unused]",
+		"6:11: t is read before it is assigned [uninitialized]",
+		"18:9: b is read before it is assigned [uninitialized]",
+		"21:3: empty if block [emptyif]",
+		"21:7: a is read before it is assigned [uninitialized]",
+		"22:10: empty else block [emptyif]",
+		"24:10: while condition is always true [constcond]",
+		"27:3: unreachable code [unreachable]",
+	)
+
+	expect(t, run(t, src, map[string]bool{"shadow": true, "emptyif": true}),
+		"3:8: param a shadows the global declared at 2:5 [shadow]",
+		"21:3: empty if block [emptyif]",
+		"22:10: empty else block [emptyif]",
+	)
+}
+
+func TestControlFlow(t *testing.T) {
+	src := `program p;
+var x, y, z : int;
+main {
+  if (x > 0) {
+    y = 1;
+  };
+  print(y);
+  while (x < 10) do {
+    print(z);
+    z = x;
+    x = x + 1;
+  };
+  if (1 > 2) {
+    print("never");
+    while (1 < 2) do { };
+    print("still never");
+  } else {
+    print("always");
+  };
+  while (1 > 2) do {
+    print("never");
+  };
+}
+end`
+	// y is only assigned when the if is taken, and z only from the second
+	// iteration of the loop on
+	expect(t, run(t, src, nil),
+		"4:7: x is read before it is assigned [uninitialized]",
+		"7:9: warning: y may be read before it is assigned [maybeuninit]",
+		"9:11: warning: z may be read before it is assigned [maybeuninit]",
+		"14:5: unreachable code: the condition at 13:7 is always false [unreachable]",
+		"15:12: while condition is always true [constcond]",
+		"20:10: while condition is always false [constcond]",
+		"21:5: unreachable code: the loop at 20:3 never runs [unreachable]",
+	)
+}
+
+func TestUninitialized(t *testing.T) {
+	src := `program p;
+var a, b, c, d, e : int;
+void set() [
+  {
+    a = 1;
+    if (e > 0) {
+      b = 1;
+    };
+  }
+];
+void local(n : int) [
+  var x, y : int;
+  {
+    if (n > 0) {
+      x = 1;
+    } else {
+      x = 2;
+    };
+    print(x, n);
+    while (n > 0) do {
+      y = n;
+      n = n - 1;
+    };
+    print(y);
+    print(y);
+  }
+];
+main {
+  set();
+  print(a, b);
+  if (a > 0) {
+    print(c);
+    c = 1;
+  } else {
+    c = 2;
+  };
+  print(c, d);
+  d = 1;
+  local(d);
+}
+end`
+	// x is assigned on both branches; y only if the loop runs, reported once.
+	// set always assigns a but not b, and reads e, which nothing assigns.
+	expect(t, run(t, src, map[string]bool{"uninitialized": true, "maybeuninit": true}),
+		"24:11: warning: y may be read before it is assigned [maybeuninit]",
+		"29:3: e is read by set before it is assigned [uninitialized]",
+		"30:12: warning: b may be read before it is assigned [maybeuninit]",
+		"32:11: c is read before it is assigned [uninitialized]",
+		"37:12: d is read before it is assigned [uninitialized]",
+	)
+}
+
+func TestUninitializedThroughCalls(t *testing.T) {
+	src := `program p;
+var g, h, k, m : int;
+void set() [
+  {
+    h = 1;
+    if (g > 0) {
+      k = 1;
+    };
+  }
+];
+void use() [
+  {
+    print(h, k);
+    m = 1;
+    print(m);
+  }
+];
+void both() [
+  {
+    set();
+    use();
+  }
+];
+main {
+  g = 1;
+  use();
+  set();
+  use();
+  both();
+}
+end`
+	// use reads h and k before set assigns them, and m only after it assigns
+	// it. both calls set first, which assigns h, and k on some paths.
+	expect(t, run(t, src, map[string]bool{"uninitialized": true, "maybeuninit": true}),
+		"26:3: h is read by use before it is assigned [uninitialized]",
+		"26:3: k is read by use before it is assigned [uninitialized]",
+	)
+}
+
+func TestUninitializedDeadCode(t *testing.T) {
+	src := `program p;
+var x, y, z, w : int;
+main {
+  if (1 > 2) {
+    print(x);
+  } else {
+    print(z);
+  };
+  if (2 > 1) {
+    w = 1;
+  };
+  print(w);
+  while (1 < 2) do {
+    y = 1;
+  };
+  print(y);
+}
+end`
+	// Only the else branch runs, w is always assigned, and the read of y
+	// after the endless loop never happens.
+	expect(t, run(t, src, map[string]bool{"uninitialized": true, "maybeuninit": true}),
+		"7:11: z is read before it is assigned [uninitialized]",
+	)
+}
+
+func TestSuppression(t *testing.T) {
+	src := `program p;
+var
+  a : int; // vet:ignore unused
+  b : int; // vet:ignore shadow
+  // vet:ignore
+  c : int;
+  d : int; // vet:ignorex
+main {
+}
+end`
+	expect(t, run(t, src, nil),
+		"4:3: b declared and not used [unused]",
+		"7:3: d declared and not used [unused]",
+	)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"patito/vet"
+)
+
+// runVet implements "patito vet": it prints the findings of the vet checks and
+// exits with status 1 when any of them is an error, like a compile error would.
+// Warnings alone do not change the status.
+func runVet(args []string) int {
+	fs := flag.NewFlagSet("vet", flag.ContinueOnError)
+	checksFlag := fs.String("checks", "", "comma-separated checks to run (default all)")
+	list := fs.Bool("list", false, "list the available checks and exit")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *list {
+		for _, c := range vet.Checks {
+			fmt.Printf("%-14s %s\n", c.Code, c.Doc)
+		}
+		return 0
+	}
+
+	var checks map[string]bool
+	if *checksFlag != "" {
+		checks = map[string]bool{}
+		for _, code := range strings.Split(*checksFlag, ",") {
+			code = strings.TrimSpace(code)
+			if !knownCheck(code) {
+				fmt.Fprintf(os.Stderr, "patito vet: unknown check %q (see patito vet -list)\n", code)
+				return 2
+			}
+			checks[code] = true
+		}
+	}
+
+	name, src, err := readSource(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patito vet: %v\n", err)
+		return 1
+	}
+	prog, dir, ok := check(name, src)
+	if !ok {
+		return 1
+	}
+	status := 0
+	for _, f := range vet.Run(prog, dir, src, checks) {
+		fmt.Printf("%s:%s\n", name, f)
+		if !f.Warning {
+			status = 1
+		}
+	}
+	return status
+}
+
+func knownCheck(code string) bool {
+	for _, c := range vet.Checks {
+		if c.Code == code {
+			return true
+		}
+	}
+	return false
+}
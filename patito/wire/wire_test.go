@@ -0,0 +1,30 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, map[string]int{"seq": 1}); err != nil {
+		t.Fatal(err)
+	}
+	Write(&buf, []string{"é"})
+	if !strings.HasPrefix(buf.String(), "Content-Length: 9\r\n\r\n{\"seq\":1}") {
+		t.Fatalf("unexpected framing: %q", buf.String())
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, want := range []string{`{"seq":1}`, `["é"]`} {
+		body, err := Read(r)
+		if err != nil || string(body) != want {
+			t.Fatalf("expected %s, got %s (%v)", want, body, err)
+		}
+	}
+	if _, err := Read(bufio.NewReader(strings.NewReader("Content-Length: x\r\n\r\n"))); err == nil {
+		t.Fatalf("expected an error for a bad header")
+	}
+}